@@ -0,0 +1,142 @@
+// Command admin manages a Parachute backend from the machine it runs on
+//
+// Usage:
+//
+//	admin token issue -name NAME [-platform PLATFORM]
+//	admin token list
+//	admin token revoke DEVICE_ID
+//	admin pair [-server URL] [-ttl DURATION]
+//
+// It opens the database at DATABASE_PATH, the same one the server uses.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain/device"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+const usage = `Usage:
+  admin token issue -name NAME [-platform PLATFORM]   Issue a device token
+  admin token list                                    List devices
+  admin token revoke DEVICE_ID                        Revoke the token of a device
+  admin pair [-server URL] [-ttl DURATION]            Show a code to pair a new device
+`
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] == "token" && len(os.Args) < 3) || (os.Args[1] != "token" && os.Args[1] != "pair") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	dbPath := os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "./data/parachute.db"
+	}
+
+	db, err := sqlite.NewDatabase(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database %s: %v\n", dbPath, err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	deviceService := device.NewService(sqlite.NewDeviceRepository(db.DB))
+	ctx := context.Background()
+
+	command := os.Args[1]
+	if command == "token" {
+		command += " " + os.Args[2]
+	}
+
+	switch command {
+	case "pair":
+		err = startPairing(ctx, deviceService, os.Args[2:])
+	case "token issue":
+		err = issueToken(ctx, deviceService, os.Args[3:])
+	case "token list":
+		err = listDevices(ctx, deviceService)
+	case "token revoke":
+		if len(os.Args) != 4 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		err = deviceService.RevokeDevice(ctx, os.Args[3])
+		if err == nil {
+			fmt.Printf("Revoked device %s\n", os.Args[3])
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// issueToken issues a token and prints it, the only time it can be seen
+func issueToken(ctx context.Context, deviceService *device.Service, args []string) error {
+	flags := flag.NewFlagSet("token issue", flag.ExitOnError)
+	name := flags.String("name", "", "name of the device, e.g. \"Pixel 8\"")
+	platform := flags.String("platform", "", "platform of the device, e.g. ios, android, macos, omi")
+	flags.Parse(args)
+
+	dev, token, err := deviceService.IssueToken(ctx, device.IssueParams{Name: *name, Platform: *platform})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Issued a token for %s (device %s)\n\n", dev.Name, dev.ID)
+	fmt.Printf("  %s\n\n", token)
+	fmt.Println("Store it now, it can't be shown again. Send it as \"Authorization: Bearer <token>\".")
+	return nil
+}
+
+// startPairing creates a pairing code and prints it with its QR payload
+func startPairing(ctx context.Context, deviceService *device.Service, args []string) error {
+	flags := flag.NewFlagSet("pair", flag.ExitOnError)
+	server := flags.String("server", "http://localhost:8080", "URL devices reach the server at, put in the QR payload")
+	ttl := flags.Duration("ttl", device.DefaultPairingTTL, "how long the code can be used")
+	flags.Parse(args)
+
+	pairing, err := deviceService.StartPairing(ctx, *server, *ttl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pairing code, valid once until %s:\n\n", pairing.ExpiresAt.Format(time.Kitchen))
+	fmt.Printf("  %s\n\n", pairing.Code)
+	fmt.Printf("QR payload: %s\n", pairing.QRPayload)
+	return nil
+}
+
+// listDevices prints every device and the state of its token
+func listDevices(ctx context.Context, deviceService *device.Service) error {
+	devices, err := deviceService.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPLATFORM\tTOKEN\tCREATED\tLAST USED\tUPLOADS\tSTATUS")
+	for _, dev := range devices {
+		status := "active"
+		if dev.Revoked() {
+			status = "revoked " + dev.RevokedAt.Format(time.DateTime)
+		}
+		lastUsed := "never"
+		if dev.LastUsedAt != nil {
+			lastUsed = dev.LastUsedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s…\t%s\t%s\t%d\t%s\n", dev.ID, dev.Name, dev.Platform, dev.TokenPrefix, dev.CreatedAt.Format(time.DateTime), lastUsed, dev.UploadCount, status)
+	}
+	return w.Flush()
+}
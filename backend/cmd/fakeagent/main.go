@@ -0,0 +1,43 @@
+// Command fakeagent is an ACP agent that plays a script instead of calling a model, or replays
+// a trace recorded with ACP_TRACE=true
+//
+// Run the backend against it with ACP_AGENT_COMMAND="fakeagent -script path/to/script.yaml"
+// or ACP_AGENT_COMMAND="fakeagent -replay data/traces/<session>.jsonl".
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/acp/fakeagent"
+)
+
+func main() {
+	scriptPath := flag.String("script", "", "YAML or JSON script to play")
+	tracePath := flag.String("replay", "", "JSONL trace to replay")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *scriptPath != "" && *tracePath == "":
+		var script *fakeagent.Script
+		if script, err = fakeagent.LoadScript(*scriptPath); err == nil {
+			err = fakeagent.Run(script, os.Stdin, os.Stdout)
+		}
+	case *tracePath != "" && *scriptPath == "":
+		var entries []acp.TraceEntry
+		if entries, err = acp.LoadTrace(*tracePath); err == nil {
+			err = fakeagent.Replay(entries, os.Stdin, os.Stdout)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: fakeagent -script path/to/script.yaml | -replay path/to/trace.jsonl")
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fakeagent: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
 	"github.com/unforced/parachute-backend/internal/acp"
 	"github.com/unforced/parachute-backend/internal/api/handlers"
 	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/device"
 	"github.com/unforced/parachute-backend/internal/domain/file"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
 	"github.com/unforced/parachute-backend/internal/domain/registry"
+	"github.com/unforced/parachute-backend/internal/domain/secret"
 	"github.com/unforced/parachute-backend/internal/domain/space"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
 	"github.com/unforced/parachute-backend/internal/storage/sqlite"
 )
 
@@ -61,6 +67,17 @@ func main() {
 
 	apiKey := os.Getenv("ANTHROPIC_API_KEY")
 
+	// How long to wait for a user to answer a tool permission request
+	permissionTimeout := handlers.DefaultPermissionTimeout
+	if v := os.Getenv("PERMISSION_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Warn("Invalid PERMISSION_TIMEOUT, using default", "value", v, "default", permissionTimeout)
+		} else {
+			permissionTimeout = d
+		}
+	}
+
 	// Initialize database
 	slog.Info("Connecting to database", "path", dbPath)
 	db, err := sqlite.NewDatabase(dbPath)
@@ -71,43 +88,56 @@ func main() {
 	defer db.Close()
 	slog.Info("Database connected and migrations applied")
 
-	// Initialize ACP client
-	// If ANTHROPIC_API_KEY is not set, the SDK will use OAuth credentials from macOS keychain
-	slog.Info("Initializing ACP client")
-	if apiKey == "" {
-		slog.Info("No ANTHROPIC_API_KEY provided, using Claude OAuth credentials from system keychain")
-	}
-
-	acpClient, err := acp.NewACPClient(apiKey)
-	if err != nil {
-		slog.Warn("Failed to initialize ACP client", "error", err)
-		slog.Warn("Continuing without ACP integration")
-		acpClient = nil
-	} else if acpClient != nil {
-		defer acpClient.Close()
-
-		// Initialize ACP connection
-		result, err := acpClient.Initialize()
-		if err != nil {
-			slog.Warn("Failed to initialize ACP", "error", err)
-			slog.Warn("Continuing without ACP integration")
-			acpClient.Close()
-			acpClient = nil
-		} else {
-			slog.Info("Connected to ACP", "server", result.ServerName, "version", result.ServerVersion)
-		}
-	}
-
 	// Initialize repositories
 	spaceRepo := sqlite.NewSpaceRepository(db.DB)
 	conversationRepo := sqlite.NewConversationRepository(db.DB)
 	registryRepo := sqlite.NewRegistryRepository(db.DB)
+	permissionRepo := sqlite.NewPermissionRepository(db.DB)
+	secretRepo := sqlite.NewSecretRepository(db.DB)
+	fileWriteRepo := sqlite.NewFileWriteRepository(db.DB)
+	deviceRepo := sqlite.NewDeviceRepository(db.DB)
 
 	// Initialize services
 	registryService := registry.NewService(registryRepo, parachuteRoot)
 	spaceService := space.NewService(spaceRepo, parachuteRoot)
 	conversationService := conversation.NewService(conversationRepo)
+	permissionService := permission.NewService(permissionRepo)
+	secretService := secret.NewService(secretRepo)
+	deviceService := device.NewService(deviceRepo)
 	spaceDBService := space.NewSpaceDatabaseService(parachuteRoot)
+	workspaceService := workspace.NewService(fileWriteRepo, registryService)
+	terminalManager := workspace.NewTerminalManager(workspace.DefaultTerminalTimeout, workspace.DefaultTerminalOutputLimit)
+	defer terminalManager.Close()
+
+	// Initialize ACP agents, started on demand and picked per space in its config
+	// If ANTHROPIC_API_KEY is not set, the SDK will use OAuth credentials from macOS keychain
+	slog.Info("Initializing ACP agents")
+	if apiKey == "" {
+		slog.Info("No ANTHROPIC_API_KEY provided, using Claude OAuth credentials from system keychain")
+	}
+
+	agentManager := acp.NewAgentManager(registryService, acp.DefaultAgent(apiKey))
+	defer agentManager.Close()
+
+	// Opt-in recording of the JSON-RPC traffic of every session, for debugging and replay
+	var tracer *acp.Tracer
+	if os.Getenv("ACP_TRACE") == "true" {
+		traceDir := filepath.Join(filepath.Dir(dbPath), "traces")
+		tracer = acp.NewTracer(traceDir)
+		agentManager.SetTracer(tracer)
+		slog.Warn("ACP_TRACE is set, recording agent traffic", "dir", traceDir)
+	}
+
+	// Start the default agent up front, it is the one most spaces use
+	initCtx, cancelInit := context.WithTimeout(context.Background(), 30*time.Second)
+	defaultAgent, err := agentManager.Get(initCtx, "")
+	cancelInit()
+	if err != nil {
+		// Keep the manager, the agent is started again by the first message that needs it
+		slog.Warn("Failed to start default ACP agent, it will be retried on demand", "error", err)
+	} else {
+		slog.Info("Default ACP agent ready", "agent", defaultAgent.Name)
+	}
 
 	// Log registry initialization
 	slog.Info("Registry service initialized",
@@ -123,6 +153,9 @@ func main() {
 	// Initialize context service for CLAUDE.md variable resolution
 	contextService := space.NewContextService(spaceDBService)
 
+	// MCP servers of a space come from its .mcp.json, with ${NAME} placeholders filled from secrets
+	mcpService := space.NewMCPService(secretService)
+
 	// Initialize file service
 	slog.Info("Initializing file service", "root", parachuteRoot)
 	fileService, err := file.NewService(parachuteRoot)
@@ -137,16 +170,29 @@ func main() {
 	spaceHandler := handlers.NewSpaceHandler(spaceService)
 	fileHandler := handlers.NewFileHandler(fileService)
 	spaceNotesHandler := handlers.NewSpaceNotesHandler(spaceService, spaceDBService)
-
-	// Initialize WebSocket handler if ACP is available
-	var wsHandler *handlers.WebSocketHandler
-	if acpClient != nil {
-		wsHandler = handlers.NewWebSocketHandler(acpClient)
-	}
-
-	// Message handler works with or without ACP (acpClient can be nil)
-	// Pass wsHandler for real-time streaming (can also be nil)
-	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, contextService, acpClient, wsHandler)
+	spaceMCPHandler := handlers.NewSpaceMCPHandler(spaceService, mcpService)
+	secretHandler := handlers.NewSecretHandler(secretService)
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceService)
+	deviceHandler := handlers.NewDeviceHandler(deviceService)
+	debugHandler := handlers.NewDebugHandler(tracer)
+	statsHandler := handlers.NewStatsHandler(conversationService)
+	fileHandler.SetDeviceService(deviceService)
+
+	// Initialize WebSocket handler
+	wsHandler := handlers.NewWebSocketHandler()
+
+	// Permission requests are forwarded to WebSocket clients, with a REST fallback
+	permissionHandler := handlers.NewPermissionHandler(wsHandler, permission.NewEngine(registryService), permissionService, permissionTimeout)
+	wsHandler.SetPermissionHandler(permissionHandler)
+	wsHandler.SetConversationService(conversationService)
+
+	// Pass wsHandler for real-time streaming
+	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, contextService, agentManager, wsHandler, permissionHandler)
+	messageHandler.SetMCPService(mcpService)
+	messageHandler.SetSpaceDatabaseService(spaceDBService)
+	messageHandler.SetWorkspaceService(workspaceService)
+	messageHandler.SetTerminalManager(terminalManager)
+	wsHandler.SetMessageHandler(messageHandler)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -154,9 +200,11 @@ func main() {
 	})
 
 	// Middleware
+	// Browsers may call the API from the origins allowed to open WebSockets: localhost unless
+	// ALLOWED_ORIGINS says otherwise
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{"Origin", "Content-Type", "Accept"},
+		AllowOriginsFunc: handlers.OriginAllowed,
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 	}))
 
 	app.Use(func(c fiber.Ctx) error {
@@ -166,22 +214,43 @@ func main() {
 
 	// Health check endpoint
 	app.Get("/health", func(c fiber.Ctx) error {
-		return c.JSON(fiber.Map{
+		health := fiber.Map{
 			"status":      "ok",
 			"service":     "parachute-backend",
 			"version":     "0.1.0",
-			"acp_enabled": acpClient != nil,
-		})
+			"acp_enabled": true,
+			"acp":         agentManager.Status(),
+			"websocket":   wsHandler.Stats(),
+		}
+		return c.JSON(health)
 	})
 
-	// WebSocket endpoint
-	if wsHandler != nil {
-		app.Get("/ws", wsHandler.HandleUpgrade())
-		slog.Info("WebSocket endpoint enabled", "url", "ws://localhost:"+port+"/ws")
+	// Every route but /health and pairing needs a device token, from pairing or the admin command
+	requireDevice := handlers.NewAuthMiddleware(deviceService)
+	if os.Getenv("AUTH_DISABLED") == "true" {
+		slog.Warn("AUTH_DISABLED is set, the API and WebSocket accept requests without a token")
+		requireDevice = func(c fiber.Ctx) error { return c.Next() }
+	} else if !hasActiveDevice(deviceService) {
+		// Nothing could pair a device through the API yet, so show a code here
+		pairing, err := deviceService.StartPairing(context.Background(), "http://localhost:"+port, device.DefaultPairingTTL)
+		if err != nil {
+			slog.Error("Failed to start pairing", "error", err)
+		} else {
+			slog.Warn("No device is paired yet, pair one with this code", "code", pairing.Code, "expires_at", pairing.ExpiresAt.Format(time.Kitchen), "qr_payload", pairing.QRPayload)
+			slog.Warn("Once it expires, get a new one with: go run ./cmd/admin pair")
+		}
 	}
 
+	// WebSocket endpoint
+	app.Get("/ws", requireDevice, wsHandler.HandleUpgrade())
+	slog.Info("WebSocket endpoint enabled", "url", "ws://localhost:"+port+"/ws")
+
+	// Pairing is how a device gets its token, so it is the one API route open without one. It is
+	// registered before the group so that it answers before the token check of the group runs
+	app.Post("/api/devices/pair", deviceHandler.Pair)
+
 	// API routes
-	api := app.Group("/api")
+	api := app.Group("/api", requireDevice)
 
 	// Registry routes (new flexible architecture)
 	registry := api.Group("/registry")
@@ -219,6 +288,28 @@ func main() {
 	spaces.Get("/:id/database/stats", spaceNotesHandler.GetDatabaseStats)
 	spaces.Get("/:id/database/tables/:table_name", spaceNotesHandler.GetTableData)
 
+	// Space MCP server routes
+	spaces.Get("/:id/mcp", spaceMCPHandler.GetConfig)
+	spaces.Put("/:id/mcp", spaceMCPHandler.PutConfig)
+
+	// Secret routes (values referenced as ${NAME} in space config files)
+	secrets := api.Group("/secrets")
+	secrets.Get("/", secretHandler.ListSecrets)
+	secrets.Put("/:name", secretHandler.SetSecret)
+	secrets.Delete("/:name", secretHandler.DeleteSecret)
+
+	// Device routes
+	devices := api.Group("/devices")
+	devices.Get("/", deviceHandler.ListDevices)
+	devices.Post("/pairing", deviceHandler.StartPairing)
+	devices.Delete("/:id", deviceHandler.RevokeDevice)
+
+	// Debug routes
+	api.Get("/debug/sessions/:id/trace", debugHandler.GetSessionTrace)
+
+	// Stats routes
+	api.Get("/stats/usage", statsHandler.GetUsage)
+
 	// Conversation routes
 	conversations := api.Group("/conversations")
 	conversations.Get("/", func(c fiber.Ctx) error {
@@ -300,11 +391,31 @@ func main() {
 		return c.JSON(conv)
 	})
 
+	conversations.Post("/:id/cancel", messageHandler.CancelConversation)
+	conversations.Put("/:id/mode", messageHandler.SetConversationMode)
+	conversations.Get("/:id/events", messageHandler.StreamConversationEvents)
+	conversations.Get("/:id/writes", workspaceHandler.ListWrites)
+
+	// Files written by agents, for diffs and undo
+	writes := api.Group("/writes")
+	writes.Get("/:id", workspaceHandler.GetWrite)
+	writes.Post("/:id/undo", workspaceHandler.UndoWrite)
+
 	// Message routes
 	messages := api.Group("/messages")
 	messages.Get("/", messageHandler.ListMessages)
 	messages.Post("/", messageHandler.SendMessage)
 
+	// Permission routes (REST fallback for non-WebSocket clients)
+	permissions := api.Group("/permissions")
+	permissions.Get("/", permissionHandler.ListPermissions)
+	permissions.Get("/grants", permissionHandler.ListGrants)
+	permissions.Post("/grants", permissionHandler.CreateGrant)
+	permissions.Get("/grants/:id", permissionHandler.GetGrant)
+	permissions.Delete("/grants/:id", permissionHandler.RevokeGrant)
+	permissions.Get("/audit", permissionHandler.ListAudit)
+	permissions.Post("/:request_id", permissionHandler.RespondPermission) // Must come after the static routes
+
 	// File/Capture routes
 	captures := api.Group("/captures")
 	captures.Post("/upload", fileHandler.UploadCapture)
@@ -326,7 +437,7 @@ func main() {
 	slog.Info("Endpoints configured",
 		"health", "http://localhost:"+port+"/health",
 		"api", "http://localhost:"+port+"/api/*",
-		"websocket", wsHandler != nil)
+		"websocket", "ws://localhost:"+port+"/ws")
 	slog.Info("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
 	if err := app.Listen(":" + port); err != nil {
@@ -334,3 +445,18 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// hasActiveDevice reports whether any device holds a token that wasn't revoked
+func hasActiveDevice(deviceService *device.Service) bool {
+	devices, err := deviceService.ListDevices(context.Background())
+	if err != nil {
+		slog.Warn("Failed to list devices", "error", err)
+		return true
+	}
+	for _, dev := range devices {
+		if !dev.Revoked() {
+			return true
+		}
+	}
+	return false
+}
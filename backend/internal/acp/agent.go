@@ -0,0 +1,144 @@
+package acp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Settings keys of the agent registry
+const (
+	AgentsSetting       = "agents"        // JSON array of AgentConfig
+	DefaultAgentSetting = "default_agent" // Name of the agent used by spaces that don't pick one
+)
+
+// DefaultAgentName is the built-in claude-code-acp agent, always available
+const DefaultAgentName = "claude-code"
+
+// AgentCommandEnv replaces the command of the built-in agent, e.g. to run a fake agent in tests
+const AgentCommandEnv = "ACP_AGENT_COMMAND"
+
+// WorkingDirSpace runs each session in the folder of the space it serves
+const WorkingDirSpace = "space"
+
+var agentNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// AgentConfig describes how to launch, or reach, an ACP-speaking agent
+type AgentConfig struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"` // Added to the backend's environment
+	// Transport is "stdio" (default) to spawn Command, "unix" to connect to the socket at
+	// Address, or "websocket" to connect to the ws:// or wss:// URL at Address
+	Transport string            `json:"transport,omitempty"`
+	Address   string            `json:"address,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"` // Sent with the WebSocket handshake, e.g. Authorization
+	// WorkingDir is "space" (default) to run sessions in the space folder,
+	// or an absolute path the process and all of its sessions run in
+	WorkingDir string `json:"working_dir,omitempty"`
+}
+
+// DefaultAgent returns the built-in claude-code-acp agent
+// apiKey: Optional Anthropic API key. If empty, the SDK will use OAuth credentials
+// ACP_AGENT_COMMAND, if set, is run instead (split on spaces), so any ACP agent can stand in.
+func DefaultAgent(apiKey string) AgentConfig {
+	agent := AgentConfig{
+		Name:    DefaultAgentName,
+		Command: "npx",
+		Args:    []string{"@zed-industries/claude-code-acp"},
+	}
+	if fields := strings.Fields(os.Getenv(AgentCommandEnv)); len(fields) > 0 {
+		agent.Command, agent.Args = fields[0], fields[1:]
+	}
+	// Only set ANTHROPIC_API_KEY if provided, otherwise SDK will use OAuth credentials
+	if apiKey != "" {
+		agent.Env = map[string]string{"ANTHROPIC_API_KEY": apiKey}
+	}
+	return agent
+}
+
+// Validate checks that the agent can be launched, or reached
+func (a *AgentConfig) Validate() error {
+	if !agentNamePattern.MatchString(a.Name) {
+		return fmt.Errorf("invalid agent name %q", a.Name)
+	}
+	switch a.Transport {
+	case "", TransportStdio:
+		if a.Command == "" {
+			return fmt.Errorf("agent %s: command is required", a.Name)
+		}
+	case TransportUnix:
+		if a.Address == "" {
+			return fmt.Errorf("agent %s: address is required", a.Name)
+		}
+	case TransportWebSocket:
+		if u, err := url.Parse(a.Address); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return fmt.Errorf("agent %s: address must be a ws:// or wss:// URL", a.Name)
+		}
+	default:
+		return fmt.Errorf("agent %s: transport must be %q, %q or %q", a.Name, TransportStdio, TransportUnix, TransportWebSocket)
+	}
+	if a.WorkingDir != "" && a.WorkingDir != WorkingDirSpace && !filepath.IsAbs(a.WorkingDir) {
+		return fmt.Errorf("agent %s: working_dir must be %q or an absolute path", a.Name, WorkingDirSpace)
+	}
+	return nil
+}
+
+// Target describes where the agent runs, for logs
+func (a *AgentConfig) Target() string {
+	if a.Transport == "" || a.Transport == TransportStdio {
+		return a.Command
+	}
+	return a.Transport + " " + a.Address
+}
+
+// SessionDir returns the working directory of a session serving the given space
+func (a *AgentConfig) SessionDir(spacePath string) string {
+	if a.WorkingDir == "" || a.WorkingDir == WorkingDirSpace {
+		return spacePath
+	}
+	return a.WorkingDir
+}
+
+// ParseAgents decodes and validates the agent registry setting
+func ParseAgents(data []byte) ([]AgentConfig, error) {
+	var agents []AgentConfig
+	if err := json.Unmarshal(data, &agents); err != nil {
+		return nil, fmt.Errorf("invalid agents: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range agents {
+		if err := agents[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[agents[i].Name] {
+			return nil, fmt.Errorf("duplicate agent name %q", agents[i].Name)
+		}
+		seen[agents[i].Name] = true
+	}
+
+	return agents, nil
+}
+
+// SpawnAgent starts the process of an agent
+func SpawnAgent(agent AgentConfig) (*ACPProcess, error) {
+	cmd := exec.Command(agent.Command, agent.Args...)
+
+	cmd.Env = os.Environ()
+	for key, value := range agent.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	if agent.WorkingDir != "" && agent.WorkingDir != WorkingDirSpace {
+		cmd.Dir = agent.WorkingDir
+	}
+
+	return startProcess(cmd)
+}
@@ -0,0 +1,247 @@
+package acp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ErrManagerClosed is returned when an agent is requested after Close
+var ErrManagerClosed = errors.New("agent manager closed")
+
+// SettingsStore reads registry settings (implemented by registry.Service)
+type SettingsStore interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+}
+
+// Agent is a running agent and the config it was started with
+type Agent struct {
+	Name   string
+	Config AgentConfig
+	Client *ACPClient
+}
+
+// agentEntry is an agent that is started, or being started by the first caller that needed it
+type agentEntry struct {
+	config AgentConfig
+	ready  chan struct{} // Closed once client or err is set
+	client *ACPClient
+	err    error
+}
+
+// AgentManager keeps one supervised ACPClient per agent, started the first time it is needed
+// Agents are looked up in the registry settings on every call, but a running agent keeps the
+// config it was started with until the backend restarts.
+type AgentManager struct {
+	settings     SettingsStore
+	defaultAgent AgentConfig
+	tracer       *Tracer
+
+	mu            sync.Mutex
+	agents        map[string]*agentEntry
+	exitCallbacks []func(agent string)
+	closed        bool
+}
+
+// NewAgentManager creates a new agent manager
+// defaultAgent is used when neither the space nor the settings pick an agent; settings may be nil
+func NewAgentManager(settings SettingsStore, defaultAgent AgentConfig) *AgentManager {
+	return &AgentManager{
+		settings:     settings,
+		defaultAgent: defaultAgent,
+		agents:       make(map[string]*agentEntry),
+	}
+}
+
+// SetTracer records the JSON-RPC traffic of agents started from now on, see Tracer
+func (m *AgentManager) SetTracer(tracer *Tracer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tracer = tracer
+}
+
+// Config resolves an agent name to its config
+// An empty name means the default agent: the default_agent setting, or the built-in one.
+func (m *AgentManager) Config(ctx context.Context, name string) (AgentConfig, error) {
+	if name == "" && m.settings != nil {
+		name, _ = m.settings.GetSetting(ctx, DefaultAgentSetting)
+	}
+	if name == "" {
+		name = m.defaultAgent.Name
+	}
+
+	if m.settings != nil {
+		if raw, err := m.settings.GetSetting(ctx, AgentsSetting); err == nil && raw != "" {
+			agents, err := ParseAgents([]byte(raw))
+			if err != nil {
+				return AgentConfig{}, err
+			}
+			for _, agent := range agents {
+				if agent.Name == name {
+					return agent, nil
+				}
+			}
+		}
+	}
+
+	// The built-in agent can be overridden by the registry, but is never missing
+	if name == m.defaultAgent.Name {
+		return m.defaultAgent, nil
+	}
+
+	return AgentConfig{}, fmt.Errorf("unknown agent %q", name)
+}
+
+// Get returns the running agent with the given name, starting and initializing it if needed
+// Concurrent callers for the same agent share one start. A failed start is not cached, and an
+// agent whose supervisor gave up restarting it is started again.
+func (m *AgentManager) Get(ctx context.Context, name string) (*Agent, error) {
+	config, err := m.Config(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrManagerClosed
+	}
+	entry, ok := m.agents[config.Name]
+	var failed *ACPClient
+	if ok && entry.client != nil && entry.client.Status().State == ProcessFailed {
+		// The supervisor gave up on it, start the agent afresh
+		failed = entry.client
+		ok = false
+	}
+	if !ok {
+		entry = &agentEntry{config: config, ready: make(chan struct{})}
+		m.agents[config.Name] = entry
+	}
+	m.mu.Unlock()
+
+	if failed != nil {
+		log.Printf("♻️  ACP agent %s failed, starting it again", config.Name)
+		failed.Close()
+	}
+	if !ok {
+		m.start(entry)
+	}
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+
+	return &Agent{Name: entry.config.Name, Config: entry.config, Client: entry.client}, nil
+}
+
+// start spawns and initializes the agent of an entry, then marks it ready
+// It is bounded by its own timeout so one impatient caller doesn't fail the start for everyone.
+func (m *AgentManager) start(entry *agentEntry) {
+	name := entry.config.Name
+	defer close(entry.ready)
+
+	m.mu.Lock()
+	tracer := m.tracer
+	m.mu.Unlock()
+
+	log.Printf("🚀 Starting ACP agent %s (%s)", name, entry.config.Target())
+	client, err := NewAgentClient(entry.config)
+	if err == nil {
+		if tracer != nil {
+			client.SetTracer(tracer)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+		var result *InitializeResult
+		result, err = client.Initialize(ctx)
+		cancel()
+		if err != nil {
+			client.Close()
+		} else {
+			log.Printf("✅ ACP agent %s connected: %s %s", name, result.ServerName, result.ServerVersion)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		entry.err = fmt.Errorf("failed to start agent %s: %w", name, err)
+		delete(m.agents, name)
+		return
+	}
+
+	if m.closed {
+		client.Close()
+		entry.err = ErrManagerClosed
+		return
+	}
+
+	entry.client = client
+	client.OnProcessExit(func() { m.processExited(name) })
+}
+
+// processExited runs the exit callbacks for an agent
+func (m *AgentManager) processExited(name string) {
+	m.mu.Lock()
+	callbacks := append([]func(string){}, m.exitCallbacks...)
+	m.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(name)
+	}
+}
+
+// OnProcessExit registers a callback run with the agent name when an agent's process exits unexpectedly
+// See ACPClient.OnProcessExit.
+func (m *AgentManager) OnProcessExit(fn func(agent string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exitCallbacks = append(m.exitCallbacks, fn)
+}
+
+// Status returns the process status of every running agent, by name
+func (m *AgentManager) Status() map[string]ProcessStatus {
+	m.mu.Lock()
+	clients := make(map[string]*ACPClient, len(m.agents))
+	for name, entry := range m.agents {
+		if entry.client != nil {
+			clients[name] = entry.client
+		}
+	}
+	m.mu.Unlock()
+
+	status := make(map[string]ProcessStatus, len(clients))
+	for name, client := range clients {
+		status[name] = client.Status()
+	}
+	return status
+}
+
+// Close shuts down all agents, agents still starting are closed once they are up
+func (m *AgentManager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	var clients []*ACPClient
+	for _, entry := range m.agents {
+		if entry.client != nil {
+			clients = append(clients, entry.client)
+		}
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, client := range clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
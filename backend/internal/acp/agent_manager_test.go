@@ -0,0 +1,172 @@
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+type mapSettings map[string]string
+
+func (s mapSettings) GetSetting(_ context.Context, key string) (string, error) {
+	value, ok := s[key]
+	if !ok {
+		return "", fmt.Errorf("setting not found: %s", key)
+	}
+	return value, nil
+}
+
+// helperAgentConfig launches the helper agent of supervisor_test.go through SpawnAgent
+func helperAgentConfig(name string) AgentConfig {
+	return AgentConfig{
+		Name:    name,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestHelperACPAgent$"},
+		Env:     map[string]string{"GO_WANT_ACP_HELPER": "1"},
+	}
+}
+
+func TestParseAgents(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `[{"name":"gemini","command":"gemini","args":["--experimental-acp"]},{"name":"local","command":"/opt/agent","working_dir":"/srv"}]`, false},
+		{"space working dir", `[{"name":"a","command":"a","working_dir":"space"}]`, false},
+		{"missing command", `[{"name":"a"}]`, true},
+		{"bad name", `[{"name":"a b","command":"a"}]`, true},
+		{"relative working dir", `[{"name":"a","command":"a","working_dir":"tmp"}]`, true},
+		{"unix socket", `[{"name":"a","transport":"unix","address":"/run/agent.sock"}]`, false},
+		{"websocket", `[{"name":"a","transport":"websocket","address":"wss://agents.home:8443/acp","headers":{"Authorization":"Bearer x"}}]`, false},
+		{"unix without address", `[{"name":"a","transport":"unix"}]`, true},
+		{"websocket over http", `[{"name":"a","transport":"websocket","address":"http://agents.home"}]`, true},
+		{"unknown transport", `[{"name":"a","command":"a","transport":"carrier-pigeon"}]`, true},
+		{"duplicate", `[{"name":"a","command":"a"},{"name":"a","command":"b"}]`, true},
+		{"not json", `gemini`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAgents([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAgents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgentManagerConfig(t *testing.T) {
+	builtin := DefaultAgent("")
+	settings := mapSettings{
+		AgentsSetting: `[{"name":"gemini","command":"gemini","working_dir":"/srv/agents"}]`,
+	}
+	manager := NewAgentManager(settings, builtin)
+	ctx := context.Background()
+
+	config, err := manager.Config(ctx, "")
+	if err != nil || config.Name != DefaultAgentName {
+		t.Fatalf("Config(\"\") = %+v, %v, want built-in agent", config, err)
+	}
+
+	config, err = manager.Config(ctx, "gemini")
+	if err != nil || config.Command != "gemini" {
+		t.Fatalf("Config(gemini) = %+v, %v", config, err)
+	}
+	if dir := config.SessionDir("/spaces/a"); dir != "/srv/agents" {
+		t.Errorf("SessionDir() = %s, want the fixed working dir", dir)
+	}
+
+	settings[DefaultAgentSetting] = "gemini"
+	if config, _ = manager.Config(ctx, ""); config.Name != "gemini" {
+		t.Errorf("Config(\"\") = %s, want the default_agent setting", config.Name)
+	}
+
+	if _, err := manager.Config(ctx, "missing"); err == nil {
+		t.Error("Config(missing) should fail")
+	}
+}
+
+func TestAgentManagerStartsOneClientPerAgent(t *testing.T) {
+	agents, _ := json.Marshal([]AgentConfig{helperAgentConfig("one"), helperAgentConfig("two")})
+	manager := NewAgentManager(mapSettings{AgentsSetting: string(agents)}, helperAgentConfig(DefaultAgentName))
+	defer manager.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	one, err := manager.Get(ctx, "one")
+	if err != nil {
+		t.Fatalf("Get(one) error = %v", err)
+	}
+	again, err := manager.Get(ctx, "one")
+	if err != nil {
+		t.Fatalf("Get(one) error = %v", err)
+	}
+	if one.Client != again.Client {
+		t.Error("Get(one) started a second client")
+	}
+
+	two, err := manager.Get(ctx, "two")
+	if err != nil {
+		t.Fatalf("Get(two) error = %v", err)
+	}
+	if two.Client == one.Client {
+		t.Error("agents one and two share a client")
+	}
+
+	status := manager.Status()
+	if len(status) != 2 || status["one"].State != ProcessRunning || status["two"].State != ProcessRunning {
+		t.Errorf("Status() = %+v, want two running agents", status)
+	}
+
+	if err := manager.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := manager.Get(ctx, "one"); err != ErrManagerClosed {
+		t.Errorf("Get() after Close error = %v, want ErrManagerClosed", err)
+	}
+}
+
+func TestAgentManagerDoesNotCacheFailedStart(t *testing.T) {
+	broken := AgentConfig{Name: DefaultAgentName, Command: "/nonexistent/acp-agent"}
+	manager := NewAgentManager(nil, broken)
+	defer manager.Close()
+
+	if _, err := manager.Get(context.Background(), ""); err == nil {
+		t.Fatal("Get() should fail for a missing command")
+	}
+	if len(manager.Status()) != 0 {
+		t.Error("failed agent should not be tracked")
+	}
+}
+
+func TestAgentManagerRestartsFailedAgent(t *testing.T) {
+	manager := NewAgentManager(nil, helperAgentConfig(DefaultAgentName))
+	defer manager.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	first, err := manager.Get(ctx, "")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	// As if the supervisor ran out of restart attempts
+	first.Client.setState(ProcessFailed)
+
+	second, err := manager.Get(ctx, "")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if second.Client == first.Client {
+		t.Fatal("Get() returned the failed client")
+	}
+	if state := manager.Status()[DefaultAgentName].State; state != ProcessRunning {
+		t.Errorf("state = %s, want running", state)
+	}
+}
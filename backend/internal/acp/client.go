@@ -1,16 +1,21 @@
 package acp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ACPClient provides high-level ACP protocol methods
+// The underlying process, or connection, is supervised: if it dies it is restarted and re-initialized
 type ACPClient struct {
-	jsonrpc *JSONRPCClient
-	process *ACPProcess
+	jsonrpc   *JSONRPCClient
+	transport Transport
+	connMu    sync.RWMutex // Guards jsonrpc and transport, which are replaced on restart
 
 	// Per-session request routing
 	sessionRequests map[string]chan *JSONRPCIncomingRequest
@@ -18,57 +23,132 @@ type ACPClient struct {
 	// Notification broadcasting - all listeners get all notifications
 	sessionNotifications map[string]chan *JSONRPCNotification
 	mu                   sync.RWMutex
+
+	// Supervision (see supervisor.go)
+	spawn         func() (Transport, error)
+	restartPolicy RestartPolicy
+	status        ProcessStatus
+	statusMu      sync.Mutex
+	exitCallbacks []func()
+	capabilities  AgentCapabilities
+	tracer        *Tracer // Guarded by connMu, handed to every connection
+	closing       atomic.Bool
+	stop          chan struct{}
+	stopOnce      sync.Once
 }
 
 // NewACPClient creates a new ACP client with the given API key
 // If apiKey is empty, the ACP SDK will use OAuth credentials from the system
 func NewACPClient(apiKey string) (*ACPClient, error) {
-	// Spawn ACP process (apiKey can be empty to use OAuth credentials)
-	process, err := SpawnACP(apiKey)
+	// apiKey can be empty to use OAuth credentials
+	return NewAgentClient(DefaultAgent(apiKey))
+}
+
+// NewAgentClient creates a new ACP client for a configured agent, over the transport of its config
+func NewAgentClient(agent AgentConfig) (*ACPClient, error) {
+	return newACPClient(func() (Transport, error) {
+		return Connect(agent)
+	}, DefaultRestartPolicy)
+}
+
+// newACPClient spawns the first process, or connection, and starts supervising it
+func newACPClient(spawn func() (Transport, error), policy RestartPolicy) (*ACPClient, error) {
+	transport, err := spawn()
 	if err != nil {
 		return nil, fmt.Errorf("failed to spawn ACP: %w", err)
 	}
 
-	// Create JSON-RPC client
-	jsonrpc := NewJSONRPCClient(process)
-
 	client := &ACPClient{
-		jsonrpc:              jsonrpc,
-		process:              process,
 		sessionRequests:      make(map[string]chan *JSONRPCIncomingRequest),
 		sessionNotifications: make(map[string]chan *JSONRPCNotification),
+		spawn:                spawn,
+		restartPolicy:        policy,
+		status:               ProcessStatus{State: ProcessRunning},
+		stop:                 make(chan struct{}),
 	}
 
-	// Start request router and notification broadcaster
-	go client.routeRequests()
-	go client.broadcastNotifications()
+	client.connect(transport)
+	go client.supervise()
 
 	return client, nil
 }
 
+// connect wires a freshly spawned process, or connection, into the client
+func (c *ACPClient) connect(transport Transport) {
+	// Create JSON-RPC client
+	jsonrpc := NewJSONRPCClient(transport)
+
+	c.connMu.Lock()
+	jsonrpc.setTracer(c.tracer)
+	c.jsonrpc = jsonrpc
+	c.transport = transport
+	c.connMu.Unlock()
+
+	c.statusMu.Lock()
+	c.status.StartedAt = time.Now()
+	c.statusMu.Unlock()
+
+	// Start request router and notification broadcaster
+	go c.routeRequests(jsonrpc)
+	go c.broadcastNotifications(jsonrpc)
+}
+
+// connection returns the current JSON-RPC client and transport
+func (c *ACPClient) connection() (*JSONRPCClient, Transport) {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.jsonrpc, c.transport
+}
+
+// rpc returns the current JSON-RPC client
+func (c *ACPClient) rpc() *JSONRPCClient {
+	rpc, _ := c.connection()
+	return rpc
+}
+
+// SetTracer records the JSON-RPC traffic of the client's sessions from now on, see Tracer
+// Set it before Initialize so that traces start with the initialize exchange.
+func (c *ACPClient) SetTracer(tracer *Tracer) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.tracer = tracer
+	c.jsonrpc.setTracer(tracer)
+}
+
 // Close shuts down the ACP client
 func (c *ACPClient) Close() error {
-	return c.process.Close()
+	c.shutdown()
+	_, transport := c.connection()
+	return transport.Close()
 }
 
 // Kill forcefully terminates the ACP process
 func (c *ACPClient) Kill() error {
-	return c.process.Kill()
+	c.shutdown()
+	_, transport := c.connection()
+	return transport.Kill()
+}
+
+// shutdown stops the supervisor from restarting the process
+func (c *ACPClient) shutdown() {
+	c.closing.Store(true)
+	c.stopOnce.Do(func() { close(c.stop) })
 }
 
 // Notifications returns a channel that receives ACP notifications
 func (c *ACPClient) Notifications() <-chan *JSONRPCNotification {
-	return c.jsonrpc.Notifications()
+	return c.rpc().Notifications()
 }
 
 // Requests returns a channel that receives incoming JSON-RPC requests from ACP
 // DEPRECATED: Use RegisterSession() instead for per-session routing
 func (c *ACPClient) Requests() <-chan *JSONRPCIncomingRequest {
-	return c.jsonrpc.Requests()
+	return c.rpc().Requests()
 }
 
 // RegisterSession creates dedicated channels for a session
 // Returns (requestChan, notificationChan)
+// Both channels are closed if the ACP process exits, since the session is gone with it
 func (c *ACPClient) RegisterSession(sessionID string) (<-chan *JSONRPCIncomingRequest, <-chan *JSONRPCNotification) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -103,9 +183,9 @@ func (c *ACPClient) UnregisterSession(sessionID string) {
 }
 
 // routeRequests routes incoming requests to the appropriate session channel
-func (c *ACPClient) routeRequests() {
+func (c *ACPClient) routeRequests(rpc *JSONRPCClient) {
 	log.Printf("🔀 Request router started")
-	for req := range c.jsonrpc.Requests() {
+	for req := range rpc.Requests() {
 		// Parse sessionId from params
 		var params struct {
 			SessionID string `json:"sessionId"`
@@ -136,64 +216,138 @@ func (c *ACPClient) routeRequests() {
 }
 
 // broadcastNotifications broadcasts notifications to all registered session listeners
-func (c *ACPClient) broadcastNotifications() {
+func (c *ACPClient) broadcastNotifications(rpc *JSONRPCClient) {
 	log.Printf("📢 Notification broadcaster started")
-	for notif := range c.jsonrpc.Notifications() {
-		// Broadcast to all registered sessions
-		c.mu.RLock()
-		sessionCount := len(c.sessionNotifications)
+	for notif := range rpc.Notifications() {
+		c.broadcast(notif)
+		rpc.notificationHandled()
+	}
+	log.Printf("📢 Notification broadcaster stopped")
+}
 
-		log.Printf("📢 Broadcasting notification to %d session(s)", sessionCount)
+// broadcast sends a notification to every registered session listener
+func (c *ACPClient) broadcast(notif *JSONRPCNotification) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-		if sessionCount == 0 {
-			c.mu.RUnlock()
-			continue
-		}
+	sessionCount := len(c.sessionNotifications)
+	log.Printf("📢 Broadcasting notification to %d session(s)", sessionCount)
 
-		// Send to each session's notification channel
-		sentCount := 0
-		for sessionID, ch := range c.sessionNotifications {
-			select {
-			case ch <- notif:
-				sentCount++
-				log.Printf("📢 Sent notification to session %s", sessionID[:8])
-			default:
-				log.Printf("⚠️  Notification channel full for session %s, dropping notification", sessionID[:8])
-			}
+	if sessionCount == 0 {
+		return
+	}
+
+	// Send to each session's notification channel
+	sentCount := 0
+	for sessionID, ch := range c.sessionNotifications {
+		select {
+		case ch <- notif:
+			sentCount++
+			log.Printf("📢 Sent notification to session %s", sessionID[:8])
+		default:
+			log.Printf("⚠️  Notification channel full for session %s, dropping notification", sessionID[:8])
 		}
-		log.Printf("📢 Broadcast complete: sent to %d/%d sessions", sentCount, sessionCount)
-		c.mu.RUnlock()
 	}
-	log.Printf("📢 Notification broadcaster stopped")
+	log.Printf("📢 Broadcast complete: sent to %d/%d sessions", sentCount, sessionCount)
 }
 
 // SendResponse sends a JSON-RPC response back to ACP
 func (c *ACPClient) SendResponse(id int, result interface{}) error {
-	return c.jsonrpc.SendResponse(id, result)
+	return c.rpc().SendResponse(id, result)
+}
+
+// SendError sends a JSON-RPC error response back to ACP
+func (c *ACPClient) SendError(id int, rpcErr *RPCError) error {
+	return c.rpc().SendError(id, rpcErr)
+}
+
+// ClientCapabilities tells the agent which client methods it may call
+type ClientCapabilities struct {
+	FS       FileSystemCapability `json:"fs"`
+	Terminal bool                 `json:"terminal"`
+}
+
+// FileSystemCapability advertises the fs/* methods
+type FileSystemCapability struct {
+	ReadTextFile  bool `json:"readTextFile"`
+	WriteTextFile bool `json:"writeTextFile"`
+}
+
+// AgentCapabilities is what the agent reported it supports at initialize
+type AgentCapabilities struct {
+	LoadSession bool               `json:"loadSession"` // session/load can resume a session
+	MCP         MCPCapabilities    `json:"mcpCapabilities"`
+	Prompt      PromptCapabilities `json:"promptCapabilities"`
+}
+
+// PromptCapabilities lists the content blocks the agent accepts besides text and resource links
+type PromptCapabilities struct {
+	Image           bool `json:"image"`
+	Audio           bool `json:"audio"`
+	EmbeddedContext bool `json:"embeddedContext"` // resource blocks
+}
+
+// SupportsContent reports whether the agent accepts a content block in prompts
+func (c AgentCapabilities) SupportsContent(block ContentBlock) bool {
+	switch block.Type {
+	case ContentImage:
+		return c.Prompt.Image
+	case ContentAudio:
+		return c.Prompt.Audio
+	case ContentResource:
+		return c.Prompt.EmbeddedContext
+	default:
+		return true
+	}
+}
+
+// MCPCapabilities lists the MCP transports the agent supports besides stdio
+type MCPCapabilities struct {
+	HTTP bool `json:"http"`
+	SSE  bool `json:"sse"`
+}
+
+// SupportsMCPServer reports whether the agent can connect to an MCP server over its transport
+func (c AgentCapabilities) SupportsMCPServer(server MCPServer) bool {
+	switch server.Type {
+	case MCPTransportHTTP:
+		return c.MCP.HTTP
+	case MCPTransportSSE:
+		return c.MCP.SSE
+	default:
+		return true
+	}
 }
 
 // InitializeParams represents parameters for the initialize method
 type InitializeParams struct {
-	ProtocolVersion int    `json:"protocolVersion"`
-	ClientName      string `json:"client_name,omitempty"`
-	ClientVersion   string `json:"client_version,omitempty"`
+	ProtocolVersion    int                `json:"protocolVersion"`
+	ClientCapabilities ClientCapabilities `json:"clientCapabilities"`
+	ClientName         string             `json:"client_name,omitempty"`
+	ClientVersion      string             `json:"client_version,omitempty"`
 }
 
 // InitializeResult represents the result of initialize
 type InitializeResult struct {
-	ServerName    string `json:"server_name"`
-	ServerVersion string `json:"server_version"`
+	ServerName        string            `json:"server_name"`
+	ServerVersion     string            `json:"server_version"`
+	AgentCapabilities AgentCapabilities `json:"agentCapabilities"`
 }
 
 // Initialize performs the ACP handshake
-func (c *ACPClient) Initialize() (*InitializeResult, error) {
+func (c *ACPClient) Initialize(ctx context.Context) (*InitializeResult, error) {
 	params := InitializeParams{
 		ProtocolVersion: 1, // ACP protocol version
 		ClientName:      "Parachute",
 		ClientVersion:   "0.1.0",
+		// File access and terminals are served by the session listener, confined to the session's space
+		ClientCapabilities: ClientCapabilities{
+			FS:       FileSystemCapability{ReadTextFile: true, WriteTextFile: true},
+			Terminal: true,
+		},
 	}
 
-	result, err := c.jsonrpc.Call("initialize", params)
+	result, err := c.rpc().CallContext(ctx, "initialize", params)
 	if err != nil {
 		return nil, fmt.Errorf("initialize failed: %w", err)
 	}
@@ -203,16 +357,79 @@ func (c *ACPClient) Initialize() (*InitializeResult, error) {
 		return nil, fmt.Errorf("failed to parse initialize result: %w", err)
 	}
 
+	// A restarted process may be a different version, always keep the latest answer
+	c.statusMu.Lock()
+	c.capabilities = initResult.AgentCapabilities
+	c.statusMu.Unlock()
+
 	return &initResult, nil
 }
 
-// MCPServer represents an MCP server configuration
+// Capabilities returns the agent capabilities reported by the last initialize
+func (c *ACPClient) Capabilities() AgentCapabilities {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.capabilities
+}
+
+// MCP server transports, stdio servers have no type on the wire
+const (
+	MCPTransportStdio = "stdio"
+	MCPTransportHTTP  = "http"
+	MCPTransportSSE   = "sse"
+)
+
+// MCPServer represents an MCP server the agent should connect to
 type MCPServer struct {
-	Name    string                 `json:"name"`
-	Command string                 `json:"command"`
-	Args    []string               `json:"args,omitempty"`
-	Env     map[string]string      `json:"env,omitempty"`
-	Config  map[string]interface{} `json:"config,omitempty"`
+	Type    string        `json:"type,omitempty"` // "http" or "sse", empty for stdio
+	Name    string        `json:"name"`
+	Command string        `json:"command,omitempty"` // stdio
+	Args    []string      `json:"args,omitempty"`    // stdio
+	Env     []EnvVariable `json:"env,omitempty"`     // stdio
+	URL     string        `json:"url,omitempty"`     // http, sse
+	Headers []HTTPHeader  `json:"headers,omitempty"` // http, sse
+}
+
+// EnvVariable is an environment variable of a stdio MCP server
+type EnvVariable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HTTPHeader is a header sent to an HTTP or SSE MCP server
+type HTTPHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// MarshalJSON always sends the list fields ACP requires for the server's transport, even when empty
+func (s MCPServer) MarshalJSON() ([]byte, error) {
+	if s.Type == MCPTransportHTTP || s.Type == MCPTransportSSE {
+		headers := s.Headers
+		if headers == nil {
+			headers = []HTTPHeader{}
+		}
+		return json.Marshal(struct {
+			Type    string       `json:"type"`
+			Name    string       `json:"name"`
+			URL     string       `json:"url"`
+			Headers []HTTPHeader `json:"headers"`
+		}{s.Type, s.Name, s.URL, headers})
+	}
+
+	args, env := s.Args, s.Env
+	if args == nil {
+		args = []string{}
+	}
+	if env == nil {
+		env = []EnvVariable{}
+	}
+	return json.Marshal(struct {
+		Name    string        `json:"name"`
+		Command string        `json:"command"`
+		Args    []string      `json:"args"`
+		Env     []EnvVariable `json:"env"`
+	}{s.Name, s.Command, args, env})
 }
 
 // NewSessionParams represents parameters for session/new
@@ -223,11 +440,44 @@ type NewSessionParams struct {
 
 // NewSessionResult represents the result of session/new
 type NewSessionResult struct {
-	SessionID string `json:"sessionId"`
+	SessionID string            `json:"sessionId"`
+	Modes     *SessionModeState `json:"modes,omitempty"` // Nil if the agent has no modes
 }
 
-// NewSession creates a new ACP session
-func (c *ACPClient) NewSession(workingDir string, mcpServers []MCPServer) (string, error) {
+// SessionMode is a way of working an agent offers, e.g. asking before edits or only planning
+type SessionMode struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// SessionModeState is the mode a session is in and the modes it can switch to
+type SessionModeState struct {
+	CurrentModeID  string        `json:"currentModeId"`
+	AvailableModes []SessionMode `json:"availableModes"`
+}
+
+// Has reports whether modeID is one of the available modes
+func (s *SessionModeState) Has(modeID string) bool {
+	for _, mode := range s.AvailableModes {
+		if mode.ID == modeID {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSession creates a new ACP session and returns its ID
+func (c *ACPClient) NewSession(ctx context.Context, workingDir string, mcpServers []MCPServer) (string, error) {
+	result, err := c.CreateSession(ctx, workingDir, mcpServers)
+	if err != nil {
+		return "", err
+	}
+	return result.SessionID, nil
+}
+
+// CreateSession creates a new ACP session, with the modes it starts in
+func (c *ACPClient) CreateSession(ctx context.Context, workingDir string, mcpServers []MCPServer) (*NewSessionResult, error) {
 	// Ensure mcpServers is always an array (empty if nil)
 	if mcpServers == nil {
 		mcpServers = []MCPServer{}
@@ -238,23 +488,124 @@ func (c *ACPClient) NewSession(workingDir string, mcpServers []MCPServer) (strin
 		McpServers: mcpServers,
 	}
 
-	result, err := c.jsonrpc.Call("session/new", params)
+	result, err := c.rpc().CallContext(ctx, "session/new", params)
 	if err != nil {
-		return "", fmt.Errorf("session/new failed: %w", err)
+		return nil, fmt.Errorf("session/new failed: %w", err)
 	}
 
 	var sessionResult NewSessionResult
 	if err := json.Unmarshal(result, &sessionResult); err != nil {
-		return "", fmt.Errorf("failed to parse session/new result: %w", err)
+		return nil, fmt.Errorf("failed to parse session/new result: %w", err)
+	}
+
+	return &sessionResult, nil
+}
+
+// LoadSessionParams represents parameters for session/load
+type LoadSessionParams struct {
+	SessionID  string      `json:"sessionId"`
+	Cwd        string      `json:"cwd"`
+	McpServers []MCPServer `json:"mcpServers"`
+}
+
+// LoadSessionResult represents the result of session/load
+type LoadSessionResult struct {
+	Modes *SessionModeState `json:"modes,omitempty"` // Nil if the agent has no modes
+}
+
+// LoadSession resumes a session created earlier, possibly by a previous process
+// Only call it if Capabilities().LoadSession is set. The agent replays the conversation as
+// session/update notifications before answering; we already have the history, so the replay
+// is discarded and none of it reaches listeners registered after LoadSession returns.
+func (c *ACPClient) LoadSession(ctx context.Context, sessionID, workingDir string, mcpServers []MCPServer) (*LoadSessionResult, error) {
+	if mcpServers == nil {
+		mcpServers = []MCPServer{}
+	}
+
+	// Swallow the replay
+	_, replay := c.RegisterSession(sessionID)
+	go func() {
+		for range replay {
+		}
+	}()
+	defer c.UnregisterSession(sessionID)
+
+	rpc := c.rpc()
+	result, err := rpc.CallContext(ctx, "session/load", LoadSessionParams{
+		SessionID:  sessionID,
+		Cwd:        workingDir,
+		McpServers: mcpServers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("session/load failed: %w", err)
 	}
 
-	return sessionResult.SessionID, nil
+	// Agents may answer null
+	var loadResult LoadSessionResult
+	if len(result) > 0 && string(result) != "null" {
+		if err := json.Unmarshal(result, &loadResult); err != nil {
+			return nil, fmt.Errorf("failed to parse session/load result: %w", err)
+		}
+	}
+
+	if err := rpc.waitNotificationsHandled(ctx); err != nil {
+		return nil, err
+	}
+	return &loadResult, nil
 }
 
+// SetSessionModeParams represents parameters for session/set_mode
+type SetSessionModeParams struct {
+	SessionID string `json:"sessionId"`
+	ModeID    string `json:"modeId"`
+}
+
+// SetSessionMode switches a session to one of its available modes
+// The agent may also switch on its own, it then sends a current_mode_update session/update.
+func (c *ACPClient) SetSessionMode(ctx context.Context, sessionID, modeID string) error {
+	_, err := c.rpc().CallContext(ctx, "session/set_mode", SetSessionModeParams{
+		SessionID: sessionID,
+		ModeID:    modeID,
+	})
+	if err != nil {
+		return fmt.Errorf("session/set_mode failed: %w", err)
+	}
+	return nil
+}
+
+// Content block types
+const (
+	ContentText         = "text"
+	ContentImage        = "image"
+	ContentAudio        = "audio"
+	ContentResourceLink = "resource_link"
+	ContentResource     = "resource"
+)
+
 // ContentBlock represents a block of content in a prompt
+// Which fields apply depends on Type, see the ACP content schema.
 type ContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`     // text
+	Data     string            `json:"data,omitempty"`     // image, audio: base64
+	MimeType string            `json:"mimeType,omitempty"` // image, audio, resource_link
+	URI      string            `json:"uri,omitempty"`      // resource_link, optionally image
+	Name     string            `json:"name,omitempty"`     // resource_link
+	Size     *int64            `json:"size,omitempty"`     // resource_link
+	Resource *EmbeddedResource `json:"resource,omitempty"` // resource
+}
+
+// EmbeddedResource is the content of a file included in a prompt, as text or base64 blob
+type EmbeddedResource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// TextBlock returns a text content block
+func TextBlock(text string) ContentBlock {
+	return ContentBlock{Type: ContentText, Text: text}
 }
 
 // SessionPromptParams represents parameters for session/prompt
@@ -263,28 +614,89 @@ type SessionPromptParams struct {
 	Prompt    []ContentBlock `json:"prompt"`
 }
 
+// Stop reasons of a session/prompt turn
+const (
+	StopReasonEndTurn         = "end_turn"
+	StopReasonMaxTokens       = "max_tokens"
+	StopReasonMaxTurnRequests = "max_turn_requests"
+	StopReasonRefusal         = "refusal"
+	StopReasonCancelled       = "cancelled"
+)
+
+// SessionPromptResult represents the result of session/prompt
+type SessionPromptResult struct {
+	StopReason string `json:"stopReason"`
+	Usage      *Usage `json:"usage,omitempty"` // Nil unless the agent reports it
+
+	// Duration is how long the turn took, from sending the prompt to its last update
+	Duration time.Duration `json:"-"`
+}
+
+// Usage is the token usage of a prompt turn, as reported by the agent
+type Usage struct {
+	InputTokens       int64 `json:"inputTokens"`
+	OutputTokens      int64 `json:"outputTokens"`
+	TotalTokens       int64 `json:"totalTokens,omitempty"`
+	ThoughtTokens     int64 `json:"thoughtTokens,omitempty"`
+	CachedReadTokens  int64 `json:"cachedReadTokens,omitempty"`
+	CachedWriteTokens int64 `json:"cachedWriteTokens,omitempty"`
+}
+
 // SessionPrompt sends a prompt to an ACP session
-// This method returns immediately - responses come via Notifications()
-func (c *ACPClient) SessionPrompt(sessionID, prompt string) error {
+// Blocks until the turn is over - responses stream in via RegisterSession(), and every update
+// of the turn has been routed to the session channels by the time it returns.
+// If ctx is done first, the agent is told to stop with session/cancel and ctx.Err() is returned.
+func (c *ACPClient) SessionPrompt(ctx context.Context, sessionID, prompt string) (*SessionPromptResult, error) {
+	return c.SessionPromptContent(ctx, sessionID, []ContentBlock{TextBlock(prompt)})
+}
+
+// SessionPromptContent sends a prompt made of content blocks to an ACP session, see SessionPrompt
+// Callers must only send block types allowed by the agent's PromptCapabilities.
+func (c *ACPClient) SessionPromptContent(ctx context.Context, sessionID string, prompt []ContentBlock) (*SessionPromptResult, error) {
 	params := SessionPromptParams{
 		SessionID: sessionID,
-		Prompt: []ContentBlock{
-			{
-				Type: "text",
-				Text: prompt,
-			},
-		},
+		Prompt:    prompt,
 	}
 
-	fmt.Printf("🔵 Calling session/prompt for session %s\n", sessionID)
-	result, err := c.jsonrpc.Call("session/prompt", params)
+	log.Printf("🔵 Calling session/prompt for session %s", sessionID)
+	started := time.Now()
+	rpc := c.rpc()
+	result, err := rpc.CallContext(ctx, "session/prompt", params)
 	if err != nil {
-		fmt.Printf("❌ session/prompt failed: %v\n", err)
-		return fmt.Errorf("session/prompt failed: %w", err)
+		if ctx.Err() != nil {
+			// We stopped waiting, make sure the agent stops working too
+			if cancelErr := c.CancelSession(sessionID); cancelErr != nil {
+				log.Printf("⚠️  Failed to cancel session %s: %v", sessionID, cancelErr)
+			}
+		}
+		log.Printf("❌ session/prompt failed: %v", err)
+		return nil, fmt.Errorf("session/prompt failed: %w", err)
 	}
 
-	fmt.Printf("✅ session/prompt returned: %s\n", string(result))
-	return nil
+	// The agent sent the updates of the turn before answering, wait until they are routed
+	if err := rpc.waitNotificationsHandled(ctx); err != nil {
+		return nil, fmt.Errorf("session/prompt failed: %w", err)
+	}
+
+	var promptResult SessionPromptResult
+	if err := json.Unmarshal(result, &promptResult); err != nil {
+		return nil, fmt.Errorf("failed to parse session/prompt result: %w", err)
+	}
+	promptResult.Duration = time.Since(started)
+
+	log.Printf("✅ session/prompt returned: stopReason=%s after %s", promptResult.StopReason, promptResult.Duration.Round(time.Millisecond))
+	return &promptResult, nil
+}
+
+// CancelSessionParams represents parameters for session/cancel
+type CancelSessionParams struct {
+	SessionID string `json:"sessionId"`
+}
+
+// CancelSession asks the agent to stop the ongoing prompt turn of a session
+// This is a notification: the agent acknowledges by ending the turn with stopReason "cancelled"
+func (c *ACPClient) CancelSession(sessionID string) error {
+	return c.rpc().Notify("session/cancel", CancelSessionParams{SessionID: sessionID})
 }
 
 // SessionUpdate represents a session/update notification
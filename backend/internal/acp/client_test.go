@@ -1,6 +1,7 @@
 package acp
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -26,7 +27,7 @@ func TestACPIntegration(t *testing.T) {
 
 	// Test 1: Initialize
 	t.Run("Initialize", func(t *testing.T) {
-		result, err := client.Initialize()
+		result, err := client.Initialize(context.Background())
 		if err != nil {
 			t.Fatalf("Initialize failed: %v", err)
 		}
@@ -40,7 +41,7 @@ func TestACPIntegration(t *testing.T) {
 
 	// Test 2: Create Session
 	t.Run("NewSession", func(t *testing.T) {
-		sessionID, err := client.NewSession("/tmp", nil)
+		sessionID, err := client.NewSession(context.Background(), "/tmp", nil)
 		if err != nil {
 			t.Fatalf("NewSession failed: %v", err)
 		}
@@ -55,7 +56,7 @@ func TestACPIntegration(t *testing.T) {
 	// Test 3: Send Prompt and Receive Response
 	t.Run("SessionPrompt", func(t *testing.T) {
 		// Create new session for this test
-		sessionID, err := client.NewSession("/tmp", nil)
+		sessionID, err := client.NewSession(context.Background(), "/tmp", nil)
 		if err != nil {
 			t.Fatalf("NewSession failed: %v", err)
 		}
@@ -93,7 +94,7 @@ func TestACPIntegration(t *testing.T) {
 		}()
 
 		// Send prompt
-		err = client.SessionPrompt(sessionID, "Say 'Hello from Parachute!' and nothing else.")
+		_, err = client.SessionPrompt(context.Background(), sessionID, "Say 'Hello from Parachute!' and nothing else.")
 		if err != nil {
 			t.Fatalf("SessionPrompt failed: %v", err)
 		}
@@ -0,0 +1,65 @@
+package acp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Complete runs a one-off prompt in a new session and returns the text the agent replied with
+// It is meant for side tasks like summarizing a conversation: the session gets no MCP servers
+// and every request the agent makes during the turn is refused.
+func (c *ACPClient) Complete(ctx context.Context, workingDir string, prompt []ContentBlock) (string, error) {
+	sessionID, err := c.NewSession(ctx, workingDir, nil)
+	if err != nil {
+		return "", err
+	}
+
+	requests, notifications := c.RegisterSession(sessionID)
+	defer c.UnregisterSession(sessionID)
+
+	go func() {
+		for req := range requests {
+			if req.ID == nil {
+				continue
+			}
+			c.SendError(*req.ID, &RPCError{
+				Code:    ErrCodeMethodNotFound,
+				Message: req.Method + " is not available in this session",
+			})
+		}
+	}()
+
+	reply := make(chan string, 1)
+	go func() {
+		var text strings.Builder
+		for notif := range notifications {
+			update, err := ParseSessionUpdate(notif)
+			if err != nil || update.SessionID != sessionID {
+				continue
+			}
+			if kind, _ := update.Update["sessionUpdate"].(string); kind != "agent_message_chunk" {
+				continue
+			}
+			if content, ok := update.Update["content"].(map[string]interface{}); ok {
+				if chunk, ok := content["text"].(string); ok {
+					text.WriteString(chunk)
+				}
+			}
+		}
+		reply <- text.String()
+	}()
+
+	result, err := c.SessionPromptContent(ctx, sessionID, prompt)
+	// Closing the channels lets the collector finish
+	c.UnregisterSession(sessionID)
+	text := <-reply
+	if err != nil {
+		return "", err
+	}
+	if result.StopReason == StopReasonCancelled || result.StopReason == StopReasonRefusal {
+		return "", fmt.Errorf("agent stopped with %s", result.StopReason)
+	}
+
+	return strings.TrimSpace(text), nil
+}
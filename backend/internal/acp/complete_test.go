@@ -0,0 +1,36 @@
+package acp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestComplete(t *testing.T) {
+	client, err := newACPClient(spawnHelperAgent, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// A listener of another session sees the updates too, but they don't leak into its reply
+	client.RegisterSession("session-12345678")
+	defer client.UnregisterSession("session-12345678")
+
+	for i := 0; i < 2; i++ {
+		reply, err := client.Complete(ctx, "/tmp", []ContentBlock{TextBlock("Say hello")})
+		if err != nil {
+			t.Fatalf("Complete failed: %v", err)
+		}
+		if reply != "Hello there" {
+			t.Errorf("Complete() = %q, want %q", reply, "Hello there")
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package fakeagent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+// message is any JSON-RPC message, in either direction
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *acp.RPCError   `json:"error,omitempty"`
+}
+
+// errCancelled ends a turn whose session got session/cancel
+var errCancelled = errors.New("cancelled")
+
+// errRejected ends a turn whose permission request wasn't allowed
+var errRejected = errors.New("permission not granted")
+
+// agent is a running fake agent
+type agent struct {
+	script *Script
+	out    io.Writer
+	outMu  sync.Mutex
+
+	mu       sync.Mutex
+	played   []bool
+	sessions map[string]string        // sessionId -> cwd
+	modes    map[string]string        // sessionId -> current mode
+	prompts  map[string]chan struct{} // sessionId -> closed on session/cancel
+	pending  map[int]chan *message    // Requests to the client, by ID
+	nextID   int
+}
+
+// Run plays a script, reading from in and writing to out until in is closed
+func Run(script *Script, in io.Reader, out io.Writer) error {
+	a := &agent{
+		script:   script,
+		out:      out,
+		played:   make([]bool, len(script.Turns)),
+		sessions: make(map[string]string),
+		modes:    make(map[string]string),
+		prompts:  make(map[string]chan struct{}),
+		pending:  make(map[int]chan *message),
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			logf("ignoring invalid message: %v", err)
+			continue
+		}
+
+		if msg.Method == "" {
+			a.handleResponse(&msg)
+			continue
+		}
+		a.handleRequest(&msg)
+	}
+	return scanner.Err()
+}
+
+// handleRequest answers a request or notification of the client
+func (a *agent) handleRequest(msg *message) {
+	var params struct {
+		SessionID string             `json:"sessionId"`
+		Cwd       string             `json:"cwd"`
+		Prompt    []acp.ContentBlock `json:"prompt"`
+		ModeID    string             `json:"modeId"`
+	}
+	json.Unmarshal(msg.Params, &params)
+
+	switch msg.Method {
+	case "initialize":
+		capabilities := a.script.Capabilities
+		if capabilities == nil {
+			capabilities = map[string]interface{}{
+				"loadSession":        true,
+				"promptCapabilities": map[string]interface{}{"image": true, "embeddedContext": true},
+			}
+		}
+		a.respond(msg.ID, map[string]interface{}{
+			"server_name":       "fakeagent",
+			"server_version":    "1.0",
+			"agentCapabilities": capabilities,
+		})
+
+	case "session/new":
+		a.mu.Lock()
+		sessionID := fmt.Sprintf("fake-session-%04d", len(a.sessions)+1)
+		a.sessions[sessionID] = params.Cwd
+		result := map[string]interface{}{"sessionId": sessionID}
+		if modes := a.modeState(sessionID); modes != nil {
+			result["modes"] = modes
+		}
+		a.mu.Unlock()
+		a.respond(msg.ID, result)
+
+	case "session/load":
+		a.mu.Lock()
+		a.sessions[params.SessionID] = params.Cwd
+		var result interface{}
+		if modes := a.modeState(params.SessionID); modes != nil {
+			result = map[string]interface{}{"modes": modes}
+		}
+		a.mu.Unlock()
+		a.respond(msg.ID, result)
+
+	case "session/set_mode":
+		if !a.hasMode(params.ModeID) {
+			a.write(message{ID: msg.ID, Error: &acp.RPCError{
+				Code:    acp.ErrCodeInvalidParams,
+				Message: "unknown mode: " + params.ModeID,
+			}})
+			return
+		}
+		a.mu.Lock()
+		a.modes[params.SessionID] = params.ModeID
+		a.mu.Unlock()
+		a.respond(msg.ID, map[string]interface{}{})
+
+	case "session/prompt":
+		cancel := make(chan struct{})
+		a.mu.Lock()
+		a.prompts[params.SessionID] = cancel
+		a.mu.Unlock()
+
+		// Turns make requests of their own, so the loop must keep reading meanwhile
+		go func() {
+			stopReason, usage := a.playTurn(params.SessionID, promptText(params.Prompt), cancel)
+			a.mu.Lock()
+			delete(a.prompts, params.SessionID)
+			a.mu.Unlock()
+			result := map[string]interface{}{"stopReason": stopReason}
+			if usage != nil {
+				result["usage"] = usage
+			}
+			a.respond(msg.ID, result)
+		}()
+
+	case "session/cancel":
+		a.mu.Lock()
+		if cancel, ok := a.prompts[params.SessionID]; ok {
+			close(cancel)
+			delete(a.prompts, params.SessionID)
+		}
+		a.mu.Unlock()
+
+	default:
+		if msg.ID != nil {
+			a.write(message{ID: msg.ID, Error: &acp.RPCError{
+				Code:    acp.ErrCodeMethodNotFound,
+				Message: "method not found: " + msg.Method,
+			}})
+		}
+	}
+}
+
+// modeState returns the modes of a session for session/new and session/load, a.mu must be held
+func (a *agent) modeState(sessionID string) *acp.SessionModeState {
+	if len(a.script.Modes) == 0 {
+		return nil
+	}
+	current, ok := a.modes[sessionID]
+	if !ok {
+		current = a.script.Modes[0].ID
+		a.modes[sessionID] = current
+	}
+
+	state := &acp.SessionModeState{CurrentModeID: current, AvailableModes: []acp.SessionMode{}}
+	for _, mode := range a.script.Modes {
+		state.AvailableModes = append(state.AvailableModes, acp.SessionMode{ID: mode.ID, Name: mode.Name, Description: mode.Description})
+	}
+	return state
+}
+
+// hasMode reports whether the script offers a mode
+func (a *agent) hasMode(modeID string) bool {
+	for _, mode := range a.script.Modes {
+		if mode.ID == modeID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleResponse hands the answer to a request of the agent to the turn waiting for it
+func (a *agent) handleResponse(msg *message) {
+	if msg.ID == nil {
+		return
+	}
+
+	a.mu.Lock()
+	reply, ok := a.pending[*msg.ID]
+	delete(a.pending, *msg.ID)
+	a.mu.Unlock()
+
+	if ok {
+		reply <- msg
+	}
+}
+
+// nextTurn picks the turn that answers a prompt
+func (a *agent) nextTurn(prompt string) Turn {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, turn := range a.script.Turns {
+		if !a.played[i] && strings.Contains(prompt, turn.Match) {
+			a.played[i] = true
+			return turn
+		}
+	}
+	return a.script.Turns[len(a.script.Turns)-1]
+}
+
+// playTurn runs the steps of a turn and returns its stop reason and usage
+func (a *agent) playTurn(sessionID, prompt string, cancel <-chan struct{}) (string, map[string]int64) {
+	turn := a.nextTurn(prompt)
+
+	for _, step := range turn.Steps {
+		err := a.playStep(sessionID, step, cancel)
+		if errors.Is(err, errCancelled) {
+			return acp.StopReasonCancelled, turn.Usage
+		}
+		if errors.Is(err, errRejected) {
+			break
+		}
+		if err != nil {
+			logf("step failed: %v", err)
+		}
+	}
+
+	if turn.WaitForCancel {
+		<-cancel
+		return acp.StopReasonCancelled, turn.Usage
+	}
+	if turn.StopReason != "" {
+		return turn.StopReason, turn.Usage
+	}
+	return acp.StopReasonEndTurn, turn.Usage
+}
+
+// playStep runs one step of a turn
+func (a *agent) playStep(sessionID string, step Step, cancel <-chan struct{}) error {
+	select {
+	case <-cancel:
+		return errCancelled
+	default:
+	}
+
+	switch {
+	case step.Chunk != "":
+		a.chunk(sessionID, "agent_message_chunk", step.Chunk)
+
+	case step.Thought != "":
+		a.chunk(sessionID, "agent_thought_chunk", step.Thought)
+
+	case step.ToolCall != nil:
+		update := toolCallUpdate("tool_call", *step.ToolCall)
+		if _, ok := update["status"]; !ok {
+			update["status"] = "pending"
+		}
+		a.update(sessionID, update)
+
+	case step.ToolCallUpdate != nil:
+		a.update(sessionID, toolCallUpdate("tool_call_update", *step.ToolCallUpdate))
+
+	case step.Plan != nil:
+		entries := make([]map[string]interface{}, 0, len(step.Plan))
+		for _, entry := range step.Plan {
+			entries = append(entries, map[string]interface{}{
+				"content":  entry.Content,
+				"priority": defaultString(entry.Priority, "medium"),
+				"status":   defaultString(entry.Status, "pending"),
+			})
+		}
+		a.update(sessionID, map[string]interface{}{"sessionUpdate": "plan", "entries": entries})
+
+	case step.Update != nil:
+		if modeID, ok := step.Update["currentModeId"].(string); ok && step.Update["sessionUpdate"] == "current_mode_update" {
+			a.mu.Lock()
+			a.modes[sessionID] = modeID
+			a.mu.Unlock()
+		}
+		a.update(sessionID, step.Update)
+
+	case step.Permission != nil:
+		return a.requestPermission(sessionID, *step.Permission, cancel)
+
+	case step.ReadFile != nil:
+		params := map[string]interface{}{"sessionId": sessionID, "path": a.resolve(sessionID, step.ReadFile.Path)}
+		if step.ReadFile.Line > 0 {
+			params["line"] = step.ReadFile.Line
+		}
+		if step.ReadFile.Limit > 0 {
+			params["limit"] = step.ReadFile.Limit
+		}
+
+		reply, err := a.call(acp.MethodReadTextFile, params, cancel)
+		if err != nil {
+			if step.ReadFile.Echo && !errors.Is(err, errCancelled) {
+				a.chunk(sessionID, "agent_message_chunk", "[read failed: "+err.Error()+"]")
+			}
+			return err
+		}
+		if step.ReadFile.Echo {
+			var result acp.ReadTextFileResponse
+			json.Unmarshal(reply, &result)
+			a.chunk(sessionID, "agent_message_chunk", result.Content)
+		}
+
+	case step.WriteFile != nil:
+		_, err := a.call(acp.MethodWriteTextFile, map[string]interface{}{
+			"sessionId": sessionID,
+			"path":      a.resolve(sessionID, step.WriteFile.Path),
+			"content":   step.WriteFile.Content,
+		}, cancel)
+		return err
+
+	case step.Sleep != "":
+		d, _ := time.ParseDuration(step.Sleep)
+		select {
+		case <-time.After(d):
+		case <-cancel:
+			return errCancelled
+		}
+	}
+	return nil
+}
+
+// requestPermission asks the client to allow a tool call, errRejected unless an allow option is picked
+func (a *agent) requestPermission(sessionID string, permission Permission, cancel <-chan struct{}) error {
+	options := permission.Options
+	if len(options) == 0 {
+		options = []PermissionOption{
+			{ID: "allow", Name: "Allow", Kind: "allow_once"},
+			{ID: "reject", Name: "Reject", Kind: "reject_once"},
+		}
+	}
+
+	wireOptions := make([]acp.PermissionOption, 0, len(options))
+	kinds := make(map[string]string, len(options))
+	for _, option := range options {
+		wireOptions = append(wireOptions, acp.PermissionOption{OptionID: option.ID, Name: option.Name, Kind: option.Kind})
+		kinds[option.ID] = option.Kind
+	}
+
+	rawInput := permission.ToolCall.RawInput
+	if rawInput == nil {
+		rawInput = map[string]interface{}{}
+	}
+	reply, err := a.call("session/request_permission", acp.PermissionRequest{
+		SessionID: sessionID,
+		ToolCall: acp.ToolCallInfo{
+			ToolCallID: permission.ToolCall.ID,
+			Title:      permission.ToolCall.Title,
+			Kind:       permission.ToolCall.Kind,
+			RawInput:   rawInput,
+		},
+		Options: wireOptions,
+	}, cancel)
+	if err != nil {
+		return err
+	}
+
+	var response acp.PermissionResponse
+	if err := json.Unmarshal(reply, &response); err != nil {
+		return fmt.Errorf("invalid permission response: %w", err)
+	}
+	if response.Outcome.Outcome == "cancelled" {
+		return errCancelled
+	}
+	if !strings.HasPrefix(kinds[response.Outcome.OptionID], "allow") {
+		return errRejected
+	}
+	return nil
+}
+
+// call sends a request to the client and waits for its result
+func (a *agent) call(method string, params interface{}, cancel <-chan struct{}) (json.RawMessage, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := make(chan *message, 1)
+	a.mu.Lock()
+	a.nextID++
+	id := a.nextID
+	a.pending[id] = reply
+	a.mu.Unlock()
+
+	a.write(message{ID: &id, Method: method, Params: data})
+
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return nil, fmt.Errorf("%s failed: %s", method, msg.Error.Message)
+		}
+		return msg.Result, nil
+	case <-cancel:
+		return nil, errCancelled
+	}
+}
+
+// chunk sends a text chunk of the given kind
+func (a *agent) chunk(sessionID, kind, text string) {
+	a.update(sessionID, map[string]interface{}{
+		"sessionUpdate": kind,
+		"content":       map[string]interface{}{"type": "text", "text": text},
+	})
+}
+
+// update sends a session/update notification
+func (a *agent) update(sessionID string, update map[string]interface{}) {
+	params, _ := json.Marshal(map[string]interface{}{"sessionId": sessionID, "update": update})
+	a.write(message{Method: "session/update", Params: params})
+}
+
+// respond answers a request of the client
+func (a *agent) respond(id *int, result interface{}) {
+	if id == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		logf("failed to encode result: %v", err)
+		return
+	}
+	a.write(message{ID: id, Result: data})
+}
+
+// write sends one message, messages are never interleaved
+func (a *agent) write(msg message) {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logf("failed to encode message: %v", err)
+		return
+	}
+
+	a.outMu.Lock()
+	defer a.outMu.Unlock()
+	a.out.Write(append(data, '\n'))
+}
+
+// resolve makes a script path absolute in the folder of a session
+func (a *agent) resolve(sessionID, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return filepath.Join(a.sessions[sessionID], path)
+}
+
+// logf writes a diagnostic to stderr, which the backend keeps in the agent's stderr tail
+func logf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "fakeagent: "+format+"\n", args...)
+}
+
+// toolCallUpdate builds a tool_call or tool_call_update notification
+func toolCallUpdate(kind string, call ToolCall) map[string]interface{} {
+	update := map[string]interface{}{"sessionUpdate": kind, "toolCallId": call.ID}
+	if call.Title != "" {
+		update["title"] = call.Title
+	}
+	if call.Kind != "" {
+		update["kind"] = call.Kind
+	}
+	if call.Status != "" {
+		update["status"] = call.Status
+	}
+	if call.RawInput != nil {
+		update["rawInput"] = call.RawInput
+	}
+	return update
+}
+
+// promptText joins the text blocks of a prompt
+func promptText(prompt []acp.ContentBlock) string {
+	var b strings.Builder
+	for _, block := range prompt {
+		if block.Type == acp.ContentText {
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String()
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,359 @@
+package fakeagent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+func TestMain(m *testing.M) {
+	RunIfRequested()
+	os.Exit(m.Run())
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{name: "yaml", script: "turns:\n  - steps:\n      - chunk: hi\n"},
+		{name: "json", script: `{"turns": [{"match": "x", "steps": [{"sleep": "1ms"}]}]}`},
+		{name: "no turns", script: "capabilities: {}\n", wantErr: "no turns"},
+		{name: "empty step", script: "turns:\n  - steps:\n      - {}\n", wantErr: "exactly one thing"},
+		{name: "two things", script: "turns:\n  - steps:\n      - {chunk: a, thought: b}\n", wantErr: "exactly one thing"},
+		{name: "bad sleep", script: "turns:\n  - steps:\n      - sleep: soon\n", wantErr: "invalid sleep"},
+		{name: "tool call id", script: "turns:\n  - steps:\n      - tool_call: {title: Read}\n", wantErr: "need an id"},
+		{name: "file path", script: "turns:\n  - steps:\n      - read_file: {echo: true}\n", wantErr: "need a path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScript([]byte(tt.script))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ParseScript() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ParseScript() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExampleScript(t *testing.T) {
+	script, err := LoadScript(filepath.Join("testdata", "hello.yaml"))
+	if err != nil {
+		t.Fatalf("LoadScript() error = %v", err)
+	}
+	if len(script.Turns) != 3 {
+		t.Errorf("got %d turns, want 3", len(script.Turns))
+	}
+	if len(script.Modes) != 3 {
+		t.Errorf("got %d modes, want 3", len(script.Modes))
+	}
+}
+
+// startAgent launches the test binary as a fake agent playing script, with a session in dir
+func startAgent(t *testing.T, script, dir string) (*acp.ACPClient, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script.yaml")
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := acp.NewAgentClient(TestAgent(path))
+	if err != nil {
+		t.Fatalf("NewAgentClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	sessionID, err := client.NewSession(ctx, dir, nil)
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	return client, sessionID
+}
+
+func TestAgentPlaysScript(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.md"), []byte("remember the milk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, sessionID := startAgent(t, `
+turns:
+  - match: notes
+    steps:
+      - chunk: "Reading. "
+      - tool_call: {id: read-1, title: Read notes.md, kind: read}
+      - permission: {tool_call: {id: read-1, title: Read notes.md, kind: read}}
+      - read_file: {path: notes.md, echo: true}
+      - write_file: {path: todo.md, content: "- milk\n"}
+      - tool_call_update: {id: read-1, status: completed}
+  - steps:
+      - permission: {tool_call: {id: edit-1, title: Edit, kind: edit}}
+      - chunk: never sent
+`, dir)
+
+	requests, notifications := client.RegisterSession(sessionID)
+	defer client.UnregisterSession(sessionID)
+
+	// Allow the first permission request and reject the second, serve fs/* from disk
+	permissions := 0
+	go func() {
+		for req := range requests {
+			switch req.Method {
+			case "session/request_permission":
+				permissions++
+				option := "allow"
+				if permissions > 1 {
+					option = "reject"
+				}
+				client.SendResponse(*req.ID, acp.NewSelectedOutcome(option))
+			case acp.MethodReadTextFile:
+				read, _ := acp.ParseReadTextFileRequest(req)
+				content, _ := os.ReadFile(read.Path)
+				client.SendResponse(*req.ID, acp.ReadTextFileResponse{Content: string(content)})
+			case acp.MethodWriteTextFile:
+				write, _ := acp.ParseWriteTextFileRequest(req)
+				os.WriteFile(write.Path, []byte(write.Content), 0644)
+				client.SendResponse(*req.ID, nil)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := client.SessionPrompt(ctx, sessionID, "summarize my notes")
+	if err != nil {
+		t.Fatalf("SessionPrompt() error = %v", err)
+	}
+	if result.StopReason != acp.StopReasonEndTurn {
+		t.Errorf("StopReason = %q, want end_turn", result.StopReason)
+	}
+
+	// Notifications are routed asynchronously, they may trail the end of the turn a little
+	var kinds, text []string
+	for len(kinds) < 4 {
+		var notif *acp.JSONRPCNotification
+		select {
+		case notif = <-notifications:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got updates %v, want 4", kinds)
+		}
+		update, err := acp.ParseSessionUpdate(notif)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, update.Update["sessionUpdate"].(string))
+		if content, ok := update.Update["content"].(map[string]interface{}); ok {
+			text = append(text, content["text"].(string))
+		}
+	}
+	if got, want := strings.Join(kinds, ","), "agent_message_chunk,tool_call,agent_message_chunk,tool_call_update"; got != want {
+		t.Errorf("updates = %s, want %s", got, want)
+	}
+	if got := strings.Join(text, ""); got != "Reading. remember the milk" {
+		t.Errorf("text = %q", got)
+	}
+	if written, _ := os.ReadFile(filepath.Join(dir, "todo.md")); string(written) != "- milk\n" {
+		t.Errorf("todo.md = %q", written)
+	}
+
+	// The second turn stops at the rejected permission
+	if _, err := client.SessionPrompt(ctx, sessionID, "edit something"); err != nil {
+		t.Fatalf("SessionPrompt() error = %v", err)
+	}
+	select {
+	case notif := <-notifications:
+		t.Errorf("got update %s after a rejected permission, want none", notif.Params)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAgentWaitsForCancel(t *testing.T) {
+	client, sessionID := startAgent(t, `
+turns:
+  - wait_for_cancel: true
+    steps:
+      - chunk: thinking
+`, t.TempDir())
+
+	_, notifications := client.RegisterSession(sessionID)
+	defer client.UnregisterSession(sessionID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	go func() {
+		<-notifications
+		client.CancelSession(sessionID)
+	}()
+
+	result, err := client.SessionPrompt(ctx, sessionID, "go")
+	if err != nil {
+		t.Fatalf("SessionPrompt() error = %v", err)
+	}
+	if result.StopReason != acp.StopReasonCancelled {
+		t.Errorf("StopReason = %q, want cancelled", result.StopReason)
+	}
+}
+
+func TestAgentSessionModes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.yaml")
+	script := `
+modes:
+  - {id: default, name: Default}
+  - {id: plan, name: Plan Mode}
+turns:
+  - steps:
+      - update: {sessionUpdate: current_mode_update, currentModeId: default}
+`
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := acp.NewAgentClient(TestAgent(path))
+	if err != nil {
+		t.Fatalf("NewAgentClient() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	session, err := client.CreateSession(ctx, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	if session.Modes == nil || session.Modes.CurrentModeID != "default" || !session.Modes.Has("plan") {
+		t.Fatalf("Modes = %+v, want default of default and plan", session.Modes)
+	}
+
+	if err := client.SetSessionMode(ctx, session.SessionID, "plan"); err != nil {
+		t.Fatalf("SetSessionMode(plan) error = %v", err)
+	}
+	if err := client.SetSessionMode(ctx, session.SessionID, "yolo"); err == nil {
+		t.Error("SetSessionMode(yolo) should fail")
+	}
+
+	loaded, err := client.LoadSession(ctx, session.SessionID, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("LoadSession() error = %v", err)
+	}
+	if loaded.Modes == nil || loaded.Modes.CurrentModeID != "plan" {
+		t.Errorf("Modes after load = %+v, want plan", loaded.Modes)
+	}
+
+	// The agent leaves plan mode on its own
+	_, notifications := client.RegisterSession(session.SessionID)
+	defer client.UnregisterSession(session.SessionID)
+	if _, err := client.SessionPrompt(ctx, session.SessionID, "go"); err != nil {
+		t.Fatalf("SessionPrompt() error = %v", err)
+	}
+	update, err := acp.ParseSessionUpdate(<-notifications)
+	if err != nil || update.Update["currentModeId"] != "default" {
+		t.Errorf("update = %+v, %v, want current_mode_update to default", update, err)
+	}
+}
+
+func TestReplayReproducesRecordedSession(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.md"), []byte("remember the milk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scriptPath := filepath.Join(t.TempDir(), "script.yaml")
+	script := `
+turns:
+  - steps:
+      - chunk: "Reading. "
+      - permission: {tool_call: {id: read-1, title: Read notes.md, kind: read}}
+      - read_file: {path: notes.md, echo: true}
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// run prompts a new session of an agent once, answering its requests, and returns what it streamed
+	run := func(config acp.AgentConfig, tracer *acp.Tracer) (sessionID, text, stopReason string) {
+		t.Helper()
+		client, err := acp.NewAgentClient(config)
+		if err != nil {
+			t.Fatalf("NewAgentClient() error = %v", err)
+		}
+		defer client.Close()
+		client.SetTracer(tracer)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := client.Initialize(ctx); err != nil {
+			t.Fatalf("Initialize() error = %v", err)
+		}
+		sessionID, err = client.NewSession(ctx, dir, nil)
+		if err != nil {
+			t.Fatalf("NewSession() error = %v", err)
+		}
+
+		requests, notifications := client.RegisterSession(sessionID)
+		defer client.UnregisterSession(sessionID)
+		go func() {
+			for req := range requests {
+				switch req.Method {
+				case "session/request_permission":
+					client.SendResponse(*req.ID, acp.NewSelectedOutcome("allow"))
+				case acp.MethodReadTextFile:
+					read, _ := acp.ParseReadTextFileRequest(req)
+					content, _ := os.ReadFile(read.Path)
+					client.SendResponse(*req.ID, acp.ReadTextFileResponse{Content: string(content)})
+				}
+			}
+		}()
+
+		result, err := client.SessionPrompt(ctx, sessionID, "read my notes")
+		if err != nil {
+			t.Fatalf("SessionPrompt() error = %v", err)
+		}
+
+		// SessionPrompt returns once the updates of the turn are routed
+		var b strings.Builder
+		for len(notifications) > 0 {
+			update, _ := acp.ParseSessionUpdate(<-notifications)
+			if content, ok := update.Update["content"].(map[string]interface{}); ok {
+				b.WriteString(content["text"].(string))
+			}
+		}
+		return sessionID, b.String(), result.StopReason
+	}
+
+	tracer := acp.NewTracer(t.TempDir())
+	sessionID, text, stopReason := run(TestAgent(scriptPath), tracer)
+	if text != "Reading. remember the milk" {
+		t.Fatalf("recorded text = %q", text)
+	}
+
+	tracePath, err := tracer.Path(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayedID, replayedText, replayedStop := run(ReplayAgent(tracePath), nil)
+	if replayedID != sessionID || replayedText != text || replayedStop != stopReason {
+		t.Errorf("replay = (%s, %q, %s), want (%s, %q, %s)", replayedID, replayedText, replayedStop, sessionID, text, stopReason)
+	}
+}
@@ -0,0 +1,90 @@
+package fakeagent
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+// Replay plays back the agent's side of a trace recorded by acp.Tracer, reading from in and
+// writing to out until in is closed
+//
+// Entries are replayed in order: the agent's messages are sent as recorded, and each message
+// the backend sent is waited for before going on. Responses are renumbered to answer the IDs
+// the backend uses now. Messages that differ from the recording are logged, not refused, and
+// requests that come after the end of the trace get an error.
+func Replay(entries []acp.TraceEntry, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	ids := make(map[int]int) // Recorded ID of a backend request -> ID it has now
+	for i, entry := range entries {
+		var recorded message
+		if err := json.Unmarshal(entry.Message, &recorded); err != nil {
+			logf("skipping invalid trace entry %d: %v", i+1, err)
+			continue
+		}
+
+		switch entry.Direction {
+		case acp.TraceOut:
+			if !scanner.Scan() {
+				return scanner.Err()
+			}
+			var live message
+			if err := json.Unmarshal(scanner.Bytes(), &live); err != nil {
+				logf("entry %d: invalid message: %v", i+1, err)
+				continue
+			}
+			if live.Method != recorded.Method {
+				logf("entry %d: expected %q, got %q", i+1, recorded.Method, live.Method)
+			}
+			if recorded.Method != "" && recorded.ID != nil && live.ID != nil {
+				ids[*recorded.ID] = *live.ID
+			}
+
+		case acp.TraceIn:
+			data := []byte(entry.Message)
+			if recorded.Method == "" && recorded.ID != nil {
+				if id, ok := ids[*recorded.ID]; ok && id != *recorded.ID {
+					data = renumber(entry.Message, id)
+				}
+			}
+			if _, err := out.Write(append(data, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The trace is over, refuse what comes next rather than leave it hanging
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.Method == "" || msg.ID == nil {
+			continue
+		}
+		logf("trace is over, refusing %s", msg.Method)
+		data, _ := json.Marshal(message{JSONRPC: "2.0", ID: msg.ID, Error: &acp.RPCError{
+			Code:    acp.ErrCodeInternal,
+			Message: "replay finished",
+		}})
+		if _, err := out.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// renumber replaces the id of a message
+func renumber(data json.RawMessage, id int) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data
+	}
+	fields["id"], _ = json.Marshal(id)
+	renumbered, err := json.Marshal(fields)
+	if err != nil {
+		return data
+	}
+	return renumbered
+}
@@ -0,0 +1,177 @@
+// Package fakeagent is a scriptable ACP agent, for tests that exercise the backend without a
+// real agent or network
+//
+// The agent speaks ACP over stdio and plays a script: for each session/prompt it runs the steps
+// of a turn, which stream session/update notifications and make requests to the client, such as
+// session/request_permission and fs/* calls. It can also replay a trace recorded by acp.Tracer,
+// to reproduce what a real agent did.
+package fakeagent
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Script is what a fake agent does, loaded from YAML or JSON
+//
+//	turns:
+//	  - match: "notes"            # only for prompts containing this text
+//	    steps:
+//	      - chunk: "Let me look."
+//	      - tool_call: {id: read-1, title: Read notes.md, kind: read}
+//	      - read_file: {path: notes.md, echo: true}
+//	      - tool_call_update: {id: read-1, status: completed}
+//	  - steps:
+//	      - permission: {tool_call: {id: edit-1, title: Edit todo.md, kind: edit}}
+//	      - write_file: {path: todo.md, content: "- [x] done\n"}
+//	      - chunk: "Done."
+type Script struct {
+	// Capabilities are the agentCapabilities answered at initialize, a sensible default if empty
+	Capabilities map[string]interface{} `yaml:"capabilities"`
+	// Modes are the session modes offered by session/new and session/load, sessions start in
+	// the first one. A step can switch modes with an update of kind current_mode_update.
+	Modes []Mode `yaml:"modes"`
+	Turns []Turn `yaml:"turns"`
+}
+
+// Mode is a session mode the agent offers
+type Mode struct {
+	ID          string `yaml:"id"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+// Turn is the answer to one session/prompt
+// Prompts take the first turn not played yet whose match is in the prompt text; once every turn
+// was played, the last one is played again.
+type Turn struct {
+	Match         string `yaml:"match"` // Substring of the prompt text, empty matches any prompt
+	Steps         []Step `yaml:"steps"`
+	StopReason    string `yaml:"stop_reason"`     // Defaults to end_turn
+	WaitForCancel bool   `yaml:"wait_for_cancel"` // After the steps, hold the turn until session/cancel
+	// Usage is reported in the session/prompt result, e.g. {inputTokens: 120, outputTokens: 40}
+	Usage map[string]int64 `yaml:"usage"`
+}
+
+// Step is one thing the agent does during a turn, exactly one field is set
+type Step struct {
+	Chunk          string                 `yaml:"chunk"`   // agent_message_chunk
+	Thought        string                 `yaml:"thought"` // agent_thought_chunk
+	ToolCall       *ToolCall              `yaml:"tool_call"`
+	ToolCallUpdate *ToolCall              `yaml:"tool_call_update"`
+	Plan           []PlanEntry            `yaml:"plan"`
+	Update         map[string]interface{} `yaml:"update"` // Any other session/update, sent as is
+	Permission     *Permission            `yaml:"permission"`
+	ReadFile       *ReadFile              `yaml:"read_file"`
+	WriteFile      *WriteFile             `yaml:"write_file"`
+	Sleep          string                 `yaml:"sleep"` // Go duration, e.g. "100ms"
+}
+
+// ToolCall is a tool_call or tool_call_update notification
+type ToolCall struct {
+	ID       string                 `yaml:"id"`
+	Title    string                 `yaml:"title"`
+	Kind     string                 `yaml:"kind"`
+	Status   string                 `yaml:"status"` // Defaults to pending for tool_call
+	RawInput map[string]interface{} `yaml:"raw_input"`
+}
+
+// PlanEntry is one entry of a plan notification
+type PlanEntry struct {
+	Content  string `yaml:"content"`
+	Priority string `yaml:"priority"` // Defaults to medium
+	Status   string `yaml:"status"`   // Defaults to pending
+}
+
+// Permission asks the client to allow a tool call; if it isn't allowed, the rest of the turn is skipped
+type Permission struct {
+	ToolCall ToolCall           `yaml:"tool_call"`
+	Options  []PermissionOption `yaml:"options"` // Defaults to allow_once and reject_once
+}
+
+// PermissionOption is an option offered in a permission request
+type PermissionOption struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"` // allow_once, allow_always, reject_once, reject_always
+}
+
+// ReadFile calls fs/read_text_file, a relative path is resolved in the session folder
+type ReadFile struct {
+	Path  string `yaml:"path"`
+	Line  int    `yaml:"line"`
+	Limit int    `yaml:"limit"`
+	Echo  bool   `yaml:"echo"` // Stream what was read, or the error, as a message chunk
+}
+
+// WriteFile calls fs/write_text_file, a relative path is resolved in the session folder
+type WriteFile struct {
+	Path    string `yaml:"path"`
+	Content string `yaml:"content"`
+}
+
+// LoadScript reads a script from a YAML or JSON file
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	return ParseScript(data)
+}
+
+// ParseScript decodes a YAML or JSON script and checks it
+func ParseScript(data []byte) (*Script, error) {
+	var script Script
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	if len(script.Turns) == 0 {
+		return nil, fmt.Errorf("invalid script: no turns")
+	}
+	for i, mode := range script.Modes {
+		if mode.ID == "" {
+			return nil, fmt.Errorf("invalid script: mode %d needs an id", i+1)
+		}
+	}
+
+	for i, turn := range script.Turns {
+		for j, step := range turn.Steps {
+			if err := step.validate(); err != nil {
+				return nil, fmt.Errorf("invalid script: turn %d, step %d: %w", i+1, j+1, err)
+			}
+		}
+	}
+	return &script, nil
+}
+
+// validate checks that a step does exactly one thing
+func (s *Step) validate() error {
+	set := 0
+	for _, isSet := range []bool{
+		s.Chunk != "", s.Thought != "", s.ToolCall != nil, s.ToolCallUpdate != nil, s.Plan != nil,
+		s.Update != nil, s.Permission != nil, s.ReadFile != nil, s.WriteFile != nil, s.Sleep != "",
+	} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("a step must do exactly one thing, it does %d", set)
+	}
+
+	if s.Sleep != "" {
+		if _, err := time.ParseDuration(s.Sleep); err != nil {
+			return fmt.Errorf("invalid sleep: %w", err)
+		}
+	}
+	if s.ToolCall != nil && s.ToolCall.ID == "" || s.ToolCallUpdate != nil && s.ToolCallUpdate.ID == "" {
+		return fmt.Errorf("tool calls need an id")
+	}
+	if s.ReadFile != nil && s.ReadFile.Path == "" || s.WriteFile != nil && s.WriteFile.Path == "" {
+		return fmt.Errorf("file steps need a path")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package fakeagent
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+// Set to make a test binary act as the fake agent
+const (
+	EnvScript = "FAKE_ACP_AGENT_SCRIPT" // Path of a script to play
+	EnvTrace  = "FAKE_ACP_AGENT_TRACE"  // Path of a trace to replay
+)
+
+// RunIfRequested plays the script named by EnvScript, or replays the trace named by EnvTrace,
+// on stdin and stdout and exits, if either is set
+// Call it first in TestMain, so TestAgent and ReplayAgent can launch the test binary itself.
+func RunIfRequested() {
+	var err error
+	switch {
+	case os.Getenv(EnvScript) != "":
+		var script *Script
+		if script, err = LoadScript(os.Getenv(EnvScript)); err == nil {
+			err = Run(script, os.Stdin, os.Stdout)
+		}
+	case os.Getenv(EnvTrace) != "":
+		var entries []acp.TraceEntry
+		if entries, err = acp.LoadTrace(os.Getenv(EnvTrace)); err == nil {
+			err = Replay(entries, os.Stdin, os.Stdout)
+		}
+	default:
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fakeagent: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// TestAgent is an agent that re-runs the current test binary as a fake agent playing a script
+// The test binary must call RunIfRequested from TestMain.
+func TestAgent(scriptPath string) acp.AgentConfig {
+	return acp.AgentConfig{
+		Name:    "fake",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{EnvScript: scriptPath},
+	}
+}
+
+// ReplayAgent is an agent that re-runs the current test binary to replay a trace
+// The test binary must call RunIfRequested from TestMain.
+func ReplayAgent(tracePath string) acp.AgentConfig {
+	return acp.AgentConfig{
+		Name:    "replay",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{EnvTrace: tracePath},
+	}
+}
@@ -0,0 +1,143 @@
+package fakeagent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+const transportScript = `
+turns:
+  - steps:
+      - chunk: "hello from afar"
+`
+
+// promptOver runs a turn of transportScript with an agent reached through config
+func promptOver(t *testing.T, config acp.AgentConfig) {
+	t.Helper()
+
+	client, err := acp.NewAgentClient(config)
+	if err != nil {
+		t.Fatalf("NewAgentClient() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	reply, err := client.Complete(ctx, t.TempDir(), []acp.ContentBlock{acp.TextBlock("hi")})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if reply != "hello from afar" {
+		t.Errorf("reply = %q", reply)
+	}
+}
+
+func TestAgentOverUnixSocket(t *testing.T) {
+	script, err := ParseScript([]byte(transportScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Socket paths are short, keep it out of the long test temp dir
+	dir, err := os.MkdirTemp("", "acp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "agent.sock")
+
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				Run(script, conn, conn)
+			}()
+		}
+	}()
+
+	promptOver(t, acp.AgentConfig{Name: "remote", Transport: acp.TransportUnix, Address: sock})
+}
+
+// wsWriter sends each write as one text message, Run writes one message at a time
+type wsWriter struct {
+	conn *websocket.Conn
+}
+
+func (w wsWriter) Write(p []byte) (int, error) {
+	if err := w.conn.WriteMessage(websocket.TextMessage, bytes.TrimSpace(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func TestAgentOverWebSocket(t *testing.T) {
+	script, err := ParseScript([]byte(transportScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// Feed incoming messages to the agent as lines
+		in, feed := io.Pipe()
+		go func() {
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					feed.Close()
+					return
+				}
+				feed.Write(append(data, '\n'))
+			}
+		}()
+		Run(script, in, wsWriter{conn})
+	}))
+	defer server.Close()
+
+	address := "ws" + strings.TrimPrefix(server.URL, "http")
+	if _, err := acp.NewAgentClient(acp.AgentConfig{Name: "remote", Transport: acp.TransportWebSocket, Address: address}); err == nil {
+		t.Error("NewAgentClient() without the token should fail")
+	}
+
+	promptOver(t, acp.AgentConfig{
+		Name:      "remote",
+		Transport: acp.TransportWebSocket,
+		Address:   address,
+		Headers:   map[string]string{"Authorization": "Bearer secret"},
+	})
+}
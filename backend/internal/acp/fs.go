@@ -0,0 +1,60 @@
+package acp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Client methods the agent calls to use Parachute's view of the filesystem
+const (
+	MethodReadTextFile  = "fs/read_text_file"
+	MethodWriteTextFile = "fs/write_text_file"
+)
+
+// ReadTextFileRequest represents an fs/read_text_file request
+type ReadTextFileRequest struct {
+	SessionID string `json:"sessionId"`
+	Path      string `json:"path"`            // Absolute path
+	Line      *int   `json:"line,omitempty"`  // 1-based line to start reading at
+	Limit     *int   `json:"limit,omitempty"` // Maximum number of lines to read
+}
+
+// ReadTextFileResponse is what we send back for fs/read_text_file
+type ReadTextFileResponse struct {
+	Content string `json:"content"`
+}
+
+// WriteTextFileRequest represents an fs/write_text_file request
+type WriteTextFileRequest struct {
+	SessionID string `json:"sessionId"`
+	Path      string `json:"path"` // Absolute path
+	Content   string `json:"content"`
+}
+
+// ParseReadTextFileRequest parses an fs/read_text_file request
+func ParseReadTextFileRequest(req *JSONRPCIncomingRequest) (*ReadTextFileRequest, error) {
+	if req.Method != MethodReadTextFile {
+		return nil, fmt.Errorf("not a read_text_file request: %s", req.Method)
+	}
+
+	var readReq ReadTextFileRequest
+	if err := json.Unmarshal(req.Params, &readReq); err != nil {
+		return nil, fmt.Errorf("failed to parse read_text_file request: %w", err)
+	}
+
+	return &readReq, nil
+}
+
+// ParseWriteTextFileRequest parses an fs/write_text_file request
+func ParseWriteTextFileRequest(req *JSONRPCIncomingRequest) (*WriteTextFileRequest, error) {
+	if req.Method != MethodWriteTextFile {
+		return nil, fmt.Errorf("not a write_text_file request: %s", req.Method)
+	}
+
+	var writeReq WriteTextFileRequest
+	if err := json.Unmarshal(req.Params, &writeReq); err != nil {
+		return nil, fmt.Errorf("failed to parse write_text_file request: %w", err)
+	}
+
+	return &writeReq, nil
+}
@@ -1,12 +1,15 @@
 package acp
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"log"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // JSONRPCRequest represents a JSON-RPC 2.0 request
@@ -51,23 +54,44 @@ func (e *RPCError) Error() string {
 	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
 }
 
-// JSONRPCClient manages JSON-RPC communication with ACP process
+// JSON-RPC error codes we answer requests from the agent with
+const (
+	ErrCodeMethodNotFound   = -32601
+	ErrCodeInvalidParams    = -32602
+	ErrCodeInternal         = -32603
+	ErrCodeResourceNotFound = -32002 // ACP: the requested file does not exist
+)
+
+// ErrConnectionClosed is returned by calls that were in flight, or made, after the ACP process exited
+var ErrConnectionClosed = errors.New("ACP connection closed")
+
+// JSONRPCClient manages JSON-RPC communication with an agent over a Transport
 type JSONRPCClient struct {
-	process       *ACPProcess
+	transport     Transport
 	nextID        atomic.Int32
 	pendingCalls  map[int]chan *JSONRPCResponse
 	mu            sync.Mutex
 	notifications chan *JSONRPCNotification
 	requests      chan *JSONRPCIncomingRequest
+	closed        chan struct{} // Closed when the read loop exits
+
+	// Notification accounting, lets a caller wait until the notifications that preceded
+	// a response have been handled by the consumer of Notifications()
+	notificationsQueued  atomic.Uint64
+	notificationsHandled atomic.Uint64
+
+	// Recorder of the traffic, nil unless tracing is on
+	trace atomic.Pointer[connTrace]
 }
 
-// NewJSONRPCClient creates a new JSON-RPC client for the ACP process
-func NewJSONRPCClient(process *ACPProcess) *JSONRPCClient {
+// NewJSONRPCClient creates a new JSON-RPC client for the connection to an agent
+func NewJSONRPCClient(transport Transport) *JSONRPCClient {
 	client := &JSONRPCClient{
-		process:       process,
+		transport:     transport,
 		pendingCalls:  make(map[int]chan *JSONRPCResponse),
 		notifications: make(chan *JSONRPCNotification, 100),
 		requests:      make(chan *JSONRPCIncomingRequest, 100),
+		closed:        make(chan struct{}),
 	}
 
 	// Start reading responses in background
@@ -76,8 +100,26 @@ func NewJSONRPCClient(process *ACPProcess) *JSONRPCClient {
 	return client
 }
 
+// setTracer records the traffic of the connection from now on, if tracer isn't nil
+func (c *JSONRPCClient) setTracer(tracer *Tracer) {
+	if tracer != nil {
+		c.trace.Store(newConnTrace(tracer))
+	}
+}
+
 // Call sends a JSON-RPC request and waits for the response
+// Prefer CallContext, Call waits as long as the process is alive
 func (c *JSONRPCClient) Call(method string, params interface{}) (json.RawMessage, error) {
+	return c.CallContext(context.Background(), method, params)
+}
+
+// CallContext sends a JSON-RPC request and waits for the response, the process to exit
+// or ctx to be done, whichever comes first. A late response to a cancelled call is dropped.
+func (c *JSONRPCClient) CallContext(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Generate request ID
 	id := int(c.nextID.Add(1))
 
@@ -102,23 +144,19 @@ func (c *JSONRPCClient) Call(method string, params interface{}) (json.RawMessage
 		Params:  params,
 	}
 
-	// Marshal to JSON
-	data, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// Send request (with newline delimiter)
-	c.process.mu.Lock()
-	_, err = c.process.stdin.Write(append(data, '\n'))
-	c.process.mu.Unlock()
-
-	if err != nil {
+	if err := c.write(req); err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	// Wait for response
-	resp := <-respChan
+	// Wait for response, the process to go away or the caller to give up
+	var resp *JSONRPCResponse
+	select {
+	case resp = <-respChan:
+	case <-c.closed:
+		return nil, ErrConnectionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
 	// Check for error
 	if resp.Error != nil {
@@ -128,12 +166,65 @@ func (c *JSONRPCClient) Call(method string, params interface{}) (json.RawMessage
 	return resp.Result, nil
 }
 
+// Notify sends a JSON-RPC notification, which has no ID and gets no response
+func (c *JSONRPCClient) Notify(method string, params interface{}) error {
+	notif := struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	}
+
+	if err := c.write(notif); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	return nil
+}
+
+// write sends one JSON message to the agent
+func (c *JSONRPCClient) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	if c.isClosed() {
+		return ErrConnectionClosed
+	}
+
+	// Traced before it is sent, the answer may be read before Write returns
+	if trace := c.trace.Load(); trace != nil {
+		trace.record(TraceOut, data)
+	}
+
+	return c.transport.Send(data)
+}
+
+// Done returns a channel that is closed when the connection to the process is lost
+func (c *JSONRPCClient) Done() <-chan struct{} {
+	return c.closed
+}
+
+func (c *JSONRPCClient) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 // Notifications returns a channel that receives JSON-RPC notifications
+// The channel is closed when the connection is lost
 func (c *JSONRPCClient) Notifications() <-chan *JSONRPCNotification {
 	return c.notifications
 }
 
 // Requests returns a channel that receives JSON-RPC requests from the server
+// The channel is closed when the connection is lost
 func (c *JSONRPCClient) Requests() <-chan *JSONRPCIncomingRequest {
 	return c.requests
 }
@@ -146,49 +237,78 @@ func (c *JSONRPCClient) SendResponse(id int, result interface{}) error {
 		"result":  result,
 	}
 
-	data, err := json.Marshal(response)
-	if err != nil {
-		return fmt.Errorf("failed to marshal response: %w", err)
+	if err := c.write(response); err != nil {
+		return fmt.Errorf("failed to send response: %w", err)
 	}
+	return nil
+}
 
-	// Log the exact JSON being sent for debugging
-	fmt.Fprintf(os.Stderr, "[ACP] 📤 Sending response: %s\n", string(data))
-
-	c.process.mu.Lock()
-	_, err = c.process.stdin.Write(append(data, '\n'))
-	c.process.mu.Unlock()
+// SendError sends a JSON-RPC error response back to the server
+func (c *JSONRPCClient) SendError(id int, rpcErr *RPCError) error {
+	response := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   rpcErr,
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to send response: %w", err)
+	if err := c.write(response); err != nil {
+		return fmt.Errorf("failed to send error: %w", err)
 	}
+	return nil
+}
+
+// notificationHandled is called by the consumer of Notifications() once it is done with one
+func (c *JSONRPCClient) notificationHandled() {
+	c.notificationsHandled.Add(1)
+}
 
-	fmt.Fprintf(os.Stderr, "[ACP] ✅ Sent response for request ID=%d\n", id)
+// waitNotificationsHandled blocks until every notification received so far has been handled
+// Messages are read in order, so after a call returns this waits out the notifications the
+// agent sent before answering it.
+func (c *JSONRPCClient) waitNotificationsHandled(ctx context.Context) error {
+	target := c.notificationsQueued.Load()
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	for c.notificationsHandled.Load() < target {
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return ErrConnectionClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	return nil
 }
 
-// readLoop continuously reads from stdout and dispatches messages
+// readLoop continuously reads from the transport and dispatches messages
 func (c *JSONRPCClient) readLoop() {
-	scanner := bufio.NewScanner(c.process.stdout)
-
 	lineCount := 0
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	var readErr error
+	for {
+		line, err := c.transport.Receive()
+		if err != nil {
+			readErr = err
+			break
+		}
 		lineCount++
 
-		// DEBUG: Log all raw output from ACP
-		fmt.Fprintf(os.Stderr, "[ACP stdout #%d] %s\n", lineCount, string(line))
+		// Raw messages go to the trace of their session, see Tracer
+		if trace := c.trace.Load(); trace != nil {
+			trace.record(TraceIn, line)
+		}
 
 		// Try to parse as incoming request (has both ID and Method)
 		var req JSONRPCIncomingRequest
 		if err := json.Unmarshal(line, &req); err == nil && req.ID != nil && req.Method != "" {
 			// It's an incoming request from ACP (has ID field)
-			fmt.Fprintf(os.Stderr, "[ACP] 📥 Parsed as incoming request: method=%s, id=%d\n", req.Method, *req.ID)
 			select {
 			case c.requests <- &req:
-				fmt.Fprintf(os.Stderr, "[ACP] ✅ Request sent to channel\n")
 			default:
 				// Channel full, drop request
-				fmt.Fprintf(os.Stderr, "[ACP] ❌ Dropped request (channel full): %s\n", req.Method)
+				log.Printf("⚠️  Dropped ACP request (channel full): %s", req.Method)
 			}
 			continue
 		}
@@ -196,8 +316,7 @@ func (c *JSONRPCClient) readLoop() {
 		// Try to parse as response (has ID, no Method)
 		var resp JSONRPCResponse
 		if err := json.Unmarshal(line, &resp); err == nil && resp.ID != 0 {
-			// It's a response
-			fmt.Fprintf(os.Stderr, "[ACP] ✅ Parsed as response ID=%d\n", resp.ID)
+			// It's a response, there is no pending call any more if it was cancelled
 			c.mu.Lock()
 			if respChan, ok := c.pendingCalls[resp.ID]; ok {
 				respChan <- &resp
@@ -210,24 +329,34 @@ func (c *JSONRPCClient) readLoop() {
 		var notif JSONRPCNotification
 		if err := json.Unmarshal(line, &notif); err == nil && notif.Method != "" {
 			// It's a notification
-			fmt.Fprintf(os.Stderr, "[ACP] 📨 Parsed as notification: method=%s\n", notif.Method)
 			select {
 			case c.notifications <- &notif:
-				fmt.Fprintf(os.Stderr, "[ACP] ✅ Notification sent to channel\n")
+				c.notificationsQueued.Add(1)
 			default:
 				// Channel full, drop notification
-				fmt.Fprintf(os.Stderr, "[ACP] ❌ Dropped notification (channel full): %s\n", notif.Method)
+				log.Printf("⚠️  Dropped ACP notification (channel full): %s", notif.Method)
 			}
 			continue
 		}
 
-		// Unknown message format
-		fmt.Fprintf(os.Stderr, "[ACP] ⚠️  Unknown message format\n")
+		log.Printf("⚠️  Ignored ACP message of unknown format (%d bytes)", len(line))
 	}
 
-	fmt.Fprintf(os.Stderr, "[ACP] 🛑 Read loop exited (total lines: %d)\n", lineCount)
+	if readErr != io.EOF {
+		log.Printf("❌ ACP read loop exited after %d messages: %v", lineCount, readErr)
+	} else {
+		log.Printf("🛑 ACP read loop exited after %d messages", lineCount)
+	}
+
+	// Fail in-flight calls and stop consumers of the channels
+	c.mu.Lock()
+	pending := len(c.pendingCalls)
+	close(c.closed)
+	c.mu.Unlock()
+	close(c.requests)
+	close(c.notifications)
 
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "[ACP] ❌ Read error: %v\n", err)
+	if pending > 0 {
+		log.Printf("❌ Failing %d in-flight ACP call(s)", pending)
 	}
 }
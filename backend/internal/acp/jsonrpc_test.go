@@ -1,8 +1,12 @@
 package acp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestJSONRPCRequestWithZeroID(t *testing.T) {
@@ -83,9 +87,7 @@ func TestPermissionResponseMarshaling(t *testing.T) {
 	response := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      0,
-		"result": PermissionResponse{
-			OptionID: "allow",
-		},
+		"result":  NewSelectedOutcome("allow"),
 	}
 
 	data, err := json.Marshal(response)
@@ -93,7 +95,7 @@ func TestPermissionResponseMarshaling(t *testing.T) {
 		t.Fatalf("Failed to marshal response: %v", err)
 	}
 
-	expected := `{"id":0,"jsonrpc":"2.0","result":{"optionId":"allow"}}`
+	expected := `{"id":0,"jsonrpc":"2.0","result":{"outcome":{"outcome":"selected","optionId":"allow"}}}`
 
 	// JSON field order doesn't matter, so let's unmarshal and compare
 	var got, want map[string]interface{}
@@ -108,11 +110,195 @@ func TestPermissionResponseMarshaling(t *testing.T) {
 		t.Errorf("jsonrpc mismatch: got %v, want %v", got["jsonrpc"], want["jsonrpc"])
 	}
 
-	gotResult := got["result"].(map[string]interface{})
-	wantResult := want["result"].(map[string]interface{})
+	gotResult := got["result"].(map[string]interface{})["outcome"].(map[string]interface{})
+	wantResult := want["result"].(map[string]interface{})["outcome"].(map[string]interface{})
 	if gotResult["optionId"] != wantResult["optionId"] {
 		t.Errorf("optionId mismatch: got %v, want %v", gotResult["optionId"], wantResult["optionId"])
 	}
 
 	t.Logf("Marshaled response: %s", string(data))
 }
+
+func TestCallContextCancellation(t *testing.T) {
+	client, err := newACPClient(spawnHelperAgent, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	rpc := client.rpc()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = rpc.CallContext(ctx, "hang", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("CallContext returned after %s, expected it to honor the deadline", elapsed)
+	}
+
+	rpc.mu.Lock()
+	pending := len(rpc.pendingCalls)
+	rpc.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected no pending calls after cancellation, got %d", pending)
+	}
+
+	// A context that is already done never sends the request
+	done, cancelDone := context.WithCancel(context.Background())
+	cancelDone()
+	if _, err := rpc.CallContext(done, "initialize", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The connection is still usable
+	if _, err := client.Initialize(context.Background()); err != nil {
+		t.Errorf("Initialize after cancelled call failed: %v", err)
+	}
+}
+
+func TestSessionPromptCancelSendsSessionCancel(t *testing.T) {
+	client, err := newACPClient(spawnHelperAgent, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err = client.SessionPrompt(ctx, "session-abc", "hello")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The agent must have been told to stop
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Contains(strings.Join(client.Status().StderrTail, "\n"), "cancelled session-abc") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Agent never received session/cancel, stderr: %v", client.Status().StderrTail)
+}
+
+func TestCancelSessionEndsTurn(t *testing.T) {
+	client, err := newACPClient(spawnHelperAgent, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.CancelSession("session-xyz")
+	}()
+
+	result, err := client.SessionPrompt(context.Background(), "session-xyz", "hello")
+	if err != nil {
+		t.Fatalf("SessionPrompt failed: %v", err)
+	}
+	if result.StopReason != StopReasonCancelled {
+		t.Errorf("Expected stopReason %q, got %q", StopReasonCancelled, result.StopReason)
+	}
+}
+
+func TestLoadSessionDiscardsReplay(t *testing.T) {
+	client, err := newACPClient(spawnHelperAgent, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	if !client.Capabilities().LoadSession {
+		t.Fatal("Expected the loadSession capability")
+	}
+
+	if _, err := client.LoadSession(ctx, "session-old", "/tmp", nil); err != nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+
+	// The replayed history must not leak into the listener registered afterwards
+	_, notifications := client.RegisterSession("session-old")
+	select {
+	case notif := <-notifications:
+		t.Errorf("Listener received replayed notification: %s", notif.Params)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSessionPromptRoutesUpdatesFirst(t *testing.T) {
+	client, err := newACPClient(spawnHelperAgent, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, notifications := client.RegisterSession("reply-0042")
+	defer client.UnregisterSession("reply-0042")
+
+	for i := 0; i < 20; i++ {
+		if _, err := client.SessionPrompt(ctx, "reply-0042", "hello"); err != nil {
+			t.Fatalf("SessionPrompt failed: %v", err)
+		}
+
+		// The listener closes the turn when the prompt returns, its updates must be waiting by then
+		if queued := len(notifications); queued != 2 {
+			t.Fatalf("Expected the 2 updates of turn %d to be queued, got %d", i, queued)
+		}
+		<-notifications
+		<-notifications
+	}
+}
+
+func TestMCPServerMarshaling(t *testing.T) {
+	tests := []struct {
+		name   string
+		server MCPServer
+		want   string
+	}{
+		{
+			name:   "stdio sends empty args and env",
+			server: MCPServer{Name: "fs", Command: "mcp-fs"},
+			want:   `{"name":"fs","command":"mcp-fs","args":[],"env":[]}`,
+		},
+		{
+			name:   "http sends type and headers",
+			server: MCPServer{Type: MCPTransportHTTP, Name: "docs", URL: "https://example.com/mcp", Headers: []HTTPHeader{{Name: "Authorization", Value: "Bearer x"}}},
+			want:   `{"type":"http","name":"docs","url":"https://example.com/mcp","headers":[{"name":"Authorization","value":"Bearer x"}]}`,
+		},
+		{
+			name:   "sse without headers",
+			server: MCPServer{Type: MCPTransportSSE, Name: "events", URL: "https://example.com/sse"},
+			want:   `{"type":"sse","name":"events","url":"https://example.com/sse","headers":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.server)
+			if err != nil {
+				t.Fatalf("Failed to marshal MCPServer: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshaled JSON = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
@@ -3,19 +3,20 @@ package acp
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 )
 
 // PermissionRequest represents a session/request_permission request
 type PermissionRequest struct {
-	SessionID string           `json:"sessionId"`
-	ToolCall  ToolCallInfo     `json:"toolCall"`
+	SessionID string             `json:"sessionId"`
+	ToolCall  ToolCallInfo       `json:"toolCall"`
 	Options   []PermissionOption `json:"options"`
 }
 
 // ToolCallInfo contains information about the tool being called
 type ToolCallInfo struct {
 	ToolCallID string                 `json:"toolCallId"`
+	Title      string                 `json:"title,omitempty"`
+	Kind       string                 `json:"kind,omitempty"` // read, edit, delete, move, search, execute, think, fetch, other
 	RawInput   map[string]interface{} `json:"rawInput"`
 }
 
@@ -34,8 +35,26 @@ type PermissionResponse struct {
 
 // PermissionOutcome represents the user's decision
 type PermissionOutcome struct {
-	Outcome  string `json:"outcome"`  // "selected" or "cancelled"
-	OptionID string `json:"optionId"` // The option that was selected (only for "selected")
+	Outcome  string `json:"outcome"`            // "selected" or "cancelled"
+	OptionID string `json:"optionId,omitempty"` // The option that was selected (only for "selected")
+}
+
+// NewSelectedOutcome builds a response selecting the given option
+func NewSelectedOutcome(optionID string) PermissionResponse {
+	return PermissionResponse{
+		Outcome: PermissionOutcome{
+			Outcome:  "selected",
+			OptionID: optionID,
+		},
+	}
+}
+
+// NewCancelledOutcome builds a response that selects nothing, e.g. because the turn was cancelled
+// or no offered option fits the decision
+func NewCancelledOutcome() PermissionResponse {
+	return PermissionResponse{
+		Outcome: PermissionOutcome{Outcome: "cancelled"},
+	}
 }
 
 // ParsePermissionRequest parses a session/request_permission request
@@ -52,61 +71,6 @@ func ParsePermissionRequest(req *JSONRPCIncomingRequest) (*PermissionRequest, er
 	return &permReq, nil
 }
 
-// ShouldAutoApprove determines if a tool call should be automatically approved
-// Currently auto-approves safe read-only operations
-func ShouldAutoApprove(toolCall ToolCallInfo) bool {
-	// Check if it's a web search operation (has "query" field)
-	if _, hasQuery := toolCall.RawInput["query"]; hasQuery {
-		log.Printf("🟢 Auto-approving web search operation")
-		return true
-	}
-
-	// Check if it's a web fetch operation (has "url" field)
-	if _, hasURL := toolCall.RawInput["url"]; hasURL {
-		log.Printf("🟢 Auto-approving web fetch operation")
-		return true
-	}
-
-	// Check for file read operations (has "file_path" field and no write/delete operation)
-	if _, hasFilePath := toolCall.RawInput["file_path"]; hasFilePath {
-		// Auto-approve if it's a read operation or no operation specified (read is default)
-		if operation, ok := toolCall.RawInput["operation"].(string); ok {
-			if operation == "read" {
-				log.Printf("🟢 Auto-approving file read operation")
-				return true
-			}
-		} else {
-			// No operation field means it's a read
-			log.Printf("🟢 Auto-approving file read operation (implicit)")
-			return true
-		}
-	}
-
-	// Check for other read-only file operations
-	if operation, ok := toolCall.RawInput["operation"].(string); ok {
-		switch operation {
-		case "glob", "grep", "list":
-			log.Printf("🟢 Auto-approving read-only file operation: %s", operation)
-			return true
-		}
-	}
-
-	// Check for safe bash commands
-	if command, ok := toolCall.RawInput["command"].(string); ok {
-		// List of safe read-only commands
-		safeCommands := []string{"ls", "cat", "grep", "git status", "pwd", "whoami", "echo", "date"}
-		for _, safe := range safeCommands {
-			if command == safe || len(command) > len(safe) && command[:len(safe)+1] == safe+" " {
-				log.Printf("🟢 Auto-approving safe bash command: %s", command)
-				return true
-			}
-		}
-	}
-
-	log.Printf("🟡 Tool requires manual approval: %+v", toolCall.RawInput)
-	return false
-}
-
 // FindAllowOption finds the "allow" or "allow_once" option from the list
 func FindAllowOption(options []PermissionOption) *PermissionOption {
 	// Prefer "allow" over "allow_once" over "allow_always"
@@ -127,3 +91,29 @@ func FindAllowOption(options []PermissionOption) *PermissionOption {
 	}
 	return nil
 }
+
+// FindRejectOption finds the "reject" or "reject_once" option from the list
+func FindRejectOption(options []PermissionOption) *PermissionOption {
+	// Prefer a one-off rejection so the agent can ask again later
+	for _, opt := range options {
+		if opt.OptionID == "reject" || opt.OptionID == "reject_once" {
+			return &opt
+		}
+	}
+	for _, opt := range options {
+		if opt.Kind == "reject_once" || opt.Kind == "reject_always" {
+			return &opt
+		}
+	}
+	return nil
+}
+
+// HasOption reports whether optionID is one of the offered options
+func HasOption(options []PermissionOption, optionID string) bool {
+	for _, opt := range options {
+		if opt.OptionID == optionID {
+			return true
+		}
+	}
+	return false
+}
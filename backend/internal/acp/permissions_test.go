@@ -88,141 +88,6 @@ func TestParsePermissionRequest(t *testing.T) {
 	}
 }
 
-func TestShouldAutoApprove(t *testing.T) {
-	tests := []struct {
-		name     string
-		toolCall ToolCallInfo
-		want     bool
-	}{
-		{
-			name: "web search should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_123",
-				RawInput: map[string]interface{}{
-					"query": "weather today",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "web fetch should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_124",
-				RawInput: map[string]interface{}{
-					"url":    "https://example.com",
-					"prompt": "fetch this",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "file read should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_125",
-				RawInput: map[string]interface{}{
-					"operation": "read",
-					"path":      "/tmp/test.txt",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "file glob should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_126",
-				RawInput: map[string]interface{}{
-					"operation": "glob",
-					"pattern":   "*.go",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "file grep should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_127",
-				RawInput: map[string]interface{}{
-					"operation": "grep",
-					"pattern":   "TODO",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "file list should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_128",
-				RawInput: map[string]interface{}{
-					"operation": "list",
-					"path":      "/tmp",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "safe bash command should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_129",
-				RawInput: map[string]interface{}{
-					"command": "ls -la",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "git status should auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_130",
-				RawInput: map[string]interface{}{
-					"command": "git status",
-				},
-			},
-			want: true,
-		},
-		{
-			name: "file write should NOT auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_131",
-				RawInput: map[string]interface{}{
-					"operation": "write",
-					"path":      "/tmp/test.txt",
-					"content":   "data",
-				},
-			},
-			want: false,
-		},
-		{
-			name: "unsafe bash command should NOT auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_132",
-				RawInput: map[string]interface{}{
-					"command": "rm -rf /",
-				},
-			},
-			want: false,
-		},
-		{
-			name: "unknown tool should NOT auto-approve",
-			toolCall: ToolCallInfo{
-				ToolCallID: "toolu_133",
-				RawInput: map[string]interface{}{
-					"unknown": "operation",
-				},
-			},
-			want: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := ShouldAutoApprove(tt.toolCall)
-			if got != tt.want {
-				t.Errorf("ShouldAutoApprove() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestFindAllowOption(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -288,16 +153,14 @@ func TestFindAllowOption(t *testing.T) {
 }
 
 func TestPermissionResponseSerialization(t *testing.T) {
-	resp := PermissionResponse{
-		OptionID: "allow",
-	}
+	resp := NewSelectedOutcome("allow")
 
 	data, err := json.Marshal(resp)
 	if err != nil {
 		t.Fatalf("Failed to marshal PermissionResponse: %v", err)
 	}
 
-	expected := `{"optionId":"allow"}`
+	expected := `{"outcome":{"outcome":"selected","optionId":"allow"}}`
 	if string(data) != expected {
 		t.Errorf("Marshaled JSON = %s, want %s", string(data), expected)
 	}
@@ -308,7 +171,60 @@ func TestPermissionResponseSerialization(t *testing.T) {
 		t.Fatalf("Failed to unmarshal PermissionResponse: %v", err)
 	}
 
-	if decoded.OptionID != resp.OptionID {
-		t.Errorf("Decoded optionId = %s, want %s", decoded.OptionID, resp.OptionID)
+	if decoded.Outcome.OptionID != resp.Outcome.OptionID {
+		t.Errorf("Decoded optionId = %s, want %s", decoded.Outcome.OptionID, resp.Outcome.OptionID)
+	}
+
+	data, err = json.Marshal(NewCancelledOutcome())
+	if err != nil {
+		t.Fatalf("Failed to marshal PermissionResponse: %v", err)
+	}
+	if expected := `{"outcome":{"outcome":"cancelled"}}`; string(data) != expected {
+		t.Errorf("Marshaled JSON = %s, want %s", string(data), expected)
+	}
+}
+
+func TestFindRejectOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []PermissionOption
+		want    string
+	}{
+		{
+			name: "prefer 'reject' by id",
+			options: []PermissionOption{
+				{OptionID: "allow", Name: "Allow", Kind: "allow_once"},
+				{OptionID: "reject", Name: "Reject", Kind: "reject_once"},
+			},
+			want: "reject",
+		},
+		{
+			name: "fall back to reject kind",
+			options: []PermissionOption{
+				{OptionID: "allow", Name: "Allow", Kind: "allow_once"},
+				{OptionID: "deny", Name: "Deny", Kind: "reject_once"},
+			},
+			want: "deny",
+		},
+		{
+			name: "return nil if no reject options",
+			options: []PermissionOption{
+				{OptionID: "allow", Name: "Allow", Kind: "allow_once"},
+			},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindRejectOption(tt.options)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("FindRejectOption() = %v, want nil", got)
+				}
+			} else if got == nil || got.OptionID != tt.want {
+				t.Errorf("FindRejectOption() = %v, want %s", got, tt.want)
+			}
+		})
 	}
 }
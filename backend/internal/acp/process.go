@@ -7,35 +7,43 @@ import (
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 )
 
-// ACPProcess manages the claude-code-acp subprocess
+// stderrTailLines is how many of the most recent stderr lines are kept for diagnostics
+const stderrTailLines = 20
+
+// closeTimeout is how long Close waits for the process to exit before killing it
+const closeTimeout = 5 * time.Second
+
+// ACPProcess manages an ACP agent subprocess, it is the stdio Transport
 type ACPProcess struct {
 	cmd    *exec.Cmd
 	stdin  io.WriteCloser
-	stdout io.ReadCloser
+	stdout *bufio.Scanner
 	stderr io.ReadCloser
 	mu     sync.Mutex
 	done   chan struct{}
+
+	// Exit tracking: Wait may be called from several places, the process is reaped once
+	waitOnce   sync.Once
+	waitErr    error
+	stderrDone chan struct{}
+
+	// Ring of the last stderr lines, kept so crashes can be diagnosed from /health
+	stderrMu   sync.Mutex
+	stderrTail []string
 }
 
 // SpawnACP spawns a new claude-code-acp subprocess
 // apiKey: Optional Anthropic API key. If empty, the SDK will use OAuth credentials from macOS keychain or ~/.claude/.credentials.json
 // Returns: *ACPProcess or error
 func SpawnACP(apiKey string) (*ACPProcess, error) {
-	// Create command
-	cmd := exec.Command("npx", "@zed-industries/claude-code-acp")
-
-	// Set environment variables
-	// Only set ANTHROPIC_API_KEY if provided, otherwise SDK will use OAuth credentials
-	if apiKey != "" {
-		cmd.Env = append(os.Environ(),
-			"ANTHROPIC_API_KEY="+apiKey,
-		)
-	} else {
-		cmd.Env = os.Environ()
-	}
+	return SpawnAgent(DefaultAgent(apiKey))
+}
 
+// startProcess attaches pipes to cmd and starts it
+func startProcess(cmd *exec.Cmd) (*ACPProcess, error) {
 	// Attach pipes
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -54,15 +62,16 @@ func SpawnACP(apiKey string) (*ACPProcess, error) {
 
 	// Start process
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start claude-code-acp: %w", err)
+		return nil, fmt.Errorf("failed to start %s: %w", cmd.Path, err)
 	}
 
 	process := &ACPProcess{
-		cmd:    cmd,
-		stdin:  stdin,
-		stdout: stdout,
-		stderr: stderr,
-		done:   make(chan struct{}),
+		cmd:        cmd,
+		stdin:      stdin,
+		stdout:     newFrameScanner(stdout),
+		stderr:     stderr,
+		done:       make(chan struct{}),
+		stderrDone: make(chan struct{}),
 	}
 
 	// Start stderr logger in background
@@ -71,67 +80,130 @@ func SpawnACP(apiKey string) (*ACPProcess, error) {
 	return process, nil
 }
 
-// logStderr logs stderr output from the subprocess
+// Send writes one message to the stdin of the process, followed by a newline
+func (p *ACPProcess) Send(frame []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.stdin.Write(append(frame, '\n'))
+	return err
+}
+
+// Receive reads the next line the process wrote to stdout
+func (p *ACPProcess) Receive() ([]byte, error) {
+	if p.stdout.Scan() {
+		return append([]byte(nil), p.stdout.Bytes()...), nil
+	}
+	if err := p.stdout.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// logStderr logs stderr output from the subprocess and keeps the last lines around
 func (p *ACPProcess) logStderr() {
+	defer close(p.stderrDone)
+
 	scanner := bufio.NewScanner(p.stderr)
 	for scanner.Scan() {
+		line := scanner.Text()
+
+		p.stderrMu.Lock()
+		p.stderrTail = append(p.stderrTail, line)
+		if len(p.stderrTail) > stderrTailLines {
+			p.stderrTail = p.stderrTail[len(p.stderrTail)-stderrTailLines:]
+		}
+		p.stderrMu.Unlock()
+
 		// TODO: Use proper logger instead of fmt
-		fmt.Fprintf(os.Stderr, "[ACP stderr] %s\n", scanner.Text())
+		fmt.Fprintf(os.Stderr, "[ACP stderr] %s\n", line)
 	}
 }
 
+// StderrTail returns the most recent stderr lines of the process
+func (p *ACPProcess) StderrTail() []string {
+	p.stderrMu.Lock()
+	defer p.stderrMu.Unlock()
+
+	tail := make([]string, len(p.stderrTail))
+	copy(tail, p.stderrTail)
+	return tail
+}
+
+// Wait blocks until the process has exited and returns its exit error
+// Safe to call more than once and from several goroutines
+func (p *ACPProcess) Wait() error {
+	p.waitOnce.Do(func() {
+		// Let the stderr logger drain so the last lines make it into the tail
+		select {
+		case <-p.stderrDone:
+		case <-time.After(time.Second):
+		}
+
+		p.waitErr = p.cmd.Wait()
+		close(p.done)
+	})
+
+	<-p.done
+	return p.waitErr
+}
+
+// Done returns a channel that is closed once the process has exited and been reaped
+func (p *ACPProcess) Done() <-chan struct{} {
+	return p.done
+}
+
 // Close gracefully shuts down the ACP process
+// The process is killed if it doesn't exit within closeTimeout
 func (p *ACPProcess) Close() error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	// Close stdin to signal process to exit
+	p.mu.Lock()
 	if p.stdin != nil {
 		p.stdin.Close()
 	}
+	p.mu.Unlock()
 
-	// Wait for process to exit (with timeout would be better)
-	if p.cmd != nil && p.cmd.Process != nil {
-		if err := p.cmd.Wait(); err != nil {
+	exited := make(chan error, 1)
+	go func() { exited <- p.Wait() }()
+
+	select {
+	case err := <-exited:
+		if err != nil {
 			return fmt.Errorf("process exit error: %w", err)
 		}
+		return nil
+	case <-time.After(closeTimeout):
+		return p.Kill()
 	}
-
-	// Signal done
-	close(p.done)
-
-	return nil
 }
 
 // Kill forcefully terminates the ACP process
 func (p *ACPProcess) Kill() error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	if p.cmd != nil && p.cmd.Process != nil {
-		if err := p.cmd.Process.Kill(); err != nil {
+		if err := p.cmd.Process.Kill(); err != nil && !p.exited() {
 			return fmt.Errorf("failed to kill process: %w", err)
 		}
 	}
 
-	close(p.done)
+	// The exit error is expected here (killed), only reap
+	p.Wait()
 	return nil
 }
 
 // IsRunning checks if the process is still running
 func (p *ACPProcess) IsRunning() bool {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	if p.cmd == nil || p.cmd.Process == nil {
 		return false
 	}
 
-	// Check if process has exited
+	return !p.exited()
+}
+
+// exited reports whether the process has been reaped
+func (p *ACPProcess) exited() bool {
 	select {
 	case <-p.done:
-		return false
-	default:
 		return true
+	default:
+		return false
 	}
 }
@@ -0,0 +1,194 @@
+package acp
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// initializeTimeout bounds the handshake with a restarted process
+const initializeTimeout = 30 * time.Second
+
+// ProcessState describes the lifecycle of the supervised ACP process
+type ProcessState string
+
+const (
+	ProcessRunning    ProcessState = "running"    // Process is up and initialized
+	ProcessRestarting ProcessState = "restarting" // Process exited, waiting to respawn
+	ProcessFailed     ProcessState = "failed"     // Gave up restarting
+	ProcessStopped    ProcessState = "stopped"    // Closed on purpose
+)
+
+// ProcessStatus is a snapshot of the supervised process, reported on /health
+type ProcessStatus struct {
+	State          ProcessState `json:"state"`
+	StartedAt      time.Time    `json:"started_at"`
+	RestartCount   int          `json:"restart_count"`
+	LastExitAt     *time.Time   `json:"last_exit_at,omitempty"`
+	LastExitError  string       `json:"last_exit_error,omitempty"`
+	LastExitStderr []string     `json:"last_exit_stderr,omitempty"` // Stderr tail of the process that exited
+	StderrTail     []string     `json:"stderr_tail"`                // Stderr tail of the current process
+}
+
+// RestartPolicy controls how the supervisor restarts a dead process
+type RestartPolicy struct {
+	InitialBackoff time.Duration // Delay before the first restart attempt
+	MaxBackoff     time.Duration // Cap for the exponentially growing delay
+	MaxAttempts    int           // Consecutive failed attempts before giving up, 0 means never give up
+	StableAfter    time.Duration // A process that ran this long resets the backoff when it exits
+}
+
+// DefaultRestartPolicy restarts after 1s, 2s, 4s, ... up to a minute, and gives up after 10 tries in a row
+var DefaultRestartPolicy = RestartPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	MaxAttempts:    10,
+	StableAfter:    time.Minute,
+}
+
+// Status returns a snapshot of the supervised process
+func (c *ACPClient) Status() ProcessStatus {
+	_, transport := c.connection()
+
+	c.statusMu.Lock()
+	status := c.status
+	c.statusMu.Unlock()
+
+	status.StderrTail = transport.StderrTail()
+	return status
+}
+
+// OnProcessExit registers a callback run when the ACP process exits unexpectedly
+// All ACP sessions die with the process, so callers use this to drop cached session IDs.
+// Callbacks run on the supervisor goroutine before the restart is attempted.
+func (c *ACPClient) OnProcessExit(fn func()) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	c.exitCallbacks = append(c.exitCallbacks, fn)
+}
+
+// supervise waits for the process to exit and restarts it until the client is closed
+func (c *ACPClient) supervise() {
+	backoff := c.restartPolicy.InitialBackoff
+
+	for {
+		rpc, transport := c.connection()
+		<-rpc.Done()
+		exitErr := transport.Wait()
+
+		if c.closing.Load() {
+			c.setState(ProcessStopped)
+			return
+		}
+
+		now := time.Now()
+		c.statusMu.Lock()
+		uptime := now.Sub(c.status.StartedAt)
+		c.status.LastExitAt = &now
+		c.status.LastExitError = ""
+		if exitErr != nil {
+			c.status.LastExitError = exitErr.Error()
+		}
+		c.status.LastExitStderr = transport.StderrTail()
+		callbacks := append([]func(){}, c.exitCallbacks...)
+		c.statusMu.Unlock()
+
+		log.Printf("💥 ACP process exited after %s: %v", uptime.Round(time.Second), exitErr)
+
+		// A process that stayed up for a while is not crash-looping
+		if uptime >= c.restartPolicy.StableAfter {
+			backoff = c.restartPolicy.InitialBackoff
+		}
+
+		c.dropSessions()
+		for _, fn := range callbacks {
+			fn()
+		}
+
+		var ok bool
+		backoff, ok = c.restart(backoff)
+		if !ok {
+			return
+		}
+	}
+}
+
+// restart respawns and re-initializes the process with exponential backoff
+// Returns the backoff to use after the next exit, and false if the supervisor should stop
+func (c *ACPClient) restart(backoff time.Duration) (time.Duration, bool) {
+	policy := c.restartPolicy
+
+	for attempt := 1; policy.MaxAttempts == 0 || attempt <= policy.MaxAttempts; attempt++ {
+		c.setState(ProcessRestarting)
+		log.Printf("🔄 Restarting ACP process in %s (attempt %d)", backoff, attempt)
+
+		select {
+		case <-time.After(backoff):
+		case <-c.stop:
+			c.setState(ProcessStopped)
+			return backoff, false
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+
+		transport, err := c.spawn()
+		if err != nil {
+			log.Printf("❌ Failed to respawn ACP process: %v", err)
+			continue
+		}
+
+		c.connect(transport)
+
+		if c.closing.Load() {
+			// Closed while we were spawning
+			transport.Kill()
+			c.setState(ProcessStopped)
+			return backoff, false
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+		result, err := c.Initialize(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("❌ Failed to re-initialize ACP: %v", err)
+			transport.Kill()
+			continue
+		}
+
+		c.statusMu.Lock()
+		c.status.State = ProcessRunning
+		c.status.RestartCount++
+		c.statusMu.Unlock()
+
+		log.Printf("✅ ACP process restarted: %s %s", result.ServerName, result.ServerVersion)
+		return backoff, true
+	}
+
+	log.Printf("❌ Giving up on ACP process after %d attempts", policy.MaxAttempts)
+	c.setState(ProcessFailed)
+	return backoff, false
+}
+
+func (c *ACPClient) setState(state ProcessState) {
+	c.statusMu.Lock()
+	c.status.State = state
+	c.statusMu.Unlock()
+}
+
+// dropSessions closes and forgets all session channels, the sessions died with the process
+func (c *ACPClient) dropSessions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for sessionID, ch := range c.sessionRequests {
+		close(ch)
+		delete(c.sessionRequests, sessionID)
+	}
+	for sessionID, ch := range c.sessionNotifications {
+		close(ch)
+		delete(c.sessionNotifications, sessionID)
+	}
+}
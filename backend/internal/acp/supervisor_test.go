@@ -0,0 +1,193 @@
+package acp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHelperACPAgent is not a real test: it is re-executed by spawnHelperAgent as a tiny ACP agent
+// It answers initialize, never answers "hang", exits on "crash" and holds session/prompt
+// until it receives session/cancel, which ends the turn with stopReason "cancelled".
+// session/load replays three agent_message_chunk updates before answering.
+// Sessions from session/new are named "reply-N": their prompts are answered right away with
+// two agent_message_chunk updates and stopReason "end_turn".
+func TestHelperACPAgent(t *testing.T) {
+	if os.Getenv("GO_WANT_ACP_HELPER") != "1" {
+		return
+	}
+
+	prompts := map[string]int{} // sessionId -> request ID of the running prompt
+	sessions := 0
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				SessionID string `json:"sessionId"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+
+		switch req.Method {
+		case "initialize":
+			fmt.Printf(`{"jsonrpc":"2.0","id":%d,"result":{"server_name":"helper","server_version":"1.0","agentCapabilities":{"loadSession":true}}}`+"\n", req.ID)
+		case "session/load":
+			for i := 0; i < 3; i++ {
+				fmt.Printf(`{"jsonrpc":"2.0","method":"session/update","params":{"sessionId":%q,"update":{"sessionUpdate":"agent_message_chunk","content":{"type":"text","text":"replayed"}}}}`+"\n", req.Params.SessionID)
+			}
+			fmt.Printf(`{"jsonrpc":"2.0","id":%d,"result":null}`+"\n", req.ID)
+		case "session/new":
+			sessions++
+			fmt.Printf(`{"jsonrpc":"2.0","id":%d,"result":{"sessionId":"reply-%04d"}}`+"\n", req.ID, sessions)
+		case "session/prompt":
+			if strings.HasPrefix(req.Params.SessionID, "reply-") {
+				for _, chunk := range []string{"Hello", " there"} {
+					fmt.Printf(`{"jsonrpc":"2.0","method":"session/update","params":{"sessionId":%q,"update":{"sessionUpdate":"agent_message_chunk","content":{"type":"text","text":%q}}}}`+"\n", req.Params.SessionID, chunk)
+				}
+				fmt.Printf(`{"jsonrpc":"2.0","id":%d,"result":{"stopReason":"end_turn"}}`+"\n", req.ID)
+				continue
+			}
+			prompts[req.Params.SessionID] = req.ID
+		case "session/cancel":
+			fmt.Fprintf(os.Stderr, "helper agent: cancelled %s\n", req.Params.SessionID)
+			if id, ok := prompts[req.Params.SessionID]; ok {
+				fmt.Printf(`{"jsonrpc":"2.0","id":%d,"result":{"stopReason":"cancelled"}}`+"\n", id)
+				delete(prompts, req.Params.SessionID)
+			}
+		case "crash":
+			fmt.Fprintln(os.Stderr, "helper agent: boom")
+			os.Exit(3)
+		}
+	}
+	os.Exit(0)
+}
+
+func spawnHelperAgent() (Transport, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperACPAgent$")
+	cmd.Env = append(os.Environ(), "GO_WANT_ACP_HELPER=1")
+	return startProcess(cmd)
+}
+
+var fastRestartPolicy = RestartPolicy{
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+	MaxAttempts:    3,
+	StableAfter:    time.Hour,
+}
+
+func waitForState(t *testing.T, client *ACPClient, state ProcessState) ProcessStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		status := client.Status()
+		if status.State == state {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Process never reached state %s, last status: %+v", state, client.Status())
+	return ProcessStatus{}
+}
+
+func TestSupervisorRestartsCrashedProcess(t *testing.T) {
+	client, err := newACPClient(spawnHelperAgent, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var exits atomic.Int32
+	client.OnProcessExit(func() { exits.Add(1) })
+
+	requests, notifications := client.RegisterSession("session-12345678")
+
+	// A call that never gets an answer must fail once the process dies
+	hung := make(chan error, 1)
+	go func() {
+		_, err := client.rpc().Call("hang", nil)
+		hung <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := client.rpc().Call("crash", nil); !errors.Is(err, ErrConnectionClosed) {
+		t.Errorf("Expected ErrConnectionClosed from crashing call, got %v", err)
+	}
+
+	select {
+	case err := <-hung:
+		if !errors.Is(err, ErrConnectionClosed) {
+			t.Errorf("Expected ErrConnectionClosed for in-flight call, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("In-flight call was not failed after process exit")
+	}
+
+	status := waitForState(t, client, ProcessRunning)
+	for status.RestartCount == 0 {
+		time.Sleep(10 * time.Millisecond)
+		status = client.Status()
+	}
+
+	if exits.Load() != 1 {
+		t.Errorf("Expected exit callback to run once, ran %d times", exits.Load())
+	}
+	if _, ok := <-requests; ok {
+		t.Error("Expected session request channel to be closed")
+	}
+	if _, ok := <-notifications; ok {
+		t.Error("Expected session notification channel to be closed")
+	}
+	if !strings.Contains(strings.Join(status.LastExitStderr, "\n"), "boom") {
+		t.Errorf("Expected stderr tail of crashed process, got %v", status.LastExitStderr)
+	}
+	if status.LastExitError == "" {
+		t.Error("Expected last exit error to be recorded")
+	}
+
+	// The restarted process is initialized and usable
+	if _, err := client.Initialize(context.Background()); err != nil {
+		t.Errorf("Initialize after restart failed: %v", err)
+	}
+
+	client.Close()
+	waitForState(t, client, ProcessStopped)
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	var spawns atomic.Int32
+	spawn := func() (Transport, error) {
+		if spawns.Add(1) > 1 {
+			return nil, errors.New("spawn disabled")
+		}
+		return spawnHelperAgent()
+	}
+
+	client, err := newACPClient(spawn, fastRestartPolicy)
+	if err != nil {
+		t.Fatalf("Failed to start helper agent: %v", err)
+	}
+	defer client.Close()
+
+	client.rpc().Call("crash", nil)
+
+	waitForState(t, client, ProcessFailed)
+	if got := spawns.Load(); got != int32(1+fastRestartPolicy.MaxAttempts) {
+		t.Errorf("Expected %d spawn attempts, got %d", 1+fastRestartPolicy.MaxAttempts, got)
+	}
+}
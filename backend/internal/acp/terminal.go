@@ -0,0 +1,106 @@
+package acp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Client methods the agent calls to run commands in terminals hosted by Parachute
+const (
+	MethodTerminalCreate      = "terminal/create"
+	MethodTerminalOutput      = "terminal/output"
+	MethodTerminalWaitForExit = "terminal/wait_for_exit"
+	MethodTerminalKill        = "terminal/kill"
+	MethodTerminalRelease     = "terminal/release"
+)
+
+// CreateTerminalRequest represents a terminal/create request
+type CreateTerminalRequest struct {
+	SessionID       string        `json:"sessionId"`
+	Command         string        `json:"command"`
+	Args            []string      `json:"args,omitempty"`
+	Env             []EnvVariable `json:"env,omitempty"`
+	Cwd             string        `json:"cwd,omitempty"`             // Absolute path
+	OutputByteLimit *int          `json:"outputByteLimit,omitempty"` // Output beyond this is dropped from the start
+}
+
+// CommandLine returns the command and its arguments as one line, for display and policies
+// Words with spaces or shell metacharacters are single-quoted, so the line reads as the argv
+// that is actually run.
+func (r *CreateTerminalRequest) CommandLine() string {
+	words := make([]string, 0, len(r.Args)+1)
+	for _, word := range append([]string{r.Command}, r.Args...) {
+		words = append(words, shellQuote(word))
+	}
+	return strings.TrimSpace(strings.Join(words, " "))
+}
+
+// shellQuote single-quotes a word unless it only has characters the shell takes literally
+func shellQuote(word string) string {
+	if word == "" {
+		return "''"
+	}
+	if strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=+,@%") == "" {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// CreateTerminalResponse is what we send back for terminal/create
+type CreateTerminalResponse struct {
+	TerminalID string `json:"terminalId"`
+}
+
+// TerminalRequest represents a terminal/output, wait_for_exit, kill or release request
+type TerminalRequest struct {
+	SessionID  string `json:"sessionId"`
+	TerminalID string `json:"terminalId"`
+}
+
+// TerminalExitStatus is how a terminal command ended, and the terminal/wait_for_exit response
+type TerminalExitStatus struct {
+	ExitCode *int    `json:"exitCode"`
+	Signal   *string `json:"signal"`
+}
+
+// TerminalOutputResponse is what we send back for terminal/output
+type TerminalOutputResponse struct {
+	Output     string              `json:"output"`
+	Truncated  bool                `json:"truncated"`
+	ExitStatus *TerminalExitStatus `json:"exitStatus,omitempty"` // Set once the command exited
+}
+
+// ParseCreateTerminalRequest parses a terminal/create request
+func ParseCreateTerminalRequest(req *JSONRPCIncomingRequest) (*CreateTerminalRequest, error) {
+	if req.Method != MethodTerminalCreate {
+		return nil, fmt.Errorf("not a terminal/create request: %s", req.Method)
+	}
+
+	var createReq CreateTerminalRequest
+	if err := json.Unmarshal(req.Params, &createReq); err != nil {
+		return nil, fmt.Errorf("failed to parse terminal/create request: %w", err)
+	}
+	if createReq.Command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	return &createReq, nil
+}
+
+// ParseTerminalRequest parses a request about an existing terminal
+func ParseTerminalRequest(req *JSONRPCIncomingRequest) (*TerminalRequest, error) {
+	if !strings.HasPrefix(req.Method, "terminal/") || req.Method == MethodTerminalCreate {
+		return nil, fmt.Errorf("not a terminal request: %s", req.Method)
+	}
+
+	var termReq TerminalRequest
+	if err := json.Unmarshal(req.Params, &termReq); err != nil {
+		return nil, fmt.Errorf("failed to parse %s request: %w", req.Method, err)
+	}
+	if termReq.TerminalID == "" {
+		return nil, fmt.Errorf("terminalId is required")
+	}
+
+	return &termReq, nil
+}
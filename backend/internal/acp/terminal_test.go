@@ -0,0 +1,27 @@
+package acp
+
+import "testing"
+
+func TestCreateTerminalRequestCommandLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		want    string
+	}{
+		{"plain words", "go", []string{"test", "./...", "-run=TestX"}, "go test ./... -run=TestX"},
+		{"spaces and metacharacters", "ls", []string{"a b; rm -rf x"}, "ls 'a b; rm -rf x'"},
+		{"single quotes", "echo", []string{"it's"}, `echo 'it'\''s'`},
+		{"empty argument", "grep", []string{"", "file"}, "grep '' file"},
+		{"substitution", "echo", []string{"$(whoami)"}, "echo '$(whoami)'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &CreateTerminalRequest{Command: tt.command, Args: tt.args}
+			if got := req.CommandLine(); got != tt.want {
+				t.Errorf("CommandLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package acp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Directions of traced messages
+const (
+	TraceIn  = "in"  // From the agent to the backend
+	TraceOut = "out" // From the backend to the agent
+)
+
+// ErrNoTrace is returned when a session has no trace
+var ErrNoTrace = errors.New("no trace for this session")
+
+// redactedValue replaces secrets in traces
+const redactedValue = "[redacted]"
+
+// traceSessionPattern keeps session IDs that can't be used as file names out of the trace folder
+var traceSessionPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// TraceEntry is one JSON-RPC message of a trace, as sent on the wire
+type TraceEntry struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// Tracer records the JSON-RPC traffic of sessions, one JSONL file of TraceEntry per session
+// Messages are attributed to a session by their sessionId, or by the request they answer.
+// Every trace starts with the initialize exchange of the process the session ran in, so a
+// trace can be replayed on its own (see fakeagent.Replay).
+type Tracer struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewTracer creates a tracer writing to dir, which is created on the first write
+func NewTracer(dir string) *Tracer {
+	return &Tracer{dir: dir}
+}
+
+// Dir returns the folder of the traces
+func (t *Tracer) Dir() string {
+	return t.dir
+}
+
+// Path returns the trace file of a session
+func (t *Tracer) Path(sessionID string) (string, error) {
+	if !traceSessionPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("invalid session id %q", sessionID)
+	}
+	return filepath.Join(t.dir, sessionID+".jsonl"), nil
+}
+
+// Open opens the trace of a session, ErrNoTrace if nothing was recorded for it
+func (t *Tracer) Open(sessionID string) (*os.File, error) {
+	path, err := t.Path(sessionID)
+	if err != nil {
+		return nil, ErrNoTrace
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoTrace
+	}
+	return f, err
+}
+
+// append adds entries to the trace of a session
+func (t *Tracer) append(sessionID string, entries []TraceEntry) error {
+	path, err := t.Path(sessionID)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadTrace decodes a trace
+func ReadTrace(r io.Reader) ([]TraceEntry, error) {
+	var entries []TraceEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry TraceEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid trace, line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// LoadTrace reads a trace file
+func LoadTrace(path string) ([]TraceEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTrace(f)
+}
+
+// connTrace attributes the messages of one connection to sessions and records them
+type connTrace struct {
+	tracer *Tracer
+
+	mu           sync.Mutex
+	initializeID int
+	preamble     []TraceEntry       // The initialize exchange, which starts every trace
+	started      map[string]bool    // Sessions whose trace has the preamble of this connection
+	calls        map[int]string     // Our requests -> session
+	newSessions  map[int]TraceEntry // Our session/new requests, until the answer names the session
+	agentCalls   map[int]string     // Requests of the agent -> session
+}
+
+func newConnTrace(tracer *Tracer) *connTrace {
+	return &connTrace{
+		tracer:      tracer,
+		started:     make(map[string]bool),
+		calls:       make(map[int]string),
+		newSessions: make(map[int]TraceEntry),
+		agentCalls:  make(map[int]string),
+	}
+}
+
+// tracedMessage is what attribution needs of a JSON-RPC message
+type tracedMessage struct {
+	ID     *int   `json:"id"`
+	Method string `json:"method"`
+	Params struct {
+		SessionID string `json:"sessionId"`
+	} `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+// record traces a message sent in the given direction
+func (t *connTrace) record(direction string, data []byte) {
+	var msg tracedMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if direction == TraceOut && (msg.Method == "session/new" || msg.Method == "session/load") {
+		data = redactMCPSecrets(data)
+	}
+	entry := TraceEntry{Time: time.Now().UTC(), Direction: direction, Message: append(json.RawMessage{}, data...)}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sessionID := msg.Params.SessionID
+	isRequest := msg.Method != "" && msg.ID != nil
+	isResponse := msg.Method == "" && msg.ID != nil
+
+	switch {
+	case direction == TraceOut && isRequest && msg.Method == "initialize":
+		t.initializeID = *msg.ID
+		t.preamble = []TraceEntry{entry}
+		return
+
+	case direction == TraceOut && isRequest && msg.Method == "session/new":
+		t.newSessions[*msg.ID] = entry
+		return
+
+	case direction == TraceOut && isRequest:
+		t.calls[*msg.ID] = sessionID
+
+	case direction == TraceIn && isRequest:
+		t.agentCalls[*msg.ID] = sessionID
+
+	case direction == TraceIn && isResponse && *msg.ID == t.initializeID && len(t.preamble) == 1:
+		t.preamble = append(t.preamble, entry)
+		return
+
+	case direction == TraceIn && isResponse:
+		if request, ok := t.newSessions[*msg.ID]; ok {
+			delete(t.newSessions, *msg.ID)
+			var result struct {
+				SessionID string `json:"sessionId"`
+			}
+			json.Unmarshal(msg.Result, &result)
+			t.write(result.SessionID, request, entry)
+			return
+		}
+		sessionID = t.calls[*msg.ID]
+		delete(t.calls, *msg.ID)
+
+	case direction == TraceOut && isResponse:
+		sessionID = t.agentCalls[*msg.ID]
+		delete(t.agentCalls, *msg.ID)
+	}
+
+	t.write(sessionID, entry)
+}
+
+// redactMCPSecrets blanks the env and header values of the MCP servers in the params of a
+// message, they hold secrets filled in from the secrets store
+func redactMCPSecrets(data []byte) []byte {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return data
+	}
+	params, _ := msg["params"].(map[string]interface{})
+	servers, _ := params["mcpServers"].([]interface{})
+	if len(servers) == 0 {
+		return data
+	}
+
+	for _, server := range servers {
+		fields, _ := server.(map[string]interface{})
+		for _, key := range []string{"env", "headers"} {
+			variables, _ := fields[key].([]interface{})
+			for _, variable := range variables {
+				if pair, ok := variable.(map[string]interface{}); ok {
+					if _, ok := pair["value"]; ok {
+						pair["value"] = redactedValue
+					}
+				}
+			}
+		}
+	}
+
+	redacted, err := json.Marshal(msg)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// write appends entries to the trace of a session, after the preamble if it is new to it, t.mu must be held
+func (t *connTrace) write(sessionID string, entries ...TraceEntry) {
+	if sessionID == "" {
+		return
+	}
+	if !t.started[sessionID] {
+		t.started[sessionID] = true
+		entries = append(append([]TraceEntry{}, t.preamble...), entries...)
+	}
+
+	if err := t.tracer.append(sessionID, entries); err != nil {
+		log.Printf("⚠️  Failed to trace session %s: %v", sessionID, err)
+	}
+}
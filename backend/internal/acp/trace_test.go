@@ -0,0 +1,113 @@
+package acp
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConnTraceAttributesMessagesToSessions(t *testing.T) {
+	tracer := NewTracer(t.TempDir())
+	trace := newConnTrace(tracer)
+
+	traffic := []struct {
+		direction string
+		message   string
+	}{
+		{TraceOut, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":1}}`},
+		{TraceIn, `{"jsonrpc":"2.0","id":1,"result":{"agentCapabilities":{}}}`},
+		{TraceOut, `{"jsonrpc":"2.0","id":2,"method":"session/new","params":{"cwd":"/tmp"}}`},
+		{TraceIn, `{"jsonrpc":"2.0","id":2,"result":{"sessionId":"session-one"}}`},
+		{TraceOut, `{"jsonrpc":"2.0","id":3,"method":"session/prompt","params":{"sessionId":"session-one"}}`},
+		{TraceOut, `{"jsonrpc":"2.0","id":4,"method":"session/load","params":{"sessionId":"session-two"}}`},
+		{TraceIn, `{"jsonrpc":"2.0","method":"session/update","params":{"sessionId":"session-one","update":{}}}`},
+		{TraceIn, `{"jsonrpc":"2.0","id":0,"method":"session/request_permission","params":{"sessionId":"session-one"}}`},
+		{TraceIn, `{"jsonrpc":"2.0","id":4,"result":null}`},
+		{TraceOut, `{"jsonrpc":"2.0","id":0,"result":{"outcome":{"outcome":"selected","optionId":"allow"}}}`},
+		{TraceIn, `{"jsonrpc":"2.0","id":3,"result":{"stopReason":"end_turn"}}`},
+		{TraceIn, `{"jsonrpc":"2.0","method":"session/update","params":{"sessionId":"../escape","update":{}}}`},
+	}
+	for _, msg := range traffic {
+		trace.record(msg.direction, []byte(msg.message))
+	}
+
+	read := func(sessionID string) []string {
+		t.Helper()
+		f, err := tracer.Open(sessionID)
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", sessionID, err)
+		}
+		defer f.Close()
+
+		entries, err := ReadTrace(f)
+		if err != nil {
+			t.Fatalf("ReadTrace() error = %v", err)
+		}
+		var got []string
+		for _, entry := range entries {
+			var msg struct {
+				ID     *int   `json:"id"`
+				Method string `json:"method"`
+			}
+			json.Unmarshal(entry.Message, &msg)
+			label := entry.Direction + " " + msg.Method
+			if msg.Method == "" {
+				label += "response"
+			}
+			got = append(got, label)
+		}
+		return got
+	}
+
+	want := []string{
+		"out initialize", "in response",
+		"out session/new", "in response",
+		"out session/prompt",
+		"in session/update",
+		"in session/request_permission",
+		"out response",
+		"in response",
+	}
+	if got := read("session-one"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("trace of session-one = %v, want %v", got, want)
+	}
+
+	want = []string{"out initialize", "in response", "out session/load", "in response"}
+	if got := read("session-two"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("trace of session-two = %v, want %v", got, want)
+	}
+
+	if _, err := tracer.Open("../escape"); err != ErrNoTrace {
+		t.Errorf("Open(../escape) error = %v, want ErrNoTrace", err)
+	}
+	if files, _ := os.ReadDir(tracer.dir); len(files) != 2 {
+		t.Errorf("got %d trace files, want 2", len(files))
+	}
+}
+
+func TestConnTraceRedactsMCPSecrets(t *testing.T) {
+	tracer := NewTracer(t.TempDir())
+	trace := newConnTrace(tracer)
+
+	trace.record(TraceOut, []byte(`{"jsonrpc":"2.0","id":1,"method":"session/load","params":{"sessionId":"session-one","cwd":"/tmp","mcpServers":[`+
+		`{"name":"db","command":"db-mcp","args":[],"env":[{"name":"DB_PASSWORD","value":"hunter2"}]},`+
+		`{"type":"http","name":"api","url":"https://mcp.example.com","headers":[{"name":"Authorization","value":"Bearer s3cret"}]}]}}`))
+	trace.record(TraceIn, []byte(`{"jsonrpc":"2.0","id":1,"result":null}`))
+
+	path, _ := tracer.Path("session-one")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for _, secret := range []string{"hunter2", "s3cret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("trace contains secret %q", secret)
+		}
+	}
+	for _, kept := range []string{"DB_PASSWORD", "Authorization", "https://mcp.example.com", redactedValue} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("trace lacks %q", kept)
+		}
+	}
+}
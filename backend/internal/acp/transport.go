@@ -0,0 +1,246 @@
+package acp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Transports an agent can be reached over, see AgentConfig.Transport
+const (
+	TransportStdio     = "stdio"     // Spawn Command and talk over its stdin and stdout
+	TransportUnix      = "unix"      // Connect to an agent listening on a Unix socket
+	TransportWebSocket = "websocket" // Connect to a remote agent over ws:// or wss://
+)
+
+// dialTimeout bounds connecting to an agent that isn't spawned
+const dialTimeout = 10 * time.Second
+
+// maxFrameSize bounds one message from an agent
+// It leaves room for a whole text file in fs/write_text_file, a large diff in a tool_call or the
+// history replayed by session/load, all JSON-escaped.
+const maxFrameSize = 64 << 20
+
+// newFrameScanner reads newline-delimited messages of up to maxFrameSize bytes
+func newFrameScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxFrameSize)
+	return scanner
+}
+
+// Transport carries the JSON-RPC messages of a connection to an agent, one message per frame
+// A transport is not restarted: when it goes away the supervisor connects a new one.
+type Transport interface {
+	// Send writes one message, it is safe for concurrent use
+	Send(frame []byte) error
+	// Receive reads the next message, io.EOF once the connection is closed
+	// Only the read loop of the connection calls it.
+	Receive() ([]byte, error)
+	// Close shuts the connection down gracefully, a spawned agent is given time to exit
+	Close() error
+	// Kill shuts the connection down at once
+	Kill() error
+	// Wait blocks until the connection is gone and returns why, nil after Close
+	Wait() error
+	// StderrTail returns the last lines the agent logged, if the transport can see them
+	StderrTail() []string
+}
+
+// Connect opens the transport of an agent: spawns it, or connects to it
+func Connect(agent AgentConfig) (Transport, error) {
+	switch agent.Transport {
+	case "", TransportStdio:
+		return SpawnAgent(agent)
+	case TransportUnix:
+		return DialUnix(agent.Address)
+	case TransportWebSocket:
+		return DialWebSocket(agent.Address, agent.Headers)
+	default:
+		return nil, fmt.Errorf("agent %s: unknown transport %q", agent.Name, agent.Transport)
+	}
+}
+
+// connState tracks when a network transport went away and why
+type connState struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// finish records the end of the connection, the first reason wins
+func (s *connState) finish(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+func (s *connState) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// SocketTransport is a connection to an agent over a stream socket, messages are newline-delimited
+type SocketTransport struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	mu      sync.Mutex // Serializes writes
+	state   connState
+}
+
+// DialUnix connects to an agent listening on a Unix socket
+func DialUnix(path string) (*SocketTransport, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", path, err)
+	}
+	return NewSocketTransport(conn), nil
+}
+
+// NewSocketTransport wraps an established connection to an agent
+func NewSocketTransport(conn net.Conn) *SocketTransport {
+	return &SocketTransport{
+		conn:    conn,
+		scanner: newFrameScanner(conn),
+		state:   connState{done: make(chan struct{})},
+	}
+}
+
+// Send writes one message followed by a newline
+func (t *SocketTransport) Send(frame []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.conn.Write(append(frame, '\n'))
+	return err
+}
+
+// Receive reads the next line
+func (t *SocketTransport) Receive() ([]byte, error) {
+	if t.scanner.Scan() {
+		return append([]byte(nil), t.scanner.Bytes()...), nil
+	}
+
+	err := t.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	t.state.finish(fmt.Errorf("connection lost: %w", err))
+	return nil, err
+}
+
+// Close closes the connection
+func (t *SocketTransport) Close() error {
+	t.state.finish(nil)
+	return t.conn.Close()
+}
+
+// Kill closes the connection, there is nothing more forceful to do
+func (t *SocketTransport) Kill() error {
+	return t.Close()
+}
+
+// Wait blocks until the connection is closed or lost
+func (t *SocketTransport) Wait() error {
+	<-t.state.done
+	return t.state.err
+}
+
+// StderrTail returns nothing, the agent logs on its own machine
+func (t *SocketTransport) StderrTail() []string {
+	return nil
+}
+
+// WebSocketTransport is a connection to a remote agent over a WebSocket, one message per text frame
+type WebSocketTransport struct {
+	conn  *websocket.Conn
+	mu    sync.Mutex // Serializes writes
+	state connState
+}
+
+// DialWebSocket connects to a remote agent, headers are sent with the handshake (e.g. Authorization)
+func DialWebSocket(url string, headers map[string]string) (*WebSocketTransport, error) {
+	header := http.Header{}
+	for key, value := range headers {
+		header.Set(key, value)
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: dialTimeout, Proxy: http.ProxyFromEnvironment}
+	conn, resp, err := dialer.Dial(url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w (HTTP %d)", url, err, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+	conn.SetReadLimit(maxFrameSize)
+
+	return &WebSocketTransport{conn: conn, state: connState{done: make(chan struct{})}}, nil
+}
+
+// Send writes one message as a text frame
+func (t *WebSocketTransport) Send(frame []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	return t.conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+// Receive reads the next frame
+func (t *WebSocketTransport) Receive() ([]byte, error) {
+	for {
+		kind, data, err := t.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) || t.state.closed() {
+				err = io.EOF
+			}
+			t.state.finish(fmt.Errorf("connection lost: %w", err))
+			return nil, err
+		}
+
+		data = bytes.TrimSpace(data)
+		if kind == websocket.TextMessage && len(data) > 0 {
+			return data, nil
+		}
+	}
+}
+
+// Close says goodbye to the agent and closes the connection
+func (t *WebSocketTransport) Close() error {
+	t.state.finish(nil)
+
+	// The agent may be gone already, the connection is closed either way
+	t.mu.Lock()
+	t.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	t.mu.Unlock()
+
+	return t.conn.Close()
+}
+
+// Kill closes the connection without the closing handshake
+func (t *WebSocketTransport) Kill() error {
+	t.state.finish(nil)
+	return t.conn.Close()
+}
+
+// Wait blocks until the connection is closed or lost
+func (t *WebSocketTransport) Wait() error {
+	<-t.state.done
+	return t.state.err
+}
+
+// StderrTail returns nothing, the agent logs on its own machine
+func (t *WebSocketTransport) StderrTail() []string {
+	return nil
+}
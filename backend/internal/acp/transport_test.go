@@ -0,0 +1,49 @@
+package acp
+
+import (
+	"bytes"
+	"net"
+	"os/exec"
+	"testing"
+)
+
+// largeFrame is well beyond the 64 KiB default line limit of bufio.Scanner
+var largeFrame = append(append([]byte(`{"jsonrpc":"2.0","method":"session/update","params":{"text":"`),
+	bytes.Repeat([]byte("a"), 1<<20)...), `"}}`...)
+
+func TestSocketTransportLargeFrame(t *testing.T) {
+	agentSide, clientSide := net.Pipe()
+	defer agentSide.Close()
+
+	transport := NewSocketTransport(clientSide)
+	defer transport.Kill()
+
+	go agentSide.Write(append(largeFrame, '\n'))
+
+	frame, err := transport.Receive()
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if !bytes.Equal(frame, largeFrame) {
+		t.Errorf("Receive() returned %d bytes, want %d", len(frame), len(largeFrame))
+	}
+}
+
+func TestProcessLargeFrame(t *testing.T) {
+	process, err := startProcess(exec.Command("cat"))
+	if err != nil {
+		t.Fatalf("startProcess() error = %v", err)
+	}
+	defer process.Kill()
+
+	// cat only takes more input once its output is read
+	go process.Send(largeFrame)
+
+	frame, err := process.Receive()
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if !bytes.Equal(frame, largeFrame) {
+		t.Errorf("Receive() returned %d bytes, want %d", len(frame), len(largeFrame))
+	}
+}
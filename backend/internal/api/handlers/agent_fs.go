@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+)
+
+// handleReadTextFile answers an fs/read_text_file request from the agent
+func (h *MessageHandler) handleReadTextFile(client *acp.ACPClient, scope workspace.Scope, req *acp.JSONRPCIncomingRequest) {
+	readReq, err := acp.ParseReadTextFileRequest(req)
+	if err != nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInvalidParams, Message: err.Error()})
+		return
+	}
+	if h.workspaceService == nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInternal, Message: "file access is not available"})
+		return
+	}
+
+	log.Printf("📖 [%s] Agent reads %s", scope.SessionID[:8], readReq.Path)
+	content, err := h.workspaceService.ReadTextFile(context.Background(), scope, readReq.Path, readReq.Line, readReq.Limit)
+	if err != nil {
+		log.Printf("⚠️  Refused read of %s: %v", readReq.Path, err)
+		h.respondError(client, *req.ID, toRPCError(err))
+		return
+	}
+
+	if err := client.SendResponse(*req.ID, acp.ReadTextFileResponse{Content: content}); err != nil {
+		log.Printf("❌ Failed to send read_text_file response: %v", err)
+	}
+}
+
+// handleWriteTextFile answers an fs/write_text_file request from the agent
+// Every write is recorded and announced so clients can show the diff and undo it
+func (h *MessageHandler) handleWriteTextFile(client *acp.ACPClient, scope workspace.Scope, req *acp.JSONRPCIncomingRequest) {
+	writeReq, err := acp.ParseWriteTextFileRequest(req)
+	if err != nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInvalidParams, Message: err.Error()})
+		return
+	}
+	if h.workspaceService == nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInternal, Message: "file access is not available"})
+		return
+	}
+
+	log.Printf("✏️  [%s] Agent writes %s (%d bytes)", scope.SessionID[:8], writeReq.Path, len(writeReq.Content))
+	write, err := h.workspaceService.WriteTextFile(context.Background(), scope, writeReq.Path, writeReq.Content)
+	if err != nil {
+		log.Printf("⚠️  Refused write of %s: %v", writeReq.Path, err)
+		h.respondError(client, *req.ID, toRPCError(err))
+		return
+	}
+
+	if h.wsHandler != nil {
+		h.wsHandler.BroadcastFileWrite(write)
+	}
+
+	// WriteTextFileResponse is empty
+	if err := client.SendResponse(*req.ID, struct{}{}); err != nil {
+		log.Printf("❌ Failed to send write_text_file response: %v", err)
+	}
+}
+
+// respondError answers a request from the agent with a JSON-RPC error
+func (h *MessageHandler) respondError(client *acp.ACPClient, requestID int, rpcErr *acp.RPCError) {
+	if err := client.SendError(requestID, rpcErr); err != nil {
+		log.Printf("❌ Failed to send error response: %v", err)
+	}
+}
+
+// toRPCError maps a domain error to the JSON-RPC error the agent gets
+func toRPCError(err error) *acp.RPCError {
+	var notFoundErr *domain.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return &acp.RPCError{Code: acp.ErrCodeResourceNotFound, Message: err.Error()}
+	}
+
+	var validationErr *domain.ValidationError
+	var forbiddenErr *domain.ForbiddenError
+	if errors.As(err, &validationErr) || errors.As(err, &forbiddenErr) {
+		return &acp.RPCError{Code: acp.ErrCodeInvalidParams, Message: err.Error()}
+	}
+
+	return &acp.RPCError{Code: acp.ErrCodeInternal, Message: err.Error()}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+)
+
+// handleTerminalCreate answers a terminal/create request from the agent
+// The permission policy decides whether the command may run before anything is spawned
+func (h *MessageHandler) handleTerminalCreate(client *acp.ACPClient, scope workspace.Scope, req *acp.JSONRPCIncomingRequest) {
+	createReq, err := acp.ParseCreateTerminalRequest(req)
+	if err != nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInvalidParams, Message: err.Error()})
+		return
+	}
+	if h.terminals == nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInternal, Message: "terminals are not available"})
+		return
+	}
+
+	command := createReq.CommandLine()
+	if err := h.authorizeCommand(scope, command); err != nil {
+		log.Printf("🚫 [%s] Refused to run %q: %v", scope.SessionID[:8], command, err)
+		h.respondError(client, *req.ID, toRPCError(err))
+		return
+	}
+
+	opts := workspace.TerminalOptions{
+		Command: createReq.Command,
+		Args:    createReq.Args,
+		Env:     make(map[string]string, len(createReq.Env)),
+		Cwd:     createReq.Cwd,
+	}
+	for _, env := range createReq.Env {
+		opts.Env[env.Name] = env.Value
+	}
+	if createReq.OutputByteLimit != nil {
+		opts.OutputByteLimit = *createReq.OutputByteLimit
+	}
+
+	term, err := h.terminals.Create(scope, opts)
+	if err != nil {
+		log.Printf("❌ [%s] Failed to create terminal for %q: %v", scope.SessionID[:8], command, err)
+		h.respondError(client, *req.ID, toRPCError(err))
+		return
+	}
+
+	log.Printf("💻 [%s] Terminal %s runs %q in %s", scope.SessionID[:8], term.ID[:8], command, term.Cwd)
+	if err := client.SendResponse(*req.ID, acp.CreateTerminalResponse{TerminalID: term.ID}); err != nil {
+		log.Printf("❌ Failed to send terminal/create response: %v", err)
+	}
+}
+
+// authorizeCommand applies the permission policy to a command the agent wants to run
+func (h *MessageHandler) authorizeCommand(scope workspace.Scope, command string) error {
+	if h.permissionHandler != nil {
+		return h.permissionHandler.AuthorizeCommand(context.Background(), PermissionScope{
+			SpaceID:        scope.SpaceID,
+			SpacePath:      scope.SpacePath,
+			ConversationID: scope.ConversationID,
+		}, scope.SessionID, command)
+	}
+
+	// Without a permission handler only the built-in policy applies, and nobody can be asked
+	decision := permission.NewEngine(nil).Evaluate(context.Background(), scope.SpacePath, permission.ToolCall{
+		Kind:     "execute",
+		RawInput: map[string]interface{}{"command": command},
+	})
+	if decision.Action != permission.ActionAllow {
+		return domain.NewForbiddenError("terminal", decision.Reason)
+	}
+	return nil
+}
+
+// handleTerminalRequest answers terminal/output, wait_for_exit, kill and release requests
+func (h *MessageHandler) handleTerminalRequest(client *acp.ACPClient, scope workspace.Scope, req *acp.JSONRPCIncomingRequest) {
+	termReq, err := acp.ParseTerminalRequest(req)
+	if err != nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInvalidParams, Message: err.Error()})
+		return
+	}
+	if h.terminals == nil {
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInternal, Message: "terminals are not available"})
+		return
+	}
+
+	var result interface{}
+	switch req.Method {
+	case acp.MethodTerminalRelease:
+		err = h.terminals.Release(scope.SessionID, termReq.TerminalID)
+		result = struct{}{}
+
+	default:
+		var term *workspace.Terminal
+		term, err = h.terminals.Get(scope.SessionID, termReq.TerminalID)
+		if err != nil {
+			break
+		}
+
+		switch req.Method {
+		case acp.MethodTerminalOutput:
+			output, truncated, exit := term.Output()
+			result = acp.TerminalOutputResponse{Output: output, Truncated: truncated, ExitStatus: toACPExitStatus(exit)}
+		case acp.MethodTerminalWaitForExit:
+			// Commands are bounded by the terminal timeout, so this wait is too
+			var exit *workspace.ExitStatus
+			exit, err = term.WaitForExit(context.Background())
+			result = toACPExitStatus(exit)
+		case acp.MethodTerminalKill:
+			term.Kill()
+			result = struct{}{}
+		}
+	}
+
+	if err != nil {
+		h.respondError(client, *req.ID, toRPCError(err))
+		return
+	}
+	if err := client.SendResponse(*req.ID, result); err != nil {
+		log.Printf("❌ Failed to send %s response: %v", req.Method, err)
+	}
+}
+
+// toACPExitStatus converts an exit status for the agent, nil while the command runs
+func toACPExitStatus(exit *workspace.ExitStatus) *acp.TerminalExitStatus {
+	if exit == nil {
+		return nil
+	}
+	return &acp.TerminalExitStatus{ExitCode: exit.ExitCode, Signal: exit.Signal}
+}
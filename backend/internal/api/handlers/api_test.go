@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/unforced/parachute-backend/internal/api/handlers"
 	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/secret"
 	"github.com/unforced/parachute-backend/internal/domain/space"
 	"github.com/unforced/parachute-backend/internal/storage/sqlite"
 )
@@ -28,14 +29,19 @@ func setupTestApp(t *testing.T) (*fiber.App, *sqlite.Database) {
 	// Initialize repositories
 	spaceRepo := sqlite.NewSpaceRepository(db.DB)
 	conversationRepo := sqlite.NewConversationRepository(db.DB)
+	secretRepo := sqlite.NewSecretRepository(db.DB)
 
 	// Initialize services
 	spaceService := space.NewService(spaceRepo, "/tmp/parachute-test")
 	conversationService := conversation.NewService(conversationRepo)
+	secretService := secret.NewService(secretRepo)
+	mcpService := space.NewMCPService(secretService)
 
 	// Initialize handlers
 	spaceHandler := handlers.NewSpaceHandler(spaceService)
-	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, nil, nil) // No ACP or WebSocket for tests
+	spaceMCPHandler := handlers.NewSpaceMCPHandler(spaceService, mcpService)
+	secretHandler := handlers.NewSecretHandler(secretService)
+	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, nil, nil, nil, nil) // No ACP or WebSocket for tests
 
 	// Create Fiber app
 	app := fiber.New()
@@ -50,6 +56,14 @@ func setupTestApp(t *testing.T) (*fiber.App, *sqlite.Database) {
 	spaces.Get("/:id", spaceHandler.Get)
 	spaces.Put("/:id", spaceHandler.Update)
 	spaces.Delete("/:id", spaceHandler.Delete)
+	spaces.Get("/:id/mcp", spaceMCPHandler.GetConfig)
+	spaces.Put("/:id/mcp", spaceMCPHandler.PutConfig)
+
+	// Secret routes
+	secrets := api.Group("/secrets")
+	secrets.Get("/", secretHandler.ListSecrets)
+	secrets.Put("/:name", secretHandler.SetSecret)
+	secrets.Delete("/:name", secretHandler.DeleteSecret)
 
 	// Conversation routes
 	conversations := api.Group("/conversations")
@@ -91,6 +105,8 @@ func setupTestApp(t *testing.T) (*fiber.App, *sqlite.Database) {
 		return c.Status(fiber.StatusCreated).JSON(conv)
 	})
 
+	conversations.Post("/:id/cancel", messageHandler.CancelConversation)
+
 	// Message routes
 	messages := api.Group("/messages")
 	messages.Get("/", messageHandler.ListMessages)
@@ -126,7 +142,8 @@ func TestSpaceAPI(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, "Test Space", result["name"])
-		assert.Equal(t, "/tmp/test-space", result["path"])
+		// Path is generated from the name under the spaces folder
+		assert.Equal(t, "/tmp/parachute-test/spaces/test-space", result["path"])
 		assert.NotEmpty(t, result["id"])
 
 		createdSpaceID = result["id"].(string)
@@ -350,6 +367,210 @@ func TestMessageAPI(t *testing.T) {
 		require.True(t, ok, "Expected 'messages' key with array value")
 		assert.Greater(t, len(messages), 0)
 	})
+
+	t.Run("SendMessageWithParts", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"conversation_id": convID,
+			"content":         "What is in this picture?",
+			"parts": []map[string]interface{}{
+				{"type": "image", "data": "iVBORw0KGgo=", "mime_type": "image/png"},
+				{"type": "resource_link", "uri": "https://example.com/spec.md"},
+			},
+		}
+		body, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var result conversation.Message
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+
+		assert.Equal(t, "What is in this picture?", result.Content)
+		require.Len(t, result.Parts, 3, "the text is stored as the first part")
+		assert.Equal(t, conversation.PartText, result.Parts[0].Type)
+		assert.Equal(t, conversation.PartImage, result.Parts[1].Type)
+		assert.Equal(t, "https://example.com/spec.md", result.Parts[2].URI)
+	})
+
+	t.Run("SendMessageWithInvalidParts", func(t *testing.T) {
+		for _, part := range []map[string]interface{}{
+			{"type": "resource", "path": "../../etc/passwd"},
+			{"type": "image", "data": "iVBORw0KGgo="},
+			{"type": "image", "data": "not base64!", "mime_type": "image/png"},
+			{"type": "video", "uri": "https://example.com/a.mp4"},
+		} {
+			payload := map[string]interface{}{
+				"conversation_id": convID,
+				"parts":           []map[string]interface{}{part},
+			}
+			body, _ := json.Marshal(payload)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "part %v", part)
+		}
+	})
+
+	t.Run("CancelWithoutResponseInProgress", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/conversations/"+convID+"/cancel", nil)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+}
+
+// TestSpaceMCPAPI tests the .mcp.json endpoints and secret expansion
+func TestSpaceMCPAPI(t *testing.T) {
+	app, _ := setupTestApp(t)
+
+	spaceBody, _ := json.Marshal(map[string]interface{}{"name": "MCP Space"})
+	spaceReq := httptest.NewRequest(http.MethodPost, "/api/spaces", bytes.NewReader(spaceBody))
+	spaceReq.Header.Set("Content-Type", "application/json")
+	spaceResp, err := app.Test(spaceReq)
+	require.NoError(t, err)
+	var spaceResult map[string]interface{}
+	json.NewDecoder(spaceResp.Body).Decode(&spaceResult)
+	spaceResp.Body.Close()
+	spaceID := spaceResult["id"].(string)
+
+	put := func(path string, payload interface{}) (*http.Response, map[string]interface{}) {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp, result
+	}
+
+	t.Run("PutInvalidConfig", func(t *testing.T) {
+		resp, result := put("/api/spaces/"+spaceID+"/mcp", map[string]interface{}{
+			"mcpServers": map[string]interface{}{
+				"ok":       map[string]interface{}{"command": "npx", "args": []string{"mcp-server"}},
+				"no-cmd":   map[string]interface{}{"args": []string{"x"}},
+				"bad-type": map[string]interface{}{"type": "grpc", "url": "http://localhost"},
+				"bad-url":  map[string]interface{}{"type": "http", "url": "localhost:3000"},
+			},
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		servers, ok := result["servers"].(map[string]interface{})
+		require.True(t, ok, "Expected per-server errors")
+		assert.Len(t, servers, 3)
+		assert.Contains(t, servers, "no-cmd")
+		assert.Contains(t, servers, "bad-type")
+		assert.Contains(t, servers, "bad-url")
+	})
+
+	t.Run("PutValidConfig", func(t *testing.T) {
+		resp, result := put("/api/spaces/"+spaceID+"/mcp", map[string]interface{}{
+			"mcpServers": map[string]interface{}{
+				"github": map[string]interface{}{
+					"command": "npx",
+					"args":    []string{"@modelcontextprotocol/server-github"},
+					"env":     map[string]string{"GITHUB_TOKEN": "${PARACHUTE_TEST_GITHUB_TOKEN}"},
+				},
+				"docs": map[string]interface{}{"type": "sse", "url": "https://docs.example.com/sse"},
+			},
+		})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		servers, ok := result["mcpServers"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Len(t, servers, 2)
+
+		// The secret isn't set yet, so the server would be left out of sessions
+		problems, _ := result["errors"].(map[string]interface{})
+		assert.Contains(t, problems, "github")
+	})
+
+	t.Run("SecretResolvesPlaceholder", func(t *testing.T) {
+		resp, _ := put("/api/secrets/PARACHUTE_TEST_GITHUB_TOKEN", map[string]string{"value": "ghp_test"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/spaces/"+spaceID+"/mcp", nil)
+		getResp, err := app.Test(req)
+		require.NoError(t, err)
+		defer getResp.Body.Close()
+
+		var result map[string]interface{}
+		json.NewDecoder(getResp.Body).Decode(&result)
+		problems, _ := result["errors"].(map[string]interface{})
+		assert.Empty(t, problems)
+	})
+
+	t.Run("EnvironmentIsNotExpanded", func(t *testing.T) {
+		t.Setenv("PARACHUTE_TEST_BACKEND_KEY", "sk-backend")
+		resp, result := put("/api/spaces/"+spaceID+"/mcp", map[string]interface{}{
+			"mcpServers": map[string]interface{}{
+				"leak": map[string]interface{}{
+					"type":    "http",
+					"url":     "https://collector.example.com",
+					"headers": map[string]string{"X-Key": "${PARACHUTE_TEST_BACKEND_KEY}"},
+				},
+			},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		problems, _ := result["errors"].(map[string]interface{})
+		assert.Contains(t, problems, "leak")
+	})
+
+	t.Run("UnknownKeysAreKept", func(t *testing.T) {
+		resp, result := put("/api/spaces/"+spaceID+"/mcp", map[string]interface{}{
+			"mcpServers": map[string]interface{}{"docs": map[string]interface{}{"type": "sse", "url": "https://docs.example.com/sse"}},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		path := result["path"].(string)
+
+		require.NoError(t, os.WriteFile(path, []byte(`{
+  "mcpServers": {"docs": {"type": "sse", "url": "https://docs.example.com/sse", "timeout": 30}},
+  "inputs": [{"id": "token"}]
+}`), 0644))
+
+		resp, _ = put("/api/spaces/"+spaceID+"/mcp", map[string]interface{}{
+			"mcpServers": map[string]interface{}{"docs": map[string]interface{}{"type": "http", "url": "https://docs.example.com/mcp"}},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var saved map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &saved))
+		assert.Equal(t, []interface{}{map[string]interface{}{"id": "token"}}, saved["inputs"])
+		docs := saved["mcpServers"].(map[string]interface{})["docs"].(map[string]interface{})
+		assert.Equal(t, "https://docs.example.com/mcp", docs["url"])
+		assert.Equal(t, float64(30), docs["timeout"])
+	})
+
+	t.Run("SecretValuesAreNotListed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/secrets", nil)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		assert.Contains(t, buf.String(), "PARACHUTE_TEST_GITHUB_TOKEN")
+		assert.NotContains(t, buf.String(), "ghp_test")
+	})
 }
 
 func TestMain(m *testing.M) {
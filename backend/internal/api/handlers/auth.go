@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/device"
+)
+
+// deviceLocal is the request local holding the authenticated device
+const deviceLocal = "device"
+
+// NewAuthMiddleware returns middleware that rejects requests without a valid device token
+// The token is a bearer token in the Authorization header or, for clients that can't set headers
+// such as browser WebSockets and EventSource, the token query parameter on /ws and the event
+// streams. It also guards the WebSocket upgrade, so /ws goes through the same check.
+func NewAuthMiddleware(deviceService *device.Service) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		token := bearerToken(c)
+		if token == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+			return HandleError(c, domain.NewUnauthorizedError("a device token is required"))
+		}
+
+		dev, err := deviceService.Authenticate(c.Context(), token)
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return HandleError(c, err)
+		}
+
+		c.Locals(deviceLocal, dev)
+		return c.Next()
+	}
+}
+
+// AuthenticatedDevice returns the device that made a request, nil if auth is disabled
+func AuthenticatedDevice(c fiber.Ctx) *device.Device {
+	dev, _ := c.Locals(deviceLocal).(*device.Device)
+	return dev
+}
+
+// bearerToken returns the token of a request, from the Authorization header or the token query parameter
+func bearerToken(c fiber.Ctx) string {
+	if header := c.Get(fiber.HeaderAuthorization); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+	if queryTokenAllowed(c) {
+		return c.Query("token")
+	}
+	return ""
+}
+
+// queryTokenAllowed reports whether a request may carry its token in the query string
+// Only the WebSocket upgrade and the Server-Sent Events streams may: their browser clients can't
+// set headers. Anywhere else the token would just end up in logs and browser history.
+func queryTokenAllowed(c fiber.Ctx) bool {
+	path := strings.TrimSuffix(c.Path(), "/")
+	switch {
+	case path == "/ws":
+		return true
+	case c.Method() == fiber.MethodGet && strings.HasPrefix(path, "/api/conversations/") && strings.HasSuffix(path, "/events"):
+		return true
+	case c.Method() == fiber.MethodPost && path == "/api/messages" && c.Query("stream") == "true":
+		return true
+	}
+	return false
+}
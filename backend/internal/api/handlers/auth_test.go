@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/domain/device"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+// TestAuthMiddleware tests that only requests with a valid device token get through
+func TestAuthMiddleware(t *testing.T) {
+	db, err := sqlite.NewDatabase(t.TempDir() + "/test.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	deviceService := device.NewService(sqlite.NewDeviceRepository(db.DB))
+	dev, token, err := deviceService.IssueToken(t.Context(), device.IssueParams{Name: "Test"})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Get("/health", func(c fiber.Ctx) error { return c.SendString("ok") })
+	api := app.Group("/api", NewAuthMiddleware(deviceService))
+	whoami := func(c fiber.Ctx) error {
+		return c.SendString(AuthenticatedDevice(c).ID)
+	}
+	api.Get("/whoami", whoami)
+	api.Get("/conversations/:id/events", whoami)
+
+	request := func(path, authorization string) (int, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body := make([]byte, 256)
+		n, _ := resp.Body.Read(body)
+		return resp.StatusCode, string(body[:n])
+	}
+
+	status, _ := request("/health", "")
+	assert.Equal(t, 200, status, "routes outside the group stay open")
+
+	status, body := request("/api/whoami", "Bearer "+token)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, dev.ID, body)
+
+	status, body = request("/api/conversations/c1/events?token="+token, "")
+	assert.Equal(t, 200, status, "the query parameter works for EventSource")
+	assert.Equal(t, dev.ID, body)
+
+	status, _ = request("/api/whoami?token="+token, "")
+	assert.Equal(t, 401, status, "the query parameter only works for /ws and event streams")
+
+	for _, authorization := range []string{"", "Bearer", "Basic " + token, "Bearer " + token + "x"} {
+		status, _ = request("/api/whoami", authorization)
+		assert.Equal(t, 401, status, "authorization %q", authorization)
+	}
+
+	require.NoError(t, deviceService.RevokeDevice(t.Context(), dev.ID))
+	status, body = request("/api/whoami", "Bearer "+token)
+	assert.Equal(t, 401, status)
+	assert.Contains(t, body, "revoked")
+}
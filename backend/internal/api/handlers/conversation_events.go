@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// eventBuffer is how many events a subscriber may lag behind before it is dropped
+const eventBuffer = 256
+
+// conversationEvents fans the events of each conversation out to its subscribers
+type conversationEvents struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan WSMessage]struct{} // ConversationID -> subscribers
+}
+
+func newConversationEvents() *conversationEvents {
+	return &conversationEvents{subscribers: make(map[string]map[chan WSMessage]struct{})}
+}
+
+// subscribe registers a subscriber to a conversation, see WebSocketHandler.Subscribe
+func (e *conversationEvents) subscribe(conversationID string) (<-chan WSMessage, func()) {
+	ch := make(chan WSMessage, eventBuffer)
+
+	e.mu.Lock()
+	if e.subscribers[conversationID] == nil {
+		e.subscribers[conversationID] = make(map[chan WSMessage]struct{})
+	}
+	e.subscribers[conversationID][ch] = struct{}{}
+	e.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.remove(conversationID, ch)
+		})
+	}
+}
+
+// publish sends an event to the subscribers of a conversation without blocking
+// A subscriber whose buffer is full is dropped: a stream with holes is worse than a closed one.
+func (e *conversationEvents) publish(conversationID string, msg WSMessage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for ch := range e.subscribers[conversationID] {
+		select {
+		case ch <- msg:
+		default:
+			slog.Warn("Dropping conversation subscriber that fell behind", "conversation_id", conversationID)
+			e.remove(conversationID, ch)
+		}
+	}
+}
+
+// remove closes a subscriber's channel if it is still registered, e.mu must be held
+func (e *conversationEvents) remove(conversationID string, ch chan WSMessage) {
+	subscribers := e.subscribers[conversationID]
+	if _, ok := subscribers[ch]; !ok {
+		return
+	}
+	delete(subscribers, ch)
+	close(ch)
+	if len(subscribers) == 0 {
+		delete(e.subscribers, conversationID)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+// DebugHandler serves diagnostics meant for developers, such as the traces of ACP sessions
+type DebugHandler struct {
+	tracer *acp.Tracer
+}
+
+// NewDebugHandler creates a new debug handler
+// tracer can be nil when tracing is off, in which case no session has a trace
+func NewDebugHandler(tracer *acp.Tracer) *DebugHandler {
+	return &DebugHandler{tracer: tracer}
+}
+
+// GetSessionTrace handles GET /api/debug/sessions/:id/trace
+// Returns the JSON-RPC traffic recorded for an ACP session, one JSON entry per line
+func (h *DebugHandler) GetSessionTrace(c fiber.Ctx) error {
+	if h.tracer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tracing is off, start the server with ACP_TRACE=true",
+		})
+	}
+
+	f, err := h.tracer.Open(c.Params("id"))
+	if errors.Is(err, acp.ErrNoTrace) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No trace for this session",
+		})
+	}
+	if err != nil {
+		slog.Error("Failed to open session trace", "error", err, "session_id", c.Params("id"))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read trace",
+		})
+	}
+
+	c.Set("Content-Type", "application/x-ndjson")
+	return c.SendStream(f)
+}
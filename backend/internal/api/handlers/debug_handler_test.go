@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+// TestGetSessionTrace tests serving the trace of a session
+func TestGetSessionTrace(t *testing.T) {
+	tracer := acp.NewTracer(t.TempDir())
+	path, err := tracer.Path("session-1")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(tracer.Dir(), 0755))
+	trace := `{"time":"2026-01-02T03:04:05Z","direction":"out","message":{"jsonrpc":"2.0","id":1,"method":"initialize"}}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(trace), 0644))
+
+	get := func(handler *DebugHandler, sessionID string) (int, string) {
+		app := fiber.New()
+		app.Get("/api/debug/sessions/:id/trace", handler.GetSessionTrace)
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/debug/sessions/"+sessionID+"/trace", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get(NewDebugHandler(tracer), "session-1")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, trace, body)
+
+	status, _ = get(NewDebugHandler(tracer), "session-2")
+	assert.Equal(t, fiber.StatusNotFound, status)
+
+	status, _ = get(NewDebugHandler(nil), "session-1")
+	assert.Equal(t, fiber.StatusNotFound, status)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/domain/device"
+)
+
+// DeviceHandler handles paired devices and the pairing of new ones
+type DeviceHandler struct {
+	deviceService *device.Service
+}
+
+// NewDeviceHandler creates a new device handler
+func NewDeviceHandler(deviceService *device.Service) *DeviceHandler {
+	return &DeviceHandler{deviceService: deviceService}
+}
+
+// ListDevices handles GET /api/devices
+func (h *DeviceHandler) ListDevices(c fiber.Ctx) error {
+	devices, err := h.deviceService.ListDevices(c.Context())
+	if err != nil {
+		slog.Error("Failed to list devices", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list devices",
+		})
+	}
+
+	currentID := ""
+	if dev := AuthenticatedDevice(c); dev != nil {
+		currentID = dev.ID
+	}
+
+	return c.JSON(fiber.Map{
+		"devices":           devices,
+		"current_device_id": currentID,
+	})
+}
+
+// RevokeDevice handles DELETE /api/devices/:id
+func (h *DeviceHandler) RevokeDevice(c fiber.Ctx) error {
+	if err := h.deviceService.RevokeDevice(c.Context(), c.Params("id")); err != nil {
+		return HandleError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// StartPairing handles POST /api/devices/pairing
+// A paired device, typically the desktop app, asks for a code to show to the device being added.
+// Body (optional): {"ttl_seconds": 600}
+func (h *DeviceHandler) StartPairing(c fiber.Ctx) error {
+	var body struct {
+		TTLSeconds int `json:"ttl_seconds"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.Bind().JSON(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	ttl := time.Duration(body.TTLSeconds) * time.Second
+	if ttl > time.Hour {
+		ttl = time.Hour
+	}
+
+	pairing, err := h.deviceService.StartPairing(c.Context(), c.BaseURL(), ttl)
+	if err != nil {
+		return HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(pairing)
+}
+
+// Pair handles POST /api/devices/pair, the one device route that needs no token
+// Body: {"code": "K7QM-2XWD", "name": "Pixel 8", "platform": "android"}
+// The token in the response is only ever shown once.
+func (h *DeviceHandler) Pair(c fiber.Ctx) error {
+	var params device.PairParams
+	if err := c.Bind().JSON(&params); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	dev, token, err := h.deviceService.Pair(c.Context(), params)
+	if err != nil {
+		slog.Warn("Pairing attempt failed", "error", err, "ip", c.IP())
+		return HandleError(c, err)
+	}
+
+	slog.Info("Device paired", "device_id", dev.ID, "name", dev.Name, "platform", dev.Platform)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"device": dev,
+		"token":  token,
+	})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/domain/device"
+	"github.com/unforced/parachute-backend/internal/domain/file"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+// TestDevicePairing tests pairing a device and uploading a capture with its token
+func TestDevicePairing(t *testing.T) {
+	db, err := sqlite.NewDatabase(t.TempDir() + "/test.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	deviceService := device.NewService(sqlite.NewDeviceRepository(db.DB))
+	fileService, err := file.NewService(t.TempDir())
+	require.NoError(t, err)
+
+	deviceHandler := NewDeviceHandler(deviceService)
+	fileHandler := NewFileHandler(fileService)
+	fileHandler.SetDeviceService(deviceService)
+
+	// Same layout as main: pairing is open, the rest of /api needs a token
+	app := fiber.New()
+	app.Post("/api/devices/pair", deviceHandler.Pair)
+	api := app.Group("/api", NewAuthMiddleware(deviceService))
+	api.Get("/devices", deviceHandler.ListDevices)
+	api.Post("/devices/pairing", deviceHandler.StartPairing)
+	api.Post("/captures/upload", fileHandler.UploadCapture)
+
+	do := func(method, path, token, contentType string, body io.Reader) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+	pair := func(code string) (int, map[string]interface{}) {
+		body, _ := json.Marshal(device.PairParams{Code: code, Name: "Pixel 8", Platform: "android"})
+		return do("POST", "/api/devices/pair", "", "application/json", bytes.NewReader(body))
+	}
+
+	_, desktopToken, err := deviceService.IssueToken(t.Context(), device.IssueParams{Name: "Desktop", Platform: "macos"})
+	require.NoError(t, err)
+
+	status, _ := do("POST", "/api/devices/pairing", "", "", nil)
+	assert.Equal(t, 401, status, "only a paired device can start pairing")
+
+	status, pairing := do("POST", "/api/devices/pairing", desktopToken, "", nil)
+	require.Equal(t, 201, status)
+	code := pairing["code"].(string)
+	assert.Contains(t, pairing["qr_payload"], "parachute://pair?code="+code)
+
+	status, _ = pair("ZZZZ-ZZZZ")
+	assert.Equal(t, 401, status)
+
+	status, paired := pair(code)
+	require.Equal(t, 201, status)
+	phoneToken := paired["token"].(string)
+	phoneID := paired["device"].(map[string]interface{})["id"].(string)
+
+	status, _ = pair(code)
+	assert.Equal(t, 401, status, "a code works once")
+
+	// The capture belongs to the device of the token, whatever the form says
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("audio", "capture.wav")
+	require.NoError(t, err)
+	part.Write([]byte("RIFF"))
+	writer.WriteField("timestamp", "2026-01-02T03:04:05Z")
+	writer.WriteField("deviceId", "spoofed")
+	require.NoError(t, writer.Close())
+
+	status, _ = do("POST", "/api/captures/upload", phoneToken, writer.FormDataContentType(), &form)
+	require.Equal(t, 201, status)
+
+	captures, _, err := fileService.ListCaptures(10, 0)
+	require.NoError(t, err)
+	require.Len(t, captures, 1)
+	assert.Equal(t, phoneID, captures[0].DeviceID)
+	assert.Equal(t, "Pixel 8", captures[0].DeviceName)
+
+	status, listed := do("GET", "/api/devices", phoneToken, "", nil)
+	require.Equal(t, 200, status)
+	assert.Equal(t, phoneID, listed["current_device_id"])
+	devices := listed["devices"].([]interface{})
+	require.Len(t, devices, 2)
+	phone := devices[1].(map[string]interface{})
+	assert.Equal(t, "Pixel 8", phone["name"])
+	assert.Equal(t, "android", phone["platform"])
+	assert.Equal(t, float64(1), phone["upload_count"])
+	assert.NotEmpty(t, phone["last_used_at"])
+	assert.NotContains(t, phone, "token_hash")
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// Bounds of the in-memory log replayed to clients that reconnect mid-response
+const (
+	eventLogSize          = 1000 // Events kept per conversation
+	eventLogConversations = 100  // Conversations kept, the least recently active is dropped first
+)
+
+// eventLog numbers the events of each conversation and keeps the latest ones for replay
+// Sequence numbers start at 1 and only live in memory: after a restart, or once a conversation
+// is dropped from the log, they start over and clients ahead of the log are told to resync.
+type eventLog struct {
+	mu            sync.Mutex
+	conversations map[string]*conversationLog
+}
+
+// conversationLog is the ring of recent events of one conversation
+type conversationLog struct {
+	seq       int64
+	events    []WSMessage // Oldest first, at most eventLogSize
+	updatedAt time.Time
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{conversations: make(map[string]*conversationLog)}
+}
+
+// append assigns the next sequence number of the conversation to msg, as payload seq, and logs it
+func (l *eventLog) append(conversationID string, msg WSMessage) WSMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	log, ok := l.conversations[conversationID]
+	if !ok {
+		l.evict()
+		log = &conversationLog{}
+		l.conversations[conversationID] = log
+	}
+
+	log.seq++
+	log.updatedAt = time.Now()
+	msg.Payload["seq"] = log.seq
+
+	if len(log.events) == eventLogSize {
+		copy(log.events, log.events[1:])
+		log.events = log.events[:eventLogSize-1]
+	}
+	log.events = append(log.events, msg)
+
+	return msg
+}
+
+// since returns the events of a conversation after lastSeq and the current sequence number
+// complete is false when the log no longer holds every event after lastSeq.
+func (l *eventLog) since(conversationID string, lastSeq int64) (events []WSMessage, seq int64, complete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	log, ok := l.conversations[conversationID]
+	if !ok {
+		return nil, 0, lastSeq == 0
+	}
+	if lastSeq > log.seq {
+		return nil, log.seq, false
+	}
+
+	for _, msg := range log.events {
+		if msg.Payload["seq"].(int64) > lastSeq {
+			events = append(events, msg)
+		}
+	}
+	complete = int64(len(events)) == log.seq-lastSeq
+	return events, log.seq, complete
+}
+
+// evict drops the least recently active conversation once the log is full, l.mu must be held
+func (l *eventLog) evict() {
+	if len(l.conversations) < eventLogConversations {
+		return
+	}
+
+	var oldestID string
+	var oldest time.Time
+	for id, log := range l.conversations {
+		if oldestID == "" || log.updatedAt.Before(oldest) {
+			oldestID, oldest = id, log.updatedAt
+		}
+	}
+	delete(l.conversations, oldestID)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLog(t *testing.T) {
+	chunk := func(text string) WSMessage {
+		return WSMessage{Type: "message_chunk", Payload: map[string]interface{}{"chunk": text}}
+	}
+
+	t.Run("NumbersEventsPerConversation", func(t *testing.T) {
+		log := newEventLog()
+
+		assert.Equal(t, int64(1), log.append("conv-a", chunk("a1")).Payload["seq"])
+		assert.Equal(t, int64(2), log.append("conv-a", chunk("a2")).Payload["seq"])
+		assert.Equal(t, int64(1), log.append("conv-b", chunk("b1")).Payload["seq"])
+	})
+
+	t.Run("ReplaysEventsAfterLastSeq", func(t *testing.T) {
+		log := newEventLog()
+		for i := 1; i <= 3; i++ {
+			log.append("conv-a", chunk(fmt.Sprintf("a%d", i)))
+		}
+
+		events, seq, complete := log.since("conv-a", 1)
+		assert.True(t, complete)
+		assert.Equal(t, int64(3), seq)
+		require.Len(t, events, 2)
+		assert.Equal(t, "a2", events[0].Payload["chunk"])
+		assert.Equal(t, "a3", events[1].Payload["chunk"])
+
+		events, _, complete = log.since("conv-a", 3)
+		assert.True(t, complete)
+		assert.Empty(t, events)
+	})
+
+	t.Run("ReportsGaps", func(t *testing.T) {
+		log := newEventLog()
+		for i := 0; i < eventLogSize+5; i++ {
+			log.append("conv-a", chunk("x"))
+		}
+
+		_, _, complete := log.since("conv-a", 2)
+		assert.False(t, complete, "events before the ring must be reported missing")
+
+		events, _, complete := log.since("conv-a", 5)
+		assert.True(t, complete)
+		assert.Len(t, events, eventLogSize)
+
+		// A client ahead of the log, e.g. after a restart
+		_, seq, complete := log.since("conv-a", eventLogSize+10)
+		assert.False(t, complete)
+		assert.Equal(t, int64(eventLogSize+5), seq)
+
+		_, _, complete = log.since("conv-unknown", 3)
+		assert.False(t, complete)
+		_, _, complete = log.since("conv-unknown", 0)
+		assert.True(t, complete)
+	})
+
+	t.Run("DropsLeastRecentConversation", func(t *testing.T) {
+		log := newEventLog()
+		for i := 0; i < eventLogConversations; i++ {
+			log.append(fmt.Sprintf("conv-%d", i), chunk("x"))
+		}
+		log.append("conv-0", chunk("y"))
+		log.append("conv-new", chunk("x"))
+
+		assert.Len(t, log.conversations, eventLogConversations)
+		assert.Contains(t, log.conversations, "conv-0")
+		assert.NotContains(t, log.conversations, "conv-1")
+	})
+}
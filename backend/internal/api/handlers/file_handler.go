@@ -1,16 +1,19 @@
 package handlers
 
 import (
+	"log/slog"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/domain/device"
 	"github.com/unforced/parachute-backend/internal/domain/file"
 )
 
 // FileHandler handles file-related HTTP requests
 type FileHandler struct {
-	fileService *file.Service
+	fileService   *file.Service
+	deviceService *device.Service
 }
 
 // NewFileHandler creates a new file handler
@@ -20,6 +23,11 @@ func NewFileHandler(fileService *file.Service) *FileHandler {
 	}
 }
 
+// SetDeviceService wires the service that counts the captures each device uploads
+func (h *FileHandler) SetDeviceService(deviceService *device.Service) {
+	h.deviceService = deviceService
+}
+
 // UploadCapture handles POST /api/captures/upload
 func (h *FileHandler) UploadCapture(c fiber.Ctx) error {
 	// Parse multipart form
@@ -51,7 +59,13 @@ func (h *FileHandler) UploadCapture(c fiber.Ctx) error {
 		source = "unknown"
 	}
 
-	deviceID := c.FormValue("deviceId")
+	// Captures belong to the device whose token uploaded them; the deviceId field is only
+	// trusted when auth is disabled
+	dev := AuthenticatedDevice(c)
+	deviceID, deviceName := c.FormValue("deviceId"), ""
+	if dev != nil {
+		deviceID, deviceName = dev.ID, dev.Name
+	}
 
 	// Open uploaded file
 	fileReader, err := audioFile.Open()
@@ -62,10 +76,11 @@ func (h *FileHandler) UploadCapture(c fiber.Ctx) error {
 
 	// Save capture
 	params := file.UploadCaptureParams{
-		Timestamp: timestamp,
-		Duration:  duration,
-		Source:    source,
-		DeviceID:  deviceID,
+		Timestamp:  timestamp,
+		Duration:   duration,
+		Source:     source,
+		DeviceID:   deviceID,
+		DeviceName: deviceName,
 	}
 
 	metadata, err := h.fileService.SaveCapture(fileReader, params)
@@ -73,6 +88,12 @@ func (h *FileHandler) UploadCapture(c fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusInternalServerError, "failed to save capture: "+err.Error())
 	}
 
+	if dev != nil && h.deviceService != nil {
+		if err := h.deviceService.RecordUpload(c.Context(), dev.ID); err != nil {
+			slog.Warn("Failed to count upload", "error", err, "device_id", dev.ID)
+		}
+	}
+
 	// TODO: Broadcast WebSocket event for real-time sync
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+)
+
+// summaryTimeout bounds the side session that updates the summary of a conversation
+const summaryTimeout = 2 * time.Minute
+
+// promptHistory is the part of a conversation replayed to a session that hasn't seen it
+type promptHistory struct {
+	summary  string // Summary of the omitted messages, empty if it couldn't be made
+	omitted  int    // Number of older messages that didn't fit in the budget
+	messages []*conversation.Message
+}
+
+// fitHistory fits the history of a conversation in the token budget of its space
+// Older messages that don't fit are covered by the rolling summary cached on the conversation,
+// which is brought up to date by the agent of the session in a side session when needed.
+func (h *MessageHandler) fitHistory(session *agentSession, spaceObj *space.Space, conv *conversation.Conversation, messages []*conversation.Message) promptHistory {
+	budget := 0
+	if spaceConfig, err := space.ParseConfig(spaceObj.Config); err == nil {
+		budget = spaceConfig.HistoryTokenBudget
+	}
+
+	recent, older := conversation.SplitHistory(messages, budget)
+	history := promptHistory{omitted: len(older), messages: recent}
+	if len(older) == 0 {
+		return history
+	}
+
+	last := older[len(older)-1]
+	if conv.SummaryThrough == last.ID {
+		history.summary = conv.Summary
+		return history
+	}
+
+	// Fold only the messages the cached summary doesn't cover yet; if it covers more than
+	// what is omitted now (the budget grew), start over rather than repeat recent messages
+	previous, pending := "", older
+	for i, msg := range older {
+		if msg.ID == conv.SummaryThrough {
+			previous, pending = conv.Summary, older[i+1:]
+			break
+		}
+	}
+
+	// Fold the pending messages a chunk at a time so no summary prompt outgrows the budget,
+	// saving after each chunk so a failure doesn't lose the chunks already folded
+	chunks := conversation.ChunkHistory(pending, conversation.SummaryChunkBudget(budget))
+	log.Printf("🗜️  Summarizing %d message(s) of conversation %s in %d chunk(s)", len(pending), conv.ID[:8], len(chunks))
+	summary := previous
+	for _, chunk := range chunks {
+		ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+		folded, err := h.summarize(ctx, session, spaceObj, summary, chunk, budget)
+		if err != nil {
+			cancel()
+			log.Printf("⚠️  Failed to summarize conversation %s: %v", conv.ID[:8], err)
+			break
+		}
+		summary = folded
+
+		through := chunk[len(chunk)-1].ID
+		if err := h.conversationService.SaveSummary(ctx, conv.ID, summary, through); err != nil {
+			log.Printf("⚠️  Failed to save summary of conversation %s: %v", conv.ID[:8], err)
+		}
+		cancel()
+	}
+
+	history.summary = summary
+	return history
+}
+
+// summarize asks the agent of a session to fold messages into the summary of a conversation
+// budget is the history token budget of the space, see conversation.SummaryBudget.
+func (h *MessageHandler) summarize(ctx context.Context, session *agentSession, spaceObj *space.Space, previous string, messages []*conversation.Message, budget int) (string, error) {
+	workingDir := spaceObj.Path
+	if h.agents != nil {
+		if config, err := h.agents.Config(ctx, session.agent); err == nil {
+			workingDir = config.SessionDir(spaceObj.Path)
+		}
+	}
+
+	summary, err := session.client.Complete(ctx, workingDir, []acp.ContentBlock{acp.TextBlock(summaryPrompt(previous, messages, budget))})
+	if err != nil {
+		return "", err
+	}
+	if summary == "" {
+		return "", fmt.Errorf("agent returned an empty summary")
+	}
+	return summary, nil
+}
+
+// summaryPrompt asks for the summary so far, updated with messages
+// A message larger than a whole chunk is cut short so the prompt stays within budget.
+func summaryPrompt(previous string, messages []*conversation.Message, budget int) string {
+	maxTokens := conversation.SummaryBudget(budget)
+	maxMessageRunes := conversation.SummaryChunkBudget(budget) * 4
+
+	var b strings.Builder
+
+	b.WriteString("You maintain a running summary of a conversation between a user and an AI assistant. ")
+	b.WriteString("It stands in for the earlier messages once they no longer fit in the assistant's context. ")
+	b.WriteString("Keep facts, decisions, open questions and the user's preferences; drop pleasantries. ")
+	fmt.Fprintf(&b, "Reply with the updated summary only, in at most %d words. Don't use any tools.\n\n", maxTokens*3/4)
+
+	if previous != "" {
+		b.WriteString("# Summary so far\n\n")
+		b.WriteString(previous)
+		b.WriteString("\n\n")
+	}
+
+	b.WriteString("# Messages to add\n\n")
+	for _, msg := range messages {
+		role := "User"
+		if msg.Role == "assistant" {
+			role = "Assistant"
+		}
+		content := msg.Content
+		if utf8.RuneCountInString(content) > maxMessageRunes {
+			content = string([]rune(content)[:maxMessageRunes]) + " [...]"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", role, content)
+
+		attachments := len(msg.NoteRefs)
+		for _, part := range msg.Parts {
+			if part.Type != conversation.PartText {
+				attachments++
+			}
+		}
+		if attachments > 0 {
+			fmt.Fprintf(&b, "(with %d attached file(s) or note(s))\n", attachments)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+)
+
+// TestSummaryPromptStaysInBudget tests that a message larger than a chunk is cut short
+func TestSummaryPromptStaysInBudget(t *testing.T) {
+	huge := &conversation.Message{Role: "user", Content: strings.Repeat("word ", 10000)}
+	small := &conversation.Message{Role: "assistant", Content: "Noted."}
+
+	prompt := summaryPrompt("The user likes milk.", []*conversation.Message{huge, small}, 1000)
+
+	assert.Contains(t, prompt, "The user likes milk.")
+	assert.Contains(t, prompt, "Assistant: Noted.")
+	assert.Contains(t, prompt, "[...]")
+	assert.LessOrEqual(t, conversation.EstimateTokens(prompt), 1000)
+}
@@ -2,32 +2,98 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain"
 	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
 	"github.com/unforced/parachute-backend/internal/domain/space"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
 )
 
+// Bounds for ACP calls made on behalf of a message
+const (
+	sessionSetupTimeout = 30 * time.Second // session/new
+	promptTimeout       = 10 * time.Minute // A whole session/prompt turn, tool calls included
+	cancelTimeout       = 15 * time.Second // How long the agent gets to acknowledge session/cancel
+)
+
+// ErrCancelTimeout is returned when the agent doesn't end a cancelled turn in time
+var ErrCancelTimeout = errors.New("agent did not acknowledge cancellation")
+
+// agentSession is the ACP session of a conversation and the agent that runs it
+type agentSession struct {
+	id     string
+	agent  string
+	client *acp.ACPClient
+	primed bool // The agent already knows the conversation history, guarded by sessionMu
+}
+
+// activePrompt is a session/prompt turn in progress
+type activePrompt struct {
+	session    *agentSession
+	done       chan struct{} // Closed when session/prompt returns
+	stopReason string        // Set before done is closed
+}
+
+// setupLock serializes setting up the session of one conversation
+type setupLock struct {
+	sync.Mutex
+	waiters int // Callers holding or waiting for the lock, guarded by sessionMu
+}
+
+// turnEnd is how a session/prompt turn ended, handed to the session listener
+type turnEnd struct {
+	stopReason string
+	duration   time.Duration
+	usage      *acp.Usage // Nil unless the agent reported it
+}
+
+// MessageMetadata is stored as JSON in the metadata column of assistant messages
+// The usage stats sum these fields, see conversation.Service.UsageStats.
+type MessageMetadata struct {
+	StopReason    string              `json:"stop_reason,omitempty"`
+	Cancelled     bool                `json:"cancelled,omitempty"`
+	DurationMs    int64               `json:"duration_ms,omitempty"`    // From sending the prompt to the end of the turn
+	Chunks        int                 `json:"chunks,omitempty"`         // agent_message_chunk updates
+	ThoughtChunks int                 `json:"thought_chunks,omitempty"` // agent_thought_chunk updates
+	Usage         *conversation.Usage `json:"usage,omitempty"`
+}
+
 // MessageHandler handles message-related HTTP requests
 type MessageHandler struct {
 	conversationService *conversation.Service
 	spaceService        *space.Service
 	contextService      *space.ContextService
-	acpClient           *acp.ACPClient
+	agents              *acp.AgentManager
 	wsHandler           *WebSocketHandler
-	// Session management: one ACP session per Conversation
-	// Map: ConversationID -> SessionID
-	conversationSessions map[string]string
+	permissionHandler   *PermissionHandler
+	mcpService          *space.MCPService
+	spaceDBService      *space.SpaceDatabaseService
+	workspaceService    *workspace.Service
+	terminals           *workspace.TerminalManager
+	// Session management: one ACP session per Conversation, on the agent of its space
+	// Map: ConversationID -> session
+	conversationSessions map[string]*agentSession
 	// Track if we've started a listener for this conversation
 	activeListeners map[string]bool
-	// Completion signals: Map SessionID -> channel to signal prompt completion
-	completionSignals map[string]chan bool
-	sessionMu         sync.RWMutex
+	// Completion signals: Map SessionID -> channel carrying how a finished prompt ended
+	completionSignals map[string]chan turnEnd
+	// Turns in progress: Map ConversationID -> prompt, used to cancel them
+	activePrompts map[string]*activePrompt
+	// Session setups in progress: Map ConversationID -> lock, the agent I/O runs outside sessionMu
+	setupLocks map[string]*setupLock
+	// Exits seen per agent: Map agent name -> count, a setup that spans an exit is discarded
+	agentExits map[string]int
+	sessionMu  sync.RWMutex
 }
 
 // NewMessageHandler creates a new message handler
@@ -35,29 +101,94 @@ func NewMessageHandler(
 	conversationService *conversation.Service,
 	spaceService *space.Service,
 	contextService *space.ContextService,
-	acpClient *acp.ACPClient,
+	agents *acp.AgentManager,
 	wsHandler *WebSocketHandler,
+	permissionHandler *PermissionHandler,
 ) *MessageHandler {
-	return &MessageHandler{
+	h := &MessageHandler{
 		conversationService:  conversationService,
 		spaceService:         spaceService,
 		contextService:       contextService,
-		acpClient:            acpClient,
+		agents:               agents,
 		wsHandler:            wsHandler,
-		conversationSessions: make(map[string]string),
+		permissionHandler:    permissionHandler,
+		conversationSessions: make(map[string]*agentSession),
 		activeListeners:      make(map[string]bool),
-		completionSignals:    make(map[string]chan bool),
+		completionSignals:    make(map[string]chan turnEnd),
+		activePrompts:        make(map[string]*activePrompt),
+		setupLocks:           make(map[string]*setupLock),
+		agentExits:           make(map[string]int),
+	}
+
+	// Sessions die with the agent process, forget them so the next message creates new ones
+	if agents != nil {
+		agents.OnProcessExit(h.invalidateSessions)
+	}
+
+	return h
+}
+
+// SetMCPService wires the service that supplies the MCP servers of new sessions
+// Without it sessions start without MCP servers
+func (h *MessageHandler) SetMCPService(mcpService *space.MCPService) {
+	h.mcpService = mcpService
+}
+
+// SetSpaceDatabaseService wires the service that resolves the note_refs of messages
+// Without it messages can't reference notes
+func (h *MessageHandler) SetSpaceDatabaseService(spaceDBService *space.SpaceDatabaseService) {
+	h.spaceDBService = spaceDBService
+}
+
+// SetWorkspaceService wires the service that serves fs/read_text_file and fs/write_text_file
+// Without it those requests are refused
+func (h *MessageHandler) SetWorkspaceService(workspaceService *workspace.Service) {
+	h.workspaceService = workspaceService
+}
+
+// SetTerminalManager wires the manager that runs the terminal/* requests of agents
+// Without it those requests are refused. Terminal output is streamed to WebSocket clients.
+func (h *MessageHandler) SetTerminalManager(terminals *workspace.TerminalManager) {
+	h.terminals = terminals
+	if h.wsHandler != nil {
+		terminals.OnOutput(func(term *workspace.Terminal, data string) {
+			h.wsHandler.BroadcastTerminalOutput(term.ConversationID, term.ID, data)
+		})
+		terminals.OnExit(func(term *workspace.Terminal, status workspace.ExitStatus) {
+			h.wsHandler.BroadcastTerminalExit(term.ConversationID, term.ID, status)
+		})
+	}
+}
+
+// invalidateSessions drops the cached ACP sessions of an agent
+func (h *MessageHandler) invalidateSessions(agent string) {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+
+	h.agentExits[agent]++
+	dropped := 0
+	for conversationID, session := range h.conversationSessions {
+		if session.agent == agent {
+			delete(h.conversationSessions, conversationID)
+			dropped++
+		}
 	}
+	log.Printf("🧹 Invalidated %d cached ACP session(s) of agent %s", dropped, agent)
 }
 
 // SendMessageRequest represents a request to send a message
+// Parts adds images and files to the text in content, see conversation.ContentPart.
+// NoteRefs are capture IDs of the space's relevant notes, embedded in the prompt with their context.
 type SendMessageRequest struct {
-	ConversationID string `json:"conversation_id"`
-	Content        string `json:"content"`
+	ConversationID string                     `json:"conversation_id"`
+	Content        string                     `json:"content"`
+	Parts          []conversation.ContentPart `json:"parts,omitempty"`
+	NoteRefs       []string                   `json:"note_refs,omitempty"`
 }
 
 // SendMessage handles POST /api/messages
-// This creates a user message and sends it to ACP
+// This creates a user message and sends it to ACP. With ?stream=true the response is a stream
+// of Server-Sent Events: the user message, then the events of the turn up to done or error.
 func (h *MessageHandler) SendMessage(c fiber.Ctx) error {
 	// Note: SendMessage can take a while with ACP, so use longer timeout
 	ctx, cancel := context.WithTimeout(c.Context(), 60*time.Second)
@@ -77,12 +208,24 @@ func (h *MessageHandler) SendMessage(c fiber.Ctx) error {
 		})
 	}
 
-	if req.Content == "" {
+	if req.Content == "" && len(req.Parts) == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "content is required",
 		})
 	}
 
+	stream := c.Query("stream") == "true"
+	if stream && h.wsHandler == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "streaming is not available",
+		})
+	}
+
+	if err := h.checkParts(req.Parts); err != nil {
+		return HandleError(c, err)
+	}
+	parts, content := normalizeParts(req.Content, req.Parts)
+
 	// Get conversation
 	conv, err := h.conversationService.GetConversation(ctx, req.ConversationID)
 	if err != nil {
@@ -99,6 +242,11 @@ func (h *MessageHandler) SendMessage(c fiber.Ctx) error {
 		})
 	}
 
+	noteRefs := uniqueNoteRefs(req.NoteRefs)
+	if err := h.checkNoteRefs(spaceObj, noteRefs); err != nil {
+		return HandleError(c, err)
+	}
+
 	// Get conversation history BEFORE creating the new message
 	messages, err := h.conversationService.ListMessages(ctx, req.ConversationID)
 	if err != nil {
@@ -113,18 +261,21 @@ func (h *MessageHandler) SendMessage(c fiber.Ctx) error {
 	userMessage, err := h.conversationService.CreateMessage(ctx, conversation.CreateMessageParams{
 		ConversationID: req.ConversationID,
 		Role:           "user",
-		Content:        req.Content,
+		Content:        content,
+		Parts:          parts,
+		NoteRefs:       noteRefs,
 	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create message",
 		})
 	}
+	h.trackNoteRefs(spaceObj, noteRefs)
 
 	// Auto-update conversation title from first message
-	if isFirstMessage && conv.Title == "New Conversation" {
+	if isFirstMessage && conv.Title == "New Conversation" && content != "" {
 		// Extract a short title from the message (first 50 chars)
-		title := req.Content
+		title := content
 		if len(title) > 50 {
 			title = title[:47] + "..."
 		}
@@ -137,72 +288,484 @@ func (h *MessageHandler) SendMessage(c fiber.Ctx) error {
 		}
 	}
 
-	// Build prompt with context and send to ACP if available
-	if h.acpClient != nil {
-		prompt := h.buildPromptWithContext(spaceObj, messages, req.Content)
+	// Subscribe before the turn starts so the stream misses none of it
+	var events <-chan WSMessage
+	var unsubscribe func()
+	if stream {
+		events, unsubscribe = h.wsHandler.Subscribe(req.ConversationID)
+	}
 
+	// Build prompt with context and send to ACP if available
+	if h.agents == nil {
+		h.failTurn(req.ConversationID, "no agent is available")
+	} else {
 		// Get or create ACP session for this conversation
-		sessionID, isNew, err := h.getOrCreateSession(req.ConversationID, spaceObj.Path)
+		session, isNew, err := h.getOrCreateSession(req.ConversationID, spaceObj)
 		if err != nil {
 			log.Printf("❌ Failed to get/create ACP session: %v", err)
 			// Continue without ACP
+			h.failTurn(req.ConversationID, err.Error())
 		} else {
+			primed := h.isPrimed(session)
+
 			// Start persistent listener only for new sessions
 			if isNew {
-				go h.startSessionListener(sessionID, req.ConversationID)
+				go h.startSessionListener(session, req.ConversationID, spaceObj)
 			}
 
-			// Send prompt to ACP (non-blocking)
-			go h.sendPrompt(sessionID, prompt)
+			// Send prompt to ACP (non-blocking), fitting the history may take a summary from the agent
+			go func() {
+				// Replay the history only to a session that hasn't seen it
+				var history promptHistory
+				if !primed {
+					history = h.fitHistory(session, spaceObj, conv, messages)
+				}
+				prompt := h.buildPromptWithContext(spaceObj, history, userMessage)
+				prompt = supportedBlocks(session.client.Capabilities(), prompt)
+				h.sendPrompt(req.ConversationID, session, prompt)
+			}()
 		}
 	}
 
+	if stream {
+		return streamEvents(c, fiber.StatusCreated, events, unsubscribe, &sseEvent{name: "message", data: userMessage}, true)
+	}
+
 	// Return user message immediately
 	return c.Status(fiber.StatusCreated).JSON(userMessage)
 }
 
+// StreamConversationEvents handles GET /api/conversations/:id/events
+// Streams the events of every turn of the conversation as Server-Sent Events until the client leaves
+func (h *MessageHandler) StreamConversationEvents(c fiber.Ctx) error {
+	conversationID := c.Params("id")
+	if _, err := h.conversationService.GetConversation(c.Context(), conversationID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+
+	if h.wsHandler == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "streaming is not available",
+		})
+	}
+
+	events, unsubscribe := h.wsHandler.Subscribe(conversationID)
+	return streamEvents(c, fiber.StatusOK, events, unsubscribe, nil, false)
+}
+
+// failTurn tells clients the turn of a conversation ended before the agent could answer
+func (h *MessageHandler) failTurn(conversationID, message string) {
+	if h.wsHandler != nil {
+		h.wsHandler.BroadcastMessageError(conversationID, message)
+	}
+}
+
 // getOrCreateSession gets an existing ACP session for a conversation or creates a new one
-// Returns: (sessionID, isNewSession, error)
-func (h *MessageHandler) getOrCreateSession(conversationID, workingDir string) (string, bool, error) {
-	// Lock for the entire operation to prevent race conditions
-	h.sessionMu.Lock()
-	defer h.sessionMu.Unlock()
+// New sessions are created on the agent picked by the space config, which is started if needed.
+// Setups are serialized per conversation; the agent I/O runs without sessionMu so a slow agent
+// doesn't hold up the other conversations.
+// Returns: (session, isNewSession, error)
+func (h *MessageHandler) getOrCreateSession(conversationID string, spaceObj *space.Space) (*agentSession, bool, error) {
+	unlock := h.lockSetup(conversationID)
+	defer unlock()
 
 	// Check if we already have a session for this conversation
-	sessionID, exists := h.conversationSessions[conversationID]
+	h.sessionMu.RLock()
+	session, exists := h.conversationSessions[conversationID]
+	h.sessionMu.RUnlock()
 	if exists {
-		log.Printf("♻️  Reusing existing session %s for conversation %s", sessionID[:8], conversationID[:8])
-		return sessionID, false, nil
+		log.Printf("♻️  Reusing existing session %s for conversation %s", session.id[:8], conversationID[:8])
+		return session, false, nil
 	}
 
-	// Create new session while holding the lock
-	log.Printf("🆕 Creating new ACP session for conversation %s", conversationID[:8])
-	sessionID, err := h.acpClient.NewSession(workingDir, nil)
+	spaceConfig, err := space.ParseConfig(spaceObj.Config)
 	if err != nil {
-		return "", false, fmt.Errorf("failed to create session: %w", err)
+		return nil, false, err
 	}
 
-	// Cache the session (still holding lock)
-	h.conversationSessions[conversationID] = sessionID
+	ctx, cancel := context.WithTimeout(context.Background(), sessionSetupTimeout)
+	defer cancel()
+
+	agent, err := h.agents.Get(ctx, spaceConfig.Agent)
+	if err != nil {
+		return nil, false, err
+	}
+
+	h.sessionMu.RLock()
+	exits := h.agentExits[agent.Name]
+	h.sessionMu.RUnlock()
+
+	workingDir := agent.Config.SessionDir(spaceObj.Path)
+	mcpServers := h.mcpServers(ctx, agent, spaceObj)
+
+	// Pick up where the conversation left off before a restart, if the agent can
+	if session, modes := h.resumeSession(ctx, agent, conversationID, workingDir, mcpServers); session != nil {
+		if err := h.cacheSession(conversationID, session, exits); err != nil {
+			return nil, false, err
+		}
+		h.saveModes(ctx, conversationID, modes)
+		return session, true, nil
+	}
+
+	log.Printf("🆕 Creating new ACP session on agent %s for conversation %s", agent.Name, conversationID[:8])
+	created, err := agent.Client.CreateSession(ctx, workingDir, mcpServers)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create session: %w", err)
+	}
+	sessionID := created.SessionID
+
+	if _, err := h.conversationService.SaveSession(ctx, conversationID, sessionID, agent.Name); err != nil {
+		log.Printf("⚠️  Failed to persist session %s: %v", sessionID[:8], err)
+	}
+
+	session = &agentSession{id: sessionID, agent: agent.Name, client: agent.Client}
+	if created.Modes != nil {
+		h.applyStartMode(ctx, session, conversationID, spaceConfig, created.Modes)
+	}
+	if err := h.cacheSession(conversationID, session, exits); err != nil {
+		return nil, false, err
+	}
+	h.saveModes(ctx, conversationID, created.Modes)
 
 	log.Printf("✅ Created and cached session %s for conversation %s", sessionID[:8], conversationID[:8])
-	return sessionID, true, nil
+	return session, true, nil
+}
+
+// lockSetup takes the setup lock of a conversation and returns the function releasing it
+func (h *MessageHandler) lockSetup(conversationID string) func() {
+	h.sessionMu.Lock()
+	lock, ok := h.setupLocks[conversationID]
+	if !ok {
+		lock = &setupLock{}
+		h.setupLocks[conversationID] = lock
+	}
+	lock.waiters++
+	h.sessionMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		h.sessionMu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(h.setupLocks, conversationID)
+		}
+		h.sessionMu.Unlock()
+	}
+}
+
+// cacheSession stores the new session of a conversation
+// It is refused if the agent exited since the setup started: the session died with it.
+func (h *MessageHandler) cacheSession(conversationID string, session *agentSession, exits int) error {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+
+	if h.agentExits[session.agent] != exits {
+		return fmt.Errorf("agent %s exited while the session was set up", session.agent)
+	}
+	h.conversationSessions[conversationID] = session
+	return nil
+}
+
+// resumeSession loads the persisted ACP session of a conversation with session/load
+// Returns nil when there is nothing to resume: no stored session, one owned by another agent,
+// an agent without the loadSession capability, or a failed load. Callers then start a new
+// session and replay the history in the prompt instead. The modes are those of the loaded session.
+func (h *MessageHandler) resumeSession(ctx context.Context, agent *acp.Agent, conversationID, workingDir string, mcpServers []acp.MCPServer) (*agentSession, *acp.SessionModeState) {
+	stored, err := h.conversationService.GetSession(ctx, conversationID)
+	if err != nil || stored.Agent != agent.Name {
+		return nil, nil
+	}
+
+	if !agent.Client.Capabilities().LoadSession {
+		log.Printf("ℹ️  Agent %s can't load sessions, replaying history for conversation %s", agent.Name, conversationID[:8])
+		return nil, nil
+	}
+
+	log.Printf("⏪ Resuming session %s for conversation %s", stored.ID[:8], conversationID[:8])
+	loaded, err := agent.Client.LoadSession(ctx, stored.ID, workingDir, mcpServers)
+	if err != nil {
+		log.Printf("⚠️  Failed to resume session %s, starting a new one: %v", stored.ID[:8], err)
+		if err := h.conversationService.DeactivateSession(ctx, conversationID); err != nil {
+			log.Printf("⚠️  Failed to deactivate session %s: %v", stored.ID[:8], err)
+		}
+		return nil, nil
+	}
+
+	return &agentSession{id: stored.ID, agent: agent.Name, client: agent.Client, primed: true}, loaded.Modes
+}
+
+// applyStartMode puts a new session in the mode its conversation was in, or the default mode of the space
+// modes is updated to the mode the session ends up in.
+func (h *MessageHandler) applyStartMode(ctx context.Context, session *agentSession, conversationID string, spaceConfig *space.Config, modes *acp.SessionModeState) {
+	want := spaceConfig.DefaultMode
+	if conv, err := h.conversationService.GetConversation(ctx, conversationID); err == nil && conv.Modes != nil && conv.Modes.CurrentModeID != "" {
+		want = conv.Modes.CurrentModeID
+	}
+	if want == "" || want == modes.CurrentModeID {
+		return
+	}
+	if !modes.Has(want) {
+		log.Printf("⚠️  Agent %s has no mode %q, session %s stays in %q", session.agent, want, session.id[:8], modes.CurrentModeID)
+		return
+	}
+
+	if err := session.client.SetSessionMode(ctx, session.id, want); err != nil {
+		log.Printf("⚠️  Failed to switch session %s to mode %q: %v", session.id[:8], want, err)
+		return
+	}
+	modes.CurrentModeID = want
+}
+
+// saveModes stores the modes a session reported for its conversation and tells clients
+func (h *MessageHandler) saveModes(ctx context.Context, conversationID string, state *acp.SessionModeState) {
+	var modes *conversation.Modes
+	if state != nil {
+		modes = &conversation.Modes{CurrentModeID: state.CurrentModeID, Available: []conversation.Mode{}}
+		for _, mode := range state.AvailableModes {
+			modes.Available = append(modes.Available, conversation.Mode{ID: mode.ID, Name: mode.Name, Description: mode.Description})
+		}
+	}
+
+	if err := h.conversationService.SaveModes(ctx, conversationID, modes); err != nil {
+		log.Printf("⚠️  Failed to save modes of conversation %s: %v", conversationID[:8], err)
+		return
+	}
+	if modes != nil && h.wsHandler != nil {
+		h.wsHandler.BroadcastModeChanged(conversationID, modes)
+	}
+}
+
+// recordMode stores the mode the session of a conversation switched to and tells clients
+func (h *MessageHandler) recordMode(ctx context.Context, conversationID, modeID string) (*conversation.Modes, error) {
+	if err := h.conversationService.SetCurrentMode(ctx, conversationID, modeID); err != nil {
+		return nil, err
+	}
+	conv, err := h.conversationService.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.wsHandler != nil {
+		h.wsHandler.BroadcastModeChanged(conversationID, conv.Modes)
+	}
+	return conv.Modes, nil
+}
+
+// SetModeRequest represents a request to switch the session mode of a conversation
+type SetModeRequest struct {
+	ModeID string `json:"mode_id"`
+}
+
+// SetConversationMode handles PUT /api/conversations/:id/mode
+// The conversation's session is started if needed, so a mode can be picked before the first message.
+func (h *MessageHandler) SetConversationMode(c fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), sessionSetupTimeout)
+	defer cancel()
+
+	conversationID := c.Params("id")
+	var req SetModeRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.ModeID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "mode_id is required",
+		})
+	}
+
+	if h.agents == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "no agent is available",
+		})
+	}
+
+	conv, err := h.conversationService.GetConversation(ctx, conversationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Conversation not found",
+		})
+	}
+	spaceObj, err := h.spaceService.GetByID(ctx, conv.SpaceID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Space not found",
+		})
+	}
+
+	session, isNew, err := h.getOrCreateSession(conversationID, spaceObj)
+	if err != nil {
+		log.Printf("❌ Failed to get/create ACP session: %v", err)
+		return HandleError(c, err)
+	}
+	if isNew {
+		go h.startSessionListener(session, conversationID, spaceObj)
+	}
+
+	// Starting the session stored the modes it offers
+	if conv, err = h.conversationService.GetConversation(ctx, conversationID); err != nil {
+		return HandleError(c, err)
+	}
+	if conv.Modes == nil || len(conv.Modes.Available) == 0 {
+		return HandleError(c, domain.NewConflictError("conversation", "the agent has no session modes"))
+	}
+	if !conv.Modes.Has(req.ModeID) {
+		return HandleError(c, domain.NewValidationError("mode_id", "unknown mode "+req.ModeID))
+	}
+
+	log.Printf("🎚️  Switching session %s to mode %s", session.id[:8], req.ModeID)
+	if err := session.client.SetSessionMode(ctx, session.id, req.ModeID); err != nil {
+		log.Printf("❌ Failed to switch mode of conversation %s: %v", conversationID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	modes, err := h.recordMode(ctx, conversationID, req.ModeID)
+	if err != nil {
+		return HandleError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"conversation_id": conversationID,
+		"modes":           modes,
+	})
+}
+
+// mcpServers returns the MCP servers of a space's .mcp.json that the agent can use
+// Servers that are invalid, need unset secrets or use a transport the agent lacks are skipped.
+func (h *MessageHandler) mcpServers(ctx context.Context, agent *acp.Agent, spaceObj *space.Space) []acp.MCPServer {
+	if h.mcpService == nil {
+		return nil
+	}
+
+	configs, problems, err := h.mcpService.ResolveServers(ctx, spaceObj)
+	if err != nil {
+		log.Printf("⚠️  Failed to load MCP config of space %s: %v", spaceObj.Name, err)
+		return nil
+	}
+	for name, problem := range problems {
+		log.Printf("⚠️  Skipping MCP server %s of space %s: %s", name, spaceObj.Name, problem)
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	capabilities := agent.Client.Capabilities()
+	servers := make([]acp.MCPServer, 0, len(names))
+	for _, name := range names {
+		server := toACPServer(name, configs[name])
+		if !capabilities.SupportsMCPServer(server) {
+			log.Printf("⚠️  Skipping MCP server %s: agent %s doesn't support %s servers", name, agent.Name, server.Type)
+			continue
+		}
+		servers = append(servers, server)
+	}
+
+	return servers
+}
+
+// toACPServer converts a resolved .mcp.json entry to its session/new form
+func toACPServer(name string, config *space.MCPServerConfig) acp.MCPServer {
+	server := acp.MCPServer{Name: name}
+
+	if config.Transport() != space.MCPTransportStdio {
+		server.Type = config.Transport()
+		server.URL = config.URL
+		for _, key := range sortedKeys(config.Headers) {
+			server.Headers = append(server.Headers, acp.HTTPHeader{Name: key, Value: config.Headers[key]})
+		}
+		return server
+	}
+
+	server.Command = config.Command
+	server.Args = config.Args
+	for _, key := range sortedKeys(config.Env) {
+		server.Env = append(server.Env, acp.EnvVariable{Name: key, Value: config.Env[key]})
+	}
+	return server
+}
+
+// sortedKeys returns the keys of m in order, so sessions get a stable config
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isPrimed reports whether the agent already knows the history of the session's conversation
+func (h *MessageHandler) isPrimed(session *agentSession) bool {
+	h.sessionMu.RLock()
+	defer h.sessionMu.RUnlock()
+	return session.primed
 }
 
 // sendPrompt sends a prompt to an ACP session and signals completion
-func (h *MessageHandler) sendPrompt(sessionID, prompt string) {
+func (h *MessageHandler) sendPrompt(conversationID string, session *agentSession, prompt []acp.ContentBlock) {
+	ctx, cancel := context.WithTimeout(context.Background(), promptTimeout)
+	defer cancel()
+
+	sessionID := session.id
+	active := &activePrompt{session: session, done: make(chan struct{})}
+	h.sessionMu.Lock()
+	h.activePrompts[conversationID] = active
+	h.sessionMu.Unlock()
+
+	defer func() {
+		h.sessionMu.Lock()
+		if h.activePrompts[conversationID] == active {
+			delete(h.activePrompts, conversationID)
+		}
+		h.sessionMu.Unlock()
+		close(active.done)
+	}()
+
 	log.Printf("🤖 Sending prompt to ACP session %s", sessionID[:8])
-	if err := h.acpClient.SessionPrompt(sessionID, prompt); err != nil {
+	started := time.Now()
+	end := turnEnd{}
+	result, err := session.client.SessionPromptContent(ctx, sessionID, prompt)
+	if err != nil {
 		log.Printf("❌ Failed to send prompt to ACP: %v", err)
-		return
+		if ctx.Err() == nil {
+			h.failTurn(conversationID, err.Error())
+			return
+		}
+		// Timed out: the turn was cancelled, still save what was streamed so far
+		active.stopReason = acp.StopReasonCancelled
+		end.duration = time.Since(started)
+	} else {
+		log.Printf("✅ Prompt sent to ACP (session/prompt returned, stopReason=%s)", result.StopReason)
+		active.stopReason = result.StopReason
+		end.duration = result.Duration
+		end.usage = result.Usage
+	}
+	end.stopReason = active.stopReason
+
+	// The agent has seen the history now, later prompts only carry the new message
+	h.sessionMu.Lock()
+	session.primed = true
+	h.sessionMu.Unlock()
+
+	if err := h.conversationService.TouchSession(context.Background(), conversationID); err != nil {
+		log.Printf("⚠️  Failed to touch session %s: %v", sessionID[:8], err)
 	}
-	log.Printf("✅ Prompt sent to ACP (session/prompt returned)")
 
 	// Signal completion so the listener can save the accumulated message
 	h.sessionMu.RLock()
 	if completionChan, ok := h.completionSignals[sessionID]; ok {
 		select {
-		case completionChan <- true:
+		case completionChan <- end:
 			log.Printf("📣 Signaled completion for session %s", sessionID[:8])
 		default:
 			log.Printf("⚠️  Completion channel full for session %s", sessionID[:8])
@@ -211,218 +774,419 @@ func (h *MessageHandler) sendPrompt(sessionID, prompt string) {
 	h.sessionMu.RUnlock()
 }
 
+// CancelResponse stops the assistant turn in progress for a conversation
+// It withdraws pending permission prompts, sends session/cancel and waits for the agent to end
+// the turn. Returns the stop reason, which is "cancelled" unless the turn happened to finish on
+// its own first.
+func (h *MessageHandler) CancelResponse(ctx context.Context, conversationID string) (string, error) {
+	h.sessionMu.RLock()
+	active, ok := h.activePrompts[conversationID]
+	h.sessionMu.RUnlock()
+
+	if !ok {
+		return "", domain.NewConflictError("conversation", "no assistant response in progress")
+	}
+
+	log.Printf("✋ Cancelling turn of session %s (conversation %s)", active.session.id[:8], conversationID[:8])
+
+	// A turn waiting on a permission prompt can only end once the prompt is answered
+	if h.permissionHandler != nil {
+		if n := h.permissionHandler.CancelPending(conversationID); n > 0 {
+			log.Printf("✋ Cancelled %d pending permission request(s) of conversation %s", n, conversationID[:8])
+		}
+	}
+
+	if err := active.session.client.CancelSession(active.session.id); err != nil {
+		return "", fmt.Errorf("failed to cancel session: %w", err)
+	}
+
+	timer := time.NewTimer(cancelTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-active.done:
+		return active.stopReason, nil
+	case <-timer.C:
+		return "", ErrCancelTimeout
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// CancelConversation handles POST /api/conversations/:id/cancel
+func (h *MessageHandler) CancelConversation(c fiber.Ctx) error {
+	conversationID := c.Params("id")
+	if conversationID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "conversation ID is required",
+		})
+	}
+
+	stopReason, err := h.CancelResponse(c.Context(), conversationID)
+	if err != nil {
+		log.Printf("❌ Failed to cancel conversation %s: %v", conversationID, err)
+		if errors.Is(err, ErrCancelTimeout) {
+			return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return HandleError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"conversation_id": conversationID,
+		"stop_reason":     stopReason,
+		"cancelled":       stopReason == acp.StopReasonCancelled,
+	})
+}
+
 // startSessionListener starts a persistent listener for a session
 // This runs for the lifetime of the conversation, handling all messages
-func (h *MessageHandler) startSessionListener(sessionID, conversationID string) {
+// spaceObj is the space whose permission policy and grants apply to tool calls
+func (h *MessageHandler) startSessionListener(session *agentSession, conversationID string, spaceObj *space.Space) {
 	ctx := context.Background()
+	sessionID := session.id
 	log.Printf("🎧 Starting persistent listener for session %s (conversation %s)", sessionID[:8], conversationID[:8])
 
 	// Register this session to receive its own requests and notifications
-	sessionRequests, sessionNotifications := h.acpClient.RegisterSession(sessionID)
+	sessionRequests, sessionNotifications := session.client.RegisterSession(sessionID)
 
 	// Ensure cleanup when listener exits
 	defer func() {
-		h.acpClient.UnregisterSession(sessionID)
+		session.client.UnregisterSession(sessionID)
+		if h.terminals != nil {
+			h.terminals.ReleaseSession(sessionID)
+		}
+
+		h.sessionMu.Lock()
+		delete(h.completionSignals, sessionID)
+		if h.conversationSessions[conversationID] == session {
+			delete(h.conversationSessions, conversationID)
+		}
+		h.sessionMu.Unlock()
+
 		log.Printf("🛑 Session listener stopped for %s", sessionID[:8])
 	}()
 
 	// Create completion signal channel
-	completionChan := make(chan bool, 10)
+	completionChan := make(chan turnEnd, 10)
 	h.sessionMu.Lock()
 	h.completionSignals[sessionID] = completionChan
 	h.sessionMu.Unlock()
 
-	// Track current response being built
+	// Track current response being built, and what the agent did along the way
 	var currentResponse string
+	activity := newTurnActivity()
 
-	for {
-		select {
-		case req := <-sessionRequests:
-			// Handle incoming JSON-RPC requests from ACP
-			if req.Method == "session/request_permission" {
-				if req.ID == nil {
-					log.Printf("⚠️  Permission request has no ID, skipping")
-					continue
-				}
-				log.Printf("🔐 [%s] Received permission request (ID=%d)", sessionID[:8], *req.ID)
+	// handleNotification applies a session/update of the agent to the turn in progress
+	handleNotification := func(notif *acp.JSONRPCNotification) {
+		log.Printf("🔔 [%s] Received notification: method=%s", sessionID[:8], notif.Method)
 
-				permReq, err := acp.ParsePermissionRequest(req)
-				if err != nil {
-					log.Printf("❌ Failed to parse permission request: %v", err)
-					continue
-				}
+		if notif.Method != "session/update" {
+			log.Printf("   Skipping non-session/update notification")
+			return
+		}
 
-				// Log the full request for debugging
-				log.Printf("📋 Permission request - ToolCallID: %s, Options: %v",
-					permReq.ToolCall.ToolCallID, permReq.Options)
-
-				// Auto-approve safe operations
-				if acp.ShouldAutoApprove(permReq.ToolCall) {
-					allowOpt := acp.FindAllowOption(permReq.Options)
-					if allowOpt != nil {
-						log.Printf("✅ Auto-approving with option: %s", allowOpt.OptionID)
-						response := acp.PermissionResponse{
-							Outcome: acp.PermissionOutcome{
-								Outcome:  "selected",
-								OptionID: allowOpt.OptionID,
-							},
-						}
-						if err := h.acpClient.SendResponse(*req.ID, response); err != nil {
-							log.Printf("❌ Failed to send permission response: %v", err)
+		update, err := acp.ParseSessionUpdate(notif)
+		if err != nil {
+			log.Printf("❌ [%s] Failed to parse update: %v", sessionID[:8], err)
+			return
+		}
+
+		log.Printf("🔔 [%s] Notification sessionID: %s, my sessionID: %s",
+			sessionID[:8], update.SessionID[:8], sessionID[:8])
+
+		// Only process notifications for our session
+		if update.SessionID != sessionID {
+			log.Printf("   Skipping notification for different session (full IDs: %s vs %s)",
+				update.SessionID, sessionID)
+			return
+		}
+
+		log.Printf("📝 [%s] Processing update", sessionID[:8])
+
+		// Extract text from update
+		if sessionUpdate, ok := update.Update["sessionUpdate"].(string); ok {
+			log.Printf("   Session update type: %s", sessionUpdate)
+
+			if sessionUpdate == "agent_message_chunk" {
+				// Extract text from content field
+				if content, ok := update.Update["content"].(map[string]interface{}); ok {
+					if text, ok := content["text"].(string); ok {
+						currentResponse += text
+						activity.chunks++
+						log.Printf("   ✍️  Added text chunk (total: %d chars)", len(currentResponse))
+
+						// Broadcast chunk to WebSocket clients
+						if h.wsHandler != nil {
+							log.Printf("   📡 Broadcasting chunk to WebSocket clients...")
+							h.wsHandler.BroadcastMessageChunk(conversationID, text)
+						} else {
+							log.Printf("   ⚠️  wsHandler is nil, cannot broadcast")
 						}
-					} else {
-						log.Printf("⚠️  No allow option found in permission request")
 					}
-				} else {
-					// TODO: For now, reject operations that need manual approval
-					// In the future, this will show a UI dialog
-					log.Printf("🚫 Rejecting operation that requires manual approval")
-					rejectOpt := acp.PermissionOption{}
-					for _, opt := range permReq.Options {
-						if opt.OptionID == "reject" || opt.OptionID == "reject_once" {
-							rejectOpt = opt
-							break
-						}
+				}
+			} else if sessionUpdate == "tool_call" {
+				// Extract tool call info
+				log.Printf("   🔧 Tool call initiated")
+				activity.applyToolCall(update.Update)
+
+				// Broadcast tool call to WebSocket clients
+				if h.wsHandler != nil {
+					toolCallID := ""
+					title := ""
+					kind := ""
+					status := ""
+
+					if id, ok := update.Update["toolCallId"].(string); ok {
+						toolCallID = id
 					}
-					if rejectOpt.OptionID != "" {
-						response := acp.PermissionResponse{
-							Outcome: acp.PermissionOutcome{
-								Outcome:  "selected",
-								OptionID: rejectOpt.OptionID,
-							},
-						}
-						if err := h.acpClient.SendResponse(*req.ID, response); err != nil {
-							log.Printf("❌ Failed to send rejection response: %v", err)
-						}
+					if t, ok := update.Update["title"].(string); ok {
+						title = t
+					}
+					if k, ok := update.Update["kind"].(string); ok {
+						kind = k
+					}
+					if s, ok := update.Update["status"].(string); ok {
+						status = s
+					}
+
+					log.Printf("   📡 Broadcasting tool call: %s (%s)", title, kind)
+					h.wsHandler.BroadcastToolCall(conversationID, toolCallID, title, kind, status)
+				}
+			} else if sessionUpdate == "tool_call_update" {
+				// Tool call completed or updated
+				log.Printf("   ✅ Tool call update")
+				activity.applyToolCall(update.Update)
+
+				// Broadcast tool call update to WebSocket clients
+				if h.wsHandler != nil {
+					toolCallID := ""
+					status := ""
+
+					if id, ok := update.Update["toolCallId"].(string); ok {
+						toolCallID = id
+					}
+					if s, ok := update.Update["status"].(string); ok {
+						status = s
+					}
+
+					log.Printf("   📡 Broadcasting tool call update: %s -> %s", toolCallID, status)
+					h.wsHandler.BroadcastToolCallUpdate(conversationID, toolCallID, status)
+				}
+			} else if sessionUpdate == "agent_thought_chunk" {
+				activity.thoughtChunks++
+			} else if sessionUpdate == "current_mode_update" {
+				// The agent switched modes on its own, e.g. out of plan mode
+				if modeID, ok := update.Update["currentModeId"].(string); ok {
+					log.Printf("   🎚️  Mode changed to %s", modeID)
+					if _, err := h.recordMode(ctx, conversationID, modeID); err != nil {
+						log.Printf("❌ Failed to record mode: %v", err)
+					}
+				}
+			} else if sessionUpdate == "plan" {
+				// Each plan update carries the whole plan
+				if plan := activity.applyPlan(update.Update); plan != nil {
+					log.Printf("   🗺️  Plan updated (%d entries)", len(plan.Entries))
+					if h.wsHandler != nil {
+						h.wsHandler.BroadcastPlan(conversationID, plan.Entries)
 					}
 				}
 			}
+		}
+	}
 
-		case notif := <-sessionNotifications:
-			log.Printf("🔔 [%s] Received notification: method=%s", sessionID[:8], notif.Method)
+	for {
+		select {
+		case req, ok := <-sessionRequests:
+			if !ok {
+				// The ACP process exited and took the session with it
+				log.Printf("💥 [%s] Session channels closed, dropping %d chars of partial response", sessionID[:8], len(currentResponse))
+				return
+			}
 
-			if notif.Method != "session/update" {
-				log.Printf("   Skipping non-session/update notification")
+			// Handle incoming JSON-RPC requests from ACP
+			if req.ID == nil {
+				log.Printf("⚠️  Request %s has no ID, skipping", req.Method)
 				continue
 			}
 
-			update, err := acp.ParseSessionUpdate(notif)
-			if err != nil {
-				log.Printf("❌ [%s] Failed to parse update: %v", sessionID[:8], err)
-				continue
+			scope := workspace.Scope{
+				SpaceID:        spaceObj.ID,
+				SpacePath:      spaceObj.Path,
+				ConversationID: conversationID,
+				SessionID:      sessionID,
 			}
 
-			log.Printf("🔔 [%s] Notification sessionID: %s, my sessionID: %s",
-				sessionID[:8], update.SessionID[:8], sessionID[:8])
+			switch req.Method {
+			case "session/request_permission":
+				log.Printf("🔐 [%s] Received permission request (ID=%d)", sessionID[:8], *req.ID)
 
-			// Only process notifications for our session
-			if update.SessionID != sessionID {
-				log.Printf("   Skipping notification for different session (full IDs: %s vs %s)",
-					update.SessionID, sessionID)
-				continue
+				// Waiting on a client can take minutes, don't block notifications meanwhile
+				go h.handlePermissionRequest(session.client, conversationID, spaceObj, req)
+			case acp.MethodReadTextFile:
+				go h.handleReadTextFile(session.client, scope, req)
+			case acp.MethodWriteTextFile:
+				go h.handleWriteTextFile(session.client, scope, req)
+			case acp.MethodTerminalCreate:
+				// Creating may wait for the user to allow the command
+				go h.handleTerminalCreate(session.client, scope, req)
+			case acp.MethodTerminalOutput, acp.MethodTerminalWaitForExit, acp.MethodTerminalKill, acp.MethodTerminalRelease:
+				go h.handleTerminalRequest(session.client, scope, req)
+			default:
+				log.Printf("⚠️  [%s] Unsupported request %s", sessionID[:8], req.Method)
+				h.respondError(session.client, *req.ID, &acp.RPCError{
+					Code:    acp.ErrCodeMethodNotFound,
+					Message: "method not found: " + req.Method,
+				})
 			}
 
-			log.Printf("📝 [%s] Processing update", sessionID[:8])
-
-			// Extract text from update
-			if sessionUpdate, ok := update.Update["sessionUpdate"].(string); ok {
-				log.Printf("   Session update type: %s", sessionUpdate)
-
-				if sessionUpdate == "agent_message_chunk" {
-					// Extract text from content field
-					if content, ok := update.Update["content"].(map[string]interface{}); ok {
-						if text, ok := content["text"].(string); ok {
-							currentResponse += text
-							log.Printf("   ✍️  Added text chunk (total: %d chars)", len(currentResponse))
-
-							// Broadcast chunk to WebSocket clients
-							if h.wsHandler != nil {
-								log.Printf("   📡 Broadcasting chunk to WebSocket clients...")
-								h.wsHandler.BroadcastMessageChunk(conversationID, text)
-							} else {
-								log.Printf("   ⚠️  wsHandler is nil, cannot broadcast")
-							}
-						}
-					}
-				} else if sessionUpdate == "tool_call" {
-					// Extract tool call info
-					log.Printf("   🔧 Tool call initiated")
-
-					// Broadcast tool call to WebSocket clients
-					if h.wsHandler != nil {
-						toolCallID := ""
-						title := ""
-						kind := ""
-						status := ""
+		case notif, ok := <-sessionNotifications:
+			if !ok {
+				log.Printf("💥 [%s] Session channels closed, dropping %d chars of partial response", sessionID[:8], len(currentResponse))
+				return
+			}
+			handleNotification(notif)
 
-						if id, ok := update.Update["toolCallId"].(string); ok {
-							toolCallID = id
-						}
-						if t, ok := update.Update["title"].(string); ok {
-							title = t
-						}
-						if k, ok := update.Update["kind"].(string); ok {
-							kind = k
-						}
-						if s, ok := update.Update["status"].(string); ok {
-							status = s
-						}
+		case end := <-completionChan:
+			// The updates of the turn are all queued by the time it ends, handle them before closing it
+			for queued := len(sessionNotifications); queued > 0; queued-- {
+				handleNotification(<-sessionNotifications)
+			}
 
-						log.Printf("   📡 Broadcasting tool call: %s (%s)", title, kind)
-						h.wsHandler.BroadcastToolCall(conversationID, toolCallID, title, kind, status)
-					}
-				} else if sessionUpdate == "tool_call_update" {
-					// Tool call completed or updated
-					log.Printf("   ✅ Tool call update")
+			// Prompt completed - save accumulated response
+			h.saveAssistantResponse(ctx, conversationID, currentResponse, activity, end)
+			// Reset for next message
+			currentResponse = ""
+			activity = newTurnActivity()
+		}
+	}
+}
 
-					// Broadcast tool call update to WebSocket clients
-					if h.wsHandler != nil {
-						toolCallID := ""
-						status := ""
+// saveAssistantResponse stores the text streamed during a turn, with its tool calls and plan
+// Cancelled turns keep their partial text, flagged as cancelled, and clients are told
+func (h *MessageHandler) saveAssistantResponse(ctx context.Context, conversationID, content string, activity *turnActivity, end turnEnd) {
+	stopReason := end.stopReason
+	cancelled := stopReason == acp.StopReasonCancelled
+	messageID := ""
+
+	// A turn that only ran tools is still part of the transcript
+	if content != "" || !activity.empty() {
+		metadata, _ := json.Marshal(MessageMetadata{
+			StopReason:    stopReason,
+			Cancelled:     cancelled,
+			DurationMs:    end.duration.Milliseconds(),
+			Chunks:        activity.chunks,
+			ThoughtChunks: activity.thoughtChunks,
+			Usage:         toConversationUsage(end.usage),
+		})
 
-						if id, ok := update.Update["toolCallId"].(string); ok {
-							toolCallID = id
-						}
-						if s, ok := update.Update["status"].(string); ok {
-							status = s
-						}
+		log.Printf("💾 Saving assistant response (%d chars) to conversation %s", len(content), conversationID[:8])
+		msg, err := h.conversationService.CreateMessage(ctx, conversation.CreateMessageParams{
+			ConversationID: conversationID,
+			Role:           "assistant",
+			Content:        content,
+			Metadata:       string(metadata),
+		})
+		if err != nil {
+			log.Printf("❌ Failed to save assistant message: %v", err)
+		} else {
+			log.Printf("✅ Assistant message saved successfully")
+			messageID = msg.ID
 
-						log.Printf("   📡 Broadcasting tool call update: %s -> %s", toolCallID, status)
-						h.wsHandler.BroadcastToolCallUpdate(conversationID, toolCallID, status)
-					}
+			if !activity.empty() {
+				if err := h.conversationService.SaveTurnActivity(ctx, msg.ID, activity.toolCalls, activity.plan); err != nil {
+					log.Printf("❌ Failed to save tool calls and plan: %v", err)
 				}
 			}
+		}
+	} else {
+		log.Printf("⚠️  Received completion signal but no response accumulated")
+	}
 
-		case <-completionChan:
-			// Prompt completed - save accumulated response
-			if currentResponse != "" {
-				log.Printf("💾 Saving assistant response (%d chars) to conversation %s", len(currentResponse), conversationID[:8])
-				_, err := h.conversationService.CreateMessage(ctx, conversation.CreateMessageParams{
-					ConversationID: conversationID,
-					Role:           "assistant",
-					Content:        currentResponse,
-				})
-				if err != nil {
-					log.Printf("❌ Failed to save assistant message: %v", err)
-				} else {
-					log.Printf("✅ Assistant message saved successfully")
-				}
-				// Reset for next message
-				currentResponse = ""
-			} else {
-				log.Printf("⚠️  Received completion signal but no response accumulated")
-			}
+	if h.wsHandler != nil {
+		if cancelled {
+			h.wsHandler.BroadcastMessageCancelled(conversationID, messageID, content)
 		}
+		h.wsHandler.BroadcastMessageDone(conversationID, messageID, stopReason)
+	}
+}
+
+// toConversationUsage converts the usage an agent reported, nil stays nil
+func toConversationUsage(usage *acp.Usage) *conversation.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &conversation.Usage{
+		InputTokens:       usage.InputTokens,
+		OutputTokens:      usage.OutputTokens,
+		TotalTokens:       usage.TotalTokens,
+		ThoughtTokens:     usage.ThoughtTokens,
+		CachedReadTokens:  usage.CachedReadTokens,
+		CachedWriteTokens: usage.CachedWriteTokens,
+	}
+}
+
+// handlePermissionRequest decides on a session/request_permission and answers ACP
+// The permission handler applies the policy and grants, or forwards the call to clients
+func (h *MessageHandler) handlePermissionRequest(client *acp.ACPClient, conversationID string, spaceObj *space.Space, req *acp.JSONRPCIncomingRequest) {
+	permReq, err := acp.ParsePermissionRequest(req)
+	if err != nil {
+		log.Printf("❌ Failed to parse permission request: %v", err)
+		h.respondError(client, *req.ID, &acp.RPCError{Code: acp.ErrCodeInvalidParams, Message: err.Error()})
+		return
+	}
+
+	log.Printf("📋 Permission request - ToolCallID: %s, Options: %v",
+		permReq.ToolCall.ToolCallID, permReq.Options)
+
+	var optionID string
+	if h.permissionHandler != nil {
+		optionID = h.permissionHandler.Decide(context.Background(), PermissionScope{
+			SpaceID:        spaceObj.ID,
+			SpacePath:      spaceObj.Path,
+			ConversationID: conversationID,
+		}, permReq)
+	} else {
+		// Without a permission handler only the built-in policy applies, and nobody can be asked
+		decision := permission.NewEngine(nil).Evaluate(context.Background(), spaceObj.Path, permission.ToolCall{
+			Kind:     permReq.ToolCall.Kind,
+			Title:    permReq.ToolCall.Title,
+			RawInput: permReq.ToolCall.RawInput,
+		})
+		option := acp.FindRejectOption(permReq.Options)
+		if decision.Action == permission.ActionAllow {
+			option = acp.FindAllowOption(permReq.Options)
+		}
+		if option != nil {
+			optionID = option.OptionID
+		}
+	}
+
+	log.Printf("🔐 Answering permission request with option: %q", optionID)
+	h.respondPermission(client, *req.ID, optionID)
+}
+
+// respondPermission sends the selected permission option back to the agent that asked
+// Without an option the request is answered as cancelled, the agent waits until it is answered.
+func (h *MessageHandler) respondPermission(client *acp.ACPClient, requestID int, optionID string) {
+	response := acp.NewSelectedOutcome(optionID)
+	if optionID == "" {
+		response = acp.NewCancelledOutcome()
+	}
+	if err := client.SendResponse(requestID, response); err != nil {
+		log.Printf("❌ Failed to send permission response: %v", err)
 	}
 }
 
 // buildPromptWithContext builds a prompt including conversation history and CLAUDE.md
+// Images, files and referenced notes of the history and of the current message are included as content blocks.
 func (h *MessageHandler) buildPromptWithContext(
 	spaceObj *space.Space,
-	messages []*conversation.Message,
-	currentPrompt string,
-) string {
-	prompt := ""
+	history promptHistory,
+	current *conversation.Message,
+) []acp.ContentBlock {
+	var prompt promptBuilder
 
 	// Include CLAUDE.md context if it exists
 	claudeMD, err := h.spaceService.ReadClaudeMD(spaceObj)
@@ -434,38 +1198,47 @@ func (h *MessageHandler) buildPromptWithContext(
 			resolvedClaudeMD = claudeMD // Fallback to unresolved
 		}
 
-		prompt += "# Context from CLAUDE.md\n\n"
-		prompt += resolvedClaudeMD
-		prompt += "\n\n---\n\n"
+		prompt.text("# Context from CLAUDE.md\n\n")
+		prompt.text(resolvedClaudeMD)
+		prompt.text("\n\n---\n\n")
 	}
 
-	// Include conversation history (last 10 messages for now)
-	if len(messages) > 0 {
-		prompt += "# Conversation History\n\n"
+	// Include what didn't fit in the history budget, summarized
+	if history.summary != "" {
+		prompt.text("# Summary of the Earlier Conversation\n\n")
+		prompt.text(history.summary)
+		prompt.text("\n\n---\n\n")
+	} else if history.omitted > 0 {
+		prompt.text(fmt.Sprintf("[%d earlier message(s) omitted]\n\n", history.omitted))
+	}
 
-		start := 0
-		if len(messages) > 10 {
-			start = len(messages) - 10
-		}
+	// Include the conversation history that fits in the budget
+	if len(history.messages) > 0 {
+		prompt.text("# Conversation History\n\n")
 
-		for _, msg := range messages[start:] {
+		for _, msg := range history.messages {
 			if msg.Role == "user" {
-				prompt += fmt.Sprintf("User: %s\n\n", msg.Content)
+				prompt.text("User: ")
+				prompt.add(h.messageBlocks(msg)...)
+				prompt.add(h.noteBlocks(spaceObj, msg.NoteRefs)...)
 			} else {
-				prompt += fmt.Sprintf("Assistant: %s\n\n", msg.Content)
+				prompt.text(fmt.Sprintf("Assistant: %s", msg.Content))
 			}
+			prompt.text("\n\n")
 		}
 
-		prompt += "---\n\n"
+		prompt.text("---\n\n")
 	}
 
 	// Current prompt
-	prompt += currentPrompt
+	prompt.add(h.messageBlocks(current)...)
+	prompt.add(h.noteBlocks(spaceObj, current.NoteRefs)...)
 
-	return prompt
+	return prompt.blocks
 }
 
 // ListMessages handles GET /api/messages?conversation_id=...
+// Assistant messages include the tool calls and plan of their turn
 func (h *MessageHandler) ListMessages(c fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
 	defer cancel()
@@ -477,7 +1250,7 @@ func (h *MessageHandler) ListMessages(c fiber.Ctx) error {
 		})
 	}
 
-	messages, err := h.conversationService.ListMessages(ctx, conversationID)
+	messages, err := h.conversationService.ListTranscript(ctx, conversationID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to list messages",
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+)
+
+// uniqueNoteRefs drops empty and repeated capture IDs, keeping the first occurrence
+func uniqueNoteRefs(refs []string) []string {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(refs))
+	unique := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		unique = append(unique, ref)
+	}
+	return unique
+}
+
+// checkNoteRefs verifies that every referenced capture is linked to the space
+func (h *MessageHandler) checkNoteRefs(spaceObj *space.Space, refs []string) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	if h.spaceDBService == nil {
+		return domain.NewValidationError("note_refs", "notes are not available")
+	}
+
+	for _, ref := range refs {
+		if _, err := h.spaceDBService.GetNoteByID(spaceObj.Path, ref); err != nil {
+			return domain.NewValidationError("note_refs", fmt.Sprintf("note %s is not linked to this space", ref))
+		}
+	}
+	return nil
+}
+
+// trackNoteRefs records that the referenced notes were used, for last_referenced and {{recent_notes}}
+func (h *MessageHandler) trackNoteRefs(spaceObj *space.Space, refs []string) {
+	if h.spaceDBService == nil {
+		return
+	}
+	for _, ref := range refs {
+		if err := h.spaceDBService.TrackNoteReference(spaceObj.Path, ref); err != nil {
+			log.Printf("⚠️  Failed to track reference to note %s: %v", ref, err)
+		}
+	}
+}
+
+// noteBlocks returns the content blocks of referenced notes
+// Each note is embedded as a resource, preceded by its space-specific context and tags.
+func (h *MessageHandler) noteBlocks(spaceObj *space.Space, refs []string) []acp.ContentBlock {
+	if len(refs) == 0 || h.spaceDBService == nil {
+		return nil
+	}
+
+	var prompt promptBuilder
+	for _, ref := range refs {
+		note, err := h.spaceDBService.GetNoteByID(spaceObj.Path, ref)
+		if err != nil {
+			// The note may have been unlinked since the message was sent
+			prompt.text(fmt.Sprintf("\n\n[Referenced note %s is unavailable: %v]", ref, err))
+			continue
+		}
+
+		prompt.text(fmt.Sprintf("\n\n## Referenced note: %s\n", note.NotePath))
+		if note.Context != "" {
+			prompt.text(fmt.Sprintf("Context in this space: %s\n", note.Context))
+		}
+		if len(note.Tags) > 0 {
+			prompt.text(fmt.Sprintf("Tags: %s\n", strings.Join(note.Tags, ", ")))
+		}
+
+		path, data, err := h.readVaultFile(note.NotePath, maxPromptResourceSize)
+		if err != nil {
+			prompt.text(fmt.Sprintf("[Content unavailable: %v]\n", err))
+			continue
+		}
+		prompt.add(acp.ContentBlock{
+			Type: acp.ContentResource,
+			Resource: &acp.EmbeddedResource{
+				URI:      fileURI(path),
+				MimeType: mimeType(path, ""),
+				Text:     string(data),
+			},
+		})
+	}
+	return prompt.blocks
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+)
+
+// TestNoteRefs tests that referenced notes are checked, embedded with their context and tracked
+func TestNoteRefs(t *testing.T) {
+	root := t.TempDir()
+	spaceObj := &space.Space{ID: "space-1", Path: filepath.Join(root, "spaces", "work")}
+
+	spaceDB := space.NewSpaceDatabaseService(root)
+	require.NoError(t, spaceDB.InitializeSpaceDatabase(spaceObj.ID, spaceObj.Path))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "captures"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "captures", "idea.md"), []byte("# Offline sync"), 0644))
+	require.NoError(t, spaceDB.LinkNote(spaceObj.ID, spaceObj.Path, "cap-1", "captures/idea.md", "Feeds the sync design", []string{"sync", "design"}))
+
+	h := &MessageHandler{spaceService: space.NewService(nil, root), spaceDBService: spaceDB}
+
+	refs := uniqueNoteRefs([]string{"cap-1", " ", "cap-1"})
+	assert.Equal(t, []string{"cap-1"}, refs)
+
+	assert.NoError(t, h.checkNoteRefs(spaceObj, refs))
+	assert.Error(t, h.checkNoteRefs(spaceObj, []string{"cap-2"}), "unlinked notes are refused")
+
+	blocks := h.noteBlocks(spaceObj, refs)
+	require.Len(t, blocks, 2)
+	assert.Contains(t, blocks[0].Text, "captures/idea.md")
+	assert.Contains(t, blocks[0].Text, "Feeds the sync design")
+	assert.Contains(t, blocks[0].Text, "sync, design")
+	assert.Equal(t, acp.ContentResource, blocks[1].Type)
+	assert.Equal(t, "# Offline sync", blocks[1].Resource.Text)
+
+	h.trackNoteRefs(spaceObj, refs)
+	note, err := spaceDB.GetNoteByID(spaceObj.Path, "cap-1")
+	require.NoError(t, err)
+	assert.NotNil(t, note.LastReferenced)
+}
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
+)
+
+// DefaultPermissionTimeout is how long we wait for a client to answer a permission request
+const DefaultPermissionTimeout = 2 * time.Minute
+
+// commandApprovalWindow is how long a user's approval of a command covers the terminal the
+// agent then creates to run it, so the user isn't asked twice for the same command
+const commandApprovalWindow = time.Minute
+
+// terminalPermissionOptions are offered when a terminal command needs the user's approval
+var terminalPermissionOptions = []acp.PermissionOption{
+	{OptionID: "allow", Name: "Allow", Kind: "allow_once"},
+	{OptionID: "allow_always", Name: "Always allow", Kind: "allow_always"},
+	{OptionID: "reject", Name: "Reject", Kind: "reject_once"},
+}
+
+// ErrPermissionTimeout is returned when no client answered a permission request in time
+var ErrPermissionTimeout = errors.New("permission request timed out")
+
+// ErrPermissionCancelled is returned when a permission request was withdrawn before anyone answered
+var ErrPermissionCancelled = errors.New("permission request cancelled")
+
+// PendingPermission is a permission request waiting for a client decision
+type PendingPermission struct {
+	RequestID      string                 `json:"request_id"`
+	ConversationID string                 `json:"conversation_id"`
+	SessionID      string                 `json:"session_id"`
+	ToolCallID     string                 `json:"tool_call_id"`
+	Title          string                 `json:"title,omitempty"`
+	Kind           string                 `json:"kind,omitempty"`
+	RawInput       map[string]interface{} `json:"raw_input"`
+	Options        []acp.PermissionOption `json:"options"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ExpiresAt      time.Time              `json:"expires_at"`
+	Policy         *permission.Decision   `json:"policy,omitempty"` // Why the policy asked the user
+
+	response  chan string
+	cancelled chan struct{} // Closed by CancelPending
+}
+
+// PermissionScope identifies where a permission request comes from
+type PermissionScope struct {
+	SpaceID        string
+	SpacePath      string
+	ConversationID string
+}
+
+// PermissionHandler evaluates ACP permission requests against the permission policy and
+// remembered grants, forwards the ones that need a user to clients and collects their decisions
+type PermissionHandler struct {
+	wsHandler         *WebSocketHandler
+	policy            *permission.Engine
+	permissionService *permission.Service
+	timeout           time.Duration
+	pending           map[string]*PendingPermission
+	approvals         map[string]time.Time // Commands allowed for a session -> when, see AuthorizeCommand
+	mu                sync.Mutex
+}
+
+// NewPermissionHandler creates a new permission handler
+// wsHandler can be nil, in which case requests can only be answered over REST
+// policy can be nil, in which case only the built-in policy applies
+// permissionService can be nil, in which case nothing is remembered or audited
+func NewPermissionHandler(
+	wsHandler *WebSocketHandler,
+	policy *permission.Engine,
+	permissionService *permission.Service,
+	timeout time.Duration,
+) *PermissionHandler {
+	if timeout <= 0 {
+		timeout = DefaultPermissionTimeout
+	}
+	if policy == nil {
+		policy = permission.NewEngine(nil)
+	}
+
+	return &PermissionHandler{
+		wsHandler:         wsHandler,
+		policy:            policy,
+		permissionService: permissionService,
+		timeout:           timeout,
+		pending:           make(map[string]*PendingPermission),
+		approvals:         make(map[string]time.Time),
+	}
+}
+
+// Decide works out the answer to a permission request: the policy allows or denies it,
+// a remembered grant allows it, or connected clients are asked.
+// Every decision is recorded in the audit log. Returns the optionId to send back to the agent,
+// or "" if the request was cancelled or none of the offered options fits the decision; the agent
+// must then get the cancelled outcome.
+func (h *PermissionHandler) Decide(ctx context.Context, scope PermissionScope, req *acp.PermissionRequest) string {
+	optionID := h.decide(ctx, scope, req)
+
+	// Remember allowed commands, the agent may run them in a terminal next
+	call := toolCallFromRequest(req)
+	if option := findOption(req.Options, optionID); optionID != "" && strings.HasPrefix(option.Kind, "allow") && permission.InferKind(call) == "execute" {
+		if command := permission.Subject(call); command != "" {
+			h.rememberApproval(req.SessionID, command)
+		}
+	}
+
+	return optionID
+}
+
+// AuthorizeCommand checks that an agent may run a command in a terminal
+// The command goes through Decide like a tool call, unless the agent's own permission request
+// for it was just allowed. Returns a ForbiddenError if it may not run.
+func (h *PermissionHandler) AuthorizeCommand(ctx context.Context, scope PermissionScope, sessionID, command string) error {
+	key := approvalKey(sessionID, command)
+	h.mu.Lock()
+	approvedAt, approved := h.approvals[key]
+	delete(h.approvals, key)
+	h.mu.Unlock()
+
+	if approved && time.Since(approvedAt) < commandApprovalWindow {
+		return nil
+	}
+
+	req := &acp.PermissionRequest{
+		SessionID: sessionID,
+		ToolCall: acp.ToolCallInfo{
+			ToolCallID: "terminal-" + uuid.New().String(),
+			Title:      command,
+			Kind:       "execute",
+			RawInput:   map[string]interface{}{"command": command},
+		},
+		Options: terminalPermissionOptions,
+	}
+
+	optionID := h.decide(ctx, scope, req)
+	if option := findOption(req.Options, optionID); optionID == "" || !strings.HasPrefix(option.Kind, "allow") {
+		return domain.NewForbiddenError("terminal", fmt.Sprintf("running %q was not allowed", command))
+	}
+	return nil
+}
+
+// rememberApproval records that a command was allowed, forgetting approvals that expired unused
+func (h *PermissionHandler) rememberApproval(sessionID, command string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for key, approvedAt := range h.approvals {
+		if now.Sub(approvedAt) >= commandApprovalWindow {
+			delete(h.approvals, key)
+		}
+	}
+	h.approvals[approvalKey(sessionID, command)] = now
+}
+
+// approvalKey identifies an allowed command of a session
+func approvalKey(sessionID, command string) string {
+	return sessionID + "\x00" + strings.TrimSpace(command)
+}
+
+// decide implements Decide
+func (h *PermissionHandler) decide(ctx context.Context, scope PermissionScope, req *acp.PermissionRequest) string {
+	call := toolCallFromRequest(req)
+	decision := h.policy.Evaluate(ctx, scope.SpacePath, call)
+	slog.Info("Permission policy decision",
+		"conversation_id", scope.ConversationID,
+		"tool_call_id", req.ToolCall.ToolCallID,
+		"action", decision.Action,
+		"reason", decision.Reason)
+
+	switch decision.Action {
+	case permission.ActionAllow:
+		return h.answer(ctx, scope, req, acp.FindAllowOption(req.Options), permission.DecidedByPolicy, decision.Reason)
+
+	case permission.ActionDeny:
+		return h.answer(ctx, scope, req, acp.FindRejectOption(req.Options), permission.DecidedByPolicy, decision.Reason)
+	}
+
+	// Remembered "allow always" decisions skip the prompt
+	if h.permissionService != nil && scope.SpaceID != "" {
+		grant, err := h.permissionService.FindGrant(ctx, scope.SpaceID, scope.ConversationID, call)
+		if err != nil {
+			slog.Warn("Failed to look up permission grants", "error", err, "space_id", scope.SpaceID)
+		} else if grant != nil {
+			return h.answer(ctx, scope, req, acp.FindAllowOption(req.Options), permission.DecidedByGrant,
+				fmt.Sprintf("grant %s allows %s", grant.ID, grant.Kind))
+		}
+	}
+
+	optionID, err := h.RequestPermission(ctx, scope.ConversationID, req, decision)
+	if errors.Is(err, ErrPermissionTimeout) {
+		// Nobody answered in time
+		return h.answer(ctx, scope, req, acp.FindRejectOption(req.Options), permission.DecidedByTimeout, err.Error())
+	}
+	if err != nil {
+		return h.answer(ctx, scope, req, nil, permission.DecidedByCancel, err.Error())
+	}
+
+	// ACP offers no conversation-scoped option, so "allow always" is remembered for the whole space.
+	// Grants for a single conversation are created through the API.
+	option := findOption(req.Options, optionID)
+	if option.Kind == "allow_always" && h.permissionService != nil && scope.SpaceID != "" {
+		grant, err := h.permissionService.GrantToolCall(ctx, scope.SpaceID, "", call, permission.DecidedByUser)
+		if err != nil {
+			slog.Warn("Failed to remember permission grant", "error", err, "space_id", scope.SpaceID)
+		} else {
+			slog.Info("Remembered permission grant", "grant_id", grant.ID, "kind", grant.Kind, "pattern", grant.Pattern)
+		}
+	}
+
+	return h.answer(ctx, scope, req, option, permission.DecidedByUser, "selected by user")
+}
+
+// answer records the decision in the audit log and returns the option to send to the agent
+// A nil option is answered with the cancelled outcome.
+func (h *PermissionHandler) answer(
+	ctx context.Context,
+	scope PermissionScope,
+	req *acp.PermissionRequest,
+	option *acp.PermissionOption,
+	decidedBy, reason string,
+) string {
+	optionID := ""
+	outcome := permission.OutcomeCancelled
+	if option != nil {
+		optionID = option.OptionID
+		outcome = permission.OutcomeRejected
+		if strings.HasPrefix(option.Kind, "allow") {
+			outcome = permission.OutcomeAllowed
+		}
+	}
+
+	if h.permissionService != nil {
+		// Record it even when the request was cancelled along with ctx
+		err := h.permissionService.RecordAudit(context.WithoutCancel(ctx), &permission.AuditEntry{
+			SpaceID:        scope.SpaceID,
+			ConversationID: scope.ConversationID,
+			SessionID:      req.SessionID,
+			ToolCallID:     req.ToolCall.ToolCallID,
+			Title:          req.ToolCall.Title,
+			Kind:           permission.InferKind(toolCallFromRequest(req)),
+			RawInput:       req.ToolCall.RawInput,
+			Outcome:        outcome,
+			OptionID:       optionID,
+			DecidedBy:      decidedBy,
+			Reason:         reason,
+		})
+		if err != nil {
+			slog.Warn("Failed to record permission audit entry", "error", err)
+		}
+	}
+
+	return optionID
+}
+
+func toolCallFromRequest(req *acp.PermissionRequest) permission.ToolCall {
+	return permission.ToolCall{
+		Kind:     req.ToolCall.Kind,
+		Title:    req.ToolCall.Title,
+		RawInput: req.ToolCall.RawInput,
+	}
+}
+
+// findOption returns the offered option with the given ID
+// Callers only pass IDs that were validated by Resolve, so the fallback is never used in practice
+func findOption(options []acp.PermissionOption, optionID string) *acp.PermissionOption {
+	for i := range options {
+		if options[i].OptionID == optionID {
+			return &options[i]
+		}
+	}
+	return &acp.PermissionOption{OptionID: optionID}
+}
+
+// RequestPermission broadcasts a permission request and blocks until a client picks an option,
+// the timeout expires or ctx is cancelled. Returns the selected optionId.
+// decision is the policy outcome that sent the request to the user, it can be nil
+func (h *PermissionHandler) RequestPermission(ctx context.Context, conversationID string, req *acp.PermissionRequest, decision *permission.Decision) (string, error) {
+	now := time.Now()
+	pending := &PendingPermission{
+		RequestID:      uuid.New().String(),
+		ConversationID: conversationID,
+		SessionID:      req.SessionID,
+		ToolCallID:     req.ToolCall.ToolCallID,
+		Title:          req.ToolCall.Title,
+		Kind:           req.ToolCall.Kind,
+		RawInput:       req.ToolCall.RawInput,
+		Options:        req.Options,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(h.timeout),
+		Policy:         decision,
+		response:       make(chan string, 1),
+		cancelled:      make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	h.pending[pending.RequestID] = pending
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.pending, pending.RequestID)
+		h.mu.Unlock()
+	}()
+
+	if h.wsHandler != nil {
+		h.wsHandler.BroadcastPermissionRequest(pending)
+	}
+
+	slog.Info("Waiting for permission decision",
+		"request_id", pending.RequestID,
+		"conversation_id", conversationID,
+		"tool_call_id", pending.ToolCallID,
+		"timeout", h.timeout)
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+
+	select {
+	case optionID := <-pending.response:
+		if h.wsHandler != nil {
+			h.wsHandler.BroadcastPermissionResolved(conversationID, pending.RequestID, optionID)
+		}
+		return optionID, nil
+	case <-pending.cancelled:
+		if h.wsHandler != nil {
+			h.wsHandler.BroadcastPermissionResolved(conversationID, pending.RequestID, "")
+		}
+		return "", ErrPermissionCancelled
+	case <-timer.C:
+		if h.wsHandler != nil {
+			h.wsHandler.BroadcastPermissionResolved(conversationID, pending.RequestID, "")
+		}
+		return "", ErrPermissionTimeout
+	case <-ctx.Done():
+		if h.wsHandler != nil {
+			h.wsHandler.BroadcastPermissionResolved(conversationID, pending.RequestID, "")
+		}
+		return "", fmt.Errorf("%w: %v", ErrPermissionCancelled, ctx.Err())
+	}
+}
+
+// Resolve delivers a client's decision for a pending permission request
+func (h *PermissionHandler) Resolve(requestID, optionID string) error {
+	h.mu.Lock()
+	pending, ok := h.pending[requestID]
+	if ok {
+		// Remove immediately so a second answer from another client is rejected
+		delete(h.pending, requestID)
+	}
+	h.mu.Unlock()
+
+	if !ok {
+		return domain.NewNotFoundError("permission request", requestID)
+	}
+
+	if !acp.HasOption(pending.Options, optionID) {
+		// Put it back so a valid answer can still be given
+		h.mu.Lock()
+		h.pending[requestID] = pending
+		h.mu.Unlock()
+		return domain.NewValidationError("option_id", fmt.Sprintf("not an offered option: %s", optionID))
+	}
+
+	pending.response <- optionID
+	return nil
+}
+
+// CancelPending withdraws every pending permission request of a conversation, e.g. because its
+// turn is being cancelled. The agents that asked get the cancelled outcome. Returns how many
+// requests were withdrawn.
+func (h *PermissionHandler) CancelPending(conversationID string) int {
+	h.mu.Lock()
+	var cancelled []*PendingPermission
+	for id, p := range h.pending {
+		if p.ConversationID == conversationID {
+			cancelled = append(cancelled, p)
+			delete(h.pending, id)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, p := range cancelled {
+		close(p.cancelled)
+	}
+	return len(cancelled)
+}
+
+// ListPending returns pending permission requests, optionally filtered by conversation
+func (h *PermissionHandler) ListPending(conversationID string) []*PendingPermission {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := []*PendingPermission{}
+	for _, p := range h.pending {
+		if conversationID == "" || p.ConversationID == conversationID {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// ListPermissions handles GET /api/permissions?conversation_id=...
+func (h *PermissionHandler) ListPermissions(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"permissions": h.ListPending(c.Query("conversation_id")),
+	})
+}
+
+// RespondPermissionRequest represents a client's decision sent over REST
+type RespondPermissionRequest struct {
+	OptionID string `json:"option_id"`
+}
+
+// RespondPermission handles POST /api/permissions/:request_id
+// Body: {"option_id": "allow"}
+func (h *PermissionHandler) RespondPermission(c fiber.Ctx) error {
+	requestID := c.Params("request_id")
+	if requestID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "request_id is required",
+		})
+	}
+
+	var body RespondPermissionRequest
+	if err := c.Bind().JSON(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if body.OptionID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "option_id is required",
+		})
+	}
+
+	if err := h.Resolve(requestID, body.OptionID); err != nil {
+		slog.Warn("Failed to resolve permission request", "error", err, "request_id", requestID)
+		return HandleError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"request_id": requestID,
+		"option_id":  body.OptionID,
+	})
+}
+
+// ListGrants handles GET /api/permissions/grants?space_id=...&conversation_id=...
+func (h *PermissionHandler) ListGrants(c fiber.Ctx) error {
+	if h.permissionService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Permission grants are not available",
+		})
+	}
+
+	grants, err := h.permissionService.ListGrants(c.Context(), c.Query("space_id"), c.Query("conversation_id"))
+	if err != nil {
+		slog.Error("Failed to list permission grants", "error", err)
+		return HandleError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"grants": grants,
+	})
+}
+
+// CreateGrant handles POST /api/permissions/grants
+// Body: {"space_id": "...", "conversation_id": "...", "kind": "execute", "pattern": "npm test*"}
+func (h *PermissionHandler) CreateGrant(c fiber.Ctx) error {
+	if h.permissionService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Permission grants are not available",
+		})
+	}
+
+	var params permission.CreateGrantParams
+	if err := c.Bind().JSON(&params); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	params.CreatedBy = "api"
+
+	grant, err := h.permissionService.CreateGrant(c.Context(), params)
+	if err != nil {
+		slog.Error("Failed to create permission grant", "error", err)
+		return HandleError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(grant)
+}
+
+// GetGrant handles GET /api/permissions/grants/:id
+func (h *PermissionHandler) GetGrant(c fiber.Ctx) error {
+	if h.permissionService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Permission grants are not available",
+		})
+	}
+
+	grant, err := h.permissionService.GetGrant(c.Context(), c.Params("id"))
+	if err != nil {
+		return HandleError(c, err)
+	}
+
+	return c.JSON(grant)
+}
+
+// RevokeGrant handles DELETE /api/permissions/grants/:id
+func (h *PermissionHandler) RevokeGrant(c fiber.Ctx) error {
+	if h.permissionService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Permission grants are not available",
+		})
+	}
+
+	id := c.Params("id")
+	if err := h.permissionService.RevokeGrant(c.Context(), id); err != nil {
+		slog.Warn("Failed to revoke permission grant", "error", err, "grant_id", id)
+		return HandleError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListAudit handles GET /api/permissions/audit?space_id=...&conversation_id=...&limit=...
+func (h *PermissionHandler) ListAudit(c fiber.Ctx) error {
+	if h.permissionService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Permission audit log is not available",
+		})
+	}
+
+	filter := permission.AuditFilter{
+		SpaceID:        c.Query("space_id"),
+		ConversationID: c.Query("conversation_id"),
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 1000 {
+			filter.Limit = l
+		}
+	}
+
+	entries, err := h.permissionService.ListAudit(c.Context(), filter)
+	if err != nil {
+		slog.Error("Failed to list permission audit log", "error", err)
+		return HandleError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"entries": entries,
+	})
+}
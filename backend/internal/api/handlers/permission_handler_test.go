@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/acp"
+)
+
+// TestAuthorizeCommand tests the permission check of terminal commands
+func TestAuthorizeCommand(t *testing.T) {
+	handler := NewPermissionHandler(nil, nil, nil, 50*time.Millisecond)
+	scope := PermissionScope{SpaceID: "space-1", SpacePath: t.TempDir(), ConversationID: "conv-1"}
+	ctx := context.Background()
+
+	// The built-in policy allows safe commands
+	assert.NoError(t, handler.AuthorizeCommand(ctx, scope, "session-1", "ls -la"))
+
+	// Other commands ask the user, nobody answers
+	assert.Error(t, handler.AuthorizeCommand(ctx, scope, "session-1", "make build"))
+
+	// Once the user allowed the agent's tool call, its terminal runs without asking again
+	req := &acp.PermissionRequest{
+		SessionID: "session-1",
+		ToolCall: acp.ToolCallInfo{
+			ToolCallID: "call-1",
+			Kind:       "execute",
+			RawInput:   map[string]interface{}{"command": "make build"},
+		},
+		Options: terminalPermissionOptions,
+	}
+	decided := make(chan string, 1)
+	go func() { decided <- handler.Decide(ctx, scope, req) }()
+
+	require.Eventually(t, func() bool { return len(handler.ListPending("conv-1")) == 1 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, handler.Resolve(handler.ListPending("conv-1")[0].RequestID, "allow"))
+	assert.Equal(t, "allow", <-decided)
+
+	assert.NoError(t, handler.AuthorizeCommand(ctx, scope, "session-1", "make build"))
+
+	// The approval covers one terminal of that session only
+	assert.Error(t, handler.AuthorizeCommand(ctx, scope, "session-1", "make build"))
+}
+
+// TestDecideCancelled tests that withdrawn requests select nothing and are audited as cancelled
+func TestDecideCancelled(t *testing.T) {
+	handler := NewPermissionHandler(nil, nil, nil, time.Minute)
+	scope := PermissionScope{SpaceID: "space-1", SpacePath: t.TempDir(), ConversationID: "conv-1"}
+	req := &acp.PermissionRequest{
+		SessionID: "session-1",
+		ToolCall: acp.ToolCallInfo{
+			ToolCallID: "call-1",
+			Kind:       "execute",
+			RawInput:   map[string]interface{}{"command": "make build"},
+		},
+		Options: terminalPermissionOptions,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	decided := make(chan string, 1)
+	go func() { decided <- handler.Decide(ctx, scope, req) }()
+
+	require.Eventually(t, func() bool { return len(handler.ListPending("conv-1")) == 1 }, time.Second, 5*time.Millisecond)
+	cancel()
+	assert.Equal(t, "", <-decided)
+	assert.Empty(t, handler.ListPending("conv-1"))
+
+	// No offered option fits a policy decision
+	noFit := *req
+	noFit.ToolCall.RawInput = map[string]interface{}{"command": "ls"}
+	noFit.Options = []acp.PermissionOption{{OptionID: "reject", Name: "Reject", Kind: "reject_once"}}
+	assert.Equal(t, "", handler.Decide(context.Background(), scope, &noFit))
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+)
+
+// Bounds for files sent with a prompt
+const (
+	maxPromptImageSize    = conversation.MaxImageSize
+	maxPromptResourceSize = 1 << 20
+)
+
+// promptBuilder assembles the content blocks of a prompt, merging consecutive text
+type promptBuilder struct {
+	blocks []acp.ContentBlock
+}
+
+// text appends text to the prompt
+func (b *promptBuilder) text(s string) {
+	if n := len(b.blocks); n > 0 && b.blocks[n-1].Type == acp.ContentText {
+		b.blocks[n-1].Text += s
+		return
+	}
+	b.blocks = append(b.blocks, acp.TextBlock(s))
+}
+
+// add appends content blocks to the prompt
+func (b *promptBuilder) add(blocks ...acp.ContentBlock) {
+	for _, block := range blocks {
+		if block.Type == acp.ContentText {
+			b.text(block.Text)
+		} else {
+			b.blocks = append(b.blocks, block)
+		}
+	}
+}
+
+// normalizeParts folds the text of a message into its parts
+// Returns the parts to store and the message text: content, or the text parts when there
+// are parts, so titles and text-only consumers keep working.
+func normalizeParts(content string, parts []conversation.ContentPart) ([]conversation.ContentPart, string) {
+	if len(parts) == 0 {
+		return nil, content
+	}
+	if content != "" {
+		parts = append([]conversation.ContentPart{{Type: conversation.PartText, Text: content}}, parts...)
+	}
+
+	var texts []string
+	for _, part := range parts {
+		if part.Type == conversation.PartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return parts, strings.Join(texts, "\n\n")
+}
+
+// checkParts verifies that the files parts refer to exist in the vault and are not too big
+// Called before a message is stored, so a broken attachment is a 400 rather than a lost prompt.
+func (h *MessageHandler) checkParts(parts []conversation.ContentPart) error {
+	for i, part := range parts {
+		if err := part.Validate(); err != nil {
+			return domain.NewValidationError("parts", fmt.Sprintf("part %d: %v", i, err))
+		}
+		if part.Path == "" {
+			continue
+		}
+
+		path, err := h.vaultPath(part.Path)
+		if err != nil {
+			return domain.NewValidationError("parts", fmt.Sprintf("part %d: %v", i, err))
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			return domain.NewValidationError("parts", fmt.Sprintf("part %d: %s is not a file", i, part.Path))
+		}
+
+		switch {
+		case part.Type == conversation.PartImage && info.Size() > maxPromptImageSize:
+			return domain.NewValidationError("parts", fmt.Sprintf("part %d: images must be at most %d bytes", i, maxPromptImageSize))
+		case part.Type == conversation.PartResource && info.Size() > maxPromptResourceSize:
+			return domain.NewValidationError("parts", fmt.Sprintf("part %d: embedded files must be at most %d bytes", i, maxPromptResourceSize))
+		}
+	}
+	return nil
+}
+
+// vaultPath resolves a path relative to the Parachute root, refusing paths that leave it
+// Symlinks are resolved first, so a link in the vault can't attach a file from outside of it.
+func (h *MessageHandler) vaultPath(rel string) (string, error) {
+	root := h.spaceService.ParachuteRoot()
+	path, ok, err := workspace.ResolveWithin(root, filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", rel, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is outside the vault", rel)
+	}
+	return path, nil
+}
+
+// messageBlocks returns the content blocks of a stored message
+func (h *MessageHandler) messageBlocks(msg *conversation.Message) []acp.ContentBlock {
+	if len(msg.Parts) == 0 {
+		return []acp.ContentBlock{acp.TextBlock(msg.Content)}
+	}
+
+	blocks := make([]acp.ContentBlock, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		block, err := h.partBlock(part)
+		if err != nil {
+			// The file may have moved since the message was sent, keep the prompt going
+			block = acp.TextBlock(fmt.Sprintf("[%s %s is unavailable: %v]", part.Type, part.Path, err))
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// partBlock translates a content part into an ACP content block, reading files as needed
+func (h *MessageHandler) partBlock(part conversation.ContentPart) (acp.ContentBlock, error) {
+	switch part.Type {
+	case conversation.PartText:
+		return acp.TextBlock(part.Text), nil
+
+	case conversation.PartImage:
+		if part.Data != "" {
+			return acp.ContentBlock{Type: acp.ContentImage, Data: part.Data, MimeType: part.MimeType}, nil
+		}
+		path, data, err := h.readVaultFile(part.Path, maxPromptImageSize)
+		if err != nil {
+			return acp.ContentBlock{}, err
+		}
+		return acp.ContentBlock{
+			Type:     acp.ContentImage,
+			Data:     base64.StdEncoding.EncodeToString(data),
+			MimeType: mimeType(path, part.MimeType),
+			URI:      fileURI(path),
+		}, nil
+
+	case conversation.PartResourceLink:
+		if part.URI != "" {
+			name := part.Name
+			if name == "" {
+				name = part.URI
+			}
+			return acp.ContentBlock{Type: acp.ContentResourceLink, URI: part.URI, Name: name, MimeType: part.MimeType}, nil
+		}
+		path, err := h.vaultPath(part.Path)
+		if err != nil {
+			return acp.ContentBlock{}, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return acp.ContentBlock{}, err
+		}
+		size := info.Size()
+		name := part.Name
+		if name == "" {
+			name = filepath.Base(path)
+		}
+		return acp.ContentBlock{
+			Type:     acp.ContentResourceLink,
+			URI:      fileURI(path),
+			Name:     name,
+			MimeType: mimeType(path, part.MimeType),
+			Size:     &size,
+		}, nil
+
+	case conversation.PartResource:
+		path, data, err := h.readVaultFile(part.Path, maxPromptResourceSize)
+		if err != nil {
+			return acp.ContentBlock{}, err
+		}
+		resource := &acp.EmbeddedResource{URI: fileURI(path), MimeType: mimeType(path, part.MimeType)}
+		if utf8.Valid(data) {
+			resource.Text = string(data)
+		} else {
+			resource.Blob = base64.StdEncoding.EncodeToString(data)
+		}
+		return acp.ContentBlock{Type: acp.ContentResource, Resource: resource}, nil
+	}
+
+	return acp.ContentBlock{}, fmt.Errorf("unknown part type %q", part.Type)
+}
+
+// readVaultFile reads a file of the vault, refusing files larger than limit
+func (h *MessageHandler) readVaultFile(rel string, limit int64) (string, []byte, error) {
+	path, err := h.vaultPath(rel)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.Size() > limit {
+		return "", nil, fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, data, nil
+}
+
+// supportedBlocks adapts a prompt to what the agent accepts
+// Embedded files the agent can't take become links, images and audio a short note.
+func supportedBlocks(caps acp.AgentCapabilities, blocks []acp.ContentBlock) []acp.ContentBlock {
+	var b promptBuilder
+	for _, block := range blocks {
+		switch {
+		case caps.SupportsContent(block):
+			b.add(block)
+		case block.Type == acp.ContentResource:
+			b.add(acp.ContentBlock{
+				Type:     acp.ContentResourceLink,
+				URI:      block.Resource.URI,
+				Name:     filepath.Base(block.Resource.URI),
+				MimeType: block.Resource.MimeType,
+			})
+		default:
+			b.text(fmt.Sprintf("\n[%s omitted: the agent does not accept %s content]\n", block.Type, block.Type))
+		}
+	}
+	return b.blocks
+}
+
+// fileURI returns the file:// URI of an absolute path
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// mimeType returns the given mime type, or guesses one from the file extension
+func mimeType(path, given string) string {
+	if given != "" {
+		return given
+	}
+	if guessed := mime.TypeByExtension(filepath.Ext(path)); guessed != "" {
+		return guessed
+	}
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		return "text/markdown"
+	}
+	return "application/octet-stream"
+}
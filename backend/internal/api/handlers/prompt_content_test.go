@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+)
+
+// TestSupportedBlocks tests that prompts are adapted to the agent's prompt capabilities
+func TestSupportedBlocks(t *testing.T) {
+	prompt := []acp.ContentBlock{
+		acp.TextBlock("Look at these"),
+		{Type: acp.ContentImage, Data: "iVBORw0KGgo=", MimeType: "image/png"},
+		{Type: acp.ContentResource, Resource: &acp.EmbeddedResource{URI: "file:///vault/notes/idea.md", MimeType: "text/markdown", Text: "An idea"}},
+	}
+
+	t.Run("Capable", func(t *testing.T) {
+		caps := acp.AgentCapabilities{Prompt: acp.PromptCapabilities{Image: true, EmbeddedContext: true}}
+		assert.Equal(t, prompt, supportedBlocks(caps, prompt))
+	})
+
+	t.Run("TextOnly", func(t *testing.T) {
+		blocks := supportedBlocks(acp.AgentCapabilities{}, prompt)
+		require.Len(t, blocks, 2)
+
+		// The image turns into a note merged with the text before it
+		assert.Equal(t, acp.ContentText, blocks[0].Type)
+		assert.Contains(t, blocks[0].Text, "Look at these")
+		assert.Contains(t, blocks[0].Text, "image omitted")
+
+		// The embedded note turns into a link
+		assert.Equal(t, acp.ContentResourceLink, blocks[1].Type)
+		assert.Equal(t, "file:///vault/notes/idea.md", blocks[1].URI)
+		assert.Equal(t, "idea.md", blocks[1].Name)
+	})
+}
+
+// TestVaultPath tests that attachments can't leave the vault, through ".." or a symlink
+func TestVaultPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "notes.md"), []byte("milk"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+
+	h := NewMessageHandler(nil, space.NewService(nil, root), nil, nil, nil, nil)
+
+	path, err := h.vaultPath("notes.md")
+	require.NoError(t, err)
+	assert.Equal(t, "notes.md", filepath.Base(path))
+
+	for _, rel := range []string{"../secret.txt", "link/secret.txt", "link"} {
+		_, err := h.vaultPath(rel)
+		assert.Error(t, err, rel)
+	}
+}
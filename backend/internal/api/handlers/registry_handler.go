@@ -4,6 +4,8 @@ import (
 	"log/slog"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
 	"github.com/unforced/parachute-backend/internal/domain/registry"
 )
 
@@ -257,6 +259,24 @@ func (h *RegistryHandler) SetSetting(c fiber.Ctx) error {
 		})
 	}
 
+	// Reject broken policies up front, the engine would otherwise ask for everything
+	if key == permission.GlobalPolicySetting {
+		if _, err := permission.ParsePolicy([]byte(body.Value)); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// A broken agent registry would make every conversation fail to start a session
+	if key == acp.AgentsSetting {
+		if _, err := acp.ParseAgents([]byte(body.Value)); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
 	if err := h.registryService.SetSetting(c.Context(), key, body.Value); err != nil {
 		slog.Error("Failed to set setting", "error", err, "key", key)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/domain/secret"
+)
+
+// SecretHandler handles the secrets referenced by space config files
+// Values can be written but are never read back through the API
+type SecretHandler struct {
+	secretService *secret.Service
+}
+
+// NewSecretHandler creates a new secret handler
+func NewSecretHandler(secretService *secret.Service) *SecretHandler {
+	return &SecretHandler{secretService: secretService}
+}
+
+// ListSecrets handles GET /api/secrets
+func (h *SecretHandler) ListSecrets(c fiber.Ctx) error {
+	secrets, err := h.secretService.ListSecrets(c.Context())
+	if err != nil {
+		slog.Error("Failed to list secrets", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list secrets",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"secrets": secrets,
+	})
+}
+
+// SetSecret handles PUT /api/secrets/:name
+// Body: {"value": "..."}
+func (h *SecretHandler) SetSecret(c fiber.Ctx) error {
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := c.Bind().JSON(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	s, err := h.secretService.SetSecret(c.Context(), c.Params("name"), body.Value)
+	if err != nil {
+		return HandleError(c, err)
+	}
+
+	return c.JSON(s)
+}
+
+// DeleteSecret handles DELETE /api/secrets/:name
+func (h *SecretHandler) DeleteSecret(c fiber.Ctx) error {
+	if err := h.secretService.DeleteSecret(c.Context(), c.Params("name")); err != nil {
+		return HandleError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+)
+
+// SpaceMCPHandler handles the MCP server config of spaces
+type SpaceMCPHandler struct {
+	spaceService *space.Service
+	mcpService   *space.MCPService
+}
+
+// NewSpaceMCPHandler creates a new space MCP handler
+func NewSpaceMCPHandler(spaceService *space.Service, mcpService *space.MCPService) *SpaceMCPHandler {
+	return &SpaceMCPHandler{
+		spaceService: spaceService,
+		mcpService:   mcpService,
+	}
+}
+
+// GetConfig handles GET /api/spaces/:id/mcp
+// Returns the servers as written, with placeholders, and the problems that will keep
+// servers out of new sessions (invalid entries, unset secrets)
+func (h *SpaceMCPHandler) GetConfig(c fiber.Ctx) error {
+	spaceObj, err := h.spaceService.GetByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return HandleError(c, err)
+	}
+
+	return h.respond(c, spaceObj)
+}
+
+// PutConfig handles PUT /api/spaces/:id/mcp
+// Body: the .mcp.json document, {"mcpServers": {"name": {...}}}
+func (h *SpaceMCPHandler) PutConfig(c fiber.Ctx) error {
+	spaceObj, err := h.spaceService.GetByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return HandleError(c, err)
+	}
+
+	cfg, err := space.ParseMCPConfig(c.Body())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.mcpService.SaveConfig(spaceObj, cfg); err != nil {
+		var configErr *space.MCPConfigError
+		if errors.As(err, &configErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "invalid MCP config",
+				"servers": configErr.Servers,
+			})
+		}
+		slog.Error("Failed to save MCP config", "error", err, "space_id", spaceObj.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save MCP config",
+		})
+	}
+
+	return h.respond(c, spaceObj)
+}
+
+// respond sends the stored config of a space along with its current problems
+func (h *SpaceMCPHandler) respond(c fiber.Ctx, spaceObj *space.Space) error {
+	cfg, err := h.mcpService.LoadConfig(spaceObj)
+	if err != nil {
+		slog.Error("Failed to load MCP config", "error", err, "space_id", spaceObj.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	_, problems, err := h.mcpService.ResolveServers(c.Context(), spaceObj)
+	if err != nil {
+		slog.Warn("Failed to resolve MCP servers", "error", err, "space_id", spaceObj.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"path":       h.spaceService.GetMCPConfigPath(spaceObj),
+		"mcpServers": cfg.MCPServers,
+		"errors":     problems,
+	})
+}
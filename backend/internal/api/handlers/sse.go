@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// sseKeepAlive is how often an idle stream gets a comment, which is also how gone clients are noticed
+const sseKeepAlive = 15 * time.Second
+
+// SSE events of a conversation, by the type of the WebSocket event they mirror
+var sseEvents = map[string]string{
+	"message_chunk":      "chunk",
+	"tool_call":          "tool_call",
+	"tool_call_update":   "tool_call_update",
+	"plan":               "plan",
+	"permission_request": "permission_request",
+	"message_done":       "done",
+	"message_error":      "error",
+}
+
+// sseEvent is one event written to a stream
+type sseEvent struct {
+	name string
+	data interface{}
+}
+
+// streamEvents answers a request with the events of a subscription as Server-Sent Events
+// first is written before anything else, if set. With untilDone the stream ends after the
+// first done or error event, otherwise it runs until the client goes away.
+func streamEvents(c fiber.Ctx, status int, events <-chan WSMessage, unsubscribe func(), first *sseEvent, untilDone bool) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Status(status)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		if first != nil {
+			if err := writeSSE(w, *first); err != nil {
+				return
+			}
+		}
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case msg, ok := <-events:
+				if !ok {
+					writeSSE(w, sseEvent{name: "error", data: fiber.Map{"error": "stream fell behind"}})
+					return
+				}
+
+				name, streamed := sseEvents[msg.Type]
+				if !streamed {
+					continue
+				}
+				if err := writeSSE(w, sseEvent{name: name, data: msg.Payload}); err != nil {
+					return
+				}
+				if untilDone && (name == "done" || name == "error") {
+					return
+				}
+
+			case <-keepAlive.C:
+				if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeSSE writes and flushes one event, failing once the client is gone
+func writeSSE(w *bufio.Writer, event sseEvent) error {
+	data, err := json.Marshal(event.data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
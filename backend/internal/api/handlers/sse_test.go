@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+// TestConversationEvents tests that subscribers only get the events of their conversation
+func TestConversationEvents(t *testing.T) {
+	ws := NewWebSocketHandler()
+
+	events, unsubscribe := ws.Subscribe("conv-1")
+	ws.BroadcastMessageChunk("conv-2", "not for us")
+	ws.BroadcastMessageChunk("conv-1", "hello")
+	ws.BroadcastMessageDone("conv-1", "msg-1", "end_turn")
+
+	msg := <-events
+	assert.Equal(t, "message_chunk", msg.Type)
+	assert.Equal(t, "hello", msg.Payload["chunk"])
+	msg = <-events
+	assert.Equal(t, "message_done", msg.Type)
+	assert.Equal(t, "msg-1", msg.Payload["message_id"])
+
+	unsubscribe()
+	unsubscribe()
+	_, open := <-events
+	assert.False(t, open, "unsubscribing closes the channel")
+
+	// A subscriber that doesn't keep up is dropped rather than blocking the broadcast
+	events, unsubscribe = ws.Subscribe("conv-1")
+	defer unsubscribe()
+	for i := 0; i <= eventBuffer; i++ {
+		ws.BroadcastMessageChunk("conv-1", "chunk")
+	}
+	received := 0
+	for range events {
+		received++
+	}
+	assert.Equal(t, eventBuffer, received)
+}
+
+// TestSendMessageStream tests that ?stream=true answers with Server-Sent Events
+func TestSendMessageStream(t *testing.T) {
+	db, err := sqlite.NewDatabase(t.TempDir() + "/test.db")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	spaceService := space.NewService(sqlite.NewSpaceRepository(db.DB), t.TempDir())
+	conversationService := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+
+	spaceObj, err := spaceService.Create(ctx, "user-1", space.CreateSpaceParams{Name: "Stream"})
+	require.NoError(t, err)
+	conv, err := conversationService.CreateConversation(ctx, conversation.CreateConversationParams{SpaceID: spaceObj.ID, Title: "New Conversation"})
+	require.NoError(t, err)
+
+	// Without an agent the turn fails right away, which ends the stream
+	messageHandler := NewMessageHandler(conversationService, spaceService, nil, nil, NewWebSocketHandler(), nil)
+	app := fiber.New()
+	app.Post("/api/messages", messageHandler.SendMessage)
+
+	body, _ := json.Marshal(SendMessageRequest{ConversationID: conv.ID, Content: "Hello"})
+	req := httptest.NewRequest(http.MethodPost, "/api/messages?stream=true", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "event: message\ndata: {")
+	assert.Contains(t, string(data), `"content":"Hello"`)
+	assert.Contains(t, string(data), "event: error\ndata: {")
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+)
+
+// StatsHandler serves aggregates over the stored conversations
+type StatsHandler struct {
+	conversationService *conversation.Service
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(conversationService *conversation.Service) *StatsHandler {
+	return &StatsHandler{conversationService: conversationService}
+}
+
+// GetUsage handles GET /api/stats/usage?space_id=&from=&to=
+// Sums the stop reasons, durations, chunks and token usage of assistant messages by space,
+// conversation and day. from and to are RFC 3339 times or YYYY-MM-DD dates (UTC), a date as
+// to includes that whole day; both are optional.
+func (h *StatsHandler) GetUsage(c fiber.Ctx) error {
+	filter := conversation.UsageFilter{SpaceID: c.Query("space_id")}
+
+	var err error
+	if filter.From, err = parseStatsTime(c.Query("from"), false); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from must be an RFC 3339 time or a YYYY-MM-DD date",
+		})
+	}
+	if filter.To, err = parseStatsTime(c.Query("to"), true); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "to must be an RFC 3339 time or a YYYY-MM-DD date",
+		})
+	}
+
+	report, err := h.conversationService.UsageStats(c.Context(), filter)
+	if err != nil {
+		slog.Error("Failed to aggregate usage", "error", err, "space_id", filter.SpaceID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to aggregate usage",
+		})
+	}
+
+	return c.JSON(report)
+}
+
+// parseStatsTime parses a bound of a stats query, empty is no bound
+// A date is the start of that day, or the start of the next one if endOfDay is set.
+func parseStatsTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
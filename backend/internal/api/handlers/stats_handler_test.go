@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+// TestGetUsage tests aggregating the usage of assistant messages over HTTP
+func TestGetUsage(t *testing.T) {
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	at := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC).Unix()
+	seed := []struct {
+		stmt string
+		args []interface{}
+	}{
+		{`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES ('space-1', 'One', '/tmp/one', ?, ?)`, []interface{}{at, at}},
+		{`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES ('conv-1', 'space-1', 'A', ?, ?)`, []interface{}{at, at}},
+		{`INSERT INTO messages (id, conversation_id, role, content, created_at, metadata) VALUES ('m1', 'conv-1', 'assistant', 'Hi', ?, ?)`,
+			[]interface{}{at, `{"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":5}}`}},
+	}
+	for _, s := range seed {
+		_, err := db.DB.Exec(s.stmt, s.args...)
+		require.NoError(t, err)
+	}
+
+	handler := NewStatsHandler(conversation.NewService(sqlite.NewConversationRepository(db.DB)))
+	app := fiber.New()
+	app.Get("/api/stats/usage", handler.GetUsage)
+
+	get := func(query string) (int, *conversation.UsageReport) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/stats/usage"+query, nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var report conversation.UsageReport
+		json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, &report
+	}
+
+	// A date as to includes that whole day
+	status, report := get("?space_id=space-1&from=2026-03-01&to=2026-03-01")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, 1, report.Totals.Messages)
+	assert.Equal(t, int64(15), report.Totals.InputTokens+report.Totals.OutputTokens)
+	require.Len(t, report.Days, 1)
+	assert.Equal(t, "2026-03-01", report.Days[0].Day)
+
+	status, report = get("?to=2026-03-01T23:00:00Z")
+	require.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, 0, report.Totals.Messages)
+	assert.NotNil(t, report.Conversations)
+
+	status, _ = get("?from=yesterday")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+)
+
+// turnActivity collects the tool calls and plan reported during the turn in progress, and
+// counts the chunks streamed. They are saved with the assistant message once the turn ends.
+type turnActivity struct {
+	toolCalls     []*conversation.ToolCall
+	byID          map[string]*conversation.ToolCall
+	plan          *conversation.Plan
+	chunks        int
+	thoughtChunks int
+}
+
+func newTurnActivity() *turnActivity {
+	return &turnActivity{byID: make(map[string]*conversation.ToolCall)}
+}
+
+// empty reports whether the agent neither called tools nor made a plan
+func (a *turnActivity) empty() bool {
+	return len(a.toolCalls) == 0 && a.plan == nil
+}
+
+// applyToolCall records a tool_call update or merges a tool_call_update into it
+// Fields missing from the update keep their value, as ACP specifies. Returns nil if the
+// update has no toolCallId.
+func (a *turnActivity) applyToolCall(update map[string]interface{}) *conversation.ToolCall {
+	id, _ := update["toolCallId"].(string)
+	if id == "" {
+		return nil
+	}
+
+	now := time.Now()
+	call, ok := a.byID[id]
+	if !ok {
+		// Also covers updates for a call we missed the start of
+		call = &conversation.ToolCall{ID: id, CreatedAt: now}
+		a.byID[id] = call
+		a.toolCalls = append(a.toolCalls, call)
+	}
+	call.UpdatedAt = now
+
+	if title, ok := update["title"].(string); ok {
+		call.Title = title
+	}
+	if kind, ok := update["kind"].(string); ok {
+		call.Kind = kind
+	}
+	if status, ok := update["status"].(string); ok {
+		call.Status = status
+	}
+
+	for field, dst := range map[string]*json.RawMessage{
+		"rawInput":  &call.RawInput,
+		"rawOutput": &call.RawOutput,
+		"content":   &call.Content,
+		"locations": &call.Locations,
+	} {
+		if value, ok := update[field]; ok && value != nil {
+			if data, err := json.Marshal(value); err == nil {
+				*dst = data
+			}
+		}
+	}
+
+	return call
+}
+
+// applyPlan replaces the plan with the one of a plan update, every update carries the full plan
+func (a *turnActivity) applyPlan(update map[string]interface{}) *conversation.Plan {
+	data, err := json.Marshal(update["entries"])
+	if err != nil {
+		return nil
+	}
+
+	var entries []conversation.PlanEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil
+	}
+	if entries == nil {
+		entries = []conversation.PlanEntry{}
+	}
+
+	a.plan = &conversation.Plan{Entries: entries, UpdatedAt: time.Now()}
+	return a.plan
+}
@@ -1,18 +1,51 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v3"
-	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
 	"github.com/valyala/fasthttp"
 )
 
+// defaultAllowedOrigins are the browser origins allowed when ALLOWED_ORIGINS is not set
+const defaultAllowedOrigins = "http://localhost,http://127.0.0.1"
+
+// OriginAllowed reports whether a browser origin may use the API and WebSocket
+// ALLOWED_ORIGINS lists the allowed origins, comma-separated, "*" allows any. An origin without a
+// port also allows it on any port, e.g. "http://localhost" allows "http://localhost:8080".
+// Defaults to localhost for development.
+func OriginAllowed(origin string) bool {
+	allowedOriginsEnv := os.Getenv("ALLOWED_ORIGINS")
+	if allowedOriginsEnv == "" {
+		allowedOriginsEnv = defaultAllowedOrigins
+	}
+
+	for _, allowed := range strings.Split(allowedOriginsEnv, ",") {
+		allowed = strings.TrimSpace(allowed)
+
+		// Exact match, or any origin
+		if origin == allowed || allowed == "*" {
+			return true
+		}
+
+		// Wildcard port match
+		if strings.HasPrefix(origin, allowed+":") {
+			return true
+		}
+	}
+	return false
+}
+
 var upgrader = websocket.FastHTTPUpgrader{
 	CheckOrigin: func(ctx *fasthttp.RequestCtx) bool {
 		origin := string(ctx.Request.Header.Peek("Origin"))
@@ -23,53 +56,52 @@ var upgrader = websocket.FastHTTPUpgrader{
 			return true
 		}
 
-		// Get allowed origins from environment variable
-		allowedOriginsEnv := os.Getenv("ALLOWED_ORIGINS")
-		if allowedOriginsEnv == "" {
-			// Default: allow localhost for development
-			allowedOriginsEnv = "http://localhost,http://127.0.0.1"
-		}
-
-		allowedOrigins := strings.Split(allowedOriginsEnv, ",")
-
-		// Check if origin matches any allowed origin (with wildcard port support)
-		for _, allowed := range allowedOrigins {
-			allowed = strings.TrimSpace(allowed)
-
-			// Exact match
-			if origin == allowed {
-				return true
-			}
-
-			// Wildcard port match (e.g., "http://localhost" matches "http://localhost:8080")
-			if strings.Contains(origin, allowed+":") {
-				return true
-			}
+		if OriginAllowed(origin) {
+			return true
 		}
 
-		slog.Warn("WebSocket connection rejected", "origin", origin, "allowed", allowedOriginsEnv)
+		slog.Warn("WebSocket connection rejected", "origin", origin)
 		return false
 	},
 }
 
 // WebSocketHandler manages WebSocket connections for real-time chat
+// Clients subscribe to conversations or spaces and only get the events of those. Events of a
+// conversation are numbered, so a client that reconnects can ask for what it missed.
 type WebSocketHandler struct {
-	acpClient   *acp.ACPClient
-	connections sync.Map // map[string]*websocket.Conn - session_id -> conn
-	mu          sync.Mutex
+	permissionHandler   *PermissionHandler
+	messageHandler      *MessageHandler
+	conversationService *conversation.Service
+	connections         sync.Map   // map[*wsClient]struct{} - every open connection
+	broadcastMu         sync.Mutex // Keeps sequence numbers in delivery order
+	slowDisconnects     atomic.Int64
+	events              *conversationEvents // Conversation-scoped subscribers, such as SSE streams
+	log                 *eventLog
+	spaceIDs            sync.Map // map[string]string - conversation_id -> space_id
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
-func NewWebSocketHandler(acpClient *acp.ACPClient) *WebSocketHandler {
-	handler := &WebSocketHandler{
-		acpClient: acpClient,
+func NewWebSocketHandler() *WebSocketHandler {
+	return &WebSocketHandler{
+		events: newConversationEvents(),
+		log:    newEventLog(),
 	}
+}
+
+// SetConversationService wires the service used to find the space of a conversation
+// Without it space subscriptions receive nothing
+func (h *WebSocketHandler) SetConversationService(conversationService *conversation.Service) {
+	h.conversationService = conversationService
+}
 
-	// TODO: Refactor to use per-session notification channels instead of global channel
-	// Currently disabled because it competes with the broadcaster for notifications
-	// go handler.listenForACPNotifications()
+// SetPermissionHandler wires the handler that receives permission_response messages
+func (h *WebSocketHandler) SetPermissionHandler(permissionHandler *PermissionHandler) {
+	h.permissionHandler = permissionHandler
+}
 
-	return handler
+// SetMessageHandler wires the handler that receives cancel messages
+func (h *WebSocketHandler) SetMessageHandler(messageHandler *MessageHandler) {
+	h.messageHandler = messageHandler
 }
 
 // WSMessage represents a WebSocket message
@@ -91,16 +123,23 @@ func (h *WebSocketHandler) HandleUpgrade() fiber.Handler {
 func (h *WebSocketHandler) handleConnection(conn *websocket.Conn) {
 	slog.Info("WebSocket connection established", "remote_addr", conn.RemoteAddr().String())
 
-	sessionID := "" // Will be set when client sends session info
+	client := newWSClient(conn)
+	h.connections.Store(client, struct{}{})
+	go client.writePump()
 
 	defer func() {
-		if sessionID != "" {
-			h.connections.Delete(sessionID)
-		}
-		conn.Close()
-		slog.Info("WebSocket connection closed", "session_id", sessionID)
+		h.connections.Delete(client)
+		client.close()
+		slog.Info("WebSocket connection closed", "remote_addr", conn.RemoteAddr().String())
 	}()
 
+	// A client that sends nothing, not even a pong, for wsPongWait is considered gone
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
 	// Read messages from client
 	for {
 		messageType, msg, err := conn.ReadMessage()
@@ -113,6 +152,8 @@ func (h *WebSocketHandler) handleConnection(conn *websocket.Conn) {
 			break
 		}
 
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
 		if messageType == websocket.TextMessage {
 			var wsMsg WSMessage
 			if err := json.Unmarshal(msg, &wsMsg); err != nil {
@@ -120,127 +161,304 @@ func (h *WebSocketHandler) handleConnection(conn *websocket.Conn) {
 				continue
 			}
 
-			h.handleClientMessage(conn, &wsMsg, &sessionID)
+			h.handleClientMessage(client, &wsMsg)
 		}
 	}
 }
 
 // handleClientMessage handles messages from the WebSocket client
-func (h *WebSocketHandler) handleClientMessage(conn *websocket.Conn, msg *WSMessage, sessionID *string) {
+func (h *WebSocketHandler) handleClientMessage(client *wsClient, msg *WSMessage) {
 	switch msg.Type {
 	case "subscribe":
-		// Client subscribes to ACP session updates
-		if sid, ok := msg.Payload["session_id"].(string); ok {
-			*sessionID = sid
-			h.connections.Store(sid, conn)
-			slog.Info("Client subscribed to session", "session_id", sid)
-
-			// Send acknowledgment
-			h.sendMessage(conn, WSMessage{
-				Type: "subscribed",
-				Payload: map[string]interface{}{
-					"session_id": sid,
-				},
-			})
-		}
+		h.subscribe(client, msg.Payload)
 
 	case "unsubscribe":
-		if *sessionID != "" {
-			h.connections.Delete(*sessionID)
-			*sessionID = ""
-			slog.Info("Client unsubscribed")
+		h.unsubscribe(client, msg.Payload)
+
+	case "permission_response":
+		// Client answers a permission_request event
+		requestID, _ := msg.Payload["request_id"].(string)
+		optionID, _ := msg.Payload["option_id"].(string)
+		if h.permissionHandler == nil || requestID == "" || optionID == "" {
+			h.sendError(client, "invalid_permission_response", "request_id and option_id are required")
+			return
+		}
+
+		if err := h.permissionHandler.Resolve(requestID, optionID); err != nil {
+			slog.Warn("Failed to resolve permission request", "error", err, "request_id", requestID)
+			h.sendError(client, "invalid_permission_response", err.Error())
+		}
+
+	case "cancel":
+		// Client stops the assistant turn in progress for a conversation
+		conversationID, _ := msg.Payload["conversation_id"].(string)
+		if h.messageHandler == nil || conversationID == "" {
+			h.sendError(client, "invalid_cancel", "conversation_id is required")
+			return
 		}
 
+		// Waiting for the agent to acknowledge can take a while, keep reading meanwhile
+		go func() {
+			if _, err := h.messageHandler.CancelResponse(context.Background(), conversationID); err != nil {
+				slog.Warn("Failed to cancel conversation", "error", err, "conversation_id", conversationID)
+				h.sendError(client, "cancel_failed", err.Error())
+			}
+		}()
+
 	default:
 		slog.Warn("Unknown WebSocket message type", "type", msg.Type)
 	}
 }
 
-// listenForACPNotifications listens for ACP notifications and broadcasts to WebSocket clients
-func (h *WebSocketHandler) listenForACPNotifications() {
-	for notif := range h.acpClient.Notifications() {
-		if notif.Method == "session/update" {
-			update, err := acp.ParseSessionUpdate(notif)
-			if err != nil {
-				slog.Error("Failed to parse session/update", "error", err)
-				continue
-			}
+// subscribe adds a conversation or space subscription to a client
+// The payload names conversation_id or space_id; session_id is the conversation_id of older
+// clients. With last_seq, the events of the conversation after it are replayed, or
+// replay_incomplete is sent if the log doesn't reach back that far and the client must reload.
+func (h *WebSocketHandler) subscribe(client *wsClient, payload map[string]interface{}) {
+	conversationID, _ := payload["conversation_id"].(string)
+	legacyID, _ := payload["session_id"].(string)
+	if conversationID == "" {
+		conversationID = legacyID
+	}
+	spaceID, _ := payload["space_id"].(string)
+	if conversationID == "" && spaceID == "" {
+		h.sendError(client, "invalid_subscribe", "conversation_id or space_id is required")
+		return
+	}
 
-			// Find connection for this session
-			if conn, ok := h.connections.Load(update.SessionID); ok {
-				if wsConn, ok := conn.(*websocket.Conn); ok {
-					// Send update to client
-					msg := WSMessage{
-						Type: "session_update",
-						Payload: map[string]interface{}{
-							"session_id": update.SessionID,
-							"update":     update.Update,
-						},
-					}
-
-					if err := h.sendMessage(wsConn, msg); err != nil {
-						slog.Error("Failed to send message to WebSocket client", "error", err, "session_id", update.SessionID)
-						h.connections.Delete(update.SessionID)
-					}
-				}
-			}
+	// No event may slip in between the replay and the subscription
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+
+	client.mu.Lock()
+	if conversationID != "" {
+		client.conversations[conversationID] = true
+	}
+	if spaceID != "" {
+		client.spaces[spaceID] = true
+	}
+	client.mu.Unlock()
+
+	ack := map[string]interface{}{}
+	if spaceID != "" {
+		ack["space_id"] = spaceID
+		slog.Info("Client subscribed to space", "space_id", spaceID)
+	}
+	if conversationID == "" {
+		h.sendMessage(client, WSMessage{Type: "subscribed", Payload: ack})
+		return
+	}
+
+	lastSeq, replay := payload["last_seq"].(float64)
+	missed, seq, complete := h.log.since(conversationID, int64(lastSeq))
+
+	ack["conversation_id"] = conversationID
+	ack["seq"] = seq
+	if legacyID != "" {
+		ack["session_id"] = legacyID
+	}
+	slog.Info("Client subscribed to conversation", "conversation_id", conversationID, "last_seq", int64(lastSeq))
+	if err := h.sendMessage(client, WSMessage{Type: "subscribed", Payload: ack}); err != nil || !replay {
+		return
+	}
+
+	if !complete {
+		h.sendMessage(client, WSMessage{
+			Type: "replay_incomplete",
+			Payload: map[string]interface{}{
+				"conversation_id": conversationID,
+				"seq":             seq,
+			},
+		})
+		return
+	}
+	for _, event := range missed {
+		if err := h.sendMessage(client, event); err != nil {
+			return
 		}
 	}
 }
 
-// sendMessage sends a message to a WebSocket connection
-func (h *WebSocketHandler) sendMessage(conn *websocket.Conn, msg WSMessage) error {
+// unsubscribe removes the named subscriptions of a client, or all of them if none is named
+func (h *WebSocketHandler) unsubscribe(client *wsClient, payload map[string]interface{}) {
+	conversationID, _ := payload["conversation_id"].(string)
+	if conversationID == "" {
+		conversationID, _ = payload["session_id"].(string)
+	}
+	spaceID, _ := payload["space_id"].(string)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if conversationID == "" && spaceID == "" {
+		client.conversations = make(map[string]bool)
+		client.spaces = make(map[string]bool)
+		slog.Info("Client unsubscribed from everything")
+		return
+	}
+	delete(client.conversations, conversationID)
+	delete(client.spaces, spaceID)
+	slog.Info("Client unsubscribed", "conversation_id", conversationID, "space_id", spaceID)
+}
+
+// wants reports whether a client subscribed to a conversation, directly or through its space
+// spaceID is only called when the client has space subscriptions.
+func (c *wsClient) wants(conversationID string, spaceID func() string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conversations[conversationID] {
+		return true
+	}
+	if len(c.spaces) == 0 {
+		return false
+	}
+	return c.spaces[spaceID()]
+}
+
+// spaceOf returns the space of a conversation, or "" if it can't be found
+func (h *WebSocketHandler) spaceOf(conversationID string) string {
+	if spaceID, ok := h.spaceIDs.Load(conversationID); ok {
+		return spaceID.(string)
+	}
+	if h.conversationService == nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conv, err := h.conversationService.GetConversation(ctx, conversationID)
+	if err != nil {
+		return ""
+	}
+	h.spaceIDs.Store(conversationID, conv.SpaceID)
+	return conv.SpaceID
+}
+
+// sendMessage queues a message for a WebSocket connection
+func (h *WebSocketHandler) sendMessage(client *wsClient, msg WSMessage) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	return conn.WriteMessage(websocket.TextMessage, data)
+	return h.enqueue(client, data)
 }
 
-// BroadcastMessageChunk broadcasts a message chunk to all clients subscribed to a conversation
-func (h *WebSocketHandler) BroadcastMessageChunk(conversationID, chunk string) {
-	msg := WSMessage{
-		Type: "message_chunk",
-		Payload: map[string]interface{}{
-			"conversation_id": conversationID,
-			"chunk":           chunk,
-		},
+// enqueue queues an encoded message for a connection, counting the clients dropped for being slow
+func (h *WebSocketHandler) enqueue(client *wsClient, data []byte) error {
+	err := client.enqueue(data)
+	if err == errSlowClient {
+		h.slowDisconnects.Add(1)
+		h.connections.Delete(client)
 	}
+	return err
+}
 
-	// Count connections
-	connCount := 0
+// Stats returns a snapshot of the WebSocket connections and their queues
+func (h *WebSocketHandler) Stats() WSStats {
+	stats := WSStats{
+		QueueCapacity:   wsQueueSize,
+		SlowDisconnects: h.slowDisconnects.Load(),
+	}
 	h.connections.Range(func(key, value interface{}) bool {
-		connCount++
+		client := key.(*wsClient)
+		depth := len(client.send)
+
+		stats.Connections++
+		stats.QueuedMessages += depth
+		if depth > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = depth
+		}
+
+		client.mu.Lock()
+		stats.Subscriptions += len(client.conversations) + len(client.spaces)
+		client.mu.Unlock()
 		return true
 	})
+	return stats
+}
+
+// sendError sends an error event to a single WebSocket connection
+func (h *WebSocketHandler) sendError(client *wsClient, code, message string) {
+	if err := h.sendMessage(client, WSMessage{
+		Type: "error",
+		Payload: map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	}); err != nil {
+		slog.Error("Failed to send error to WebSocket client", "error", err)
+	}
+}
+
+// Subscribe returns the events of one conversation as they are broadcast, and a function to stop
+// The channel is closed when the subscription stops, or if the subscriber falls too far behind.
+func (h *WebSocketHandler) Subscribe(conversationID string) (<-chan WSMessage, func()) {
+	return h.events.subscribe(conversationID)
+}
+
+// broadcast sends an event to the connections subscribed to its conversation
+// The conversation is named by the conversation_id of the payload; its events are numbered
+// and logged for replay, and conversation subscribers like SSE streams get them too. Events of
+// no conversation go to every connection. It returns the number of connections the event was
+// queued for; connections whose queue is full are closed.
+func (h *WebSocketHandler) broadcast(msg WSMessage) int {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+
+	conversationID, _ := msg.Payload["conversation_id"].(string)
+	if conversationID != "" {
+		msg = h.log.append(conversationID, msg)
+		h.events.publish(conversationID, msg)
+	}
+
+	spaceID, resolved := "", false
+	spaceOf := func() string {
+		if !resolved {
+			spaceID, resolved = h.spaceOf(conversationID), true
+		}
+		return spaceID
+	}
 
-	slog.Debug("Broadcasting message chunk", "connections", connCount, "conversation_id", conversationID)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Failed to encode WebSocket message", "error", err, "type", msg.Type)
+		return 0
+	}
 
-	// Send to all connections (they can filter by conversation_id on client side)
 	sentCount := 0
 	h.connections.Range(func(key, value interface{}) bool {
-		if conn, ok := value.(*websocket.Conn); ok {
-			if err := h.sendMessage(conn, msg); err != nil {
-				slog.Error("Failed to send chunk to WebSocket client", "error", err)
-				// Remove dead connection
-				if sessionID, ok := key.(string); ok {
-					h.connections.Delete(sessionID)
-				}
-			} else {
-				sentCount++
-			}
+		client := key.(*wsClient)
+		if conversationID != "" && !client.wants(conversationID, spaceOf) {
+			return true
+		}
+
+		if err := h.enqueue(client, data); err != nil {
+			slog.Error("Failed to send message to WebSocket client", "error", err, "type", msg.Type)
+		} else {
+			sentCount++
 		}
-		return true // continue iteration
+		return true
 	})
-	slog.Debug("Broadcast complete", "sent", sentCount, "total", connCount)
+	return sentCount
+}
+
+// BroadcastMessageChunk broadcasts a message chunk to all clients subscribed to a conversation
+func (h *WebSocketHandler) BroadcastMessageChunk(conversationID, chunk string) {
+	sent := h.broadcast(WSMessage{
+		Type: "message_chunk",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"chunk":           chunk,
+		},
+	})
+	slog.Debug("Message chunk broadcast complete", "conversation_id", conversationID, "sent", sent)
 }
 
 // BroadcastToolCall broadcasts a tool call event to all clients
 func (h *WebSocketHandler) BroadcastToolCall(conversationID, toolCallID, title, kind, status string) {
-	msg := WSMessage{
+	sent := h.broadcast(WSMessage{
 		Type: "tool_call",
 		Payload: map[string]interface{}{
 			"conversation_id": conversationID,
@@ -249,54 +467,156 @@ func (h *WebSocketHandler) BroadcastToolCall(conversationID, toolCallID, title,
 			"kind":            kind,
 			"status":          status,
 		},
-	}
-
-	// Count connections
-	connCount := 0
-	h.connections.Range(func(key, value interface{}) bool {
-		connCount++
-		return true
 	})
-
-	slog.Debug("Broadcasting tool call", "connections", connCount, "conversation_id", conversationID, "tool", kind, "title", title)
-
-	sentCount := 0
-	h.connections.Range(func(key, value interface{}) bool {
-		if conn, ok := value.(*websocket.Conn); ok {
-			if err := h.sendMessage(conn, msg); err != nil {
-				slog.Error("Failed to send tool call to WebSocket client", "error", err)
-				if sessionID, ok := key.(string); ok {
-					h.connections.Delete(sessionID)
-				}
-			} else {
-				sentCount++
-			}
-		}
-		return true
-	})
-	slog.Debug("Tool call broadcast complete", "sent", sentCount, "total", connCount)
+	slog.Debug("Tool call broadcast complete", "conversation_id", conversationID, "tool", kind, "title", title, "sent", sent)
 }
 
 // BroadcastToolCallUpdate broadcasts a tool call update event to all clients
 func (h *WebSocketHandler) BroadcastToolCallUpdate(conversationID, toolCallID, status string) {
-	msg := WSMessage{
+	h.broadcast(WSMessage{
 		Type: "tool_call_update",
 		Payload: map[string]interface{}{
 			"conversation_id": conversationID,
 			"tool_call_id":    toolCallID,
 			"status":          status,
 		},
+	})
+}
+
+// BroadcastPermissionRequest asks clients to approve or reject a tool call
+func (h *WebSocketHandler) BroadcastPermissionRequest(p *PendingPermission) {
+	options := make([]map[string]interface{}, 0, len(p.Options))
+	for _, opt := range p.Options {
+		options = append(options, map[string]interface{}{
+			"option_id": opt.OptionID,
+			"name":      opt.Name,
+			"kind":      opt.Kind,
+		})
 	}
 
-	h.connections.Range(func(key, value interface{}) bool {
-		if conn, ok := value.(*websocket.Conn); ok {
-			if err := h.sendMessage(conn, msg); err != nil {
-				slog.Error("Failed to send tool call update to WebSocket client", "error", err, "tool_call_id", toolCallID)
-				if sessionID, ok := key.(string); ok {
-					h.connections.Delete(sessionID)
-				}
-			}
-		}
-		return true
+	sent := h.broadcast(WSMessage{
+		Type: "permission_request",
+		Payload: map[string]interface{}{
+			"conversation_id": p.ConversationID,
+			"request_id":      p.RequestID,
+			"tool_call_id":    p.ToolCallID,
+			"title":           p.Title,
+			"kind":            p.Kind,
+			"raw_input":       p.RawInput,
+			"options":         options,
+			"expires_at":      p.ExpiresAt,
+			"policy":          p.Policy,
+		},
+	})
+	slog.Debug("Permission request broadcast complete", "request_id", p.RequestID, "sent", sent)
+}
+
+// BroadcastPermissionResolved tells clients a permission request is no longer pending
+// optionID is empty when the request timed out
+func (h *WebSocketHandler) BroadcastPermissionResolved(conversationID, requestID, optionID string) {
+	h.broadcast(WSMessage{
+		Type: "permission_resolved",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"request_id":      requestID,
+			"option_id":       optionID,
+			"timed_out":       optionID == "",
+		},
+	})
+}
+
+// BroadcastFileWrite tells clients an agent wrote a file, with enough to show the diff
+func (h *WebSocketHandler) BroadcastFileWrite(write *workspace.FileWrite) {
+	h.broadcast(WSMessage{
+		Type: "file_write",
+		Payload: map[string]interface{}{
+			"conversation_id": write.ConversationID,
+			"write":           write,
+		},
+	})
+}
+
+// BroadcastTerminalOutput streams output of a command an agent runs in a terminal
+func (h *WebSocketHandler) BroadcastTerminalOutput(conversationID, terminalID, data string) {
+	h.broadcast(WSMessage{
+		Type: "terminal_output",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"terminal_id":     terminalID,
+			"data":            data,
+		},
+	})
+}
+
+// BroadcastTerminalExit tells clients a terminal command exited
+func (h *WebSocketHandler) BroadcastTerminalExit(conversationID, terminalID string, status workspace.ExitStatus) {
+	h.broadcast(WSMessage{
+		Type: "terminal_exit",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"terminal_id":     terminalID,
+			"exit_code":       status.ExitCode,
+			"signal":          status.Signal,
+		},
+	})
+}
+
+// BroadcastPlan sends the agent's current plan for a turn, each plan replaces the previous one
+func (h *WebSocketHandler) BroadcastPlan(conversationID string, entries []conversation.PlanEntry) {
+	h.broadcast(WSMessage{
+		Type: "plan",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"entries":         entries,
+		},
+	})
+}
+
+// BroadcastModeChanged tells clients the session mode of a conversation, with the modes it can switch to
+func (h *WebSocketHandler) BroadcastModeChanged(conversationID string, modes *conversation.Modes) {
+	h.broadcast(WSMessage{
+		Type: "mode_changed",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"current_mode_id": modes.CurrentModeID,
+			"available_modes": modes.Available,
+		},
+	})
+}
+
+// BroadcastMessageDone tells clients an assistant turn is over
+// messageID is empty when the turn produced nothing to save.
+func (h *WebSocketHandler) BroadcastMessageDone(conversationID, messageID, stopReason string) {
+	h.broadcast(WSMessage{
+		Type: "message_done",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"message_id":      messageID,
+			"stop_reason":     stopReason,
+		},
+	})
+}
+
+// BroadcastMessageError tells clients an assistant turn failed before the agent could answer
+func (h *WebSocketHandler) BroadcastMessageError(conversationID, message string) {
+	h.broadcast(WSMessage{
+		Type: "message_error",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"error":           message,
+		},
+	})
+}
+
+// BroadcastMessageCancelled tells clients an assistant turn was cancelled
+// messageID is empty when nothing had been streamed yet, so nothing was saved
+func (h *WebSocketHandler) BroadcastMessageCancelled(conversationID, messageID, content string) {
+	h.broadcast(WSMessage{
+		Type: "message_cancelled",
+		Payload: map[string]interface{}{
+			"conversation_id": conversationID,
+			"message_id":      messageID,
+			"content":         content,
+		},
 	})
 }
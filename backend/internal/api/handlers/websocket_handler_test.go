@@ -2,18 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"net"
 	"testing"
+	"time"
 
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 // TestWebSocketHandler_Creation tests handler creation
 func TestWebSocketHandler_Creation(t *testing.T) {
-	handler := NewWebSocketHandler(nil)
+	handler := NewWebSocketHandler()
 
 	assert.NotNil(t, handler)
-	assert.Nil(t, handler.acpClient)
 
 	// Verify connections map is initialized (not nil)
 	count := 0
@@ -162,7 +165,7 @@ func TestWSMessage_ToolCallUpdate(t *testing.T) {
 
 // TestWebSocketHandler_BroadcastToNoConnections tests broadcasting with no connections
 func TestWebSocketHandler_BroadcastToNoConnections(t *testing.T) {
-	handler := NewWebSocketHandler(nil)
+	handler := NewWebSocketHandler()
 
 	// Should not panic when broadcasting to no connections
 	assert.NotPanics(t, func() {
@@ -177,3 +180,75 @@ func TestWebSocketHandler_BroadcastToNoConnections(t *testing.T) {
 		handler.BroadcastToolCallUpdate("conv-123", "tool-1", "completed")
 	})
 }
+
+// TestWebSocketHandler_SlowClient tests that a client that can't keep up is disconnected
+func TestWebSocketHandler_SlowClient(t *testing.T) {
+	handler := NewWebSocketHandler()
+
+	app := fiber.New()
+	app.Get("/ws", handler.HandleUpgrade())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	defer app.Shutdown()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(WSMessage{Type: "subscribe", Payload: map[string]interface{}{"conversation_id": "conv-1"}}))
+	var ack WSMessage
+	require.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, "subscribed", ack.Type)
+
+	stats := handler.Stats()
+	assert.Equal(t, 1, stats.Connections)
+	assert.Equal(t, 1, stats.Subscriptions)
+	assert.Equal(t, wsQueueSize, stats.QueueCapacity)
+
+	// A client whose writer is stuck, so that nothing leaves its queue
+	stuckConn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+	require.NoError(t, err)
+	defer stuckConn.Close()
+	stuck := newWSClient(stuckConn)
+	stuck.conversations["conv-1"] = true
+	handler.connections.Store(stuck, struct{}{})
+
+	for i := 0; i < wsQueueSize; i++ {
+		handler.BroadcastMessageChunk("conv-1", "chunk")
+	}
+	assert.Equal(t, wsQueueSize, handler.Stats().MaxQueueDepth)
+
+	// One more overflows the queue, the other client keeps receiving
+	handler.BroadcastMessageChunk("conv-1", "chunk")
+	stats = handler.Stats()
+	assert.Equal(t, int64(1), stats.SlowDisconnects)
+	assert.Eventually(t, func() bool { return handler.Stats().Connections == 2 }, time.Second, 10*time.Millisecond,
+		"the stuck client is gone, both server-side connections remain")
+	assert.ErrorIs(t, stuck.enqueue([]byte("{}")), errClientClosed)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i <= wsQueueSize; i++ {
+		var msg WSMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		require.Equal(t, "message_chunk", msg.Type)
+	}
+}
+
+// TestOriginAllowed tests the browser origins allowed to use the API and WebSocket
+func TestOriginAllowed(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "")
+	assert.True(t, OriginAllowed("http://localhost"))
+	assert.True(t, OriginAllowed("http://localhost:5173"))
+	assert.True(t, OriginAllowed("http://127.0.0.1:3333"))
+	assert.False(t, OriginAllowed("https://evil.example.com"))
+	assert.False(t, OriginAllowed("http://localhost.evil.example.com"))
+
+	t.Setenv("ALLOWED_ORIGINS", "https://app.example.com, http://localhost")
+	assert.True(t, OriginAllowed("https://app.example.com"))
+	assert.True(t, OriginAllowed("http://localhost:8080"))
+	assert.False(t, OriginAllowed("http://127.0.0.1:3333"))
+
+	t.Setenv("ALLOWED_ORIGINS", "*")
+	assert.True(t, OriginAllowed("https://evil.example.com"))
+}
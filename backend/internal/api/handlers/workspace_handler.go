@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+)
+
+// WorkspaceHandler exposes the files agents wrote, for diffs and undo
+type WorkspaceHandler struct {
+	workspaceService *workspace.Service
+}
+
+// NewWorkspaceHandler creates a new workspace handler
+func NewWorkspaceHandler(workspaceService *workspace.Service) *WorkspaceHandler {
+	return &WorkspaceHandler{workspaceService: workspaceService}
+}
+
+// ListWrites handles GET /api/conversations/:id/writes
+func (h *WorkspaceHandler) ListWrites(c fiber.Ctx) error {
+	writes, err := h.workspaceService.ListWrites(c.Context(), c.Params("id"))
+	if err != nil {
+		slog.Error("Failed to list file writes", "error", err, "conversation_id", c.Params("id"))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list file writes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"writes": writes,
+	})
+}
+
+// GetWrite handles GET /api/writes/:id
+func (h *WorkspaceHandler) GetWrite(c fiber.Ctx) error {
+	write, err := h.workspaceService.GetWrite(c.Context(), c.Params("id"))
+	if err != nil {
+		return HandleError(c, err)
+	}
+
+	return c.JSON(write)
+}
+
+// UndoWrite handles POST /api/writes/:id/undo
+// Responds 409 if the file changed since the write, later writes must be undone first
+func (h *WorkspaceHandler) UndoWrite(c fiber.Ctx) error {
+	write, err := h.workspaceService.UndoWrite(c.Context(), c.Params("id"))
+	if err != nil {
+		slog.Warn("Failed to undo file write", "error", err, "id", c.Params("id"))
+		return HandleError(c, err)
+	}
+
+	return c.JSON(write)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+// Timing and limits of WebSocket connections
+const (
+	wsWriteWait      = 10 * time.Second    // Time allowed to write one message
+	wsPongWait       = 60 * time.Second    // Time allowed between two messages or pongs from the client
+	wsPingPeriod     = wsPongWait * 9 / 10 // Pings are sent before the read deadline passes
+	wsMaxMessageSize = 1 << 20             // Largest message accepted from a client
+	wsQueueSize      = eventLogSize + 256  // Outbound messages per connection, room for a full replay
+)
+
+// errSlowClient is returned when a message doesn't fit in the queue of a connection
+var errSlowClient = errors.New("client is too slow, disconnected")
+
+// errClientClosed is returned when a message is sent to a closed connection
+var errClientClosed = errors.New("connection is closed")
+
+// wsClient is a WebSocket connection and what it subscribed to
+// Messages are written by the goroutine of writePump, from a bounded queue. A client whose
+// queue is full is disconnected rather than allowed to hold up anyone else; it can resume
+// with last_seq once it reconnects.
+type wsClient struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	conversations map[string]bool
+	spaces        map[string]bool
+}
+
+func newWSClient(conn *websocket.Conn) *wsClient {
+	return &wsClient{
+		conn:          conn,
+		send:          make(chan []byte, wsQueueSize),
+		done:          make(chan struct{}),
+		conversations: make(map[string]bool),
+		spaces:        make(map[string]bool),
+	}
+}
+
+// enqueue queues a message without blocking, closing the connection if the queue is full
+func (c *wsClient) enqueue(data []byte) error {
+	select {
+	case <-c.done:
+		return errClientClosed
+	default:
+	}
+
+	select {
+	case c.send <- data:
+		return nil
+	default:
+		slog.Warn("Disconnecting slow WebSocket client", "remote_addr", c.conn.RemoteAddr().String(), "queued", len(c.send))
+		c.close()
+		return errSlowClient
+	}
+}
+
+// close closes the connection once, which also ends the read loop and writePump
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// writePump writes queued messages and pings until the connection closes
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.close()
+	}()
+
+	for {
+		select {
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				slog.Debug("WebSocket write failed", "error", err)
+				return
+			}
+
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				slog.Debug("WebSocket ping failed", "error", err)
+				return
+			}
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// WSStats is a snapshot of the WebSocket connections, reported on /health
+type WSStats struct {
+	Connections     int   `json:"connections"`
+	Subscriptions   int   `json:"subscriptions"`
+	QueuedMessages  int   `json:"queued_messages"`  // Across all connections
+	MaxQueueDepth   int   `json:"max_queue_depth"`  // Of the most backed up connection
+	QueueCapacity   int   `json:"queue_capacity"`   // Per connection
+	SlowDisconnects int64 `json:"slow_disconnects"` // Connections closed because their queue was full
+}
@@ -1,6 +1,10 @@
 package conversation
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -11,6 +15,38 @@ type Conversation struct {
 	Title     string    `json:"title"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Rolling summary of the messages that no longer fit in the history budget,
+	// covering every message up to and including SummaryThrough
+	Summary        string `json:"summary,omitempty"`
+	SummaryThrough string `json:"summary_through,omitempty"`
+
+	// Session modes of the agent, nil until a session reported them
+	Modes *Modes `json:"modes,omitempty"`
+}
+
+// Modes are the session modes the agent of a conversation offers, and the one it is in
+// They outlive the ACP session, so a new session can be put back in the mode the user picked.
+type Modes struct {
+	CurrentModeID string `json:"current_mode_id"`
+	Available     []Mode `json:"available"`
+}
+
+// Mode is a session mode, e.g. asking before edits or only planning
+type Mode struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Has reports whether modeID is one of the available modes
+func (m *Modes) Has(modeID string) bool {
+	for _, mode := range m.Available {
+		if mode.ID == modeID {
+			return true
+		}
+	}
+	return false
 }
 
 // Message represents a single message in a conversation
@@ -21,6 +57,121 @@ type Message struct {
 	Content        string    `json:"content"`
 	CreatedAt      time.Time `json:"created_at"`
 	Metadata       string    `json:"metadata,omitempty"` // JSON metadata
+
+	// Images and files sent with a user message, in prompt order; Content holds their text
+	Parts []ContentPart `json:"parts,omitempty"`
+	// Capture IDs of the space's relevant notes the user referenced, injected into the prompt
+	NoteRefs []string `json:"note_refs,omitempty"`
+
+	// What the agent did during the turn, only set on assistant messages by ListTranscript
+	ToolCalls []*ToolCall `json:"tool_calls,omitempty"`
+	Plan      *Plan       `json:"plan,omitempty"`
+}
+
+// Content part types of a user message
+const (
+	PartText         = "text"
+	PartImage        = "image"
+	PartResourceLink = "resource_link" // A file the agent may open
+	PartResource     = "resource"      // A file whose content is embedded in the prompt
+)
+
+// MaxImageSize bounds an image sent with a message, inline or from the vault
+const MaxImageSize = 5 << 20
+
+// ContentPart is one piece of a user message, sent to the agent as an ACP content block
+// Images carry base64 data or a path; resources a path, links a path or a URI.
+// Paths are relative to the Parachute root.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"` // Base64, images only
+	MimeType string `json:"mime_type,omitempty"`
+	Path     string `json:"path,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// Validate checks that a part has what its type needs
+func (p *ContentPart) Validate() error {
+	switch p.Type {
+	case PartText:
+		if p.Text == "" {
+			return fmt.Errorf("text part needs text")
+		}
+	case PartImage:
+		if (p.Data == "") == (p.Path == "") {
+			return fmt.Errorf("image part needs either data or path")
+		}
+		if p.Data != "" {
+			if !strings.HasPrefix(p.MimeType, "image/") {
+				return fmt.Errorf("image part with data needs an image mime_type")
+			}
+			// Refuse oversized data before decoding it
+			if len(p.Data) > base64.StdEncoding.EncodedLen(MaxImageSize) {
+				return fmt.Errorf("images must be at most %d bytes", MaxImageSize)
+			}
+			data, err := base64.StdEncoding.DecodeString(p.Data)
+			if err != nil {
+				return fmt.Errorf("image data is not valid base64")
+			}
+			if len(data) > MaxImageSize {
+				return fmt.Errorf("images must be at most %d bytes", MaxImageSize)
+			}
+		}
+	case PartResourceLink:
+		if (p.Path == "") == (p.URI == "") {
+			return fmt.Errorf("resource_link part needs either path or uri")
+		}
+	case PartResource:
+		if p.Path == "" {
+			return fmt.Errorf("resource part needs a path")
+		}
+	default:
+		return fmt.Errorf("unknown part type %q", p.Type)
+	}
+	return nil
+}
+
+// ToolCall is a tool invocation the agent made while producing an assistant message
+// It holds the final state after all ACP tool_call_update notifications were applied.
+type ToolCall struct {
+	ID        string          `json:"id"` // ACP toolCallId
+	MessageID string          `json:"message_id"`
+	Position  int             `json:"position"` // Order within the message
+	Kind      string          `json:"kind,omitempty"`
+	Title     string          `json:"title"`
+	Status    string          `json:"status,omitempty"`
+	RawInput  json.RawMessage `json:"raw_input,omitempty"`
+	RawOutput json.RawMessage `json:"raw_output,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`   // ACP tool call content: text, diffs, terminals
+	Locations json.RawMessage `json:"locations,omitempty"` // Files the tool touched
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Plan is the last execution plan the agent reported while producing an assistant message
+type Plan struct {
+	MessageID string      `json:"message_id"`
+	Entries   []PlanEntry `json:"entries"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// PlanEntry is one task of a plan
+type PlanEntry struct {
+	Content  string `json:"content"`
+	Priority string `json:"priority"` // high, medium, low
+	Status   string `json:"status"`   // pending, in_progress, completed
+}
+
+// Session is the ACP session that serves a conversation
+// It is persisted so the conversation can be resumed with session/load after a restart.
+type Session struct {
+	ID             string    `json:"id"` // ACP sessionId
+	ConversationID string    `json:"conversation_id"`
+	Agent          string    `json:"agent"` // Name of the agent that owns the session
+	CreatedAt      time.Time `json:"created_at"`
+	LastUsedAt     time.Time `json:"last_used_at"`
 }
 
 // CreateConversationParams represents parameters for creating a conversation
@@ -31,8 +182,10 @@ type CreateConversationParams struct {
 
 // CreateMessageParams represents parameters for creating a message
 type CreateMessageParams struct {
-	ConversationID string `json:"conversation_id"`
-	Role           string `json:"role"`
-	Content        string `json:"content"`
-	Metadata       string `json:"metadata,omitempty"`
+	ConversationID string        `json:"conversation_id"`
+	Role           string        `json:"role"`
+	Content        string        `json:"content"`
+	Metadata       string        `json:"metadata,omitempty"`
+	Parts          []ContentPart `json:"parts,omitempty"`
+	NoteRefs       []string      `json:"note_refs,omitempty"`
 }
@@ -0,0 +1,42 @@
+package conversation_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+)
+
+func TestContentPartValidate(t *testing.T) {
+	image := func(data string) conversation.ContentPart {
+		return conversation.ContentPart{Type: conversation.PartImage, Data: data, MimeType: "image/png"}
+	}
+
+	valid := []conversation.ContentPart{
+		{Type: conversation.PartText, Text: "hi"},
+		image("iVBORw0KGgo="),
+		image(base64.StdEncoding.EncodeToString(make([]byte, conversation.MaxImageSize))),
+		{Type: conversation.PartImage, Path: "photos/cat.png"},
+		{Type: conversation.PartResourceLink, URI: "https://example.com/spec.md"},
+	}
+	for _, part := range valid {
+		if err := part.Validate(); err != nil {
+			t.Errorf("Expected %s part to be valid, got %v", part.Type, err)
+		}
+	}
+
+	invalid := map[string]conversation.ContentPart{
+		"no mime type":  {Type: conversation.PartImage, Data: "iVBORw0KGgo="},
+		"not base64":    image("not base64!"),
+		"too big":       image(base64.StdEncoding.EncodeToString(make([]byte, conversation.MaxImageSize+1))),
+		"far too big":   image(strings.Repeat("A", 2*conversation.MaxImageSize)),
+		"data and path": {Type: conversation.PartImage, Data: "iVBORw0KGgo=", Path: "cat.png", MimeType: "image/png"},
+		"unknown type":  {Type: "video", URI: "https://example.com/a.mp4"},
+	}
+	for name, part := range invalid {
+		if err := part.Validate(); err == nil {
+			t.Errorf("Expected %s to be refused", name)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package conversation
+
+import "unicode/utf8"
+
+// DefaultHistoryTokenBudget bounds the history replayed to a new session when the space sets no budget
+const DefaultHistoryTokenBudget = 8000
+
+// attachmentTokens is the rough cost of an image, file or note, whatever its size
+const attachmentTokens = 1000
+
+// EstimateTokens approximates the number of tokens of a text, at about four characters per token
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// MessageTokens approximates what a message costs in a prompt
+func MessageTokens(msg *Message) int {
+	tokens := EstimateTokens(msg.Content)
+	for _, part := range msg.Parts {
+		if part.Type != PartText {
+			tokens += attachmentTokens
+		}
+	}
+	return tokens + len(msg.NoteRefs)*attachmentTokens
+}
+
+// SummaryBudget returns the tokens a history budget leaves for the summary of older messages
+func SummaryBudget(budget int) int {
+	if budget <= 0 {
+		budget = DefaultHistoryTokenBudget
+	}
+	return budget / 4
+}
+
+// SplitHistory splits messages into the most recent ones that fit in budget tokens and the older ones
+// When not everything fits, SummaryBudget(budget) is kept free for a summary of the older messages.
+// A budget of 0 means DefaultHistoryTokenBudget.
+func SplitHistory(messages []*Message, budget int) (recent, older []*Message) {
+	if budget <= 0 {
+		budget = DefaultHistoryTokenBudget
+	}
+
+	total := 0
+	for _, msg := range messages {
+		total += MessageTokens(msg)
+	}
+	if total <= budget {
+		return messages, nil
+	}
+
+	remaining := budget - SummaryBudget(budget)
+	start := len(messages)
+	for start > 0 {
+		tokens := MessageTokens(messages[start-1])
+		if tokens > remaining {
+			break
+		}
+		remaining -= tokens
+		start--
+	}
+
+	return messages[start:], messages[:start]
+}
+
+// SummaryChunkBudget returns the tokens of messages folded into the summary at once
+// With the summary so far, each summary prompt stays within the history budget.
+func SummaryChunkBudget(budget int) int {
+	if budget <= 0 {
+		budget = DefaultHistoryTokenBudget
+	}
+	return budget - SummaryBudget(budget)
+}
+
+// ChunkHistory splits messages into consecutive chunks of at most budget tokens
+// A message larger than the budget makes a chunk of its own.
+func ChunkHistory(messages []*Message, budget int) [][]*Message {
+	var chunks [][]*Message
+	start, tokens := 0, 0
+	for i, msg := range messages {
+		cost := MessageTokens(msg)
+		if i > start && tokens+cost > budget {
+			chunks = append(chunks, messages[start:i])
+			start, tokens = i, 0
+		}
+		tokens += cost
+	}
+	if start < len(messages) {
+		chunks = append(chunks, messages[start:])
+	}
+	return chunks
+}
@@ -0,0 +1,67 @@
+package conversation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+)
+
+func TestSplitHistory(t *testing.T) {
+	// 100 tokens each
+	var messages []*conversation.Message
+	for i := 0; i < 10; i++ {
+		messages = append(messages, &conversation.Message{ID: string(rune('a' + i)), Content: strings.Repeat("word", 100)})
+	}
+
+	recent, older := conversation.SplitHistory(messages, 1000)
+	if len(recent) != 10 || len(older) != 0 {
+		t.Errorf("Expected everything to fit, got %d recent and %d older", len(recent), len(older))
+	}
+
+	// A quarter of the budget is kept for the summary of what doesn't fit
+	recent, older = conversation.SplitHistory(messages, 800)
+	if len(recent) != 6 || len(older) != 4 {
+		t.Fatalf("Expected 6 recent and 4 older messages, got %d and %d", len(recent), len(older))
+	}
+	if recent[0].ID != "e" || older[len(older)-1].ID != "d" {
+		t.Errorf("Expected the split between d and e, got %s and %s", older[len(older)-1].ID, recent[0].ID)
+	}
+
+	// Attachments count whatever their size
+	withImage := &conversation.Message{Content: "see", Parts: []conversation.ContentPart{
+		{Type: conversation.PartText, Text: "see"},
+		{Type: conversation.PartImage, Data: "aGk=", MimeType: "image/png"},
+	}}
+	if tokens := conversation.MessageTokens(withImage); tokens <= conversation.EstimateTokens("see") {
+		t.Errorf("Expected the image to add to the estimate, got %d tokens", tokens)
+	}
+}
+
+func TestChunkHistory(t *testing.T) {
+	// 100 tokens each, the fourth is 500
+	var messages []*conversation.Message
+	for i := 0; i < 6; i++ {
+		content := strings.Repeat("word", 100)
+		if i == 3 {
+			content = strings.Repeat(content, 5)
+		}
+		messages = append(messages, &conversation.Message{ID: string(rune('a' + i)), Content: content})
+	}
+
+	chunks := conversation.ChunkHistory(messages, 250)
+	var sizes []int
+	for _, chunk := range chunks {
+		sizes = append(sizes, len(chunk))
+	}
+	if len(sizes) != 4 || sizes[0] != 2 || sizes[1] != 1 || sizes[2] != 1 || sizes[3] != 2 {
+		t.Errorf("Expected chunks of 2, 1, 1 and 2 messages, got %v", sizes)
+	}
+	if chunks[2][0].ID != "d" {
+		t.Errorf("Expected the large message in a chunk of its own, got %s", chunks[2][0].ID)
+	}
+
+	if chunks := conversation.ChunkHistory(nil, 250); len(chunks) != 0 {
+		t.Errorf("Expected no chunks, got %d", len(chunks))
+	}
+}
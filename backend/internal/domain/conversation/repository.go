@@ -2,6 +2,7 @@ package conversation
 
 import (
 	"context"
+	"time"
 )
 
 // Repository defines the interface for conversation and message persistence
@@ -12,10 +13,26 @@ type Repository interface {
 	ListConversations(ctx context.Context, spaceID string) ([]*Conversation, error)
 	UpdateConversation(ctx context.Context, conv *Conversation) error
 	DeleteConversation(ctx context.Context, id string) error
+	SaveSummary(ctx context.Context, conversationID, summary, throughMessageID string) error
+	SaveModes(ctx context.Context, conversationID string, modes *Modes) error
+	SetCurrentMode(ctx context.Context, conversationID, modeID string) error
 
 	// Message methods
 	CreateMessage(ctx context.Context, msg *Message) error
 	GetMessage(ctx context.Context, id string) (*Message, error)
 	ListMessages(ctx context.Context, conversationID string) ([]*Message, error)
 	DeleteMessage(ctx context.Context, id string) error
+	ListUsage(ctx context.Context, filter UsageFilter) ([]*UsageRow, error)
+
+	// Turn activity methods, ListToolCalls and ListPlans return those of a whole conversation
+	SaveToolCalls(ctx context.Context, toolCalls []*ToolCall) error
+	ListToolCalls(ctx context.Context, conversationID string) ([]*ToolCall, error)
+	SavePlan(ctx context.Context, plan *Plan) error
+	ListPlans(ctx context.Context, conversationID string) ([]*Plan, error)
+
+	// Session methods
+	SaveSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, conversationID string) (*Session, error)
+	TouchSession(ctx context.Context, conversationID string, usedAt time.Time) error
+	DeactivateSession(ctx context.Context, conversationID string) error
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/unforced/parachute-backend/internal/domain"
 )
 
 // Service provides business logic for conversations and messages
@@ -70,6 +71,21 @@ func (s *Service) UpdateConversation(ctx context.Context, id string, title strin
 	return conv, nil
 }
 
+// SaveSummary caches the summary of a conversation's messages up to throughMessageID
+func (s *Service) SaveSummary(ctx context.Context, conversationID, summary, throughMessageID string) error {
+	return s.repo.SaveSummary(ctx, conversationID, summary, throughMessageID)
+}
+
+// SaveModes records the session modes the agent reported for a conversation
+func (s *Service) SaveModes(ctx context.Context, conversationID string, modes *Modes) error {
+	return s.repo.SaveModes(ctx, conversationID, modes)
+}
+
+// SetCurrentMode records the mode the session of a conversation switched to
+func (s *Service) SetCurrentMode(ctx context.Context, conversationID, modeID string) error {
+	return s.repo.SetCurrentMode(ctx, conversationID, modeID)
+}
+
 // DeleteConversation deletes a conversation
 func (s *Service) DeleteConversation(ctx context.Context, id string) error {
 	return s.repo.DeleteConversation(ctx, id)
@@ -89,10 +105,17 @@ func (s *Service) CreateMessage(ctx context.Context, params CreateMessageParams)
 		return nil, fmt.Errorf("role must be 'user' or 'assistant'")
 	}
 
-	if params.Content == "" {
+	// An assistant turn may consist of tool calls only
+	if params.Content == "" && len(params.Parts) == 0 && params.Role == "user" {
 		return nil, fmt.Errorf("content is required")
 	}
 
+	for i := range params.Parts {
+		if err := params.Parts[i].Validate(); err != nil {
+			return nil, domain.NewValidationError("parts", fmt.Sprintf("part %d: %v", i, err))
+		}
+	}
+
 	msg := &Message{
 		ID:             uuid.New().String(),
 		ConversationID: params.ConversationID,
@@ -100,6 +123,8 @@ func (s *Service) CreateMessage(ctx context.Context, params CreateMessageParams)
 		Content:        params.Content,
 		CreatedAt:      time.Now(),
 		Metadata:       params.Metadata,
+		Parts:          params.Parts,
+		NoteRefs:       params.NoteRefs,
 	}
 
 	if err := s.repo.CreateMessage(ctx, msg); err != nil {
@@ -126,7 +151,108 @@ func (s *Service) ListMessages(ctx context.Context, conversationID string) ([]*M
 	return s.repo.ListMessages(ctx, conversationID)
 }
 
+// ListTranscript retrieves all messages for a conversation with the tool calls and plan
+// of each assistant message attached
+func (s *Service) ListTranscript(ctx context.Context, conversationID string) ([]*Message, error) {
+	messages, err := s.repo.ListMessages(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	toolCalls, err := s.repo.ListToolCalls(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	plans, err := s.repo.ListPlans(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*Message, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+	}
+	for _, call := range toolCalls {
+		if msg, ok := byID[call.MessageID]; ok {
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+	}
+	for _, plan := range plans {
+		if msg, ok := byID[plan.MessageID]; ok {
+			msg.Plan = plan
+		}
+	}
+
+	return messages, nil
+}
+
+// SaveTurnActivity stores the tool calls and plan of an assistant message
+// Tool calls are numbered in the order given, plan may be nil
+func (s *Service) SaveTurnActivity(ctx context.Context, messageID string, toolCalls []*ToolCall, plan *Plan) error {
+	for i, call := range toolCalls {
+		call.MessageID = messageID
+		call.Position = i
+	}
+	if len(toolCalls) > 0 {
+		if err := s.repo.SaveToolCalls(ctx, toolCalls); err != nil {
+			return fmt.Errorf("failed to save tool calls: %w", err)
+		}
+	}
+
+	if plan != nil {
+		plan.MessageID = messageID
+		if err := s.repo.SavePlan(ctx, plan); err != nil {
+			return fmt.Errorf("failed to save plan: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UsageStats aggregates the stop reasons, timing and token usage of assistant messages
+func (s *Service) UsageStats(ctx context.Context, filter UsageFilter) (*UsageReport, error) {
+	rows, err := s.repo.ListUsage(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return newUsageReport(rows), nil
+}
+
 // DeleteMessage deletes a message
 func (s *Service) DeleteMessage(ctx context.Context, id string) error {
 	return s.repo.DeleteMessage(ctx, id)
 }
+
+// SaveSession records the ACP session of a conversation, replacing the previous one
+func (s *Service) SaveSession(ctx context.Context, conversationID, sessionID, agent string) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		ID:             sessionID,
+		ConversationID: conversationID,
+		Agent:          agent,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}
+
+	if err := s.repo.SaveSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSession retrieves the active ACP session of a conversation
+func (s *Service) GetSession(ctx context.Context, conversationID string) (*Session, error) {
+	return s.repo.GetSession(ctx, conversationID)
+}
+
+// TouchSession marks the ACP session of a conversation as used now
+func (s *Service) TouchSession(ctx context.Context, conversationID string) error {
+	return s.repo.TouchSession(ctx, conversationID, time.Now())
+}
+
+// DeactivateSession marks the ACP session of a conversation as no longer resumable
+func (s *Service) DeactivateSession(ctx context.Context, conversationID string) error {
+	return s.repo.DeactivateSession(ctx, conversationID)
+}
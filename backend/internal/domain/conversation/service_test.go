@@ -0,0 +1,300 @@
+package conversation_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+func TestSessionPersistence(t *testing.T) {
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now().Unix()
+	for _, stmt := range []string{
+		`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES ('space-1', 'Space', '/tmp/space-1', ?, ?)`,
+		`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES ('conv-1', 'space-1', 'A', ?, ?)`,
+	} {
+		if _, err := db.DB.Exec(stmt, now, now); err != nil {
+			t.Fatalf("Failed to seed database: %v", err)
+		}
+	}
+
+	service := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+
+	var notFound *domain.NotFoundError
+	if _, err := service.GetSession(ctx, "conv-1"); !errors.As(err, &notFound) {
+		t.Fatalf("Expected NotFoundError before any session, got %v", err)
+	}
+
+	if _, err := service.SaveSession(ctx, "conv-1", "session-1", "claude-code"); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	// A new session replaces the previous one of the conversation
+	if _, err := service.SaveSession(ctx, "conv-1", "session-2", "gemini"); err != nil {
+		t.Fatalf("Failed to replace session: %v", err)
+	}
+
+	session, err := service.GetSession(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if session.ID != "session-2" || session.Agent != "gemini" {
+		t.Errorf("Expected session-2 on gemini, got %s on %s", session.ID, session.Agent)
+	}
+
+	if err := service.TouchSession(ctx, "conv-1"); err != nil {
+		t.Fatalf("Failed to touch session: %v", err)
+	}
+
+	if err := service.DeactivateSession(ctx, "conv-1"); err != nil {
+		t.Fatalf("Failed to deactivate session: %v", err)
+	}
+	if _, err := service.GetSession(ctx, "conv-1"); !errors.As(err, &notFound) {
+		t.Errorf("Expected NotFoundError for a deactivated session, got %v", err)
+	}
+}
+
+func TestTranscriptIncludesToolCallsAndPlan(t *testing.T) {
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now().Unix()
+	for _, stmt := range []string{
+		`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES ('space-1', 'Space', '/tmp/space-1', ?, ?)`,
+		`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES ('conv-1', 'space-1', 'A', ?, ?)`,
+	} {
+		if _, err := db.DB.Exec(stmt, now, now); err != nil {
+			t.Fatalf("Failed to seed database: %v", err)
+		}
+	}
+
+	service := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+
+	if _, err := service.CreateMessage(ctx, conversation.CreateMessageParams{ConversationID: "conv-1", Role: "user", Content: "Tidy my notes"}); err != nil {
+		t.Fatalf("Failed to create user message: %v", err)
+	}
+
+	// A turn without text is saved for its tool calls
+	reply, err := service.CreateMessage(ctx, conversation.CreateMessageParams{ConversationID: "conv-1", Role: "assistant"})
+	if err != nil {
+		t.Fatalf("Failed to create assistant message: %v", err)
+	}
+
+	toolCalls := []*conversation.ToolCall{
+		{ID: "call-1", Kind: "read", Title: "Read notes.md", Status: "completed", RawInput: []byte(`{"path":"notes.md"}`), CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{ID: "call-2", Kind: "edit", Title: "Edit notes.md", Status: "failed", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	}
+	plan := &conversation.Plan{
+		Entries:   []conversation.PlanEntry{{Content: "Read notes", Priority: "high", Status: "completed"}},
+		UpdatedAt: time.Now(),
+	}
+	if err := service.SaveTurnActivity(ctx, reply.ID, toolCalls, plan); err != nil {
+		t.Fatalf("Failed to save turn activity: %v", err)
+	}
+
+	messages, err := service.ListTranscript(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("Failed to list transcript: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	if len(messages[0].ToolCalls) != 0 || messages[0].Plan != nil {
+		t.Errorf("Expected no activity on the user message")
+	}
+
+	got := messages[1]
+	if len(got.ToolCalls) != 2 || got.ToolCalls[0].ID != "call-1" || got.ToolCalls[1].Status != "failed" {
+		t.Fatalf("Expected both tool calls in order, got %+v", got.ToolCalls)
+	}
+	if string(got.ToolCalls[0].RawInput) != `{"path":"notes.md"}` {
+		t.Errorf("Expected raw input to round-trip, got %s", got.ToolCalls[0].RawInput)
+	}
+	if got.Plan == nil || len(got.Plan.Entries) != 1 || got.Plan.Entries[0].Content != "Read notes" {
+		t.Errorf("Expected the plan, got %+v", got.Plan)
+	}
+}
+
+func TestConversationSummary(t *testing.T) {
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now().Unix()
+	for _, stmt := range []string{
+		`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES ('space-1', 'Space', '/tmp/space-1', ?, ?)`,
+		`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES ('conv-1', 'space-1', 'A', ?, ?)`,
+	} {
+		if _, err := db.DB.Exec(stmt, now, now); err != nil {
+			t.Fatalf("Failed to seed database: %v", err)
+		}
+	}
+
+	service := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+
+	conv, err := service.GetConversation(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("Failed to get conversation: %v", err)
+	}
+	if conv.Summary != "" || conv.SummaryThrough != "" {
+		t.Errorf("Expected no summary on a new conversation, got %q through %q", conv.Summary, conv.SummaryThrough)
+	}
+
+	if err := service.SaveSummary(ctx, "conv-1", "The user plans a trip", "msg-4"); err != nil {
+		t.Fatalf("Failed to save summary: %v", err)
+	}
+
+	conversations, err := service.ListConversations(ctx, "space-1")
+	if err != nil {
+		t.Fatalf("Failed to list conversations: %v", err)
+	}
+	if len(conversations) != 1 || conversations[0].Summary != "The user plans a trip" || conversations[0].SummaryThrough != "msg-4" {
+		t.Errorf("Expected the summary through msg-4, got %+v", conversations)
+	}
+}
+
+func TestConversationModes(t *testing.T) {
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now().Unix()
+	for _, stmt := range []string{
+		`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES ('space-1', 'Space', '/tmp/space-1', ?, ?)`,
+		`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES ('conv-1', 'space-1', 'A', ?, ?)`,
+	} {
+		if _, err := db.DB.Exec(stmt, now, now); err != nil {
+			t.Fatalf("Failed to seed database: %v", err)
+		}
+	}
+
+	service := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+
+	conv, err := service.GetConversation(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("Failed to get conversation: %v", err)
+	}
+	if conv.Modes != nil {
+		t.Errorf("Expected no modes on a new conversation, got %+v", conv.Modes)
+	}
+
+	modes := &conversation.Modes{
+		CurrentModeID: "default",
+		Available:     []conversation.Mode{{ID: "default", Name: "Default"}, {ID: "plan", Name: "Plan Mode"}},
+	}
+	if err := service.SaveModes(ctx, "conv-1", modes); err != nil {
+		t.Fatalf("Failed to save modes: %v", err)
+	}
+	if err := service.SetCurrentMode(ctx, "conv-1", "plan"); err != nil {
+		t.Fatalf("Failed to set mode: %v", err)
+	}
+
+	conversations, err := service.ListConversations(ctx, "space-1")
+	if err != nil {
+		t.Fatalf("Failed to list conversations: %v", err)
+	}
+	got := conversations[0].Modes
+	if got == nil || got.CurrentModeID != "plan" || !got.Has("default") || len(got.Available) != 2 {
+		t.Errorf("Expected plan mode of two, got %+v", got)
+	}
+}
+
+func TestUsageStats(t *testing.T) {
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC).Unix()
+	day2 := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC).Unix()
+	seed := []struct {
+		stmt string
+		args []interface{}
+	}{
+		{`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, []interface{}{"space-1", "One", "/tmp/one", day1, day1}},
+		{`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, []interface{}{"space-2", "Two", "/tmp/two", day1, day1}},
+		{`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, []interface{}{"conv-1", "space-1", "A", day1, day1}},
+		{`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, []interface{}{"conv-2", "space-2", "B", day1, day1}},
+	}
+	messages := []struct {
+		id, conv, role string
+		at             int64
+		metadata       string
+	}{
+		{"m1", "conv-1", "user", day1, ""},
+		{"m2", "conv-1", "assistant", day1, `{"stop_reason":"end_turn","duration_ms":1500,"chunks":4,"usage":{"input_tokens":100,"output_tokens":20}}`},
+		{"m3", "conv-1", "assistant", day2, `{"stop_reason":"cancelled","cancelled":true,"duration_ms":500,"chunks":1}`},
+		{"m4", "conv-2", "assistant", day2, `{"stop_reason":"max_tokens","duration_ms":9000,"thought_chunks":2,"usage":{"input_tokens":1000,"output_tokens":4000}}`},
+		{"m5", "conv-2", "assistant", day2, ""}, // Saved before metadata was recorded
+	}
+	for _, s := range seed {
+		if _, err := db.DB.Exec(s.stmt, s.args...); err != nil {
+			t.Fatalf("Failed to seed database: %v", err)
+		}
+	}
+	for _, m := range messages {
+		_, err := db.DB.Exec(`INSERT INTO messages (id, conversation_id, role, content, created_at, metadata) VALUES (?, ?, ?, '', ?, ?)`,
+			m.id, m.conv, m.role, m.at, m.metadata)
+		if err != nil {
+			t.Fatalf("Failed to seed database: %v", err)
+		}
+	}
+
+	service := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+
+	report, err := service.UsageStats(ctx, conversation.UsageFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	totals := report.Totals
+	if totals.Messages != 4 || totals.InputTokens != 1100 || totals.OutputTokens != 4020 || totals.DurationMs != 11000 || totals.Chunks != 5 || totals.ThoughtChunks != 2 {
+		t.Errorf("Unexpected totals %+v", totals)
+	}
+	if totals.StopReasons["end_turn"] != 1 || totals.StopReasons["cancelled"] != 1 || totals.StopReasons["max_tokens"] != 1 || totals.StopReasons["unknown"] != 1 {
+		t.Errorf("Unexpected stop reasons %v", totals.StopReasons)
+	}
+	if len(report.Spaces) != 2 || report.Spaces[0].SpaceID != "space-2" {
+		t.Errorf("Expected space-2 to lead the spaces, got %+v", report.Spaces)
+	}
+	if len(report.Conversations) != 2 || report.Conversations[1].Title != "A" || report.Conversations[1].Messages != 2 {
+		t.Errorf("Unexpected conversations %+v", report.Conversations)
+	}
+	if len(report.Days) != 2 || report.Days[0].Day != "2026-03-01" || report.Days[1].Messages != 3 {
+		t.Errorf("Unexpected days %+v", report.Days)
+	}
+
+	report, err = service.UsageStats(ctx, conversation.UsageFilter{
+		SpaceID: "space-1",
+		From:    time.Unix(day2, 0).Truncate(24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if report.Totals.Messages != 1 || report.Totals.StopReasons["cancelled"] != 1 || len(report.Conversations) != 1 {
+		t.Errorf("Expected the cancelled message of space-1 on day 2, got %+v", report)
+	}
+}
@@ -0,0 +1,169 @@
+package conversation
+
+import (
+	"sort"
+	"time"
+)
+
+// Usage is the token usage the agent reported for an assistant turn
+type Usage struct {
+	InputTokens       int64 `json:"input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+	TotalTokens       int64 `json:"total_tokens,omitempty"`
+	ThoughtTokens     int64 `json:"thought_tokens,omitempty"`
+	CachedReadTokens  int64 `json:"cached_read_tokens,omitempty"`
+	CachedWriteTokens int64 `json:"cached_write_tokens,omitempty"`
+}
+
+// add sums another usage into u
+func (u *Usage) add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.TotalTokens += other.TotalTokens
+	u.ThoughtTokens += other.ThoughtTokens
+	u.CachedReadTokens += other.CachedReadTokens
+	u.CachedWriteTokens += other.CachedWriteTokens
+}
+
+// UsageFilter selects the assistant messages that usage stats cover
+type UsageFilter struct {
+	SpaceID string    // Empty for every space
+	From    time.Time // Inclusive, zero for no lower bound
+	To      time.Time // Exclusive, zero for no upper bound
+}
+
+// UsageRow sums the assistant messages of a conversation that ended with one stop reason on one day (UTC)
+type UsageRow struct {
+	SpaceID        string
+	ConversationID string
+	Title          string
+	Day            string // YYYY-MM-DD
+	StopReason     string // Empty for messages saved before stop reasons were recorded
+	Messages       int
+	DurationMs     int64
+	Chunks         int64
+	ThoughtChunks  int64
+	Usage          Usage
+}
+
+// UsageTotals sums assistant messages: how many, how they ended, how long they took and what they used
+type UsageTotals struct {
+	Messages      int            `json:"messages"`
+	StopReasons   map[string]int `json:"stop_reasons"`
+	DurationMs    int64          `json:"duration_ms"`
+	Chunks        int64          `json:"chunks"`
+	ThoughtChunks int64          `json:"thought_chunks"`
+	Usage
+}
+
+// add sums a row into t
+func (t *UsageTotals) add(row *UsageRow) {
+	if t.StopReasons == nil {
+		t.StopReasons = make(map[string]int)
+	}
+	t.Messages += row.Messages
+	reason := row.StopReason
+	if reason == "" {
+		reason = "unknown"
+	}
+	t.StopReasons[reason] += row.Messages
+	t.DurationMs += row.DurationMs
+	t.Chunks += row.Chunks
+	t.ThoughtChunks += row.ThoughtChunks
+	t.Usage.add(row.Usage)
+}
+
+// tokens is what ranks spaces and conversations in a report
+func (t *UsageTotals) tokens() int64 {
+	return t.InputTokens + t.OutputTokens
+}
+
+// SpaceUsage is the usage of a space
+type SpaceUsage struct {
+	SpaceID string `json:"space_id"`
+	UsageTotals
+}
+
+// ConversationUsage is the usage of a conversation
+type ConversationUsage struct {
+	ConversationID string `json:"conversation_id"`
+	SpaceID        string `json:"space_id"`
+	Title          string `json:"title"`
+	UsageTotals
+}
+
+// DayUsage is the usage of a day (UTC)
+type DayUsage struct {
+	Day string `json:"day"` // YYYY-MM-DD
+	UsageTotals
+}
+
+// UsageReport aggregates the assistant messages selected by a UsageFilter
+// Spaces and conversations come by decreasing token use, days in order.
+type UsageReport struct {
+	Totals        UsageTotals          `json:"totals"`
+	Spaces        []*SpaceUsage        `json:"spaces"`
+	Conversations []*ConversationUsage `json:"conversations"`
+	Days          []*DayUsage          `json:"days"`
+}
+
+// newUsageReport rolls rows up by space, conversation and day
+func newUsageReport(rows []*UsageRow) *UsageReport {
+	report := &UsageReport{
+		Totals:        UsageTotals{StopReasons: map[string]int{}},
+		Spaces:        []*SpaceUsage{},
+		Conversations: []*ConversationUsage{},
+		Days:          []*DayUsage{},
+	}
+	spaces := make(map[string]*SpaceUsage)
+	conversations := make(map[string]*ConversationUsage)
+	days := make(map[string]*DayUsage)
+
+	for _, row := range rows {
+		report.Totals.add(row)
+
+		spaceUsage, ok := spaces[row.SpaceID]
+		if !ok {
+			spaceUsage = &SpaceUsage{SpaceID: row.SpaceID}
+			spaces[row.SpaceID] = spaceUsage
+			report.Spaces = append(report.Spaces, spaceUsage)
+		}
+		spaceUsage.add(row)
+
+		convUsage, ok := conversations[row.ConversationID]
+		if !ok {
+			convUsage = &ConversationUsage{ConversationID: row.ConversationID, SpaceID: row.SpaceID, Title: row.Title}
+			conversations[row.ConversationID] = convUsage
+			report.Conversations = append(report.Conversations, convUsage)
+		}
+		convUsage.add(row)
+
+		dayUsage, ok := days[row.Day]
+		if !ok {
+			dayUsage = &DayUsage{Day: row.Day}
+			days[row.Day] = dayUsage
+			report.Days = append(report.Days, dayUsage)
+		}
+		dayUsage.add(row)
+	}
+
+	sort.Slice(report.Spaces, func(i, j int) bool {
+		a, b := report.Spaces[i], report.Spaces[j]
+		if a.tokens() != b.tokens() {
+			return a.tokens() > b.tokens()
+		}
+		return a.SpaceID < b.SpaceID
+	})
+	sort.Slice(report.Conversations, func(i, j int) bool {
+		a, b := report.Conversations[i], report.Conversations[j]
+		if a.tokens() != b.tokens() {
+			return a.tokens() > b.tokens()
+		}
+		return a.ConversationID < b.ConversationID
+	})
+	sort.Slice(report.Days, func(i, j int) bool {
+		return report.Days[i].Day < report.Days[j].Day
+	})
+
+	return report
+}
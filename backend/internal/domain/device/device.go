@@ -0,0 +1,46 @@
+package device
+
+import (
+	"time"
+)
+
+// Device is a client allowed to use the API, such as a phone, the desktop app or the Omi relay
+// It authenticates with a bearer token; only the SHA-256 hash of the token is stored.
+type Device struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Platform    string     `json:"platform,omitempty"` // e.g. "ios", "android", "macos", "omi"
+	TokenPrefix string     `json:"token_prefix"`       // First characters of the token, to tell tokens apart
+	TokenHash   string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"` // When the device was last seen
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+
+	UploadCount  int        `json:"upload_count"` // Captures uploaded with the token
+	LastUploadAt *time.Time `json:"last_upload_at,omitempty"`
+}
+
+// Revoked reports whether the token of the device was revoked
+func (d *Device) Revoked() bool {
+	return d.RevokedAt != nil
+}
+
+// IssueParams represents parameters for issuing a device token
+type IssueParams struct {
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+}
+
+// Pairing is a short code a new device exchanges for its token, shown on a trusted screen
+type Pairing struct {
+	Code      string    `json:"code"`       // e.g. "K7QM-2XWD", case and dashes don't matter
+	ExpiresAt time.Time `json:"expires_at"` // The code works once, until then
+	QRPayload string    `json:"qr_payload"` // parachute://pair URI with the code and server, to show as a QR code
+}
+
+// PairParams represents parameters for pairing a device
+type PairParams struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+}
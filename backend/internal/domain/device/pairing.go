@@ -0,0 +1,100 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+)
+
+const (
+	// DefaultPairingTTL is how long a pairing code can be used
+	DefaultPairingTTL = 10 * time.Minute
+
+	// pairingAlphabet has no 0/O or 1/I, so codes survive being read aloud or typed from a screen
+	pairingAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	pairingCodeSize = 8
+)
+
+// StartPairing creates a pairing code valid for ttl
+// serverURL is where devices reach this server, it goes in the QR payload with the code.
+func (s *Service) StartPairing(ctx context.Context, serverURL string, ttl time.Duration) (*Pairing, error) {
+	if ttl <= 0 {
+		ttl = DefaultPairingTTL
+	}
+
+	raw := make([]byte, pairingCodeSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate pairing code: %w", err)
+	}
+	code := make([]byte, pairingCodeSize)
+	for i, b := range raw {
+		code[i] = pairingAlphabet[int(b)%len(pairingAlphabet)] // 256 is a multiple of 32, so unbiased
+	}
+
+	now := time.Now()
+	if err := s.repo.DeleteExpiredPairingCodes(ctx, now); err != nil {
+		return nil, fmt.Errorf("failed to clean up pairing codes: %w", err)
+	}
+	if err := s.repo.CreatePairingCode(ctx, HashToken(string(code)), now, now.Add(ttl)); err != nil {
+		return nil, fmt.Errorf("failed to create pairing code: %w", err)
+	}
+
+	display := string(code[:4]) + "-" + string(code[4:])
+	return &Pairing{
+		Code:      display,
+		ExpiresAt: now.Add(ttl),
+		QRPayload: PairingURI(serverURL, display),
+	}, nil
+}
+
+// Pair exchanges a pairing code for a new device and its token
+func (s *Service) Pair(ctx context.Context, params PairParams) (*Device, string, error) {
+	code := normalizePairingCode(params.Code)
+	if len(code) != pairingCodeSize {
+		return nil, "", domain.NewUnauthorizedError("invalid or expired pairing code")
+	}
+	if strings.TrimSpace(params.Name) == "" {
+		return nil, "", domain.NewValidationError("name", "is required")
+	}
+
+	err := s.repo.RedeemPairingCode(ctx, HashToken(code), time.Now())
+	var notFound *domain.NotFoundError
+	if errors.As(err, &notFound) {
+		return nil, "", domain.NewUnauthorizedError("invalid or expired pairing code")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to redeem pairing code: %w", err)
+	}
+
+	return s.IssueToken(ctx, IssueParams{Name: params.Name, Platform: params.Platform})
+}
+
+// RecordUpload counts a capture uploaded by a device
+func (s *Service) RecordUpload(ctx context.Context, id string) error {
+	return s.repo.RecordUpload(ctx, id, time.Now())
+}
+
+// PairingURI returns the QR payload of a pairing code, e.g. parachute://pair?code=K7QM-2XWD&server=...
+func PairingURI(serverURL, code string) string {
+	query := url.Values{"code": {code}}
+	if serverURL != "" {
+		query.Set("server", serverURL)
+	}
+	return "parachute://pair?" + query.Encode()
+}
+
+// normalizePairingCode uppercases a code and drops the separators people type
+func normalizePairingCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
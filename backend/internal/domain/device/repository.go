@@ -0,0 +1,21 @@
+package device
+
+import (
+	"context"
+	"time"
+)
+
+// Repository defines the interface for device persistence
+type Repository interface {
+	CreateDevice(ctx context.Context, device *Device) error
+	GetDevice(ctx context.Context, id string) (*Device, error)
+	GetDeviceByTokenHash(ctx context.Context, tokenHash string) (*Device, error)
+	ListDevices(ctx context.Context) ([]*Device, error)
+	RevokeDevice(ctx context.Context, id string, at time.Time) error
+	TouchDevice(ctx context.Context, id string, at time.Time) error
+	RecordUpload(ctx context.Context, id string, at time.Time) error
+
+	CreatePairingCode(ctx context.Context, codeHash string, createdAt, expiresAt time.Time) error
+	RedeemPairingCode(ctx context.Context, codeHash string, at time.Time) error // NotFoundError unless unused and unexpired
+	DeleteExpiredPairingCodes(ctx context.Context, before time.Time) error
+}
@@ -0,0 +1,121 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unforced/parachute-backend/internal/domain"
+)
+
+const (
+	// TokenPrefix starts every device token, so leaked tokens are easy to recognize
+	TokenPrefix = "pct_"
+
+	// touchInterval is how stale last_used_at may get, so that requests don't all write
+	touchInterval = time.Minute
+)
+
+// Service provides business logic for devices and their tokens
+type Service struct {
+	repo Repository
+}
+
+// NewService creates a new device service
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// IssueToken registers a device and returns it with its token
+// The token is only available now, the server keeps nothing but its hash.
+func (s *Service) IssueToken(ctx context.Context, params IssueParams) (*Device, string, error) {
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		return nil, "", domain.NewValidationError("name", "is required")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	device := &Device{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Platform:    strings.TrimSpace(params.Platform),
+		TokenPrefix: token[:len(TokenPrefix)+6],
+		TokenHash:   HashToken(token),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.CreateDevice(ctx, device); err != nil {
+		return nil, "", fmt.Errorf("failed to create device: %w", err)
+	}
+
+	return device, token, nil
+}
+
+// Authenticate returns the device a token belongs to, and records that it was used
+func (s *Service) Authenticate(ctx context.Context, token string) (*Device, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, domain.NewUnauthorizedError("invalid token")
+	}
+
+	device, err := s.repo.GetDeviceByTokenHash(ctx, HashToken(token))
+	var notFound *domain.NotFoundError
+	if errors.As(err, &notFound) {
+		return nil, domain.NewUnauthorizedError("invalid token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if device.Revoked() {
+		return nil, domain.NewUnauthorizedError("token was revoked")
+	}
+
+	now := time.Now()
+	if device.LastUsedAt == nil || now.Sub(*device.LastUsedAt) >= touchInterval {
+		if err := s.repo.TouchDevice(ctx, device.ID, now); err != nil {
+			return nil, fmt.Errorf("failed to record token use: %w", err)
+		}
+		device.LastUsedAt = &now
+	}
+
+	return device, nil
+}
+
+// GetDevice returns a device
+func (s *Service) GetDevice(ctx context.Context, id string) (*Device, error) {
+	return s.repo.GetDevice(ctx, id)
+}
+
+// ListDevices returns all devices, revoked ones included
+func (s *Service) ListDevices(ctx context.Context) ([]*Device, error) {
+	return s.repo.ListDevices(ctx)
+}
+
+// RevokeDevice revokes the token of a device, which can't be used anymore
+func (s *Service) RevokeDevice(ctx context.Context, id string) error {
+	device, err := s.repo.GetDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	if device.Revoked() {
+		return nil
+	}
+	return s.repo.RevokeDevice(ctx, id, time.Now())
+}
+
+// HashToken returns the hex SHA-256 hash under which a token is stored
+// Tokens carry 256 random bits, so a fast unsalted hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
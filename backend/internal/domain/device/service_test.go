@@ -0,0 +1,162 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/device"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+func TestDeviceService(t *testing.T) {
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	service := device.NewService(sqlite.NewDeviceRepository(db.DB))
+
+	dev, token, err := service.IssueToken(ctx, device.IssueParams{Name: "Pixel 8", Platform: "android"})
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	t.Run("IssueToken stores only the hash", func(t *testing.T) {
+		if !strings.HasPrefix(token, device.TokenPrefix) || !strings.HasPrefix(token, dev.TokenPrefix) {
+			t.Errorf("Unexpected token %q for prefix %q", token, dev.TokenPrefix)
+		}
+
+		var stored string
+		if err := db.DB.QueryRow(`SELECT token_hash FROM devices WHERE id = ?`, dev.ID).Scan(&stored); err != nil {
+			t.Fatalf("Failed to read device: %v", err)
+		}
+		if stored != device.HashToken(token) || strings.Contains(stored, token) {
+			t.Errorf("Expected the hash of the token to be stored, got %q", stored)
+		}
+
+		_, _, err := service.IssueToken(ctx, device.IssueParams{Name: "  "})
+		var validationErr *domain.ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("Expected a validation error without a name, got %v", err)
+		}
+	})
+
+	t.Run("Authenticate records the last use", func(t *testing.T) {
+		authenticated, err := service.Authenticate(ctx, token)
+		if err != nil {
+			t.Fatalf("Failed to authenticate: %v", err)
+		}
+		if authenticated.ID != dev.ID || authenticated.LastUsedAt == nil {
+			t.Errorf("Expected device %s with a last use, got %+v", dev.ID, authenticated)
+		}
+
+		stored, err := service.GetDevice(ctx, dev.ID)
+		if err != nil || stored.LastUsedAt == nil {
+			t.Errorf("Expected last_used_at to be stored, got %+v (err %v)", stored, err)
+		}
+	})
+
+	t.Run("Authenticate rejects unknown tokens", func(t *testing.T) {
+		for _, bad := range []string{"", "nope", device.TokenPrefix + "unknown", token + "x"} {
+			_, err := service.Authenticate(ctx, bad)
+			var unauthorizedErr *domain.UnauthorizedError
+			if !errors.As(err, &unauthorizedErr) {
+				t.Errorf("Expected token %q to be rejected, got %v", bad, err)
+			}
+		}
+	})
+
+	t.Run("RevokeDevice disables the token", func(t *testing.T) {
+		if err := service.RevokeDevice(ctx, dev.ID); err != nil {
+			t.Fatalf("Failed to revoke: %v", err)
+		}
+		if err := service.RevokeDevice(ctx, dev.ID); err != nil {
+			t.Errorf("Revoking twice should succeed, got %v", err)
+		}
+
+		_, err := service.Authenticate(ctx, token)
+		var unauthorizedErr *domain.UnauthorizedError
+		if !errors.As(err, &unauthorizedErr) {
+			t.Errorf("Expected revoked token to be rejected, got %v", err)
+		}
+
+		devices, err := service.ListDevices(ctx)
+		if err != nil || len(devices) != 1 || !devices[0].Revoked() {
+			t.Errorf("Expected one revoked device, got %+v (err %v)", devices, err)
+		}
+
+		var notFound *domain.NotFoundError
+		if err := service.RevokeDevice(ctx, "missing"); !errors.As(err, &notFound) {
+			t.Errorf("Expected not found, got %v", err)
+		}
+	})
+
+	t.Run("Pair exchanges a code once for a token", func(t *testing.T) {
+		pairing, err := service.StartPairing(ctx, "http://10.0.0.2:8080", 0)
+		if err != nil {
+			t.Fatalf("Failed to start pairing: %v", err)
+		}
+		if len(pairing.Code) != 9 || !strings.Contains(pairing.QRPayload, "code="+pairing.Code) || !strings.Contains(pairing.QRPayload, "server=http") {
+			t.Errorf("Unexpected pairing %+v", pairing)
+		}
+
+		// Codes are typed by people, so case and dashes don't matter
+		typed := strings.ToLower(strings.ReplaceAll(pairing.Code, "-", ""))
+		paired, token, err := service.Pair(ctx, device.PairParams{Code: typed, Name: "Omi relay", Platform: "omi"})
+		if err != nil {
+			t.Fatalf("Failed to pair: %v", err)
+		}
+		if authenticated, err := service.Authenticate(ctx, token); err != nil || authenticated.ID != paired.ID {
+			t.Errorf("Expected the paired token to authenticate, got %v (err %v)", authenticated, err)
+		}
+
+		_, _, err = service.Pair(ctx, device.PairParams{Code: pairing.Code, Name: "Again"})
+		var unauthorizedErr *domain.UnauthorizedError
+		if !errors.As(err, &unauthorizedErr) {
+			t.Errorf("Expected a used code to be rejected, got %v", err)
+		}
+		if _, _, err = service.Pair(ctx, device.PairParams{Code: "AAAA-AAAA", Name: "Guess"}); !errors.As(err, &unauthorizedErr) {
+			t.Errorf("Expected an unknown code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Pair rejects expired codes", func(t *testing.T) {
+		pairing, err := service.StartPairing(ctx, "", time.Second)
+		if err != nil {
+			t.Fatalf("Failed to start pairing: %v", err)
+		}
+		if _, err := db.DB.Exec(`UPDATE pairing_codes SET expires_at = ?`, time.Now().Add(-time.Minute).Unix()); err != nil {
+			t.Fatalf("Failed to expire code: %v", err)
+		}
+
+		_, _, err = service.Pair(ctx, device.PairParams{Code: pairing.Code, Name: "Late"})
+		var unauthorizedErr *domain.UnauthorizedError
+		if !errors.As(err, &unauthorizedErr) {
+			t.Errorf("Expected an expired code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("RecordUpload counts captures", func(t *testing.T) {
+		uploader, _, err := service.IssueToken(ctx, device.IssueParams{Name: "Phone"})
+		if err != nil {
+			t.Fatalf("Failed to issue token: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := service.RecordUpload(ctx, uploader.ID); err != nil {
+				t.Fatalf("Failed to record upload: %v", err)
+			}
+		}
+
+		stored, err := service.GetDevice(ctx, uploader.ID)
+		if err != nil || stored.UploadCount != 2 || stored.LastUploadAt == nil {
+			t.Errorf("Expected 2 uploads, got %+v (err %v)", stored, err)
+		}
+	})
+}
@@ -12,6 +12,7 @@ type CaptureMetadata struct {
 	Duration       float64   `json:"duration"` // seconds
 	Source         string    `json:"source"`   // phone, omi, desktop
 	DeviceID       string    `json:"deviceId,omitempty"`
+	DeviceName     string    `json:"deviceName,omitempty"`
 	Size           int64     `json:"size"`
 	HasTranscript  bool      `json:"hasTranscript"`
 	TranscriptMode string    `json:"transcriptMode,omitempty"` // api, local
@@ -29,6 +30,7 @@ type CaptureInfo struct {
 	Duration      float64   `json:"duration"`
 	Source        string    `json:"source"`
 	DeviceID      string    `json:"deviceId,omitempty"`
+	DeviceName    string    `json:"deviceName,omitempty"`
 	Size          int64     `json:"size"`
 	HasTranscript bool      `json:"hasTranscript"`
 	Transcript    string    `json:"transcript,omitempty"`
@@ -46,10 +48,11 @@ type TranscriptData struct {
 
 // UploadCaptureParams represents parameters for uploading a capture
 type UploadCaptureParams struct {
-	Timestamp time.Time
-	Duration  float64
-	Source    string
-	DeviceID  string
+	Timestamp  time.Time
+	Duration   float64
+	Source     string
+	DeviceID   string
+	DeviceName string
 }
 
 // FileInfo represents information about a file or directory
@@ -68,6 +68,7 @@ func (s *Service) SaveCapture(audioData io.Reader, params UploadCaptureParams) (
 		Duration:      params.Duration,
 		Source:        params.Source,
 		DeviceID:      params.DeviceID,
+		DeviceName:    params.DeviceName,
 		Size:          written,
 		HasTranscript: false,
 		CreatedAt:     now,
@@ -165,6 +166,7 @@ func (s *Service) ListCaptures(limit, offset int) ([]CaptureInfo, int, error) {
 			Duration:      metadata.Duration,
 			Source:        metadata.Source,
 			DeviceID:      metadata.DeviceID,
+			DeviceName:    metadata.DeviceName,
 			Size:          metadata.Size,
 			HasTranscript: metadata.HasTranscript,
 			AudioURL:      "/api/captures/" + metadata.Filename,
@@ -321,6 +323,10 @@ func (s *Service) generateTranscriptMarkdown(metadata *CaptureMetadata, transcri
 		sb.WriteString(fmt.Sprintf("deviceId: %s\n", metadata.DeviceID))
 	}
 
+	if metadata.DeviceName != "" {
+		sb.WriteString(fmt.Sprintf("deviceName: %s\n", metadata.DeviceName))
+	}
+
 	if metadata.TranscriptMode != "" {
 		sb.WriteString(fmt.Sprintf("transcriptionMode: %s\n", metadata.TranscriptMode))
 	}
@@ -0,0 +1,159 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// PolicyFileName is the per-space policy file, relative to the space root
+const PolicyFileName = ".parachute/permissions.yaml"
+
+// GlobalPolicySetting is the registry setting key holding the global default policy
+const GlobalPolicySetting = "permission_policy"
+
+// SettingsStore reads registry settings (implemented by registry.Service)
+type SettingsStore interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+}
+
+// Engine evaluates tool calls against the space, global and built-in policies, in that order
+type Engine struct {
+	settings SettingsStore
+	builtin  *Policy
+}
+
+// NewEngine creates a new policy engine
+// settings can be nil, in which case only space and built-in policies apply
+func NewEngine(settings SettingsStore) *Engine {
+	return &Engine{
+		settings: settings,
+		builtin:  DefaultPolicy(),
+	}
+}
+
+// DefaultPolicy returns the built-in policy: reading and searching the space and a few safe
+// commands are allowed, everything else asks the user, fetches included
+// Reads, searches and safe commands only run unasked on paths inside the space
+func DefaultPolicy() *Policy {
+	safeCommands := []string{}
+	for _, cmd := range []string{"ls", "cat", "grep", "git status", "pwd", "whoami", "echo", "date"} {
+		safeCommands = append(safeCommands, cmd, cmd+" *")
+	}
+
+	return &Policy{
+		Default: ActionAsk,
+		Rules: []Rule{
+			{Name: "read-only tools", Action: ActionAllow, Kinds: []string{"read", "search"}, Paths: []string{"**"}},
+			{Name: "thinking", Action: ActionAllow, Kinds: []string{"think"}},
+			{Name: "safe commands", Action: ActionAllow, Kinds: []string{"execute"}, Commands: safeCommands, ConfineArgs: true},
+		},
+	}
+}
+
+// SpacePolicyPath returns the path of the policy file for a space
+func SpacePolicyPath(spaceRoot string) string {
+	return filepath.Join(spaceRoot, PolicyFileName)
+}
+
+// LoadSpacePolicy reads the policy file of a space
+// Returns (nil, nil) if the space has no policy file
+func LoadSpacePolicy(spaceRoot string) (*Policy, error) {
+	data, err := os.ReadFile(SpacePolicyPath(spaceRoot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read space policy: %w", err)
+	}
+
+	return ParsePolicy(data)
+}
+
+// LoadGlobalPolicy reads the global default policy from settings
+// Returns (nil, nil) if no global policy is configured
+func (e *Engine) LoadGlobalPolicy(ctx context.Context) (*Policy, error) {
+	if e.settings == nil {
+		return nil, nil
+	}
+
+	value, err := e.settings.GetSetting(ctx, GlobalPolicySetting)
+	if err != nil || value == "" {
+		return nil, nil // Not configured
+	}
+
+	return ParsePolicy([]byte(value))
+}
+
+// policyLayer is one named policy in the evaluation chain
+type policyLayer struct {
+	source string
+	policy *Policy
+}
+
+// Evaluate decides what to do with a tool call in the given space
+// Broken policy files never allow anything: the call is forwarded to the user instead
+func (e *Engine) Evaluate(ctx context.Context, spaceRoot string, call ToolCall) *Decision {
+	var layers []policyLayer
+
+	if spaceRoot != "" {
+		spacePolicy, err := LoadSpacePolicy(spaceRoot)
+		if err != nil {
+			slog.Warn("Invalid space permission policy", "error", err, "space", spaceRoot)
+			return &Decision{Action: ActionAsk, Source: "space", RuleIndex: -1,
+				Reason: fmt.Sprintf("space policy is invalid: %v", err)}
+		}
+		if spacePolicy != nil {
+			layers = append(layers, policyLayer{"space", spacePolicy})
+		}
+	}
+
+	globalPolicy, err := e.LoadGlobalPolicy(ctx)
+	if err != nil {
+		slog.Warn("Invalid global permission policy", "error", err)
+		return &Decision{Action: ActionAsk, Source: "global", RuleIndex: -1,
+			Reason: fmt.Sprintf("global policy is invalid: %v", err)}
+	}
+	if globalPolicy != nil {
+		layers = append(layers, policyLayer{"global", globalPolicy})
+	}
+
+	layers = append(layers, policyLayer{"builtin", e.builtin})
+
+	kind := InferKind(call)
+	for _, layer := range layers {
+		if i := layer.policy.Match(spaceRoot, call); i >= 0 {
+			rule := layer.policy.Rules[i]
+			return &Decision{
+				Action:    rule.Action,
+				Source:    layer.source,
+				RuleIndex: i,
+				RuleName:  rule.Name,
+				Reason:    fmt.Sprintf("%s policy rule %s matched %s tool call", layer.source, describeRule(i, rule), kind),
+			}
+		}
+
+		// A layer with a default stops evaluation so it can override the layers below it
+		if layer.policy.Default != "" {
+			return &Decision{
+				Action:    layer.policy.Default,
+				Source:    layer.source,
+				RuleIndex: -1,
+				Reason:    fmt.Sprintf("no %s policy rule matched %s tool call, default is %s", layer.source, kind, layer.policy.Default),
+			}
+		}
+	}
+
+	// Unreachable while the built-in policy has a default
+	return &Decision{Action: ActionAsk, Source: "builtin", RuleIndex: -1, Reason: "no policy matched"}
+}
+
+// describeRule formats a rule reference for explanations
+func describeRule(i int, rule Rule) string {
+	if rule.Name != "" {
+		return fmt.Sprintf("#%d (%q)", i+1, rule.Name)
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
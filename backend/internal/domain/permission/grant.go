@@ -0,0 +1,84 @@
+package permission
+
+import (
+	"time"
+)
+
+// Grant remembers an "allow always" decision so matching tool calls are approved without asking
+type Grant struct {
+	ID             string    `json:"id"`
+	SpaceID        string    `json:"space_id"`
+	ConversationID string    `json:"conversation_id,omitempty"` // Empty means the whole space
+	Kind           string    `json:"kind"`                      // ACP tool kind the grant covers
+	Pattern        string    `json:"pattern,omitempty"`         // Glob over the tool call subject, empty matches any subject
+	CreatedBy      string    `json:"created_by"`                // "user" or "api"
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Matches reports whether the grant covers the tool call
+// A chained or redirected command is only covered by a grant for exactly that command.
+func (g *Grant) Matches(call ToolCall) bool {
+	if g.Kind != InferKind(call) {
+		return false
+	}
+	if g.Pattern == "" {
+		return true
+	}
+	subject := Subject(call)
+	if _, isCommand := call.RawInput["command"].(string); isCommand && hasShellMeta(subject) {
+		return g.Pattern == QuoteGlob(subject)
+	}
+	return globMatch(g.Pattern, subject, false)
+}
+
+// CreateGrantParams represents parameters for creating a grant
+type CreateGrantParams struct {
+	SpaceID        string `json:"space_id"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Kind           string `json:"kind"`
+	Pattern        string `json:"pattern,omitempty"`
+	CreatedBy      string `json:"-"`
+}
+
+// Outcome is what was finally answered to the agent
+type Outcome string
+
+const (
+	OutcomeAllowed   Outcome = "allowed"
+	OutcomeRejected  Outcome = "rejected"
+	OutcomeCancelled Outcome = "cancelled" // No option was selected, e.g. the turn was cancelled
+)
+
+// Who or what made a permission decision
+const (
+	DecidedByPolicy  = "policy"
+	DecidedByGrant   = "grant"
+	DecidedByUser    = "user"
+	DecidedByTimeout = "timeout"
+	DecidedByCancel  = "cancel"
+)
+
+// AuditEntry is one permission request and how it was decided
+// Entries are append-only
+type AuditEntry struct {
+	ID             string                 `json:"id"`
+	SpaceID        string                 `json:"space_id"`
+	ConversationID string                 `json:"conversation_id"`
+	SessionID      string                 `json:"session_id"`
+	ToolCallID     string                 `json:"tool_call_id"`
+	Title          string                 `json:"title,omitempty"`
+	Kind           string                 `json:"kind"`
+	RawInput       map[string]interface{} `json:"raw_input"`
+	Outcome        Outcome                `json:"outcome"`
+	OptionID       string                 `json:"option_id,omitempty"` // Option sent back to the agent
+	DecidedBy      string                 `json:"decided_by"`
+	Reason         string                 `json:"reason"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+// AuditFilter narrows down audit log queries
+type AuditFilter struct {
+	SpaceID        string
+	ConversationID string
+	Limit          int
+}
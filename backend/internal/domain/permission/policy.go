@@ -0,0 +1,384 @@
+package permission
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action is what a policy decides to do with a tool call
+type Action string
+
+const (
+	ActionAllow Action = "allow" // Approve without asking
+	ActionDeny  Action = "deny"  // Reject without asking
+	ActionAsk   Action = "ask"   // Forward to the user
+)
+
+// Rule matches tool calls and decides what to do with them
+// All non-empty conditions must match; within a condition any pattern may match.
+// Allow rules never match commands containing shell metacharacters, and only match when every
+// path the tool touches is covered; deny and ask rules match as soon as one path is.
+type Rule struct {
+	Name        string   `yaml:"name,omitempty" json:"name,omitempty"`
+	Action      Action   `yaml:"action" json:"action"`
+	Kinds       []string `yaml:"kinds,omitempty" json:"kinds,omitempty"`               // ACP tool kinds: read, edit, delete, move, search, execute, think, fetch, other
+	Commands    []string `yaml:"commands,omitempty" json:"commands,omitempty"`         // Globs over the full command line, e.g. "git status*"
+	ConfineArgs bool     `yaml:"confine_args,omitempty" json:"confine_args,omitempty"` // Path arguments of matched commands must stay inside the space root
+	Paths       []string `yaml:"paths,omitempty" json:"paths,omitempty"`               // Globs relative to the space root, e.g. "files/**"; absolute globs match absolute paths
+	Hosts       []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`               // Host globs, e.g. "*.wikipedia.org"
+}
+
+// Policy is an ordered list of rules with an optional fallback action
+// When Default is empty, unmatched tool calls fall through to the next policy layer
+type Policy struct {
+	Default Action `yaml:"default,omitempty" json:"default,omitempty"`
+	Rules   []Rule `yaml:"rules" json:"rules"`
+}
+
+// ToolCall is the part of an ACP permission request the policy looks at
+type ToolCall struct {
+	Kind     string
+	Title    string
+	RawInput map[string]interface{}
+}
+
+// Decision is the outcome of evaluating a tool call against the policies
+type Decision struct {
+	Action    Action `json:"action"`
+	Source    string `json:"source"`              // "space", "global" or "builtin"
+	RuleIndex int    `json:"rule_index"`          // -1 when the policy default applied
+	RuleName  string `json:"rule_name,omitempty"` // Name of the matching rule, if any
+	Reason    string `json:"reason"`              // Human readable explanation
+}
+
+// ParsePolicy parses and validates a YAML (or JSON) policy document
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Validate checks that actions are known and patterns are non-empty
+func (p *Policy) Validate() error {
+	if p.Default != "" && !validAction(p.Default) {
+		return fmt.Errorf("invalid default action: %q", p.Default)
+	}
+
+	for i, rule := range p.Rules {
+		if !validAction(rule.Action) {
+			return fmt.Errorf("rule %d: invalid action: %q", i, rule.Action)
+		}
+		for _, patterns := range [][]string{rule.Commands, rule.Paths, rule.Hosts} {
+			for _, pattern := range patterns {
+				if pattern == "" {
+					return fmt.Errorf("rule %d: empty pattern", i)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func validAction(a Action) bool {
+	return a == ActionAllow || a == ActionDeny || a == ActionAsk
+}
+
+// Match returns the first rule matching the tool call, or -1 if none does
+func (p *Policy) Match(spaceRoot string, call ToolCall) int {
+	for i := range p.Rules {
+		if p.Rules[i].Matches(spaceRoot, call) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Matches reports whether the rule applies to the tool call
+func (r *Rule) Matches(spaceRoot string, call ToolCall) bool {
+	if len(r.Kinds) > 0 && !containsString(r.Kinds, InferKind(call)) {
+		return false
+	}
+
+	if len(r.Commands) > 0 {
+		command, ok := call.RawInput["command"].(string)
+		if !ok {
+			return false
+		}
+		command = strings.TrimSpace(command)
+		// A glob can't tell what a chained or redirected command really does
+		if r.Action == ActionAllow && hasShellMeta(command) {
+			return false
+		}
+		if !matchAny(r.Commands, command, false) {
+			return false
+		}
+		if r.ConfineArgs && !argsConfined(spaceRoot, command) {
+			return false
+		}
+	}
+
+	if len(r.Paths) > 0 {
+		paths := extractPaths(call.RawInput)
+		if len(paths) == 0 {
+			return false
+		}
+		// Allowing needs every path the tool touches to be covered, denying or asking just one
+		covered := 0
+		for _, p := range paths {
+			if matchPath(r.Paths, spaceRoot, p) {
+				covered++
+			}
+		}
+		if covered == 0 || (r.Action == ActionAllow && covered < len(paths)) {
+			return false
+		}
+	}
+
+	if len(r.Hosts) > 0 {
+		host := extractHost(call.RawInput)
+		if host == "" || !matchAny(r.Hosts, host, false) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// InferKind returns the ACP tool kind, guessing from the raw input when the agent didn't send one
+func InferKind(call ToolCall) string {
+	if call.Kind != "" {
+		return call.Kind
+	}
+
+	input := call.RawInput
+	if _, ok := input["command"]; ok {
+		return "execute"
+	}
+	if _, ok := input["url"]; ok {
+		return "fetch"
+	}
+	if _, ok := input["query"]; ok {
+		return "search"
+	}
+
+	if operation, ok := input["operation"].(string); ok {
+		switch operation {
+		case "read":
+			return "read"
+		case "glob", "grep", "list":
+			return "search"
+		case "write", "edit":
+			return "edit"
+		case "delete":
+			return "delete"
+		case "move", "rename":
+			return "move"
+		}
+		return "other"
+	}
+
+	if _, ok := input["file_path"]; ok {
+		if _, hasContent := input["content"]; hasContent {
+			return "edit"
+		}
+		if _, hasEdit := input["new_string"]; hasEdit {
+			return "edit"
+		}
+		return "read"
+	}
+
+	return "other"
+}
+
+// Subject returns the most specific thing the tool call acts on: a command, a path or a host
+func Subject(call ToolCall) string {
+	if command, ok := call.RawInput["command"].(string); ok {
+		return strings.TrimSpace(command)
+	}
+	if paths := extractPaths(call.RawInput); len(paths) > 0 {
+		return paths[0]
+	}
+	return extractHost(call.RawInput)
+}
+
+// hasShellMeta reports whether a command line chains, pipes, redirects or substitutes
+func hasShellMeta(command string) bool {
+	return strings.ContainsAny(command, ";&|<>$`\n")
+}
+
+// argsConfined reports whether every path-like argument of a command stays inside the space root
+// Plain relative arguments resolve under the working directory and are fine; absolute ones, "~"
+// and ".." must land inside the space. Without a space root only plain relative arguments pass.
+func argsConfined(spaceRoot, command string) bool {
+	unquote := strings.NewReplacer(`"`, "", `'`, "", `\`, "")
+	for _, arg := range strings.Fields(command) {
+		arg = unquote.Replace(arg)
+		if strings.HasPrefix(arg, "-") {
+			// Flag values can be paths too: --file=/etc/passwd, -f/etc/passwd
+			i := strings.IndexAny(arg, "=/~")
+			if i < 0 {
+				continue
+			}
+			if arg[i] == '=' {
+				i++
+			}
+			arg = arg[i:]
+		}
+		if arg == "" {
+			continue
+		}
+		if strings.HasPrefix(arg, "~") {
+			return false
+		}
+		if !filepath.IsAbs(arg) && !strings.Contains(arg, "..") {
+			continue
+		}
+		if spaceRoot == "" || !matchPath([]string{"**"}, spaceRoot, arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// extractPaths collects file paths from the common raw input fields
+func extractPaths(input map[string]interface{}) []string {
+	var paths []string
+	for _, key := range []string{"file_path", "path", "notebook_path", "source", "destination"} {
+		if p, ok := input[key].(string); ok && p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// extractHost returns the host of the url field, if any
+func extractHost(input map[string]interface{}) string {
+	raw, ok := input["url"].(string)
+	if !ok || raw == "" {
+		return ""
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// matchPath matches a path against globs relative to the space root
+// Paths outside the space root, "~" ones included, only match absolute patterns
+func matchPath(patterns []string, spaceRoot, p string) bool {
+	home := strings.HasPrefix(p, "~")
+	abs := p
+	if !filepath.IsAbs(abs) && !home && spaceRoot != "" {
+		abs = filepath.Join(spaceRoot, p)
+	}
+	abs = filepath.Clean(abs)
+
+	rel := ""
+	if spaceRoot != "" && !home {
+		if r, err := filepath.Rel(spaceRoot, abs); err == nil && r != ".." && !strings.HasPrefix(r, "../") {
+			rel = filepath.ToSlash(r)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if filepath.IsAbs(pattern) {
+			if globMatch(pattern, filepath.ToSlash(abs), true) {
+				return true
+			}
+		} else if rel != "" && globMatch(pattern, rel, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, s string, pathMode bool) bool {
+	for _, pattern := range patterns {
+		if globMatch(pattern, s, pathMode) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches s against a glob pattern
+// In path mode "*" stops at "/" and "**" crosses directories; otherwise "*" matches anything
+// A backslash makes the next character literal
+func globMatch(pattern, s string, pathMode bool) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				// "**/" matches zero or more whole directories
+				b.WriteString("(.*/)?")
+				i++
+			} else {
+				b.WriteString(".*")
+			}
+		case c == '*':
+			if pathMode {
+				b.WriteString("[^/]*")
+			} else {
+				b.WriteString(".*")
+			}
+		case c == '?':
+			if pathMode {
+				b.WriteString("[^/]")
+			} else {
+				b.WriteString(".")
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(s)
+}
+
+// QuoteGlob escapes glob metacharacters so the pattern only matches s itself
+func QuoteGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '*' || r == '?' || r == '\\' {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package permission
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSettings is an in-memory SettingsStore
+type fakeSettings map[string]string
+
+func (f fakeSettings) GetSetting(ctx context.Context, key string) (string, error) {
+	return f[key], nil
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawInput map[string]interface{}
+		want     Action
+	}{
+		{"web search asks", map[string]interface{}{"query": "weather today"}, ActionAsk},
+		{"web fetch asks", map[string]interface{}{"url": "https://example.com", "prompt": "fetch this"}, ActionAsk},
+		{"file read in the space is allowed", map[string]interface{}{"operation": "read", "path": "/work/space/test.txt"}, ActionAllow},
+		{"relative file read is allowed", map[string]interface{}{"file_path": "notes/test.txt"}, ActionAllow},
+		{"file read outside the space asks", map[string]interface{}{"operation": "read", "path": "/tmp/test.txt"}, ActionAsk},
+		{"file read of a dotfile asks", map[string]interface{}{"file_path": "~/.ssh/id_rsa"}, ActionAsk},
+		{"file read leaving the space asks", map[string]interface{}{"file_path": "../../etc/passwd"}, ActionAsk},
+		{"file glob in the space is allowed", map[string]interface{}{"operation": "glob", "pattern": "*.go", "path": "/work/space"}, ActionAllow},
+		{"file grep without a path asks", map[string]interface{}{"operation": "grep", "pattern": "TODO"}, ActionAsk},
+		{"file list outside the space asks", map[string]interface{}{"operation": "list", "path": "/tmp"}, ActionAsk},
+		{"safe bash command is allowed", map[string]interface{}{"command": "ls -la"}, ActionAllow},
+		{"git status is allowed", map[string]interface{}{"command": "git status"}, ActionAllow},
+		{"file write asks", map[string]interface{}{"operation": "write", "path": "/tmp/test.txt", "content": "data"}, ActionAsk},
+		{"unsafe bash command asks", map[string]interface{}{"command": "rm -rf /"}, ActionAsk},
+		{"prefix lookalike asks", map[string]interface{}{"command": "lsblk"}, ActionAsk},
+		{"chained safe command asks", map[string]interface{}{"command": "ls && rm -rf ~"}, ActionAsk},
+		{"redirected safe command asks", map[string]interface{}{"command": "echo x > ~/.bashrc"}, ActionAsk},
+		{"substituted safe command asks", map[string]interface{}{"command": "echo $(whoami)"}, ActionAsk},
+		{"safe command outside the space asks", map[string]interface{}{"command": "cat ~/.ssh/id_rsa"}, ActionAsk},
+		{"safe command on an absolute path asks", map[string]interface{}{"command": "grep -r key /etc"}, ActionAsk},
+		{"unknown tool asks", map[string]interface{}{"unknown": "operation"}, ActionAsk},
+	}
+
+	engine := NewEngine(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := engine.Evaluate(context.Background(), "/work/space", ToolCall{RawInput: tt.rawInput})
+			if decision.Action != tt.want {
+				t.Errorf("Evaluate() = %s (%s), want %s", decision.Action, decision.Reason, tt.want)
+			}
+			if decision.Source != "builtin" {
+				t.Errorf("Source = %s, want builtin", decision.Source)
+			}
+		})
+	}
+
+	if decision := engine.Evaluate(context.Background(), "/work/space", ToolCall{Kind: "think"}); decision.Action != ActionAllow {
+		t.Errorf("Evaluate(think) = %s (%s), want allow", decision.Action, decision.Reason)
+	}
+}
+
+func TestSpacePolicy(t *testing.T) {
+	spaceRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(spaceRoot, ".parachute"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := `
+rules:
+  - name: no sudo
+    action: deny
+    kinds: [execute]
+    commands: ["sudo *"]
+  - name: npm scripts
+    action: allow
+    commands: ["npm run *"]
+  - name: guard secrets
+    action: ask
+    paths: ["secrets/**"]
+  - name: edit space files
+    action: allow
+    kinds: [edit, move]
+    paths: ["files/**", "notes/*.md"]
+  - name: safe reads
+    action: allow
+    commands: ["cat *"]
+    confine_args: true
+  - action: allow
+    hosts: ["*.wikipedia.org"]
+`
+	if err := os.WriteFile(SpacePolicyPath(spaceRoot), []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	global := fakeSettings{GlobalPolicySetting: `{"default": "deny", "rules": [{"action": "allow", "kinds": ["think"]}]}`}
+	engine := NewEngine(global)
+
+	tests := []struct {
+		name       string
+		call       ToolCall
+		wantAction Action
+		wantSource string
+		wantRule   string
+	}{
+		{
+			name:       "deny rule matches command glob",
+			call:       ToolCall{Kind: "execute", RawInput: map[string]interface{}{"command": "sudo rm -rf /"}},
+			wantAction: ActionDeny, wantSource: "space", wantRule: "no sudo",
+		},
+		{
+			name:       "edit inside allowed folder",
+			call:       ToolCall{Kind: "edit", RawInput: map[string]interface{}{"file_path": filepath.Join(spaceRoot, "files/a/b.txt")}},
+			wantAction: ActionAllow, wantSource: "space", wantRule: "edit space files",
+		},
+		{
+			name:       "single star does not cross directories",
+			call:       ToolCall{Kind: "edit", RawInput: map[string]interface{}{"file_path": filepath.Join(spaceRoot, "notes/deep/x.md")}},
+			wantAction: ActionDeny, wantSource: "global",
+		},
+		{
+			name:       "edit outside the space never matches relative globs",
+			call:       ToolCall{Kind: "edit", RawInput: map[string]interface{}{"file_path": filepath.Join(spaceRoot, "../files/x.txt")}},
+			wantAction: ActionDeny, wantSource: "global",
+		},
+		{
+			name:       "allow rule never matches chained commands",
+			call:       ToolCall{Kind: "execute", RawInput: map[string]interface{}{"command": "npm run build && rm -rf /"}},
+			wantAction: ActionDeny, wantSource: "global",
+		},
+		{
+			name:       "allow rule matches plain commands",
+			call:       ToolCall{Kind: "execute", RawInput: map[string]interface{}{"command": "npm run build"}},
+			wantAction: ActionAllow, wantSource: "space", wantRule: "npm scripts",
+		},
+		{
+			name: "ask rule matches when one path is covered",
+			call: ToolCall{Kind: "move", RawInput: map[string]interface{}{
+				"source": filepath.Join(spaceRoot, "secrets/key"), "destination": filepath.Join(spaceRoot, "files/key")}},
+			wantAction: ActionAsk, wantSource: "space", wantRule: "guard secrets",
+		},
+		{
+			name: "allow rule needs every path covered",
+			call: ToolCall{Kind: "move", RawInput: map[string]interface{}{
+				"source": filepath.Join(spaceRoot, "files/a"), "destination": "/tmp/a"}},
+			wantAction: ActionDeny, wantSource: "global",
+		},
+		{
+			name:       "confined arguments inside the space",
+			call:       ToolCall{Kind: "execute", RawInput: map[string]interface{}{"command": "cat notes/a.md " + filepath.Join(spaceRoot, "b.md")}},
+			wantAction: ActionAllow, wantSource: "space", wantRule: "safe reads",
+		},
+		{
+			name:       "confined arguments escaping the space",
+			call:       ToolCall{Kind: "execute", RawInput: map[string]interface{}{"command": "cat notes/../../secret"}},
+			wantAction: ActionDeny, wantSource: "global",
+		},
+		{
+			name:       "confined flag values are checked",
+			call:       ToolCall{Kind: "execute", RawInput: map[string]interface{}{"command": "cat --file=/etc/passwd"}},
+			wantAction: ActionDeny, wantSource: "global",
+		},
+		{
+			name:       "host glob",
+			call:       ToolCall{RawInput: map[string]interface{}{"url": "https://en.wikipedia.org/wiki/Go"}},
+			wantAction: ActionAllow, wantSource: "space",
+		},
+		{
+			name:       "global rule",
+			call:       ToolCall{Kind: "think"},
+			wantAction: ActionAllow, wantSource: "global",
+		},
+		{
+			name:       "global default overrides builtin",
+			call:       ToolCall{Kind: "read", RawInput: map[string]interface{}{"file_path": "/etc/hosts"}},
+			wantAction: ActionDeny, wantSource: "global",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := engine.Evaluate(context.Background(), spaceRoot, tt.call)
+			if decision.Action != tt.wantAction || decision.Source != tt.wantSource {
+				t.Errorf("Evaluate() = %s from %s (%s), want %s from %s",
+					decision.Action, decision.Source, decision.Reason, tt.wantAction, tt.wantSource)
+			}
+			if tt.wantRule != "" && decision.RuleName != tt.wantRule {
+				t.Errorf("RuleName = %q, want %q", decision.RuleName, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	if _, err := ParsePolicy([]byte("rules:\n  - action: maybe\n")); err == nil {
+		t.Error("Expected error for unknown action")
+	}
+
+	spaceRoot := t.TempDir()
+	os.MkdirAll(filepath.Join(spaceRoot, ".parachute"), 0755)
+	os.WriteFile(SpacePolicyPath(spaceRoot), []byte("rules: [\n"), 0644)
+
+	// A broken policy file must never allow anything
+	decision := NewEngine(nil).Evaluate(context.Background(), spaceRoot, ToolCall{Kind: "read"})
+	if decision.Action != ActionAsk {
+		t.Errorf("Evaluate() with broken policy = %s, want ask", decision.Action)
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		s        string
+		pathMode bool
+		want     bool
+	}{
+		{"**/*.md", "a.md", true, true},
+		{"**/*.md", "x/y/a.md", true, true},
+		{"**/secret", "mysecret", true, false},
+		{"files/*", "files/a/b", true, false},
+		{"files/**", "files/a/b", true, true},
+		{"git status*", "git status --short", false, true},
+		{"npm run *", "npm run build", false, true},
+		{"a.b", "axb", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s, tt.pathMode); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
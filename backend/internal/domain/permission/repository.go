@@ -0,0 +1,20 @@
+package permission
+
+import (
+	"context"
+)
+
+// Repository defines the interface for permission grant and audit persistence
+type Repository interface {
+	// Grant methods
+	CreateGrant(ctx context.Context, grant *Grant) error
+	GetGrant(ctx context.Context, id string) (*Grant, error)
+	// ListGrants returns the grants of a space; a non-empty conversationID also limits
+	// the result to space-wide grants and grants for that conversation
+	ListGrants(ctx context.Context, spaceID, conversationID string) ([]*Grant, error)
+	DeleteGrant(ctx context.Context, id string) error
+
+	// Audit methods
+	AppendAudit(ctx context.Context, entry *AuditEntry) error
+	ListAudit(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error)
+}
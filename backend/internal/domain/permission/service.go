@@ -0,0 +1,127 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unforced/parachute-backend/internal/domain"
+)
+
+// DefaultAuditLimit is the number of audit entries returned when no limit is given
+const DefaultAuditLimit = 100
+
+// Service provides business logic for permission grants and the audit log
+type Service struct {
+	repo Repository
+}
+
+// NewService creates a new permission service
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// CreateGrant remembers that tool calls matching kind and pattern are allowed
+func (s *Service) CreateGrant(ctx context.Context, params CreateGrantParams) (*Grant, error) {
+	if params.SpaceID == "" {
+		return nil, domain.NewValidationError("space_id", "is required")
+	}
+	if params.Kind == "" {
+		return nil, domain.NewValidationError("kind", "is required")
+	}
+	if params.CreatedBy == "" {
+		params.CreatedBy = "api"
+	}
+
+	grant := &Grant{
+		ID:             uuid.New().String(),
+		SpaceID:        params.SpaceID,
+		ConversationID: params.ConversationID,
+		Kind:           params.Kind,
+		Pattern:        params.Pattern,
+		CreatedBy:      params.CreatedBy,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := s.repo.CreateGrant(ctx, grant); err != nil {
+		return nil, fmt.Errorf("failed to create grant: %w", err)
+	}
+
+	return grant, nil
+}
+
+// GrantToolCall creates a grant covering exactly the subject of a tool call
+// A tool call without a command, path or host is refused, its empty pattern would match every
+// call of that kind.
+func (s *Service) GrantToolCall(ctx context.Context, spaceID, conversationID string, call ToolCall, createdBy string) (*Grant, error) {
+	subject := Subject(call)
+	if subject == "" {
+		return nil, domain.NewValidationError("pattern", "tool call has no command, path or host to grant")
+	}
+
+	return s.CreateGrant(ctx, CreateGrantParams{
+		SpaceID:        spaceID,
+		ConversationID: conversationID,
+		Kind:           InferKind(call),
+		Pattern:        QuoteGlob(subject),
+		CreatedBy:      createdBy,
+	})
+}
+
+// GetGrant retrieves a grant by ID
+func (s *Service) GetGrant(ctx context.Context, id string) (*Grant, error) {
+	return s.repo.GetGrant(ctx, id)
+}
+
+// ListGrants retrieves the grants of a space, optionally narrowed to one conversation
+func (s *Service) ListGrants(ctx context.Context, spaceID, conversationID string) ([]*Grant, error) {
+	if spaceID == "" {
+		return nil, domain.NewValidationError("space_id", "is required")
+	}
+	return s.repo.ListGrants(ctx, spaceID, conversationID)
+}
+
+// RevokeGrant deletes a grant
+func (s *Service) RevokeGrant(ctx context.Context, id string) error {
+	if _, err := s.repo.GetGrant(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteGrant(ctx, id)
+}
+
+// FindGrant returns the first grant covering the tool call, or nil if there is none
+func (s *Service) FindGrant(ctx context.Context, spaceID, conversationID string, call ToolCall) (*Grant, error) {
+	grants, err := s.repo.ListGrants(ctx, spaceID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, grant := range grants {
+		if grant.Matches(call) {
+			return grant, nil
+		}
+	}
+	return nil, nil
+}
+
+// RecordAudit appends an entry to the audit log
+func (s *Service) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	entry.ID = uuid.New().String()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	if err := s.repo.AppendAudit(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record permission audit: %w", err)
+	}
+	return nil
+}
+
+// ListAudit retrieves audit entries, newest first
+func (s *Service) ListAudit(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditLimit
+	}
+	return s.repo.ListAudit(ctx, filter)
+}
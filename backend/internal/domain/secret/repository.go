@@ -0,0 +1,13 @@
+package secret
+
+import (
+	"context"
+)
+
+// Repository defines the interface for secret persistence
+type Repository interface {
+	SetSecret(ctx context.Context, secret *Secret) error
+	GetSecret(ctx context.Context, name string) (*Secret, error)
+	ListSecrets(ctx context.Context) ([]*Secret, error)
+	DeleteSecret(ctx context.Context, name string) error
+}
@@ -0,0 +1,13 @@
+package secret
+
+import (
+	"time"
+)
+
+// Secret is a named value that config files reference as ${NAME}, e.g. API keys in .mcp.json
+// Values are stored in the local database and never returned by the API.
+type Secret struct {
+	Name      string    `json:"name"`
+	Value     string    `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,59 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+)
+
+// namePattern matches environment-variable style names, the form placeholders use
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Service provides business logic for secrets
+type Service struct {
+	repo Repository
+}
+
+// NewService creates a new secret service
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// SetSecret creates or replaces a secret
+func (s *Service) SetSecret(ctx context.Context, name, value string) (*Secret, error) {
+	if !namePattern.MatchString(name) {
+		return nil, domain.NewValidationError("name", "must contain only letters, digits and underscores, and not start with a digit")
+	}
+	if value == "" {
+		return nil, domain.NewValidationError("value", "is required")
+	}
+
+	secret := &Secret{Name: name, Value: value, UpdatedAt: time.Now()}
+	if err := s.repo.SetSecret(ctx, secret); err != nil {
+		return nil, fmt.Errorf("failed to set secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// GetSecret returns the value of a secret
+func (s *Service) GetSecret(ctx context.Context, name string) (string, error) {
+	secret, err := s.repo.GetSecret(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return secret.Value, nil
+}
+
+// ListSecrets returns all secrets, callers must not expose the values
+func (s *Service) ListSecrets(ctx context.Context) ([]*Secret, error) {
+	return s.repo.ListSecrets(ctx)
+}
+
+// DeleteSecret removes a secret
+func (s *Service) DeleteSecret(ctx context.Context, name string) error {
+	return s.repo.DeleteSecret(ctx, name)
+}
@@ -0,0 +1,414 @@
+package space
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MCP server transports
+const (
+	MCPTransportStdio = "stdio"
+	MCPTransportHTTP  = "http"
+	MCPTransportSSE   = "sse"
+)
+
+// placeholderPattern matches ${NAME} and ${NAME:-default}
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// MCPConfig is the content of a space's .mcp.json
+// Keys other than mcpServers are kept as they are, other tools share the file.
+type MCPConfig struct {
+	MCPServers map[string]*MCPServerConfig `json:"mcpServers"`
+
+	extra map[string]json.RawMessage
+}
+
+// MCPServerConfig is one entry of mcpServers
+// String values may contain ${NAME} placeholders, see MCPService.ResolveServers.
+// Keys this backend doesn't know are kept as they are.
+type MCPServerConfig struct {
+	Type    string            `json:"type,omitempty"` // "stdio" (default), "http" or "sse"
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	extra map[string]json.RawMessage
+}
+
+// mcpServerFields are the keys of a server entry MCPServerConfig knows
+var mcpServerFields = []string{"type", "command", "args", "env", "url", "headers"}
+
+// mcpServerConfig has the fields of MCPServerConfig without its JSON methods
+type mcpServerConfig MCPServerConfig
+
+// UnmarshalJSON decodes a server entry, keeping unknown keys
+func (s *MCPServerConfig) UnmarshalJSON(data []byte) error {
+	var known mcpServerConfig
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, key := range mcpServerFields {
+		delete(fields, key)
+	}
+
+	*s = MCPServerConfig(known)
+	if len(fields) > 0 {
+		s.extra = fields
+	}
+	return nil
+}
+
+// MarshalJSON encodes a server entry, the unknown keys it was decoded with come last
+func (s MCPServerConfig) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(mcpServerConfig(s))
+	if err != nil || len(s.extra) == 0 {
+		return data, err
+	}
+	return appendFields(data, s.extra)
+}
+
+// appendFields adds fields to an encoded JSON object, in key order
+func appendFields(object []byte, fields map[string]json.RawMessage) ([]byte, error) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.TrimSuffix(object, []byte("}"))
+	for _, key := range keys {
+		if len(buf) > 1 {
+			buf = append(buf, ',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, name...), ':'), fields[key]...)
+	}
+	return append(buf, '}'), nil
+}
+
+// MCPConfigError lists what is wrong with an MCP config, by server name
+type MCPConfigError struct {
+	Servers map[string]string `json:"servers"`
+}
+
+func (e *MCPConfigError) Error() string {
+	names := make([]string, 0, len(e.Servers))
+	for name := range e.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := make([]string, 0, len(names))
+	for _, name := range names {
+		problems = append(problems, fmt.Sprintf("%s: %s", name, e.Servers[name]))
+	}
+	return "invalid MCP config: " + strings.Join(problems, "; ")
+}
+
+// ParseMCPConfig decodes a .mcp.json document, without validating the servers
+func ParseMCPConfig(data []byte) (*MCPConfig, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid MCP config: %w", err)
+	}
+
+	cfg := &MCPConfig{MCPServers: make(map[string]*MCPServerConfig)}
+	if servers, ok := fields["mcpServers"]; ok {
+		if err := json.Unmarshal(servers, &cfg.MCPServers); err != nil {
+			return nil, fmt.Errorf("invalid MCP config: %w", err)
+		}
+		if cfg.MCPServers == nil {
+			cfg.MCPServers = make(map[string]*MCPServerConfig)
+		}
+		delete(fields, "mcpServers")
+	}
+	if len(fields) > 0 {
+		cfg.extra = fields
+	}
+	return cfg, nil
+}
+
+// MarshalJSON encodes the config, the unknown keys it was decoded with come last
+func (c MCPConfig) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(struct {
+		MCPServers map[string]*MCPServerConfig `json:"mcpServers"`
+	}{c.MCPServers})
+	if err != nil || len(c.extra) == 0 {
+		return data, err
+	}
+	return appendFields(data, c.extra)
+}
+
+// keepUnknown copies the unknown keys of previous that c doesn't set, for the config itself and
+// for every server both have
+func (c *MCPConfig) keepUnknown(previous *MCPConfig) {
+	c.extra = mergeFields(c.extra, previous.extra)
+	for name, server := range c.MCPServers {
+		if old, ok := previous.MCPServers[name]; ok && server != nil && old != nil {
+			server.extra = mergeFields(server.extra, old.extra)
+		}
+	}
+}
+
+// mergeFields adds the fields of previous that fields lacks
+func mergeFields(fields, previous map[string]json.RawMessage) map[string]json.RawMessage {
+	for key, value := range previous {
+		if fields == nil {
+			fields = make(map[string]json.RawMessage)
+		}
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// Validate checks every server and returns an *MCPConfigError if any is invalid
+func (c *MCPConfig) Validate() error {
+	problems := make(map[string]string)
+	for name, server := range c.MCPServers {
+		if err := server.validate(name); err != nil {
+			problems[name] = err.Error()
+		}
+	}
+
+	if len(problems) > 0 {
+		return &MCPConfigError{Servers: problems}
+	}
+	return nil
+}
+
+// Transport returns the transport of the server, stdio when no type is given
+func (s *MCPServerConfig) Transport() string {
+	if s == nil || s.Type == "" {
+		return MCPTransportStdio
+	}
+	return s.Type
+}
+
+func (s *MCPServerConfig) validate(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("server name is required")
+	}
+	if s == nil {
+		return fmt.Errorf("server config is empty")
+	}
+
+	switch s.Transport() {
+	case MCPTransportStdio:
+		if s.Command == "" {
+			return fmt.Errorf("command is required for stdio servers")
+		}
+		if s.URL != "" || len(s.Headers) > 0 {
+			return fmt.Errorf("url and headers are only valid for http and sse servers")
+		}
+	case MCPTransportHTTP, MCPTransportSSE:
+		if s.URL == "" {
+			return fmt.Errorf("url is required for %s servers", s.Type)
+		}
+		if !strings.HasPrefix(s.URL, "${") && !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+			return fmt.Errorf("url must start with http:// or https://")
+		}
+		if s.Command != "" || len(s.Args) > 0 || len(s.Env) > 0 {
+			return fmt.Errorf("command, args and env are only valid for stdio servers")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected stdio, http or sse", s.Type)
+	}
+
+	// Catch typos like "${API_KEY" before they reach the agent
+	for _, value := range s.values() {
+		if strings.Count(value, "${") != len(placeholderPattern.FindAllString(value, -1)) {
+			return fmt.Errorf("malformed placeholder in %q", value)
+		}
+	}
+
+	return nil
+}
+
+// values returns every string of the server that may hold placeholders
+func (s *MCPServerConfig) values() []string {
+	values := []string{s.Command, s.URL}
+	values = append(values, s.Args...)
+	for _, v := range s.Env {
+		values = append(values, v)
+	}
+	for _, v := range s.Headers {
+		values = append(values, v)
+	}
+	return values
+}
+
+// SecretStore looks up secrets by name (implemented by secret.Service)
+type SecretStore interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// MCPService reads and writes space MCP configs and resolves them for sessions
+type MCPService struct {
+	secrets SecretStore
+}
+
+// NewMCPService creates a new MCP service
+// secrets can be nil, in which case only placeholders with a default resolve
+func NewMCPService(secrets SecretStore) *MCPService {
+	return &MCPService{secrets: secrets}
+}
+
+// LoadConfig reads the .mcp.json of a space, a missing file is an empty config
+func (s *MCPService) LoadConfig(space *Space) (*MCPConfig, error) {
+	data, err := os.ReadFile(mcpConfigPath(space))
+	if os.IsNotExist(err) {
+		return &MCPConfig{MCPServers: make(map[string]*MCPServerConfig)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MCP config: %w", err)
+	}
+	return ParseMCPConfig(data)
+}
+
+// SaveConfig validates the config and writes it to the .mcp.json of a space
+// Keys of the current file this backend doesn't know are kept, unless cfg sets them.
+func (s *MCPService) SaveConfig(space *Space, cfg *MCPConfig) error {
+	if cfg.MCPServers == nil {
+		cfg.MCPServers = make(map[string]*MCPServerConfig)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// A file that can't be parsed has nothing worth keeping
+	if previous, err := s.LoadConfig(space); err == nil {
+		cfg.keepUnknown(previous)
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode MCP config: %w", err)
+	}
+
+	if err := os.WriteFile(mcpConfigPath(space), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write MCP config: %w", err)
+	}
+	return nil
+}
+
+// ResolveServers loads the MCP config of a space and expands its placeholders
+// ${NAME} is looked up in the secret store, ${NAME:-default} falls back to default. The backend's
+// own environment is never used: .mcp.json is written by users and agents alike, and would
+// otherwise be able to send its variables to any server. Invalid servers and servers with unresolved placeholders are left out
+// and reported in problems, so one broken entry doesn't cost the session its other servers.
+func (s *MCPService) ResolveServers(ctx context.Context, space *Space) (servers map[string]*MCPServerConfig, problems map[string]string, err error) {
+	cfg, err := s.LoadConfig(space)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	servers = make(map[string]*MCPServerConfig)
+	problems = make(map[string]string)
+
+	if err := cfg.Validate(); err != nil {
+		for name, problem := range err.(*MCPConfigError).Servers {
+			problems[name] = problem
+		}
+	}
+
+	for name, server := range cfg.MCPServers {
+		if _, invalid := problems[name]; invalid {
+			continue
+		}
+
+		resolved, err := s.resolveServer(ctx, server)
+		if err != nil {
+			problems[name] = err.Error()
+			continue
+		}
+		servers[name] = resolved
+	}
+
+	return servers, problems, nil
+}
+
+// resolveServer returns a copy of server with all placeholders expanded
+func (s *MCPService) resolveServer(ctx context.Context, server *MCPServerConfig) (*MCPServerConfig, error) {
+	var firstErr error
+	expand := func(value string) string {
+		return placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			match := placeholderPattern.FindStringSubmatch(placeholder)
+			name, hasDefault := match[1], strings.Contains(placeholder, ":-")
+
+			if value, ok := s.lookup(ctx, name); ok {
+				return value
+			}
+			if hasDefault {
+				return match[2]
+			}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("secret %s is not set", name)
+			}
+			return placeholder
+		})
+	}
+
+	resolved := &MCPServerConfig{
+		Type:    server.Type,
+		Command: expand(server.Command),
+		URL:     expand(server.URL),
+	}
+	for _, arg := range server.Args {
+		resolved.Args = append(resolved.Args, expand(arg))
+	}
+	if server.Env != nil {
+		resolved.Env = make(map[string]string, len(server.Env))
+		for k, v := range server.Env {
+			resolved.Env[k] = expand(v)
+		}
+	}
+	if server.Headers != nil {
+		resolved.Headers = make(map[string]string, len(server.Headers))
+		for k, v := range server.Headers {
+			resolved.Headers[k] = expand(v)
+		}
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return resolved, nil
+}
+
+// lookup finds a placeholder value in the secret store
+func (s *MCPService) lookup(ctx context.Context, name string) (string, bool) {
+	if s.secrets == nil {
+		return "", false
+	}
+	value, err := s.secrets.GetSecret(ctx, name)
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// MCPConfigFileName is the file listing the MCP servers of a space, relative to the space root
+const MCPConfigFileName = ".mcp.json"
+
+// mcpConfigPath returns the path to the .mcp.json file of a space
+func mcpConfigPath(space *Space) string {
+	return filepath.Join(space.Path, MCPConfigFileName)
+}
@@ -27,6 +27,11 @@ func NewService(repo Repository, parachuteRoot string) *Service {
 	}
 }
 
+// ParachuteRoot returns the root folder of the vault, which holds the spaces and notes
+func (s *Service) ParachuteRoot() string {
+	return s.parachuteRoot
+}
+
 // sanitizeName converts a space name to a filesystem-safe name
 // Example: "Work Project" -> "work-project"
 func sanitizeName(name string) string {
@@ -162,6 +167,12 @@ func (s *Service) Update(ctx context.Context, id string, params UpdateSpaceParam
 	if params.Color != "" {
 		space.Color = params.Color
 	}
+	if params.Config != "" {
+		if _, err := ParseConfig(params.Config); err != nil {
+			return nil, domain.NewValidationError("config", err.Error())
+		}
+		space.Config = params.Config
+	}
 
 	// Save
 	if err := s.repo.Update(ctx, space); err != nil {
@@ -183,7 +194,7 @@ func (s *Service) GetClaudeMDPath(space *Space) string {
 
 // GetMCPConfigPath returns the path to the .mcp.json file for a space
 func (s *Service) GetMCPConfigPath(space *Space) string {
-	return filepath.Join(space.Path, ".mcp.json")
+	return mcpConfigPath(space)
 }
 
 // ReadClaudeMD reads the agents.md or CLAUDE.md file for a space
@@ -1,6 +1,8 @@
 package space
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -9,9 +11,10 @@ type Space struct {
 	ID        string    `json:"id"`
 	UserID    string    `json:"user_id"`
 	Name      string    `json:"name"`
-	Path      string    `json:"path"`            // Absolute path to directory (auto-generated from name)
-	Icon      string    `json:"icon,omitempty"`  // Emoji icon for the space
-	Color     string    `json:"color,omitempty"` // Hex color code (e.g., "#2E7D32")
+	Path      string    `json:"path"`             // Absolute path to directory (auto-generated from name)
+	Icon      string    `json:"icon,omitempty"`   // Emoji icon for the space
+	Color     string    `json:"color,omitempty"`  // Hex color code (e.g., "#2E7D32")
+	Config    string    `json:"config,omitempty"` // JSON, see Config
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -25,7 +28,33 @@ type CreateSpaceParams struct {
 
 // UpdateSpaceParams represents parameters for updating a space
 type UpdateSpaceParams struct {
-	Name  string `json:"name,omitempty"`
-	Icon  string `json:"icon,omitempty"`
-	Color string `json:"color,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Icon   string `json:"icon,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Config string `json:"config,omitempty"`
+}
+
+// Config holds the per-space settings stored in the config column
+// Unknown keys (color, icon, folder_names written by the registry) are ignored.
+type Config struct {
+	Agent string `json:"agent,omitempty"` // Name of the ACP agent that serves this space, empty for the default
+	// DefaultMode is the session mode new conversations start in, if the agent offers it
+	DefaultMode string `json:"default_mode,omitempty"`
+	// HistoryTokenBudget bounds the conversation history replayed to new sessions, 0 for the default
+	HistoryTokenBudget int `json:"history_token_budget,omitempty"`
+}
+
+// ParseConfig decodes a space config, an empty string yields the zero config
+func ParseConfig(raw string) (*Config, error) {
+	var cfg Config
+	if raw == "" {
+		return &cfg, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid space config: %w", err)
+	}
+	if cfg.HistoryTokenBudget < 0 {
+		return nil, fmt.Errorf("invalid space config: history_token_budget must not be negative")
+	}
+	return &cfg, nil
 }
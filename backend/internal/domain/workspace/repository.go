@@ -0,0 +1,14 @@
+package workspace
+
+import (
+	"context"
+	"time"
+)
+
+// Repository defines the interface for file write persistence
+type Repository interface {
+	CreateWrite(ctx context.Context, write *FileWrite) error
+	GetWrite(ctx context.Context, id string) (*FileWrite, error)
+	ListWrites(ctx context.Context, conversationID string) ([]*FileWrite, error)
+	MarkUndone(ctx context.Context, id string, undoneAt time.Time) error
+}
@@ -0,0 +1,319 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+)
+
+// maxTextFileSize bounds what agents can read or write in one call
+const maxTextFileSize = 10 << 20
+
+// protectedFiles configure what agents may do in a space, relative to its root
+// An agent able to write them could allow itself anything, or start MCP servers with the user's secrets.
+var protectedFiles = []string{permission.PolicyFileName, space.MCPConfigFileName}
+
+// NotesFolder locates the vault's notes folder (implemented by registry.Service)
+type NotesFolder interface {
+	GetNotesFolder(ctx context.Context) string
+}
+
+// Service serves agent file access: confined to the space of the session, plus the notes
+// folder read-only, with every write recorded so it can be undone
+type Service struct {
+	repo  Repository
+	notes NotesFolder
+}
+
+// NewService creates a new workspace service, notes may be nil to give agents only their space
+func NewService(repo Repository, notes NotesFolder) *Service {
+	return &Service{repo: repo, notes: notes}
+}
+
+// ReadTextFile reads a text file for an agent
+// line is the 1-based line to start at and limit the maximum number of lines, both optional
+func (s *Service) ReadTextFile(ctx context.Context, scope Scope, path string, line, limit *int) (string, error) {
+	resolved, err := s.resolve(ctx, scope, path, false)
+	if err != nil {
+		return "", err
+	}
+
+	content, exists, err := readText(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", domain.NewNotFoundError("file", path)
+	}
+
+	if line == nil && limit == nil {
+		return content, nil
+	}
+
+	start := 0
+	if line != nil {
+		if *line < 1 {
+			return "", domain.NewValidationError("line", "must be 1 or more")
+		}
+		start = *line - 1
+	}
+	if limit != nil && *limit < 0 {
+		return "", domain.NewValidationError("limit", "must not be negative")
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if start >= len(lines) {
+		return "", nil
+	}
+	lines = lines[start:]
+	if limit != nil && *limit < len(lines) {
+		lines = lines[:*limit]
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// WriteTextFile writes a text file for an agent and records the write
+// Missing parent folders inside the space are created.
+func (s *Service) WriteTextFile(ctx context.Context, scope Scope, path, content string) (*FileWrite, error) {
+	if len(content) > maxTextFileSize {
+		return nil, domain.NewValidationError("content", fmt.Sprintf("must be at most %d bytes", maxTextFileSize))
+	}
+
+	resolved, err := s.resolve(ctx, scope, path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, existed, err := readText(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(resolved); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create parent folder: %w", err)
+	}
+	if err := os.WriteFile(resolved, []byte(content), mode); err != nil {
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	write := &FileWrite{
+		ID:             uuid.New().String(),
+		SpaceID:        scope.SpaceID,
+		ConversationID: scope.ConversationID,
+		SessionID:      scope.SessionID,
+		Path:           resolved,
+		After:          content,
+		CreatedAt:      time.Now(),
+	}
+	if existed {
+		write.Before = &previous
+	}
+
+	if err := s.repo.CreateWrite(ctx, write); err != nil {
+		// An unrecorded write could never be undone, put the file back as it was
+		if restoreErr := restore(resolved, write.Before, mode); restoreErr != nil {
+			return nil, fmt.Errorf("failed to record write: %w (and failed to restore file: %v)", err, restoreErr)
+		}
+		return nil, fmt.Errorf("failed to record write: %w", err)
+	}
+
+	return write, nil
+}
+
+// GetWrite retrieves a recorded write by ID
+func (s *Service) GetWrite(ctx context.Context, id string) (*FileWrite, error) {
+	return s.repo.GetWrite(ctx, id)
+}
+
+// ListWrites retrieves the writes made in a conversation, oldest first
+func (s *Service) ListWrites(ctx context.Context, conversationID string) ([]*FileWrite, error) {
+	return s.repo.ListWrites(ctx, conversationID)
+}
+
+// UndoWrite restores a file to its content before a write, deleting it if the write created it
+// Fails with a ConflictError if the file was changed since, e.g. by a later write that
+// has to be undone first.
+func (s *Service) UndoWrite(ctx context.Context, id string) (*FileWrite, error) {
+	write, err := s.repo.GetWrite(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if write.UndoneAt != nil {
+		return nil, domain.NewConflictError("file write", "already undone")
+	}
+
+	current, exists, err := readText(write.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || current != write.After {
+		return nil, domain.NewConflictError("file write", "the file has changed since it was written")
+	}
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(write.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := restore(write.Path, write.Before, mode); err != nil {
+		return nil, fmt.Errorf("failed to undo write: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.repo.MarkUndone(ctx, id, now); err != nil {
+		return nil, fmt.Errorf("failed to mark write undone: %w", err)
+	}
+	write.UndoneAt = &now
+
+	return write, nil
+}
+
+// resolve checks that an agent may access path and returns it with symlinks resolved
+// Paths must be absolute and inside the space, or inside the notes folder for reads.
+// The permission policy and MCP config of the space can't be written.
+func (s *Service) resolve(ctx context.Context, scope Scope, path string, write bool) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", domain.NewValidationError("path", "must be absolute")
+	}
+
+	resolved, err := evalExisting(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	if s.notes != nil {
+		notesPath, err := evalExisting(s.notes.GetNotesFolder(ctx))
+		if err == nil && within(resolved, notesPath) {
+			if write {
+				return "", domain.NewForbiddenError("notes", "notes are read-only to agents")
+			}
+			return resolved, nil
+		}
+	}
+
+	spacePath, err := evalExisting(scope.SpacePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve space path: %w", err)
+	}
+	if !within(resolved, spacePath) {
+		return "", domain.NewForbiddenError("file", fmt.Sprintf("%s is outside the space", path))
+	}
+
+	if write {
+		for _, name := range protectedFiles {
+			// Case-insensitive file systems would let .MCP.json through otherwise
+			if strings.EqualFold(resolved, filepath.Join(spacePath, filepath.FromSlash(name))) {
+				return "", domain.NewForbiddenError("file", fmt.Sprintf("%s configures the space and is read-only to agents", path))
+			}
+		}
+	}
+
+	return resolved, nil
+}
+
+// ResolveWithin resolves the symlinks of path and checks that it stays inside root, symlinks resolved too
+// Returns the resolved path; ok is false if it leads outside root.
+func ResolveWithin(root, path string) (resolved string, ok bool, err error) {
+	rootPath, err := evalExisting(root)
+	if err != nil {
+		return "", false, err
+	}
+	resolved, err = evalExisting(path)
+	if err != nil {
+		return "", false, err
+	}
+	return resolved, within(resolved, rootPath), nil
+}
+
+// evalExisting resolves the symlinks of the longest existing prefix of path
+// so a link inside the space can't point an agent outside of it
+func evalExisting(path string) (string, error) {
+	path = filepath.Clean(path)
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	// A dangling link still leads somewhere: writing through it creates its target
+	if target, err := os.Readlink(path); err == nil {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		return evalExisting(target)
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	resolvedParent, err := evalExisting(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// within reports whether path is root or inside it
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// readText reads a UTF-8 text file, exists is false if there is no file
+func readText(path string) (content string, exists bool, err error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return "", false, domain.NewValidationError("path", "is a directory")
+	}
+	if info.Size() > maxTextFileSize {
+		return "", false, domain.NewValidationError("path", fmt.Sprintf("file is larger than %d bytes", maxTextFileSize))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !utf8.Valid(data) {
+		return "", false, domain.NewValidationError("path", "is not a text file")
+	}
+
+	return string(data), true, nil
+}
+
+// restore puts back the content of a file before a write, nil removes the file
+func restore(path string, before *string, mode fs.FileMode) error {
+	if before == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(*before), mode)
+}
@@ -0,0 +1,189 @@
+package workspace_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+type notesFolder string
+
+func (n notesFolder) GetNotesFolder(context.Context) string {
+	return string(n)
+}
+
+func setupService(t *testing.T) (*workspace.Service, workspace.Scope, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	spacePath := filepath.Join(root, "spaces", "a")
+	notesPath := filepath.Join(root, "notes")
+	for _, dir := range []string{spacePath, notesPath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	db, err := sqlite.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	now := time.Now().Unix()
+	for _, stmt := range []string{
+		`INSERT INTO spaces (id, name, path, created_at, updated_at) VALUES ('space-1', 'Space', '/tmp/space-1', ?, ?)`,
+		`INSERT INTO conversations (id, space_id, title, created_at, updated_at) VALUES ('conv-1', 'space-1', 'A', ?, ?)`,
+	} {
+		if _, err := db.DB.Exec(stmt, now, now); err != nil {
+			t.Fatalf("Failed to seed database: %v", err)
+		}
+	}
+
+	service := workspace.NewService(sqlite.NewFileWriteRepository(db.DB), notesFolder(notesPath))
+	scope := workspace.Scope{SpaceID: "space-1", SpacePath: spacePath, ConversationID: "conv-1", SessionID: "session-1"}
+	return service, scope, root
+}
+
+func TestFileAccessIsConfined(t *testing.T) {
+	service, scope, root := setupService(t)
+	ctx := context.Background()
+
+	note := filepath.Join(root, "notes", "idea.md")
+	if err := os.WriteFile(note, []byte("an idea\n"), 0644); err != nil {
+		t.Fatalf("Failed to write note: %v", err)
+	}
+	outside := filepath.Join(root, "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(root, filepath.Join(scope.SpacePath, "escape")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	var forbidden *domain.ForbiddenError
+	var validation *domain.ValidationError
+
+	if content, err := service.ReadTextFile(ctx, scope, note, nil, nil); err != nil || content != "an idea\n" {
+		t.Errorf("Expected notes to be readable, got %q, %v", content, err)
+	}
+	if _, err := service.WriteTextFile(ctx, scope, note, "changed"); !errors.As(err, &forbidden) {
+		t.Errorf("Expected notes to be read-only, got %v", err)
+	}
+	if _, err := service.ReadTextFile(ctx, scope, outside, nil, nil); !errors.As(err, &forbidden) {
+		t.Errorf("Expected ForbiddenError outside the space, got %v", err)
+	}
+	if _, err := service.ReadTextFile(ctx, scope, filepath.Join(scope.SpacePath, "..", "..", "secret.txt"), nil, nil); !errors.As(err, &forbidden) {
+		t.Errorf("Expected ForbiddenError for a path leaving the space, got %v", err)
+	}
+	if _, err := service.WriteTextFile(ctx, scope, filepath.Join(scope.SpacePath, "escape", "secret.txt"), "x"); !errors.As(err, &forbidden) {
+		t.Errorf("Expected ForbiddenError through a symlink, got %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "planted.txt"), filepath.Join(scope.SpacePath, "dangling")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := service.WriteTextFile(ctx, scope, filepath.Join(scope.SpacePath, "dangling"), "x"); !errors.As(err, &forbidden) {
+		t.Errorf("Expected ForbiddenError through a dangling symlink, got %v", err)
+	}
+	for _, name := range []string{".parachute/permissions.yaml", ".mcp.json", ".MCP.json"} {
+		if _, err := service.WriteTextFile(ctx, scope, filepath.Join(scope.SpacePath, name), "{}"); !errors.As(err, &forbidden) {
+			t.Errorf("Expected ForbiddenError writing %s, got %v", name, err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(scope.SpacePath, ".mcp.json"), filepath.Join(scope.SpacePath, "servers.json")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := service.WriteTextFile(ctx, scope, filepath.Join(scope.SpacePath, "servers.json"), "{}"); !errors.As(err, &forbidden) {
+		t.Errorf("Expected ForbiddenError writing .mcp.json through a symlink, got %v", err)
+	}
+	if _, err := service.ReadTextFile(ctx, scope, "notes.md", nil, nil); !errors.As(err, &validation) {
+		t.Errorf("Expected ValidationError for a relative path, got %v", err)
+	}
+
+	var notFound *domain.NotFoundError
+	if _, err := service.ReadTextFile(ctx, scope, filepath.Join(scope.SpacePath, "missing.md"), nil, nil); !errors.As(err, &notFound) {
+		t.Errorf("Expected NotFoundError for a missing file, got %v", err)
+	}
+}
+
+func TestReadTextFileLines(t *testing.T) {
+	service, scope, _ := setupService(t)
+	ctx := context.Background()
+
+	path := filepath.Join(scope.SpacePath, "list.md")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	line, limit := 2, 2
+	content, err := service.ReadTextFile(ctx, scope, path, &line, &limit)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if content != "two\nthree\n" {
+		t.Errorf("Expected lines 2-3, got %q", content)
+	}
+}
+
+func TestWriteAndUndo(t *testing.T) {
+	service, scope, _ := setupService(t)
+	ctx := context.Background()
+
+	path := filepath.Join(scope.SpacePath, "docs", "plan.md")
+
+	created, err := service.WriteTextFile(ctx, scope, path, "v1")
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if created.Before != nil {
+		t.Errorf("Expected no previous content for a new file, got %q", *created.Before)
+	}
+
+	edited, err := service.WriteTextFile(ctx, scope, path, "v2")
+	if err != nil {
+		t.Fatalf("Failed to edit file: %v", err)
+	}
+	if edited.Before == nil || *edited.Before != "v1" {
+		t.Errorf("Expected previous content v1, got %v", edited.Before)
+	}
+
+	writes, err := service.ListWrites(ctx, "conv-1")
+	if err != nil || len(writes) != 2 {
+		t.Fatalf("Expected 2 recorded writes, got %d, %v", len(writes), err)
+	}
+
+	// The first write can't be undone while the second one is in place
+	var conflict *domain.ConflictError
+	if _, err := service.UndoWrite(ctx, created.ID); !errors.As(err, &conflict) {
+		t.Fatalf("Expected ConflictError when undoing out of order, got %v", err)
+	}
+
+	if _, err := service.UndoWrite(ctx, edited.ID); err != nil {
+		t.Fatalf("Failed to undo edit: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "v1" {
+		t.Errorf("Expected v1 after undo, got %q", data)
+	}
+	if _, err := service.UndoWrite(ctx, edited.ID); !errors.As(err, &conflict) {
+		t.Errorf("Expected ConflictError when undoing twice, got %v", err)
+	}
+
+	if _, err := service.UndoWrite(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to undo creation: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the created file to be removed, got %v", err)
+	}
+
+	got, err := service.GetWrite(ctx, created.ID)
+	if err != nil || got.UndoneAt == nil {
+		t.Errorf("Expected the write to be marked undone, got %+v, %v", got, err)
+	}
+}
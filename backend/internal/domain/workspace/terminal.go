@@ -0,0 +1,368 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/unforced/parachute-backend/internal/domain"
+)
+
+// Terminal limits, agents may ask for less output but never more
+const (
+	DefaultTerminalTimeout     = 10 * time.Minute
+	DefaultTerminalOutputLimit = 1 << 20
+
+	// terminalWaitDelay bounds how long a killed command's children may hold its output open
+	terminalWaitDelay = 2 * time.Second
+)
+
+// TerminalOptions describes a command to run in a terminal
+type TerminalOptions struct {
+	Command         string
+	Args            []string
+	Env             map[string]string // Added to the backend's environment, see checkTerminalEnv
+	Cwd             string            // Absolute path inside the space, the space folder if empty
+	OutputByteLimit int               // 0 for the manager's limit, larger values are capped to it
+}
+
+// ExitStatus is how a terminal command ended: an exit code, or the signal that killed it
+type ExitStatus struct {
+	ExitCode *int    `json:"exit_code"`
+	Signal   *string `json:"signal"`
+}
+
+// Terminal is a command an agent runs in a space
+// Output keeps the most recent bytes up to the output limit.
+type Terminal struct {
+	ID             string
+	SessionID      string
+	ConversationID string
+	CommandLine    string
+	Cwd            string
+
+	manager *TerminalManager
+	limit   int
+	cancel  context.CancelFunc
+	done    chan struct{} // Closed once the command exited and exit is set
+
+	mu        sync.Mutex
+	output    []byte
+	truncated bool
+	exit      *ExitStatus
+}
+
+// TerminalManager runs the terminals agents create, with a timeout and an output cap
+type TerminalManager struct {
+	timeout     time.Duration
+	outputLimit int
+
+	mu            sync.Mutex
+	terminals     map[string]*Terminal
+	outputHandler func(term *Terminal, data string)
+	exitHandler   func(term *Terminal, status ExitStatus)
+}
+
+// NewTerminalManager creates a new terminal manager
+// Zero values use DefaultTerminalTimeout and DefaultTerminalOutputLimit
+func NewTerminalManager(timeout time.Duration, outputLimit int) *TerminalManager {
+	if timeout <= 0 {
+		timeout = DefaultTerminalTimeout
+	}
+	if outputLimit <= 0 {
+		outputLimit = DefaultTerminalOutputLimit
+	}
+
+	return &TerminalManager{
+		timeout:     timeout,
+		outputLimit: outputLimit,
+		terminals:   make(map[string]*Terminal),
+	}
+}
+
+// OnOutput registers a callback run with every chunk of output a terminal produces
+func (m *TerminalManager) OnOutput(fn func(term *Terminal, data string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outputHandler = fn
+}
+
+// OnExit registers a callback run when a terminal command exits
+func (m *TerminalManager) OnExit(fn func(term *Terminal, status ExitStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exitHandler = fn
+}
+
+// Create starts a command in a new terminal
+// The caller is responsible for checking that the command may run.
+func (m *TerminalManager) Create(scope Scope, opts TerminalOptions) (*Terminal, error) {
+	if opts.Command == "" {
+		return nil, domain.NewValidationError("command", "is required")
+	}
+
+	if err := checkTerminalEnv(opts.Env); err != nil {
+		return nil, err
+	}
+
+	cwd, err := terminalDir(scope, opts.Cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := m.outputLimit
+	if opts.OutputByteLimit > 0 && opts.OutputByteLimit < limit {
+		limit = opts.OutputByteLimit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	cmd := exec.CommandContext(ctx, opts.Command, opts.Args...)
+	cmd.Dir = cwd
+	cmd.Env = os.Environ()
+	for key, value := range opts.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.WaitDelay = terminalWaitDelay
+	// Run the command in its own process group so timeouts and kills reach its children too,
+	// e.g. the server started by "npm run dev"
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	term := &Terminal{
+		ID:             uuid.New().String(),
+		SessionID:      scope.SessionID,
+		ConversationID: scope.ConversationID,
+		CommandLine:    joinCommand(opts.Command, opts.Args),
+		Cwd:            cwd,
+		manager:        m,
+		limit:          limit,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+	// One writer for both streams keeps them interleaved as the command wrote them
+	cmd.Stdout = term
+	cmd.Stderr = term
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start %s: %w", opts.Command, err)
+	}
+
+	m.mu.Lock()
+	m.terminals[term.ID] = term
+	m.mu.Unlock()
+
+	go term.wait(cmd)
+
+	return term, nil
+}
+
+// Get returns a terminal of a session
+func (m *TerminalManager) Get(sessionID, terminalID string) (*Terminal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	term, ok := m.terminals[terminalID]
+	if !ok || term.SessionID != sessionID {
+		return nil, domain.NewNotFoundError("terminal", terminalID)
+	}
+	return term, nil
+}
+
+// Release kills the command of a terminal if it still runs and forgets the terminal
+func (m *TerminalManager) Release(sessionID, terminalID string) error {
+	term, err := m.Get(sessionID, terminalID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.terminals, terminalID)
+	m.mu.Unlock()
+
+	term.Kill()
+	return nil
+}
+
+// ReleaseSession releases every terminal of a session, e.g. when its listener stops
+func (m *TerminalManager) ReleaseSession(sessionID string) {
+	m.mu.Lock()
+	var released []*Terminal
+	for id, term := range m.terminals {
+		if term.SessionID == sessionID {
+			released = append(released, term)
+			delete(m.terminals, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, term := range released {
+		term.Kill()
+	}
+}
+
+// Close kills every terminal
+func (m *TerminalManager) Close() {
+	m.mu.Lock()
+	terminals := m.terminals
+	m.terminals = make(map[string]*Terminal)
+	m.mu.Unlock()
+
+	for _, term := range terminals {
+		term.Kill()
+	}
+}
+
+// Write collects output of the command, dropping the oldest bytes beyond the limit
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.output = append(t.output, p...)
+	if len(t.output) > t.limit {
+		cut := len(t.output) - t.limit
+		// Never split a character
+		for cut < len(t.output) && !utf8.RuneStart(t.output[cut]) {
+			cut++
+		}
+		t.output = append([]byte(nil), t.output[cut:]...)
+		t.truncated = true
+	}
+	t.mu.Unlock()
+
+	t.manager.mu.Lock()
+	handler := t.manager.outputHandler
+	t.manager.mu.Unlock()
+	if handler != nil {
+		handler(t, string(p))
+	}
+
+	return len(p), nil
+}
+
+// Output returns the output so far, whether older output was dropped, and the exit status
+// once the command exited
+func (t *Terminal) Output() (output string, truncated bool, exit *ExitStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.output), t.truncated, t.exit
+}
+
+// WaitForExit blocks until the command exits or ctx is done
+func (t *Terminal) WaitForExit(ctx context.Context) (*ExitStatus, error) {
+	select {
+	case <-t.done:
+		_, _, exit := t.Output()
+		return exit, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Kill stops the command, the terminal stays available for its output
+func (t *Terminal) Kill() {
+	t.cancel()
+}
+
+// wait reaps the command and records how it ended
+func (t *Terminal) wait(cmd *exec.Cmd) {
+	err := cmd.Wait()
+	t.cancel()
+
+	status := exitStatus(cmd.ProcessState)
+	if status.ExitCode == nil && status.Signal == nil && err != nil {
+		// Output copying failed after the command ended, report it as a failure
+		code := -1
+		status.ExitCode = &code
+	}
+
+	t.mu.Lock()
+	t.exit = &status
+	t.mu.Unlock()
+	close(t.done)
+
+	t.manager.mu.Lock()
+	handler := t.manager.exitHandler
+	t.manager.mu.Unlock()
+	if handler != nil {
+		handler(t, status)
+	}
+}
+
+// exitStatus converts the state of an exited process
+func exitStatus(state *os.ProcessState) ExitStatus {
+	if state == nil {
+		return ExitStatus{}
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		signal := ws.Signal().String()
+		return ExitStatus{Signal: &signal}
+	}
+	code := state.ExitCode()
+	return ExitStatus{ExitCode: &code}
+}
+
+// checkTerminalEnv refuses variables that change which code a command runs
+// The permission policy only sees the command line, so a safe command must stay safe whatever
+// environment the agent asks for.
+func checkTerminalEnv(env map[string]string) error {
+	for name := range env {
+		upper := strings.ToUpper(name)
+		switch {
+		case upper == "PATH", upper == "IFS", upper == "BASH_ENV", upper == "ENV",
+			strings.HasPrefix(upper, "LD_"), strings.HasPrefix(upper, "DYLD_"):
+			return domain.NewForbiddenError("terminal", fmt.Sprintf("setting %s is not allowed", name))
+		}
+	}
+	return nil
+}
+
+// terminalDir resolves the working directory of a terminal, which must be inside the space
+func terminalDir(scope Scope, cwd string) (string, error) {
+	spacePath, err := evalExisting(scope.SpacePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve space path: %w", err)
+	}
+	if cwd == "" {
+		return spacePath, nil
+	}
+	if !filepath.IsAbs(cwd) {
+		return "", domain.NewValidationError("cwd", "must be absolute")
+	}
+
+	resolved, err := evalExisting(cwd)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cwd: %w", err)
+	}
+	if !within(resolved, spacePath) {
+		return "", domain.NewForbiddenError("terminal", fmt.Sprintf("%s is outside the space", cwd))
+	}
+
+	info, err := os.Stat(resolved)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !info.IsDir()) {
+		return "", domain.NewValidationError("cwd", "is not a directory")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to stat cwd: %w", err)
+	}
+
+	return resolved, nil
+}
+
+// joinCommand formats a command and its arguments as one line
+func joinCommand(command string, args []string) string {
+	line := command
+	for _, arg := range args {
+		line += " " + arg
+	}
+	return line
+}
@@ -0,0 +1,151 @@
+package workspace_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+)
+
+func waitForExit(t *testing.T, term *workspace.Terminal) *workspace.ExitStatus {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := term.WaitForExit(ctx)
+	if err != nil {
+		t.Fatalf("Command did not exit: %v", err)
+	}
+	return status
+}
+
+func TestTerminalRunsInSpace(t *testing.T) {
+	spacePath := t.TempDir()
+	scope := workspace.Scope{SpacePath: spacePath, ConversationID: "conv-1", SessionID: "session-1"}
+	manager := workspace.NewTerminalManager(0, 0)
+	defer manager.Close()
+
+	var streamed strings.Builder
+	streamDone := make(chan struct{})
+	manager.OnOutput(func(_ *workspace.Terminal, data string) { streamed.WriteString(data) })
+	manager.OnExit(func(*workspace.Terminal, workspace.ExitStatus) { close(streamDone) })
+
+	term, err := manager.Create(scope, workspace.TerminalOptions{
+		Command: "sh",
+		Args:    []string{"-c", "pwd; echo $GREETING; exit 3"},
+		Env:     map[string]string{"GREETING": "hello"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create terminal: %v", err)
+	}
+
+	status := waitForExit(t, term)
+	if status.ExitCode == nil || *status.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %+v", status)
+	}
+
+	resolved, _ := filepath.EvalSymlinks(spacePath)
+	output, truncated, exit := term.Output()
+	if output != resolved+"\nhello\n" || truncated || exit == nil {
+		t.Errorf("Unexpected output %q (truncated %v, exit %v)", output, truncated, exit)
+	}
+
+	<-streamDone
+	if streamed.String() != output {
+		t.Errorf("Expected streamed output to match, got %q", streamed.String())
+	}
+
+	if _, err := manager.Get("session-2", term.ID); err == nil {
+		t.Error("Expected terminals to be private to their session")
+	}
+	if err := manager.Release("session-1", term.ID); err != nil {
+		t.Fatalf("Failed to release terminal: %v", err)
+	}
+	var notFound *domain.NotFoundError
+	if _, err := manager.Get("session-1", term.ID); !errors.As(err, &notFound) {
+		t.Errorf("Expected NotFoundError after release, got %v", err)
+	}
+}
+
+func TestTerminalLimits(t *testing.T) {
+	spacePath := t.TempDir()
+	scope := workspace.Scope{SpacePath: spacePath, SessionID: "session-1"}
+	manager := workspace.NewTerminalManager(200*time.Millisecond, 0)
+	defer manager.Close()
+
+	// Only the most recent output is kept
+	term, err := manager.Create(scope, workspace.TerminalOptions{
+		Command:         "sh",
+		Args:            []string{"-c", "echo 0123456789; echo abcdef"},
+		OutputByteLimit: 7,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create terminal: %v", err)
+	}
+	waitForExit(t, term)
+	if output, truncated, _ := term.Output(); output != "abcdef\n" || !truncated {
+		t.Errorf("Expected the last 7 bytes, got %q (truncated %v)", output, truncated)
+	}
+
+	// Commands are killed after the timeout
+	term, err = manager.Create(scope, workspace.TerminalOptions{Command: "sleep", Args: []string{"10"}})
+	if err != nil {
+		t.Fatalf("Failed to create terminal: %v", err)
+	}
+	if status := waitForExit(t, term); status.Signal == nil {
+		t.Errorf("Expected the command to be killed, got %+v", status)
+	}
+
+	// Killing reaches the children of the command too
+	pidFile := filepath.Join(spacePath, "child.pid")
+	term, err = manager.Create(scope, workspace.TerminalOptions{
+		Command: "sh",
+		Args:    []string{"-c", "sleep 10 & echo $! > child.pid; wait"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create terminal: %v", err)
+	}
+	waitForExit(t, term)
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Failed to read child pid: %v", err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the child of a killed command to be killed too")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Variables that change which code runs are refused
+	var forbidden *domain.ForbiddenError
+	for _, name := range []string{"PATH", "LD_PRELOAD", "DYLD_INSERT_LIBRARIES"} {
+		_, err := manager.Create(scope, workspace.TerminalOptions{Command: "ls", Env: map[string]string{name: spacePath}})
+		if !errors.As(err, &forbidden) {
+			t.Errorf("Expected ForbiddenError for %s, got %v", name, err)
+		}
+	}
+
+	// The working directory must be inside the space
+	outside := filepath.Dir(spacePath)
+	if _, err := manager.Create(scope, workspace.TerminalOptions{Command: "ls", Cwd: outside}); !errors.As(err, &forbidden) {
+		t.Errorf("Expected ForbiddenError for a cwd outside the space, got %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(spacePath, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create folder: %v", err)
+	}
+	if _, err := manager.Create(scope, workspace.TerminalOptions{Command: "true", Cwd: filepath.Join(spacePath, "sub")}); err != nil {
+		t.Errorf("Expected a cwd inside the space to work, got %v", err)
+	}
+}
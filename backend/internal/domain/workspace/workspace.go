@@ -0,0 +1,27 @@
+package workspace
+
+import (
+	"time"
+)
+
+// Scope is the space and conversation an agent's file access is made for
+type Scope struct {
+	SpaceID        string
+	SpacePath      string
+	ConversationID string
+	SessionID      string
+}
+
+// FileWrite records one file written by an agent, with the content before and after
+// so clients can show it as a diff and undo it
+type FileWrite struct {
+	ID             string     `json:"id"`
+	SpaceID        string     `json:"space_id"`
+	ConversationID string     `json:"conversation_id"`
+	SessionID      string     `json:"session_id"`
+	Path           string     `json:"path"`   // Absolute path of the file
+	Before         *string    `json:"before"` // Nil when the write created the file
+	After          string     `json:"after"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UndoneAt       *time.Time `json:"undone_at,omitempty"`
+}
@@ -3,9 +3,12 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 
+	"github.com/unforced/parachute-backend/internal/domain"
 	"github.com/unforced/parachute-backend/internal/domain/conversation"
 )
 
@@ -44,13 +47,14 @@ func (r *ConversationRepository) CreateConversation(ctx context.Context, conv *c
 // GetConversation retrieves a conversation by ID
 func (r *ConversationRepository) GetConversation(ctx context.Context, id string) (*conversation.Conversation, error) {
 	query := `
-		SELECT id, space_id, title, created_at, updated_at
+		SELECT id, space_id, title, created_at, updated_at, summary, summary_through, modes
 		FROM conversations
 		WHERE id = ?
 	`
 
 	var conv conversation.Conversation
 	var createdAt, updatedAt int64
+	var summary, summaryThrough, modes sql.NullString
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&conv.ID,
@@ -58,6 +62,9 @@ func (r *ConversationRepository) GetConversation(ctx context.Context, id string)
 		&conv.Title,
 		&createdAt,
 		&updatedAt,
+		&summary,
+		&summaryThrough,
+		&modes,
 	)
 
 	if err == sql.ErrNoRows {
@@ -69,6 +76,11 @@ func (r *ConversationRepository) GetConversation(ctx context.Context, id string)
 
 	conv.CreatedAt = time.Unix(createdAt, 0)
 	conv.UpdatedAt = time.Unix(updatedAt, 0)
+	conv.Summary = summary.String
+	conv.SummaryThrough = summaryThrough.String
+	if conv.Modes, err = decodeModes(modes); err != nil {
+		return nil, err
+	}
 
 	return &conv, nil
 }
@@ -76,7 +88,7 @@ func (r *ConversationRepository) GetConversation(ctx context.Context, id string)
 // ListConversations retrieves all conversations for a space
 func (r *ConversationRepository) ListConversations(ctx context.Context, spaceID string) ([]*conversation.Conversation, error) {
 	query := `
-		SELECT id, space_id, title, created_at, updated_at
+		SELECT id, space_id, title, created_at, updated_at, summary, summary_through, modes
 		FROM conversations
 		WHERE space_id = ?
 		ORDER BY updated_at DESC
@@ -93,6 +105,7 @@ func (r *ConversationRepository) ListConversations(ctx context.Context, spaceID
 	for rows.Next() {
 		var conv conversation.Conversation
 		var createdAt, updatedAt int64
+		var summary, summaryThrough, modes sql.NullString
 
 		err := rows.Scan(
 			&conv.ID,
@@ -100,6 +113,9 @@ func (r *ConversationRepository) ListConversations(ctx context.Context, spaceID
 			&conv.Title,
 			&createdAt,
 			&updatedAt,
+			&summary,
+			&summaryThrough,
+			&modes,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conversation: %w", err)
@@ -107,6 +123,11 @@ func (r *ConversationRepository) ListConversations(ctx context.Context, spaceID
 
 		conv.CreatedAt = time.Unix(createdAt, 0)
 		conv.UpdatedAt = time.Unix(updatedAt, 0)
+		conv.Summary = summary.String
+		conv.SummaryThrough = summaryThrough.String
+		if conv.Modes, err = decodeModes(modes); err != nil {
+			return nil, err
+		}
 
 		conversations = append(conversations, &conv)
 	}
@@ -150,6 +171,52 @@ func (r *ConversationRepository) UpdateConversation(ctx context.Context, conv *c
 	return nil
 }
 
+// SaveSummary stores the rolling summary of a conversation, without touching updated_at
+func (r *ConversationRepository) SaveSummary(ctx context.Context, conversationID, summary, throughMessageID string) error {
+	query := `UPDATE conversations SET summary = ?, summary_through = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, summary, throughMessageID, conversationID); err != nil {
+		return fmt.Errorf("failed to save conversation summary: %w", err)
+	}
+
+	return nil
+}
+
+// SaveModes stores the session modes of a conversation, without touching updated_at
+func (r *ConversationRepository) SaveModes(ctx context.Context, conversationID string, modes *conversation.Modes) error {
+	var value interface{}
+	if modes != nil {
+		data, err := json.Marshal(modes)
+		if err != nil {
+			return fmt.Errorf("failed to encode modes: %w", err)
+		}
+		value = string(data)
+	}
+
+	query := `UPDATE conversations SET modes = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, value, conversationID); err != nil {
+		return fmt.Errorf("failed to save conversation modes: %w", err)
+	}
+
+	return nil
+}
+
+// SetCurrentMode changes the current mode of a conversation, keeping its available modes
+func (r *ConversationRepository) SetCurrentMode(ctx context.Context, conversationID, modeID string) error {
+	query := `
+		UPDATE conversations
+		SET modes = json_set(COALESCE(modes, '{"available":[]}'), '$.current_mode_id', ?)
+		WHERE id = ?
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, modeID, conversationID); err != nil {
+		return fmt.Errorf("failed to set conversation mode: %w", err)
+	}
+
+	return nil
+}
+
 // DeleteConversation deletes a conversation
 func (r *ConversationRepository) DeleteConversation(ctx context.Context, id string) error {
 	query := `DELETE FROM conversations WHERE id = ?`
@@ -174,10 +241,28 @@ func (r *ConversationRepository) DeleteConversation(ctx context.Context, id stri
 // CreateMessage creates a new message
 func (r *ConversationRepository) CreateMessage(ctx context.Context, msg *conversation.Message) error {
 	query := `
-		INSERT INTO messages (id, conversation_id, role, content, created_at, metadata)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO messages (id, conversation_id, role, content, created_at, metadata, parts, note_refs)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	var parts sql.NullString
+	if len(msg.Parts) > 0 {
+		data, err := json.Marshal(msg.Parts)
+		if err != nil {
+			return fmt.Errorf("failed to encode message parts: %w", err)
+		}
+		parts = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var noteRefs sql.NullString
+	if len(msg.NoteRefs) > 0 {
+		data, err := json.Marshal(msg.NoteRefs)
+		if err != nil {
+			return fmt.Errorf("failed to encode message note refs: %w", err)
+		}
+		noteRefs = sql.NullString{String: string(data), Valid: true}
+	}
+
 	_, err := r.db.ExecContext(ctx, query,
 		msg.ID,
 		msg.ConversationID,
@@ -185,6 +270,8 @@ func (r *ConversationRepository) CreateMessage(ctx context.Context, msg *convers
 		msg.Content,
 		msg.CreatedAt.Unix(),
 		msg.Metadata,
+		parts,
+		noteRefs,
 	)
 
 	if err != nil {
@@ -197,14 +284,14 @@ func (r *ConversationRepository) CreateMessage(ctx context.Context, msg *convers
 // GetMessage retrieves a message by ID
 func (r *ConversationRepository) GetMessage(ctx context.Context, id string) (*conversation.Message, error) {
 	query := `
-		SELECT id, conversation_id, role, content, created_at, metadata
+		SELECT id, conversation_id, role, content, created_at, metadata, parts, note_refs
 		FROM messages
 		WHERE id = ?
 	`
 
 	var msg conversation.Message
 	var createdAt int64
-	var metadata sql.NullString
+	var metadata, parts, noteRefs sql.NullString
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&msg.ID,
@@ -213,6 +300,8 @@ func (r *ConversationRepository) GetMessage(ctx context.Context, id string) (*co
 		&msg.Content,
 		&createdAt,
 		&metadata,
+		&parts,
+		&noteRefs,
 	)
 
 	if err == sql.ErrNoRows {
@@ -226,6 +315,9 @@ func (r *ConversationRepository) GetMessage(ctx context.Context, id string) (*co
 	if metadata.Valid {
 		msg.Metadata = metadata.String
 	}
+	if err := decodeParts(parts, noteRefs, &msg); err != nil {
+		return nil, err
+	}
 
 	return &msg, nil
 }
@@ -233,7 +325,7 @@ func (r *ConversationRepository) GetMessage(ctx context.Context, id string) (*co
 // ListMessages retrieves all messages for a conversation
 func (r *ConversationRepository) ListMessages(ctx context.Context, conversationID string) ([]*conversation.Message, error) {
 	query := `
-		SELECT id, conversation_id, role, content, created_at, metadata
+		SELECT id, conversation_id, role, content, created_at, metadata, parts, note_refs
 		FROM messages
 		WHERE conversation_id = ?
 		ORDER BY created_at ASC
@@ -250,7 +342,7 @@ func (r *ConversationRepository) ListMessages(ctx context.Context, conversationI
 	for rows.Next() {
 		var msg conversation.Message
 		var createdAt int64
-		var metadata sql.NullString
+		var metadata, parts, noteRefs sql.NullString
 
 		err := rows.Scan(
 			&msg.ID,
@@ -259,6 +351,8 @@ func (r *ConversationRepository) ListMessages(ctx context.Context, conversationI
 			&msg.Content,
 			&createdAt,
 			&metadata,
+			&parts,
+			&noteRefs,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
@@ -268,6 +362,9 @@ func (r *ConversationRepository) ListMessages(ctx context.Context, conversationI
 		if metadata.Valid {
 			msg.Metadata = metadata.String
 		}
+		if err := decodeParts(parts, noteRefs, &msg); err != nil {
+			return nil, err
+		}
 
 		messages = append(messages, &msg)
 	}
@@ -299,3 +396,359 @@ func (r *ConversationRepository) DeleteMessage(ctx context.Context, id string) e
 
 	return nil
 }
+
+// ListUsage sums assistant messages by conversation, day and stop reason
+// It reads the metadata the message handler stores with assistant messages: stop_reason,
+// duration_ms, chunks, thought_chunks and usage. Messages without it count with zeroes.
+func (r *ConversationRepository) ListUsage(ctx context.Context, filter conversation.UsageFilter) ([]*conversation.UsageRow, error) {
+	query := `
+		SELECT c.space_id, c.id, c.title,
+			date(m.created_at, 'unixepoch') AS day,
+			COALESCE(json_extract(m.meta, '$.stop_reason'), '') AS stop_reason,
+			COUNT(*),
+			COALESCE(SUM(json_extract(m.meta, '$.duration_ms')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.chunks')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.thought_chunks')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.usage.input_tokens')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.usage.output_tokens')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.usage.total_tokens')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.usage.thought_tokens')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.usage.cached_read_tokens')), 0),
+			COALESCE(SUM(json_extract(m.meta, '$.usage.cached_write_tokens')), 0)
+		FROM (
+			SELECT conversation_id, created_at, CASE WHEN json_valid(metadata) THEN metadata END AS meta
+			FROM messages
+			WHERE role = 'assistant' AND created_at >= ? AND created_at < ?
+		) m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE ? = '' OR c.space_id = ?
+		GROUP BY c.id, day, stop_reason
+		ORDER BY day, c.id
+	`
+
+	from, to := int64(0), int64(math.MaxInt64)
+	if !filter.From.IsZero() {
+		from = filter.From.Unix()
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.Unix()
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, from, to, filter.SpaceID, filter.SpaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []*conversation.UsageRow
+	for rows.Next() {
+		var row conversation.UsageRow
+		err := rows.Scan(
+			&row.SpaceID,
+			&row.ConversationID,
+			&row.Title,
+			&row.Day,
+			&row.StopReason,
+			&row.Messages,
+			&row.DurationMs,
+			&row.Chunks,
+			&row.ThoughtChunks,
+			&row.Usage.InputTokens,
+			&row.Usage.OutputTokens,
+			&row.Usage.TotalTokens,
+			&row.Usage.ThoughtTokens,
+			&row.Usage.CachedReadTokens,
+			&row.Usage.CachedWriteTokens,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		usage = append(usage, &row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// SaveSession inserts or replaces the session of a conversation
+func (r *ConversationRepository) SaveSession(ctx context.Context, session *conversation.Session) error {
+	query := `
+		INSERT INTO sessions (id, conversation_id, agent, created_at, last_used_at, is_active)
+		VALUES (?, ?, ?, ?, ?, 1)
+		ON CONFLICT(conversation_id) DO UPDATE SET
+			id = excluded.id,
+			agent = excluded.agent,
+			created_at = excluded.created_at,
+			last_used_at = excluded.last_used_at,
+			is_active = 1
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		session.ID,
+		session.ConversationID,
+		session.Agent,
+		session.CreatedAt.Unix(),
+		session.LastUsedAt.Unix(),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession retrieves the active session of a conversation
+func (r *ConversationRepository) GetSession(ctx context.Context, conversationID string) (*conversation.Session, error) {
+	query := `
+		SELECT id, conversation_id, agent, created_at, last_used_at
+		FROM sessions
+		WHERE conversation_id = ? AND is_active = 1
+	`
+
+	var session conversation.Session
+	var createdAt, lastUsedAt int64
+
+	err := r.db.QueryRowContext(ctx, query, conversationID).Scan(
+		&session.ID,
+		&session.ConversationID,
+		&session.Agent,
+		&createdAt,
+		&lastUsedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("session", conversationID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	session.CreatedAt = time.Unix(createdAt, 0)
+	session.LastUsedAt = time.Unix(lastUsedAt, 0)
+
+	return &session, nil
+}
+
+// TouchSession updates the last use of the session of a conversation
+func (r *ConversationRepository) TouchSession(ctx context.Context, conversationID string, usedAt time.Time) error {
+	query := `UPDATE sessions SET last_used_at = ? WHERE conversation_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, usedAt.Unix(), conversationID); err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	return nil
+}
+
+// DeactivateSession flags the session of a conversation as not resumable
+func (r *ConversationRepository) DeactivateSession(ctx context.Context, conversationID string) error {
+	query := `UPDATE sessions SET is_active = 0 WHERE conversation_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, conversationID); err != nil {
+		return fmt.Errorf("failed to deactivate session: %w", err)
+	}
+
+	return nil
+}
+
+// SaveToolCalls inserts or replaces tool calls in one transaction
+func (r *ConversationRepository) SaveToolCalls(ctx context.Context, toolCalls []*conversation.ToolCall) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR REPLACE INTO tool_calls
+			(id, message_id, position, kind, title, status, raw_input, raw_output, content, locations, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare tool call insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, call := range toolCalls {
+		_, err := stmt.ExecContext(ctx,
+			call.ID,
+			call.MessageID,
+			call.Position,
+			nullString(call.Kind),
+			call.Title,
+			nullString(call.Status),
+			nullString(string(call.RawInput)),
+			nullString(string(call.RawOutput)),
+			nullString(string(call.Content)),
+			nullString(string(call.Locations)),
+			call.CreatedAt.Unix(),
+			call.UpdatedAt.Unix(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save tool call %s: %w", call.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tool calls: %w", err)
+	}
+	return nil
+}
+
+// ListToolCalls retrieves the tool calls of all messages of a conversation
+func (r *ConversationRepository) ListToolCalls(ctx context.Context, conversationID string) ([]*conversation.ToolCall, error) {
+	query := `
+		SELECT tc.id, tc.message_id, tc.position, tc.kind, tc.title, tc.status,
+			tc.raw_input, tc.raw_output, tc.content, tc.locations, tc.created_at, tc.updated_at
+		FROM tool_calls tc
+		JOIN messages m ON m.id = tc.message_id
+		WHERE m.conversation_id = ?
+		ORDER BY m.created_at ASC, tc.position ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tool calls: %w", err)
+	}
+	defer rows.Close()
+
+	var toolCalls []*conversation.ToolCall
+
+	for rows.Next() {
+		var call conversation.ToolCall
+		var kind, status, rawInput, rawOutput, content, locations sql.NullString
+		var createdAt, updatedAt int64
+
+		err := rows.Scan(
+			&call.ID,
+			&call.MessageID,
+			&call.Position,
+			&kind,
+			&call.Title,
+			&status,
+			&rawInput,
+			&rawOutput,
+			&content,
+			&locations,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tool call: %w", err)
+		}
+
+		call.Kind = kind.String
+		call.Status = status.String
+		call.RawInput = rawJSON(rawInput)
+		call.RawOutput = rawJSON(rawOutput)
+		call.Content = rawJSON(content)
+		call.Locations = rawJSON(locations)
+		call.CreatedAt = time.Unix(createdAt, 0)
+		call.UpdatedAt = time.Unix(updatedAt, 0)
+
+		toolCalls = append(toolCalls, &call)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tool calls: %w", err)
+	}
+
+	return toolCalls, nil
+}
+
+// SavePlan inserts or replaces the plan of a message
+func (r *ConversationRepository) SavePlan(ctx context.Context, plan *conversation.Plan) error {
+	entries, err := json.Marshal(plan.Entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO plans (message_id, entries, updated_at)
+		VALUES (?, ?, ?)
+	`, plan.MessageID, string(entries), plan.UpdatedAt.Unix())
+
+	if err != nil {
+		return fmt.Errorf("failed to save plan: %w", err)
+	}
+	return nil
+}
+
+// ListPlans retrieves the plans of all messages of a conversation
+func (r *ConversationRepository) ListPlans(ctx context.Context, conversationID string) ([]*conversation.Plan, error) {
+	query := `
+		SELECT p.message_id, p.entries, p.updated_at
+		FROM plans p
+		JOIN messages m ON m.id = p.message_id
+		WHERE m.conversation_id = ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+	defer rows.Close()
+
+	var plans []*conversation.Plan
+
+	for rows.Next() {
+		var plan conversation.Plan
+		var entries string
+		var updatedAt int64
+
+		if err := rows.Scan(&plan.MessageID, &entries, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan plan: %w", err)
+		}
+		if err := json.Unmarshal([]byte(entries), &plan.Entries); err != nil {
+			return nil, fmt.Errorf("failed to decode plan of message %s: %w", plan.MessageID, err)
+		}
+		plan.UpdatedAt = time.Unix(updatedAt, 0)
+
+		plans = append(plans, &plan)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating plans: %w", err)
+	}
+
+	return plans, nil
+}
+
+// rawJSON turns a nullable JSON column back into a raw message
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	return json.RawMessage(s.String)
+}
+
+// decodeModes reads the modes column of a conversation
+func decodeModes(modes sql.NullString) (*conversation.Modes, error) {
+	if !modes.Valid || modes.String == "" {
+		return nil, nil
+	}
+	var decoded conversation.Modes
+	if err := json.Unmarshal([]byte(modes.String), &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation modes: %w", err)
+	}
+	return &decoded, nil
+}
+
+// decodeParts decodes the parts and note_refs columns of a message
+func decodeParts(parts, noteRefs sql.NullString, msg *conversation.Message) error {
+	if parts.Valid && parts.String != "" {
+		if err := json.Unmarshal([]byte(parts.String), &msg.Parts); err != nil {
+			return fmt.Errorf("failed to decode parts of message %s: %w", msg.ID, err)
+		}
+	}
+	if noteRefs.Valid && noteRefs.String != "" {
+		if err := json.Unmarshal([]byte(noteRefs.String), &msg.NoteRefs); err != nil {
+			return fmt.Errorf("failed to decode note refs of message %s: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
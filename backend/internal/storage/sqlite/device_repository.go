@@ -0,0 +1,184 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/device"
+)
+
+const deviceColumns = `id, name, platform, token_prefix, token_hash, created_at, last_used_at, revoked_at, upload_count, last_upload_at`
+
+// DeviceRepository implements the device.Repository interface
+type DeviceRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceRepository creates a new device repository
+func NewDeviceRepository(db *sql.DB) *DeviceRepository {
+	return &DeviceRepository{db: db}
+}
+
+// CreateDevice inserts a new device
+func (r *DeviceRepository) CreateDevice(ctx context.Context, d *device.Device) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO devices (id, name, platform, token_prefix, token_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, d.ID, d.Name, d.Platform, d.TokenPrefix, d.TokenHash, d.CreatedAt.Unix())
+
+	if err != nil {
+		return fmt.Errorf("failed to insert device: %w", err)
+	}
+	return nil
+}
+
+// GetDevice retrieves a device by ID
+func (r *DeviceRepository) GetDevice(ctx context.Context, id string) (*device.Device, error) {
+	d, err := scanDevice(r.db.QueryRowContext(ctx, `SELECT `+deviceColumns+` FROM devices WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("device", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return d, nil
+}
+
+// GetDeviceByTokenHash retrieves the device a token hash belongs to
+func (r *DeviceRepository) GetDeviceByTokenHash(ctx context.Context, tokenHash string) (*device.Device, error) {
+	d, err := scanDevice(r.db.QueryRowContext(ctx, `SELECT `+deviceColumns+` FROM devices WHERE token_hash = ?`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("device", "token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	return d, nil
+}
+
+// ListDevices retrieves all devices, oldest first
+func (r *DeviceRepository) ListDevices(ctx context.Context) ([]*device.Device, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+deviceColumns+` FROM devices ORDER BY created_at, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := make([]*device.Device, 0)
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// RevokeDevice marks the token of a device as revoked
+func (r *DeviceRepository) RevokeDevice(ctx context.Context, id string, at time.Time) error {
+	return r.updateDevice(ctx, id, `UPDATE devices SET revoked_at = ? WHERE id = ?`, at.Unix())
+}
+
+// TouchDevice records when the token of a device was last used
+func (r *DeviceRepository) TouchDevice(ctx context.Context, id string, at time.Time) error {
+	return r.updateDevice(ctx, id, `UPDATE devices SET last_used_at = ? WHERE id = ?`, at.Unix())
+}
+
+// RecordUpload counts a capture uploaded by a device
+func (r *DeviceRepository) RecordUpload(ctx context.Context, id string, at time.Time) error {
+	return r.updateDevice(ctx, id, `UPDATE devices SET upload_count = upload_count + 1, last_upload_at = ? WHERE id = ?`, at.Unix())
+}
+
+// CreatePairingCode stores the hash of a pairing code
+func (r *DeviceRepository) CreatePairingCode(ctx context.Context, codeHash string, createdAt, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO pairing_codes (code_hash, created_at, expires_at) VALUES (?, ?, ?)
+	`, codeHash, createdAt.Unix(), expiresAt.Unix())
+
+	if err != nil {
+		return fmt.Errorf("failed to insert pairing code: %w", err)
+	}
+	return nil
+}
+
+// RedeemPairingCode marks a pairing code as used, in one statement so a code can't be used twice
+func (r *DeviceRepository) RedeemPairingCode(ctx context.Context, codeHash string, at time.Time) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE pairing_codes SET redeemed_at = ?
+		WHERE code_hash = ? AND redeemed_at IS NULL AND expires_at > ?
+	`, at.Unix(), codeHash, at.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to redeem pairing code: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return domain.NewNotFoundError("pairing code", "code")
+	}
+
+	return nil
+}
+
+// DeleteExpiredPairingCodes removes the pairing codes that expired before a time
+func (r *DeviceRepository) DeleteExpiredPairingCodes(ctx context.Context, before time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM pairing_codes WHERE expires_at <= ?`, before.Unix()); err != nil {
+		return fmt.Errorf("failed to delete expired pairing codes: %w", err)
+	}
+	return nil
+}
+
+// updateDevice runs an update of one device that takes a value and the device ID
+func (r *DeviceRepository) updateDevice(ctx context.Context, id, query string, value interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, value, id)
+	if err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return domain.NewNotFoundError("device", id)
+	}
+
+	return nil
+}
+
+// scanDevice scans a devices row from a *sql.Row or *sql.Rows
+func scanDevice(row interface{ Scan(...interface{}) error }) (*device.Device, error) {
+	var d device.Device
+	var createdAt int64
+	var lastUsedAt, revokedAt, lastUploadAt sql.NullInt64
+
+	if err := row.Scan(&d.ID, &d.Name, &d.Platform, &d.TokenPrefix, &d.TokenHash, &createdAt, &lastUsedAt, &revokedAt, &d.UploadCount, &lastUploadAt); err != nil {
+		return nil, err
+	}
+
+	d.CreatedAt = time.Unix(createdAt, 0)
+	if lastUsedAt.Valid {
+		t := time.Unix(lastUsedAt.Int64, 0)
+		d.LastUsedAt = &t
+	}
+	if revokedAt.Valid {
+		t := time.Unix(revokedAt.Int64, 0)
+		d.RevokedAt = &t
+	}
+	if lastUploadAt.Valid {
+		t := time.Unix(lastUploadAt.Int64, 0)
+		d.LastUploadAt = &t
+	}
+	return &d, nil
+}
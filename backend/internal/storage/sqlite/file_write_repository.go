@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+)
+
+// FileWriteRepository implements the workspace.Repository interface
+type FileWriteRepository struct {
+	db *sql.DB
+}
+
+// NewFileWriteRepository creates a new file write repository
+func NewFileWriteRepository(db *sql.DB) *FileWriteRepository {
+	return &FileWriteRepository{db: db}
+}
+
+// CreateWrite records a file write
+func (r *FileWriteRepository) CreateWrite(ctx context.Context, w *workspace.FileWrite) error {
+	var before sql.NullString
+	if w.Before != nil {
+		before = sql.NullString{String: *w.Before, Valid: true}
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO file_writes (id, space_id, conversation_id, session_id, path, before_content, after_content, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, w.ID, w.SpaceID, w.ConversationID, w.SessionID, w.Path, before, w.After, w.CreatedAt.Unix())
+
+	if err != nil {
+		return fmt.Errorf("failed to create file write: %w", err)
+	}
+	return nil
+}
+
+// GetWrite retrieves a file write by ID
+func (r *FileWriteRepository) GetWrite(ctx context.Context, id string) (*workspace.FileWrite, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT id, space_id, conversation_id, session_id, path, before_content, after_content, created_at, undone_at
+		FROM file_writes WHERE id = ?
+	`, id)
+
+	w, err := scanFileWrite(row)
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("file write", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file write: %w", err)
+	}
+	return w, nil
+}
+
+// ListWrites retrieves the file writes of a conversation, oldest first
+func (r *FileWriteRepository) ListWrites(ctx context.Context, conversationID string) ([]*workspace.FileWrite, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, space_id, conversation_id, session_id, path, before_content, after_content, created_at, undone_at
+		FROM file_writes WHERE conversation_id = ?
+		ORDER BY created_at ASC, rowid ASC
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file writes: %w", err)
+	}
+	defer rows.Close()
+
+	writes := make([]*workspace.FileWrite, 0)
+	for rows.Next() {
+		w, err := scanFileWrite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file write: %w", err)
+		}
+		writes = append(writes, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating file writes: %w", err)
+	}
+
+	return writes, nil
+}
+
+// MarkUndone records that a file write was undone
+func (r *FileWriteRepository) MarkUndone(ctx context.Context, id string, undoneAt time.Time) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE file_writes SET undone_at = ? WHERE id = ?`, undoneAt.Unix(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark file write undone: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return domain.NewNotFoundError("file write", id)
+	}
+
+	return nil
+}
+
+// scanFileWrite scans a file_writes row from a *sql.Row or *sql.Rows
+func scanFileWrite(row interface{ Scan(...interface{}) error }) (*workspace.FileWrite, error) {
+	var w workspace.FileWrite
+	var before sql.NullString
+	var createdAt int64
+	var undoneAt sql.NullInt64
+
+	if err := row.Scan(&w.ID, &w.SpaceID, &w.ConversationID, &w.SessionID, &w.Path, &before, &w.After, &createdAt, &undoneAt); err != nil {
+		return nil, err
+	}
+
+	if before.Valid {
+		w.Before = &before.String
+	}
+	w.CreatedAt = time.Unix(createdAt, 0)
+	if undoneAt.Valid {
+		t := time.Unix(undoneAt.Int64, 0)
+		w.UndoneAt = &t
+	}
+	return &w, nil
+}
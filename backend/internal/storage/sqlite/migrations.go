@@ -124,6 +124,180 @@ ALTER TABLE spaces ADD COLUMN last_accessed INTEGER;
 
 -- Add config column
 ALTER TABLE spaces ADD COLUMN config TEXT DEFAULT '';
+`,
+	},
+	{
+		Version: 4,
+		Name:    "add_permission_tables",
+		SQL: `
+-- Remembered "allow always" decisions
+CREATE TABLE IF NOT EXISTS permission_grants (
+    id TEXT PRIMARY KEY,
+    space_id TEXT NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+    conversation_id TEXT REFERENCES conversations(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    pattern TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_permission_grants_space_id ON permission_grants(space_id);
+
+-- Append-only log of every permission request (no foreign keys so it outlives spaces)
+CREATE TABLE IF NOT EXISTS permission_audit (
+    id TEXT PRIMARY KEY,
+    space_id TEXT NOT NULL,
+    conversation_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    tool_call_id TEXT NOT NULL,
+    title TEXT,
+    kind TEXT NOT NULL,
+    raw_input TEXT,
+    outcome TEXT NOT NULL,
+    option_id TEXT,
+    decided_by TEXT NOT NULL,
+    reason TEXT,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_permission_audit_space_id ON permission_audit(space_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_permission_audit_conversation_id ON permission_audit(conversation_id);
+`,
+	},
+	{
+		Version: 5,
+		Name:    "add_session_agent",
+		SQL: `
+-- Sessions belong to the agent that created them, only that agent can resume them
+ALTER TABLE sessions ADD COLUMN agent TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		Version: 6,
+		Name:    "add_secrets",
+		SQL: `
+-- Values substituted for ${NAME} placeholders in space config files
+CREATE TABLE IF NOT EXISTS secrets (
+    name TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+`,
+	},
+	{
+		Version: 7,
+		Name:    "add_tool_calls_and_plans",
+		SQL: `
+-- Tool calls the agent made while producing an assistant message, in their final state
+CREATE TABLE IF NOT EXISTS tool_calls (
+    id TEXT NOT NULL,
+    message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    kind TEXT,
+    title TEXT NOT NULL DEFAULT '',
+    status TEXT,
+    raw_input TEXT,
+    raw_output TEXT,
+    content TEXT,
+    locations TEXT,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (message_id, id)
+);
+
+-- Last plan reported during an assistant message
+CREATE TABLE IF NOT EXISTS plans (
+    message_id TEXT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    entries TEXT NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+`,
+	},
+	{
+		Version: 8,
+		Name:    "add_file_writes",
+		SQL: `
+-- Files written by agents through fs/write_text_file, kept for diffs and undo
+CREATE TABLE IF NOT EXISTS file_writes (
+    id TEXT PRIMARY KEY,
+    space_id TEXT NOT NULL,
+    conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    session_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    before_content TEXT, -- NULL when the write created the file
+    after_content TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    undone_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_writes_conversation_id ON file_writes(conversation_id, created_at);
+`,
+	},
+	{
+		Version: 9,
+		Name:    "add_message_parts",
+		SQL: `
+-- Images and files sent with a user message, JSON array of content parts
+ALTER TABLE messages ADD COLUMN parts TEXT;
+`,
+	},
+	{
+		Version: 10,
+		Name:    "add_message_note_refs",
+		SQL: `
+-- Capture IDs of the space notes a user message references, JSON array
+ALTER TABLE messages ADD COLUMN note_refs TEXT;
+`,
+	},
+	{
+		Version: 11,
+		Name:    "add_conversation_summary",
+		SQL: `
+-- Rolling summary of the messages that no longer fit in the history sent to new sessions
+ALTER TABLE conversations ADD COLUMN summary TEXT;
+ALTER TABLE conversations ADD COLUMN summary_through TEXT;
+`,
+	},
+	{
+		Version: 12,
+		Name:    "add_devices",
+		SQL: `
+-- Devices allowed to use the API, authenticated by the SHA-256 hash of their bearer token
+CREATE TABLE IF NOT EXISTS devices (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    platform TEXT NOT NULL DEFAULT '',
+    token_prefix TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at INTEGER NOT NULL,
+    last_used_at INTEGER,
+    revoked_at INTEGER
+);
+`,
+	},
+	{
+		Version: 13,
+		Name:    "add_device_pairing",
+		SQL: `
+-- Captures uploaded by each device
+ALTER TABLE devices ADD COLUMN upload_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN last_upload_at INTEGER;
+
+-- Short-lived codes a new device exchanges for its token, stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS pairing_codes (
+    code_hash TEXT PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    redeemed_at INTEGER
+);
+`,
+	},
+	{
+		Version: 14,
+		Name:    "add_conversation_modes",
+		SQL: `
+-- Session modes of the agent and the current one, JSON object, see conversation.Modes
+ALTER TABLE conversations ADD COLUMN modes TEXT;
 `,
 	},
 }
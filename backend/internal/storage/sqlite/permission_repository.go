@@ -0,0 +1,199 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
+)
+
+// PermissionRepository implements the permission.Repository interface
+type PermissionRepository struct {
+	db *sql.DB
+}
+
+// NewPermissionRepository creates a new permission repository
+func NewPermissionRepository(db *sql.DB) *PermissionRepository {
+	return &PermissionRepository{db: db}
+}
+
+// CreateGrant creates a new permission grant
+func (r *PermissionRepository) CreateGrant(ctx context.Context, grant *permission.Grant) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO permission_grants (id, space_id, conversation_id, kind, pattern, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, grant.ID, grant.SpaceID, nullString(grant.ConversationID), grant.Kind, grant.Pattern,
+		grant.CreatedBy, grant.CreatedAt.Unix())
+
+	if err != nil {
+		return fmt.Errorf("failed to create grant: %w", err)
+	}
+	return nil
+}
+
+// GetGrant retrieves a grant by ID
+func (r *PermissionRepository) GetGrant(ctx context.Context, id string) (*permission.Grant, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT id, space_id, conversation_id, kind, pattern, created_by, created_at
+		FROM permission_grants WHERE id = ?
+	`, id)
+
+	grant, err := scanGrant(row)
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("grant", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grant: %w", err)
+	}
+	return grant, nil
+}
+
+// ListGrants retrieves the grants of a space
+// A non-empty conversationID limits the result to space-wide grants and grants for that conversation
+func (r *PermissionRepository) ListGrants(ctx context.Context, spaceID, conversationID string) ([]*permission.Grant, error) {
+	query := `
+		SELECT id, space_id, conversation_id, kind, pattern, created_by, created_at
+		FROM permission_grants
+		WHERE space_id = ?
+	`
+	args := []interface{}{spaceID}
+	if conversationID != "" {
+		query += ` AND (conversation_id IS NULL OR conversation_id = ?)`
+		args = append(args, conversationID)
+	}
+	query += ` ORDER BY created_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make([]*permission.Grant, 0)
+	for rows.Next() {
+		grant, err := scanGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+// DeleteGrant deletes a grant
+func (r *PermissionRepository) DeleteGrant(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM permission_grants WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete grant: %w", err)
+	}
+	return nil
+}
+
+// AppendAudit appends an entry to the audit log
+func (r *PermissionRepository) AppendAudit(ctx context.Context, entry *permission.AuditEntry) error {
+	rawInput, err := json.Marshal(entry.RawInput)
+	if err != nil {
+		return fmt.Errorf("failed to marshal raw input: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO permission_audit (id, space_id, conversation_id, session_id, tool_call_id, title, kind,
+			raw_input, outcome, option_id, decided_by, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.SpaceID, entry.ConversationID, entry.SessionID, entry.ToolCallID, entry.Title,
+		entry.Kind, string(rawInput), string(entry.Outcome), entry.OptionID, entry.DecidedBy,
+		entry.Reason, entry.CreatedAt.Unix())
+
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAudit retrieves audit entries, newest first
+func (r *PermissionRepository) ListAudit(ctx context.Context, filter permission.AuditFilter) ([]*permission.AuditEntry, error) {
+	query := `
+		SELECT id, space_id, conversation_id, session_id, tool_call_id, title, kind,
+			raw_input, outcome, option_id, decided_by, reason, created_at
+		FROM permission_audit
+		WHERE 1 = 1
+	`
+	args := []interface{}{}
+	if filter.SpaceID != "" {
+		query += ` AND space_id = ?`
+		args = append(args, filter.SpaceID)
+	}
+	if filter.ConversationID != "" {
+		query += ` AND conversation_id = ?`
+		args = append(args, filter.ConversationID)
+	}
+	query += ` ORDER BY created_at DESC, rowid DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*permission.AuditEntry, 0)
+	for rows.Next() {
+		entry := &permission.AuditEntry{}
+		var title, rawInput, optionID, reason sql.NullString
+		var outcome string
+		var createdAt int64
+
+		err := rows.Scan(&entry.ID, &entry.SpaceID, &entry.ConversationID, &entry.SessionID,
+			&entry.ToolCallID, &title, &entry.Kind, &rawInput, &outcome, &optionID,
+			&entry.DecidedBy, &reason, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+
+		entry.Title = title.String
+		entry.Outcome = permission.Outcome(outcome)
+		entry.OptionID = optionID.String
+		entry.Reason = reason.String
+		entry.CreatedAt = time.Unix(createdAt, 0)
+		if rawInput.Valid && rawInput.String != "" {
+			if err := json.Unmarshal([]byte(rawInput.String), &entry.RawInput); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal raw input: %w", err)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanGrant(row rowScanner) (*permission.Grant, error) {
+	grant := &permission.Grant{}
+	var conversationID sql.NullString
+	var createdAt int64
+
+	err := row.Scan(&grant.ID, &grant.SpaceID, &conversationID, &grant.Kind, &grant.Pattern,
+		&grant.CreatedBy, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	grant.ConversationID = conversationID.String
+	grant.CreatedAt = time.Unix(createdAt, 0)
+	return grant, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
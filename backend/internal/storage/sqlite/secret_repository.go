@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/unforced/parachute-backend/internal/domain"
+	"github.com/unforced/parachute-backend/internal/domain/secret"
+)
+
+// SecretRepository implements the secret.Repository interface
+type SecretRepository struct {
+	db *sql.DB
+}
+
+// NewSecretRepository creates a new secret repository
+func NewSecretRepository(db *sql.DB) *SecretRepository {
+	return &SecretRepository{db: db}
+}
+
+// SetSecret inserts or replaces a secret
+func (r *SecretRepository) SetSecret(ctx context.Context, s *secret.Secret) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO secrets (name, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, s.Name, s.Value, s.UpdatedAt.Unix())
+
+	if err != nil {
+		return fmt.Errorf("failed to set secret: %w", err)
+	}
+	return nil
+}
+
+// GetSecret retrieves a secret by name
+func (r *SecretRepository) GetSecret(ctx context.Context, name string) (*secret.Secret, error) {
+	var s secret.Secret
+	var updatedAt int64
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT name, value, updated_at FROM secrets WHERE name = ?
+	`, name).Scan(&s.Name, &s.Value, &updatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, domain.NewNotFoundError("secret", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	s.UpdatedAt = time.Unix(updatedAt, 0)
+	return &s, nil
+}
+
+// ListSecrets retrieves all secrets ordered by name
+func (r *SecretRepository) ListSecrets(ctx context.Context) ([]*secret.Secret, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT name, value, updated_at FROM secrets ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := make([]*secret.Secret, 0)
+	for rows.Next() {
+		var s secret.Secret
+		var updatedAt int64
+		if err := rows.Scan(&s.Name, &s.Value, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan secret: %w", err)
+		}
+		s.UpdatedAt = time.Unix(updatedAt, 0)
+		secrets = append(secrets, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// DeleteSecret deletes a secret
+func (r *SecretRepository) DeleteSecret(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM secrets WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return domain.NewNotFoundError("secret", name)
+	}
+
+	return nil
+}
@@ -22,8 +22,8 @@ func NewSpaceRepository(db *sql.DB) *SpaceRepository {
 // Create creates a new space
 func (r *SpaceRepository) Create(ctx context.Context, s *space.Space) error {
 	query := `
-		INSERT INTO spaces (id, user_id, name, path, icon, color, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO spaces (id, user_id, name, path, icon, color, config, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -33,6 +33,7 @@ func (r *SpaceRepository) Create(ctx context.Context, s *space.Space) error {
 		s.Path,
 		s.Icon,
 		s.Color,
+		s.Config,
 		s.CreatedAt.Unix(),
 		s.UpdatedAt.Unix(),
 	)
@@ -47,7 +48,7 @@ func (r *SpaceRepository) Create(ctx context.Context, s *space.Space) error {
 // GetByID retrieves a space by ID
 func (r *SpaceRepository) GetByID(ctx context.Context, id string) (*space.Space, error) {
 	query := `
-		SELECT id, user_id, name, path, icon, color, created_at, updated_at
+		SELECT id, user_id, name, path, icon, color, COALESCE(config, ''), created_at, updated_at
 		FROM spaces
 		WHERE id = ?
 	`
@@ -62,6 +63,7 @@ func (r *SpaceRepository) GetByID(ctx context.Context, id string) (*space.Space,
 		&s.Path,
 		&s.Icon,
 		&s.Color,
+		&s.Config,
 		&createdAt,
 		&updatedAt,
 	)
@@ -82,7 +84,7 @@ func (r *SpaceRepository) GetByID(ctx context.Context, id string) (*space.Space,
 // GetByPath retrieves a space by path
 func (r *SpaceRepository) GetByPath(ctx context.Context, path string) (*space.Space, error) {
 	query := `
-		SELECT id, user_id, name, path, icon, color, created_at, updated_at
+		SELECT id, user_id, name, path, icon, color, COALESCE(config, ''), created_at, updated_at
 		FROM spaces
 		WHERE path = ?
 	`
@@ -97,6 +99,7 @@ func (r *SpaceRepository) GetByPath(ctx context.Context, path string) (*space.Sp
 		&s.Path,
 		&s.Icon,
 		&s.Color,
+		&s.Config,
 		&createdAt,
 		&updatedAt,
 	)
@@ -117,7 +120,7 @@ func (r *SpaceRepository) GetByPath(ctx context.Context, path string) (*space.Sp
 // List retrieves all spaces for a user
 func (r *SpaceRepository) List(ctx context.Context, userID string) ([]*space.Space, error) {
 	query := `
-		SELECT id, user_id, name, path, icon, color, created_at, updated_at
+		SELECT id, user_id, name, path, icon, color, COALESCE(config, ''), created_at, updated_at
 		FROM spaces
 		WHERE user_id = ?
 		ORDER BY updated_at DESC
@@ -142,6 +145,7 @@ func (r *SpaceRepository) List(ctx context.Context, userID string) ([]*space.Spa
 			&s.Path,
 			&s.Icon,
 			&s.Color,
+			&s.Config,
 			&createdAt,
 			&updatedAt,
 		)
@@ -166,7 +170,7 @@ func (r *SpaceRepository) List(ctx context.Context, userID string) ([]*space.Spa
 func (r *SpaceRepository) Update(ctx context.Context, s *space.Space) error {
 	query := `
 		UPDATE spaces
-		SET name = ?, icon = ?, color = ?, updated_at = ?
+		SET name = ?, icon = ?, color = ?, config = ?, updated_at = ?
 		WHERE id = ?
 	`
 
@@ -176,6 +180,7 @@ func (r *SpaceRepository) Update(ctx context.Context, s *space.Space) error {
 		s.Name,
 		s.Icon,
 		s.Color,
+		s.Config,
 		s.UpdatedAt.Unix(),
 		s.ID,
 	)
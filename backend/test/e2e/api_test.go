@@ -35,6 +35,9 @@ func makeRequest(method, path string, body interface{}) (*http.Response, []byte,
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if token := os.Getenv("PARACHUTE_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
 )
 
 // TestACPConnection tests that we can connect to ACP and get version info
@@ -42,7 +44,7 @@ func TestACPSessionCreation(t *testing.T) {
 	defer client.Close()
 
 	// Create a new session
-	sessionID, err := client.NewSession("/tmp", nil)
+	sessionID, err := client.NewSession(context.Background(), "/tmp", nil)
 	if err != nil {
 		t.Fatalf("Failed to create session: %v", err)
 	}
@@ -66,7 +68,7 @@ func TestACPSimplePrompt(t *testing.T) {
 	}
 	defer client.Close()
 
-	sessionID, err := client.NewSession("/tmp", nil)
+	sessionID, err := client.NewSession(context.Background(), "/tmp", nil)
 	if err != nil {
 		t.Fatalf("Failed to create session: %v", err)
 	}
@@ -101,7 +103,7 @@ func TestACPSimplePrompt(t *testing.T) {
 	prompt := "Say 'Hello, test!' and nothing else."
 	log.Printf("📤 Sending prompt: %s", prompt)
 
-	if err := client.SessionPrompt(sessionID, prompt); err != nil {
+	if _, err := client.SessionPrompt(context.Background(), sessionID, prompt); err != nil {
 		t.Fatalf("Failed to send prompt: %v", err)
 	}
 
@@ -128,7 +130,7 @@ func TestACPToolCallWithPermission(t *testing.T) {
 	}
 	defer client.Close()
 
-	sessionID, err := client.NewSession("/tmp", nil)
+	sessionID, err := client.NewSession(context.Background(), "/tmp", nil)
 	if err != nil {
 		t.Fatalf("Failed to create session: %v", err)
 	}
@@ -192,13 +194,16 @@ func TestACPToolCallWithPermission(t *testing.T) {
 					log.Printf("📋 Options: %v", permReq.Options)
 
 					// Auto-approve if safe
-					if acp.ShouldAutoApprove(permReq.ToolCall) {
+					decision := permission.NewEngine(nil).Evaluate(context.Background(), "", permission.ToolCall{
+						Kind:     permReq.ToolCall.Kind,
+						Title:    permReq.ToolCall.Title,
+						RawInput: permReq.ToolCall.RawInput,
+					})
+					if decision.Action == permission.ActionAllow {
 						log.Printf("✅ Auto-approving safe operation")
 						allowOpt := acp.FindAllowOption(permReq.Options)
 						if allowOpt != nil {
-							response := acp.PermissionResponse{
-								OptionID: allowOpt.OptionID,
-							}
+							response := acp.NewSelectedOutcome(allowOpt.OptionID)
 							if err := client.SendResponse(*req.ID, response); err != nil {
 								log.Printf("❌ Failed to send response: %v", err)
 							} else {
@@ -221,7 +226,7 @@ func TestACPToolCallWithPermission(t *testing.T) {
 	prompt := "What is the current weather in San Francisco? Use web search to find out."
 	log.Printf("📤 Sending prompt: %s", prompt)
 
-	if err := client.SessionPrompt(sessionID, prompt); err != nil {
+	if _, err := client.SessionPrompt(context.Background(), sessionID, prompt); err != nil {
 		t.Fatalf("Failed to send prompt: %v", err)
 	}
 
@@ -266,7 +271,7 @@ func TestACPMultipleMessages(t *testing.T) {
 	}
 	defer client.Close()
 
-	sessionID, err := client.NewSession("/tmp", nil)
+	sessionID, err := client.NewSession(context.Background(), "/tmp", nil)
 	if err != nil {
 		t.Fatalf("Failed to create session: %v", err)
 	}
@@ -293,7 +298,7 @@ func TestACPMultipleMessages(t *testing.T) {
 			}
 		}()
 
-		if err := client.SessionPrompt(sessionID, prompt); err != nil {
+		if _, err := client.SessionPrompt(context.Background(), sessionID, prompt); err != nil {
 			log.Printf("❌ Failed to send prompt: %v", err)
 			return false
 		}
@@ -0,0 +1,436 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unforced/parachute-backend/internal/acp"
+	"github.com/unforced/parachute-backend/internal/acp/fakeagent"
+	"github.com/unforced/parachute-backend/internal/api/handlers"
+	"github.com/unforced/parachute-backend/internal/domain/conversation"
+	"github.com/unforced/parachute-backend/internal/domain/permission"
+	"github.com/unforced/parachute-backend/internal/domain/space"
+	"github.com/unforced/parachute-backend/internal/domain/workspace"
+	"github.com/unforced/parachute-backend/internal/storage/sqlite"
+)
+
+// TestMain lets the test binary stand in for the agent, see fakeagent.TestAgent
+func TestMain(m *testing.M) {
+	fakeagent.RunIfRequested()
+	os.Exit(m.Run())
+}
+
+// pipelineScript reads a note, asks to edit a file and writes it
+const pipelineScript = `
+turns:
+  - usage: {inputTokens: 120, outputTokens: 40}
+    steps:
+      - thought: "The user wants milk."
+      - chunk: "Let me check your notes. "
+      - tool_call: {id: read-1, title: Read notes.md, kind: read}
+      - read_file: {path: notes.md, echo: true}
+      - tool_call_update: {id: read-1, status: completed}
+      - permission: {tool_call: {id: edit-1, title: Edit todo.md, kind: edit, raw_input: {path: todo.md}}}
+      - write_file: {path: todo.md, content: "- buy milk\n"}
+      - chunk: " Added it to your todo list."
+`
+
+// TestPipelineWithFakeAgent runs a message through HTTP, the agent and WebSocket without a real agent
+func TestPipelineWithFakeAgent(t *testing.T) {
+	root := t.TempDir()
+	scriptPath := filepath.Join(root, "script.yaml")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(pipelineScript), 0644))
+
+	db, err := sqlite.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	spaceService := space.NewService(sqlite.NewSpaceRepository(db.DB), root)
+	conversationService := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+	permissionService := permission.NewService(sqlite.NewPermissionRepository(db.DB))
+	workspaceService := workspace.NewService(sqlite.NewFileWriteRepository(db.DB), nil)
+
+	ctx := context.Background()
+	spaceObj, err := spaceService.Create(ctx, "", space.CreateSpaceParams{Name: "Pipeline"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(spaceObj.Path, "notes.md"), []byte("buy milk"), 0644))
+	conv, err := conversationService.CreateConversation(ctx, conversation.CreateConversationParams{SpaceID: spaceObj.ID, Title: "Pipeline"})
+	require.NoError(t, err)
+
+	agentManager := acp.NewAgentManager(nil, fakeagent.TestAgent(scriptPath))
+	defer agentManager.Close()
+
+	wsHandler := handlers.NewWebSocketHandler()
+	wsHandler.SetConversationService(conversationService)
+	permissionHandler := handlers.NewPermissionHandler(wsHandler, nil, permissionService, 10*time.Second)
+	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, nil, agentManager, wsHandler, permissionHandler)
+	messageHandler.SetWorkspaceService(workspaceService)
+	wsHandler.SetMessageHandler(messageHandler)
+	wsHandler.SetPermissionHandler(permissionHandler)
+
+	app := fiber.New()
+	app.Get("/ws", wsHandler.HandleUpgrade())
+	app.Post("/api/messages", messageHandler.SendMessage)
+	serverURL := startTestServer(t, app)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/ws", nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.WriteJSON(map[string]interface{}{
+		"type":    "subscribe",
+		"payload": map[string]interface{}{"conversation_id": conv.ID},
+	}))
+	var subscribed map[string]interface{}
+	require.NoError(t, client.ReadJSON(&subscribed))
+	require.Equal(t, "subscribed", subscribed["type"])
+
+	body, _ := json.Marshal(map[string]string{"conversation_id": conv.ID, "content": "Add milk to my todo list"})
+	resp, err := http.Post(serverURL+"/api/messages", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Follow the turn, approving the edit when asked
+	var types []string
+	var text strings.Builder
+	var done map[string]interface{}
+	for done == nil {
+		var msg struct {
+			Type    string                 `json:"type"`
+			Payload map[string]interface{} `json:"payload"`
+		}
+		client.SetReadDeadline(time.Now().Add(10 * time.Second))
+		require.NoError(t, client.ReadJSON(&msg), "events so far: %v", types)
+		types = append(types, msg.Type)
+
+		switch msg.Type {
+		case "message_chunk":
+			text.WriteString(msg.Payload["chunk"].(string))
+		case "permission_request":
+			assert.Equal(t, "edit-1", msg.Payload["tool_call_id"])
+			require.NoError(t, client.WriteJSON(map[string]interface{}{
+				"type":    "permission_response",
+				"payload": map[string]interface{}{"request_id": msg.Payload["request_id"], "option_id": "allow"},
+			}))
+		case "message_error":
+			t.Fatalf("turn failed: %v", msg.Payload)
+		case "message_done":
+			done = msg.Payload
+		}
+	}
+
+	assert.Subset(t, types, []string{"tool_call", "tool_call_update", "permission_request", "permission_resolved", "file_write"})
+	assert.Equal(t, "Let me check your notes. buy milk Added it to your todo list.", text.String())
+	assert.Equal(t, acp.StopReasonEndTurn, done["stop_reason"])
+
+	written, err := os.ReadFile(filepath.Join(spaceObj.Path, "todo.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "- buy milk\n", string(written))
+
+	messages, err := conversationService.ListMessages(ctx, conv.ID)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "assistant", messages[1].Role)
+	assert.Equal(t, done["message_id"], messages[1].ID)
+	assert.Equal(t, text.String(), messages[1].Content)
+
+	var metadata handlers.MessageMetadata
+	require.NoError(t, json.Unmarshal([]byte(messages[1].Metadata), &metadata))
+	assert.Equal(t, acp.StopReasonEndTurn, metadata.StopReason)
+	assert.Equal(t, 3, metadata.Chunks)
+	assert.Equal(t, 1, metadata.ThoughtChunks)
+	assert.Positive(t, metadata.DurationMs)
+	require.NotNil(t, metadata.Usage)
+	assert.Equal(t, int64(120), metadata.Usage.InputTokens)
+	assert.Equal(t, int64(40), metadata.Usage.OutputTokens)
+}
+
+// modesScript offers three modes and leaves plan mode on its own during a turn
+const modesScript = `
+modes:
+  - {id: default, name: Default}
+  - {id: acceptEdits, name: Accept Edits}
+  - {id: plan, name: Plan Mode}
+turns:
+  - steps:
+      - chunk: "Here is the plan."
+      - update: {sessionUpdate: current_mode_update, currentModeId: acceptEdits}
+`
+
+// TestSessionModesWithFakeAgent starts a session in the space's default mode, switches it and follows the agent
+func TestSessionModesWithFakeAgent(t *testing.T) {
+	root := t.TempDir()
+	scriptPath := filepath.Join(root, "script.yaml")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(modesScript), 0644))
+
+	db, err := sqlite.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	spaceService := space.NewService(sqlite.NewSpaceRepository(db.DB), root)
+	conversationService := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+	permissionService := permission.NewService(sqlite.NewPermissionRepository(db.DB))
+
+	ctx := context.Background()
+	spaceObj, err := spaceService.Create(ctx, "", space.CreateSpaceParams{Name: "Modes"})
+	require.NoError(t, err)
+	_, err = spaceService.Update(ctx, spaceObj.ID, space.UpdateSpaceParams{Config: `{"default_mode":"acceptEdits"}`})
+	require.NoError(t, err)
+	conv, err := conversationService.CreateConversation(ctx, conversation.CreateConversationParams{SpaceID: spaceObj.ID, Title: "Modes"})
+	require.NoError(t, err)
+
+	agentManager := acp.NewAgentManager(nil, fakeagent.TestAgent(scriptPath))
+	defer agentManager.Close()
+
+	wsHandler := handlers.NewWebSocketHandler()
+	wsHandler.SetConversationService(conversationService)
+	permissionHandler := handlers.NewPermissionHandler(wsHandler, nil, permissionService, 10*time.Second)
+	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, nil, agentManager, wsHandler, permissionHandler)
+	wsHandler.SetMessageHandler(messageHandler)
+
+	app := fiber.New()
+	app.Post("/api/messages", messageHandler.SendMessage)
+	app.Put("/api/conversations/:id/mode", messageHandler.SetConversationMode)
+	serverURL := startTestServer(t, app)
+
+	events, unsubscribe := wsHandler.Subscribe(conv.ID)
+	defer unsubscribe()
+	nextMode := func() map[string]interface{} {
+		t.Helper()
+		for {
+			select {
+			case msg := <-events:
+				if msg.Type == "mode_changed" {
+					return msg.Payload
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("no mode_changed event")
+			}
+		}
+	}
+
+	setMode := func(modeID string) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"mode_id": modeID})
+		req, _ := http.NewRequest(http.MethodPut, serverURL+"/api/conversations/"+conv.ID+"/mode", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// Picking a mode before the first message starts the session in the space's default
+	resp := setMode("plan")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "acceptEdits", nextMode()["current_mode_id"])
+	assert.Equal(t, "plan", nextMode()["current_mode_id"])
+
+	assert.Equal(t, http.StatusBadRequest, setMode("yolo").StatusCode)
+
+	stored, err := conversationService.GetConversation(ctx, conv.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.Modes)
+	assert.Equal(t, "plan", stored.Modes.CurrentModeID)
+	assert.Len(t, stored.Modes.Available, 3)
+
+	// The agent leaves plan mode at the end of the turn
+	body, _ := json.Marshal(map[string]string{"conversation_id": conv.ID, "content": "Plan my week"})
+	resp, err = http.Post(serverURL+"/api/messages", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	assert.Equal(t, "acceptEdits", nextMode()["current_mode_id"])
+	stored, err = conversationService.GetConversation(ctx, conv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "acceptEdits", stored.Modes.CurrentModeID)
+}
+
+// promptScript asks to run a command and waits for the answer
+const promptScript = `
+turns:
+  - steps:
+      - chunk: "Building."
+      - permission: {tool_call: {id: make-1, title: make build, kind: execute, raw_input: {command: make build}}}
+      - chunk: " Built."
+`
+
+// TestCancelDuringPermissionPrompt cancels a turn that waits for the user to answer a permission prompt
+func TestCancelDuringPermissionPrompt(t *testing.T) {
+	root := t.TempDir()
+	scriptPath := filepath.Join(root, "script.yaml")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(promptScript), 0644))
+
+	db, err := sqlite.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	spaceService := space.NewService(sqlite.NewSpaceRepository(db.DB), root)
+	conversationService := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+	permissionService := permission.NewService(sqlite.NewPermissionRepository(db.DB))
+
+	ctx := context.Background()
+	spaceObj, err := spaceService.Create(ctx, "", space.CreateSpaceParams{Name: "Cancel"})
+	require.NoError(t, err)
+	conv, err := conversationService.CreateConversation(ctx, conversation.CreateConversationParams{SpaceID: spaceObj.ID, Title: "Cancel"})
+	require.NoError(t, err)
+
+	agentManager := acp.NewAgentManager(nil, fakeagent.TestAgent(scriptPath))
+	defer agentManager.Close()
+
+	wsHandler := handlers.NewWebSocketHandler()
+	wsHandler.SetConversationService(conversationService)
+	// Longer than the cancel timeout, the prompt must not hold the cancellation up
+	permissionHandler := handlers.NewPermissionHandler(wsHandler, nil, permissionService, time.Minute)
+	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, nil, agentManager, wsHandler, permissionHandler)
+	wsHandler.SetMessageHandler(messageHandler)
+
+	app := fiber.New()
+	app.Post("/api/messages", messageHandler.SendMessage)
+	serverURL := startTestServer(t, app)
+
+	events, unsubscribe := wsHandler.Subscribe(conv.ID)
+	defer unsubscribe()
+
+	body, _ := json.Marshal(map[string]string{"conversation_id": conv.ID, "content": "Build it"})
+	resp, err := http.Post(serverURL+"/api/messages", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	for asked := false; !asked; {
+		select {
+		case msg := <-events:
+			asked = msg.Type == "permission_request"
+		case <-time.After(10 * time.Second):
+			t.Fatal("no permission_request event")
+		}
+	}
+
+	stopReason, err := messageHandler.CancelResponse(ctx, conv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, acp.StopReasonCancelled, stopReason)
+	assert.Empty(t, permissionHandler.ListPending(conv.ID))
+
+	entries, err := permissionService.ListAudit(ctx, permission.AuditFilter{ConversationID: conv.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, permission.OutcomeCancelled, entries[0].Outcome)
+	assert.Equal(t, permission.DecidedByCancel, entries[0].DecidedBy)
+}
+
+// agentSettings serves the agent registry setting
+type agentSettings string
+
+func (s agentSettings) GetSetting(ctx context.Context, key string) (string, error) {
+	if key == acp.AgentsSetting {
+		return string(s), nil
+	}
+	return "", nil
+}
+
+// TestSlowAgentDoesNotBlockOtherConversations sends a message while another space's agent hangs in initialize
+func TestSlowAgentDoesNotBlockOtherConversations(t *testing.T) {
+	root := t.TempDir()
+	scriptPath := filepath.Join(root, "script.yaml")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(promptScript), 0644))
+
+	// Socket paths are short, keep it out of the long test temp dir
+	sockDir, err := os.MkdirTemp("", "acp")
+	require.NoError(t, err)
+	defer os.RemoveAll(sockDir)
+	sock := filepath.Join(sockDir, "slow.sock")
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// The slow agent accepts the connection and never answers
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	db, err := sqlite.NewDatabase(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	spaceService := space.NewService(sqlite.NewSpaceRepository(db.DB), root)
+	conversationService := conversation.NewService(sqlite.NewConversationRepository(db.DB))
+	permissionService := permission.NewService(sqlite.NewPermissionRepository(db.DB))
+
+	ctx := context.Background()
+	slowSpace, err := spaceService.Create(ctx, "", space.CreateSpaceParams{Name: "Slow"})
+	require.NoError(t, err)
+	_, err = spaceService.Update(ctx, slowSpace.ID, space.UpdateSpaceParams{Config: `{"agent":"slow"}`})
+	require.NoError(t, err)
+	slowConv, err := conversationService.CreateConversation(ctx, conversation.CreateConversationParams{SpaceID: slowSpace.ID, Title: "Slow"})
+	require.NoError(t, err)
+	fastSpace, err := spaceService.Create(ctx, "", space.CreateSpaceParams{Name: "Fast"})
+	require.NoError(t, err)
+	fastConv, err := conversationService.CreateConversation(ctx, conversation.CreateConversationParams{SpaceID: fastSpace.ID, Title: "Fast"})
+	require.NoError(t, err)
+
+	settings := agentSettings(`[{"name":"slow","transport":"unix","address":"` + sock + `"}]`)
+	agentManager := acp.NewAgentManager(settings, fakeagent.TestAgent(scriptPath))
+	defer agentManager.Close()
+
+	wsHandler := handlers.NewWebSocketHandler()
+	wsHandler.SetConversationService(conversationService)
+	permissionHandler := handlers.NewPermissionHandler(wsHandler, nil, permissionService, time.Minute)
+	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, nil, agentManager, wsHandler, permissionHandler)
+	wsHandler.SetMessageHandler(messageHandler)
+
+	app := fiber.New()
+	app.Post("/api/messages", messageHandler.SendMessage)
+	serverURL := startTestServer(t, app)
+
+	send := func(conversationID string) int {
+		body, _ := json.Marshal(map[string]string{"conversation_id": conversationID, "content": "Build it"})
+		resp, err := http.Post(serverURL+"/api/messages", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	slowDone := make(chan int, 1)
+	go func() { slowDone <- send(slowConv.ID) }()
+
+	var slowConn net.Conn
+	select {
+	case slowConn = <-accepted:
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow agent was never connected")
+	}
+
+	// The fast conversation sets up its session while the slow agent still hangs
+	start := time.Now()
+	assert.Equal(t, http.StatusCreated, send(fastConv.ID))
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// Hanging up fails the slow setup, the message is still stored
+	slowConn.Close()
+	select {
+	case status := <-slowDone:
+		assert.Equal(t, http.StatusCreated, status)
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow conversation never answered")
+	}
+}
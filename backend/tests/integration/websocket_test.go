@@ -2,7 +2,7 @@ package integration
 
 import (
 	"fmt"
-	"net/http/httptest"
+	"net"
 	"strings"
 	"testing"
 	"time"
@@ -11,7 +11,6 @@ import (
 	"github.com/gofiber/fiber/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"github.com/unforced/parachute-backend/internal/acp"
 	"github.com/unforced/parachute-backend/internal/api/handlers"
 	"github.com/unforced/parachute-backend/internal/domain/conversation"
 	"github.com/unforced/parachute-backend/internal/domain/space"
@@ -25,11 +24,10 @@ func TestWebSocketMessageChunkBroadcast(t *testing.T) {
 	defer cleanup()
 
 	// Start server
-	server := httptest.NewServer(app)
-	defer server.Close()
+	serverURL := startTestServer(t, app)
 
 	// Connect WebSocket client
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
 	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	require.NoError(t, err, "Failed to connect WebSocket")
 	defer client.Close()
@@ -74,10 +72,9 @@ func TestWebSocketToolCallBroadcast(t *testing.T) {
 	app, wsHandler, cleanup := setupTestServer(t)
 	defer cleanup()
 
-	server := httptest.NewServer(app)
-	defer server.Close()
+	serverURL := startTestServer(t, app)
 
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
 	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	require.NoError(t, err)
 	defer client.Close()
@@ -125,10 +122,9 @@ func TestWebSocketToolCallUpdate(t *testing.T) {
 	app, wsHandler, cleanup := setupTestServer(t)
 	defer cleanup()
 
-	server := httptest.NewServer(app)
-	defer server.Close()
+	serverURL := startTestServer(t, app)
 
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
 	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	require.NoError(t, err)
 	defer client.Close()
@@ -170,13 +166,12 @@ func TestMultipleWebSocketClients(t *testing.T) {
 	app, wsHandler, cleanup := setupTestServer(t)
 	defer cleanup()
 
-	server := httptest.NewServer(app)
-	defer server.Close()
+	serverURL := startTestServer(t, app)
 
 	// Connect 3 clients
 	clients := make([]*websocket.Conn, 3)
 	for i := 0; i < 3; i++ {
-		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+		wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
 		client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 		require.NoError(t, err, fmt.Sprintf("Failed to connect client %d", i))
 		clients[i] = client
@@ -225,10 +220,9 @@ func TestWebSocketConversationFiltering(t *testing.T) {
 	app, wsHandler, cleanup := setupTestServer(t)
 	defer cleanup()
 
-	server := httptest.NewServer(app)
-	defer server.Close()
+	serverURL := startTestServer(t, app)
 
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
 	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	require.NoError(t, err)
 	defer client.Close()
@@ -273,10 +267,9 @@ func TestWebSocketReconnection(t *testing.T) {
 	app, wsHandler, cleanup := setupTestServer(t)
 	defer cleanup()
 
-	server := httptest.NewServer(app)
-	defer server.Close()
+	serverURL := startTestServer(t, app)
 
-	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
 
 	// Connect first time
 	client1, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
@@ -323,6 +316,104 @@ func TestWebSocketReconnection(t *testing.T) {
 	assert.Equal(t, "After reconnect", payload["chunk"])
 }
 
+// TestWebSocketReplayAfterReconnect tests that a client resuming with last_seq gets the events it missed
+func TestWebSocketReplayAfterReconnect(t *testing.T) {
+	app, wsHandler, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	serverURL := startTestServer(t, app)
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
+	conversationID := "test-replay"
+
+	client1, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	require.NoError(t, client1.WriteJSON(map[string]interface{}{
+		"type":    "subscribe",
+		"payload": map[string]interface{}{"conversation_id": conversationID},
+	}))
+
+	var response map[string]interface{}
+	require.NoError(t, client1.ReadJSON(&response))
+	assert.Equal(t, "subscribed", response["type"])
+
+	wsHandler.BroadcastMessageChunk(conversationID, "one")
+	var msg map[string]interface{}
+	client1.SetReadDeadline(time.Now().Add(2 * time.Second))
+	require.NoError(t, client1.ReadJSON(&msg))
+	payload := msg["payload"].(map[string]interface{})
+	lastSeq := payload["seq"]
+	assert.Equal(t, float64(1), lastSeq)
+
+	// Drop the connection mid-response
+	client1.Close()
+	time.Sleep(100 * time.Millisecond)
+	wsHandler.BroadcastMessageChunk(conversationID, "two")
+	wsHandler.BroadcastMessageChunk(conversationID, "three")
+
+	client2, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer client2.Close()
+	require.NoError(t, client2.WriteJSON(map[string]interface{}{
+		"type":    "subscribe",
+		"payload": map[string]interface{}{"conversation_id": conversationID, "last_seq": lastSeq},
+	}))
+
+	client2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	require.NoError(t, client2.ReadJSON(&response))
+	assert.Equal(t, "subscribed", response["type"])
+	assert.Equal(t, float64(3), response["payload"].(map[string]interface{})["seq"])
+
+	for _, expected := range []string{"two", "three"} {
+		require.NoError(t, client2.ReadJSON(&msg))
+		payload := msg["payload"].(map[string]interface{})
+		assert.Equal(t, expected, payload["chunk"])
+	}
+
+	// Live events continue the sequence
+	wsHandler.BroadcastMessageChunk(conversationID, "four")
+	require.NoError(t, client2.ReadJSON(&msg))
+	assert.Equal(t, float64(4), msg["payload"].(map[string]interface{})["seq"])
+}
+
+// TestWebSocketMultipleSubscriptions tests that one socket can follow several conversations
+func TestWebSocketMultipleSubscriptions(t *testing.T) {
+	app, wsHandler, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	serverURL := startTestServer(t, app)
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws"
+
+	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var response map[string]interface{}
+	for _, id := range []string{"conversation-a", "conversation-b"} {
+		require.NoError(t, client.WriteJSON(map[string]interface{}{
+			"type":    "subscribe",
+			"payload": map[string]interface{}{"conversation_id": id},
+		}))
+		require.NoError(t, client.ReadJSON(&response))
+	}
+	require.NoError(t, client.WriteJSON(map[string]interface{}{
+		"type":    "unsubscribe",
+		"payload": map[string]interface{}{"conversation_id": "conversation-a"},
+	}))
+	time.Sleep(100 * time.Millisecond)
+
+	wsHandler.BroadcastMessageChunk("conversation-a", "Message for A")
+	wsHandler.BroadcastMessageChunk("conversation-b", "Message for B")
+	wsHandler.BroadcastMessageChunk("conversation-c", "Message for C")
+
+	var msg map[string]interface{}
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	require.NoError(t, client.ReadJSON(&msg))
+	assert.Equal(t, "Message for B", msg["payload"].(map[string]interface{})["chunk"])
+
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	assert.Error(t, client.ReadJSON(&msg), "no other conversation should be delivered")
+}
+
 // setupTestServer creates a test Fiber app with WebSocket handler
 func setupTestServer(t *testing.T) (*fiber.App, *handlers.WebSocketHandler, func()) {
 	// Setup in-memory database
@@ -335,12 +426,10 @@ func setupTestServer(t *testing.T) (*fiber.App, *handlers.WebSocketHandler, func
 	spaceService := space.NewService(spaceRepo, "/tmp/parachute-test")
 	conversationService := conversation.NewService(conversationRepo)
 
-	// Create mock ACP client (nil for testing, or use a mock)
-	var acpClient *acp.ACPClient = nil
-
 	// Create handlers
-	wsHandler := handlers.NewWebSocketHandler(acpClient)
-	messageHandler := handlers.NewMessageHandler(conversationService, spaceService, acpClient, wsHandler)
+	wsHandler := handlers.NewWebSocketHandler()
+	wsHandler.SetConversationService(conversationService)
+	_ = handlers.NewMessageHandler(conversationService, spaceService, nil, nil, wsHandler, nil)
 
 	// Create Fiber app
 	app := fiber.New()
@@ -353,3 +442,14 @@ func setupTestServer(t *testing.T) (*fiber.App, *handlers.WebSocketHandler, func
 
 	return app, wsHandler, cleanup
 }
+
+// startTestServer serves app on a random local port and returns its base URL
+func startTestServer(t *testing.T, app *fiber.App) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	t.Cleanup(func() { app.Shutdown() })
+
+	return "http://" + ln.Addr().String()
+}